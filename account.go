@@ -14,13 +14,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/mailgun/mailgun-go"
-	"github.com/writefreely/writefreely/spam"
 	"html/template"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gorilla/csrf"
@@ -78,10 +76,6 @@ func (up *UserPage) SetMessaging(u *User) {
 	// up.NeedsAuth = app.db.DoesUserNeedAuth(u.ID)
 }
 
-const (
-	loginAttemptExpiration = 3 * time.Second
-)
-
 var actuallyUsernameReg = regexp.MustCompile("username is actually ([a-z0-9\\-]+)\\. Please try that, instead")
 
 func apiSignup(app *App, w http.ResponseWriter, r *http.Request) error {
@@ -153,6 +147,30 @@ func signupWithRegistration(app *App, signup userRegistration, w http.ResponseWr
 		return nil, impart.HTTPError{http.StatusPreconditionFailed, "Username is reserved or isn't valid. It must be at least 3 characters long, and can only include letters, numbers, and hyphens."}
 	}
 
+	// Prevent mass account creation from the same client
+	if ok, wait := app.limits.signupIP.allow(requestIP(r)); !ok {
+		log.Info("Signup: Too many attempts from %s", requestIP(r))
+		return nil, tooManyRequests(w, wait, "Too many accounts created from your network.")
+	}
+	if err := checkSignupBlocks(app, r, signup.Email); err != nil {
+		return nil, err
+	}
+
+	if signup.InviteCode != "" {
+		// Verify invite code is valid
+		i, err := app.db.GetUserInvite(signup.InviteCode)
+		if err != nil {
+			return nil, err
+		}
+		if !i.Active(app.db) {
+			return nil, impart.HTTPError{http.StatusNotFound, "Invite link has expired."}
+		}
+	}
+	pending := needsApproval(app, signup.InviteCode)
+	if pending && signup.Email == "" {
+		return nil, impart.HTTPError{http.StatusBadRequest, "An email address is required, so we can let you know when your account is approved."}
+	}
+
 	// Handle empty optional params
 	hashedPass, err := auth.HashPass([]byte(signup.Pass))
 	if err != nil {
@@ -167,11 +185,23 @@ func signupWithRegistration(app *App, signup userRegistration, w http.ResponseWr
 		Email:      prepareUserEmail(signup.Email, app.keys.EmailKey),
 		Created:    time.Now().Truncate(time.Second).UTC(),
 	}
+	if pending {
+		u.Status = UserPending
+	}
 
 	// Create actual user
 	if err := app.db.CreateUser(app.cfg, u, desiredUsername, signup.Description); err != nil {
 		return nil, err
 	}
+	scoreSignup(app, r, u.ID)
+	if pending {
+		if err = recordSignupReason(app, u.ID, signup.Reason); err != nil {
+			return nil, err
+		}
+	}
+	if signup.Email != "" {
+		startEmailVerification(app, u.ID, signup.Email)
+	}
 
 	// Log invite if needed
 	if signup.InviteCode != "" {
@@ -218,9 +248,18 @@ func signupWithRegistration(app *App, signup userRegistration, w http.ResponseWr
 		coll.Monetization = signup.Monetization
 	}
 
+	if pending {
+		// Don't log in until an admin approves the account
+		log.Info("Signup: %s is waiting for approval", u.Username)
+		if reqJSON {
+			return resUser, impart.WriteSuccess(w, resUser, http.StatusAccepted)
+		}
+		return resUser, nil
+	}
+
 	var token string
 	if reqJSON && !signup.Web {
-		token, err = app.db.GetAccessToken(u.ID)
+		token, err = app.db.GetClientAccessToken(u.ID, r.UserAgent(), requestIP(r))
 		if err != nil {
 			return nil, impart.HTTPError{http.StatusInternalServerError, "Could not create access token. Try re-authenticating."}
 		}
@@ -360,6 +399,11 @@ func webLogin(app *App, w http.ResponseWriter, r *http.Request) error {
 		username := r.FormValue("alias")
 		// Login request was unsuccessful; save the error in the session and redirect them
 		if err, ok := err.(impart.HTTPError); ok {
+			if err.Status == http.StatusTooManyRequests {
+				// Show the error with its status instead, so clients know to back off
+				return err
+			}
+
 			session, _ := app.sessionStore.Get(r, cookieName)
 			if session != nil {
 				session.AddFlash(err.Message)
@@ -389,8 +433,6 @@ func webLogin(app *App, w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-var loginAttemptUsers = sync.Map{}
-
 func login(app *App, w http.ResponseWriter, r *http.Request) error {
 	reqJSON := IsJSON(r)
 	oneTimeToken := r.FormValue("with")
@@ -473,63 +515,62 @@ func login(app *App, w http.ResponseWriter, r *http.Request) error {
 			return impart.HTTPError{http.StatusBadRequest, msg}
 		}
 
-		// Prevent excessive login attempts on the same account
-		// Skip this check in dev environment
-		if !app.cfg.Server.Dev {
-			now := time.Now()
-			attemptExp, att := loginAttemptUsers.LoadOrStore(signin.Alias, now.Add(loginAttemptExpiration))
-			if att {
-				if attemptExpTime, ok := attemptExp.(time.Time); ok {
-					if attemptExpTime.After(now) {
-						// This user attempted previously, and the period hasn't expired yet
-						return impart.HTTPError{http.StatusTooManyRequests, "You're doing that too much."}
-					} else {
-						// This user attempted previously, but the time expired; free up space
-						loginAttemptUsers.Delete(signin.Alias)
-					}
-				} else {
-					log.Error("Unable to cast expiration to time")
-				}
-			}
+		// Prevent excessive login attempts from the same client
+		if ok, wait := app.limits.loginIP.allow(requestIP(r)); !ok {
+			log.Info("Login: Too many attempts from %s", requestIP(r))
+			return tooManyRequests(w, wait, "Too many login attempts.")
 		}
 
-		// Retrieve password
-		u, err = app.db.GetUserForAuth(signin.Alias)
-		if err != nil {
-			log.Info("Unable to getUserForAuth on %s: %v", signin.Alias, err)
-			if strings.IndexAny(signin.Alias, "@") > 0 {
-				log.Info("Suggesting: %s", ErrUserNotFoundEmail.Message)
-				return ErrUserNotFoundEmail
+		// Users in the directory log in with it; anyone else needs a local password
+		if app.cfg.LDAP.Enabled() {
+			u, err = loginViaLDAP(app, w, r, signin.Alias, signin.Pass)
+			if err != nil {
+				return err
 			}
-			return err
 		}
-		// Authenticate
-		if u.Email.String == "" {
-			// User has no email set, so check if they haven't added a password, either,
-			// so we can return a more helpful error message.
-			if hasPass, _ := app.db.IsUserPassSet(u.ID); !hasPass {
-				log.Info("Tried logging into %s, but no password or email.", signin.Alias)
-				return impart.HTTPError{http.StatusPreconditionFailed, "This user never added a password or email address. Please contact us for help."}
+		if u == nil {
+			u, err = loginViaPassword(app, w, r, signin)
+			if err != nil {
+				return err
 			}
 		}
-		if len(u.HashedPass) == 0 {
-			return impart.HTTPError{http.StatusUnauthorized, "This user never set a password. Perhaps try logging in via OAuth?"}
+	}
+
+	if u.IsPending() {
+		log.Info("Login: %s is waiting for approval", u.Username)
+		return ErrUserPending
+	}
+
+	// Check the second factor, if the user has one
+	has2FA, err := app.db.IsTwoFactorEnabled(u.ID)
+	if err != nil {
+		log.Error("Login: Unable to check two-factor auth: %v", err)
+		return ErrInternalGeneral
+	}
+	if has2FA {
+		if !reqJSON {
+			return startTwoFactorLogin(app, w, r, u, redirectTo)
 		}
-		if !auth.Authenticated(u.HashedPass, []byte(signin.Pass)) {
-			return impart.HTTPError{http.StatusUnauthorized, "Incorrect password."}
+		if err = checkTwoFactorLogin(app, u, signin.OTP); err != nil {
+			return err
 		}
 	}
 
+	// Logging back in is how users change their mind about deleting
+	if err = restoreAccount(app, w, r, u); err != nil {
+		return err
+	}
+
 	if reqJSON && !signin.Web {
 		var token string
 		if r.Header.Get("User-Agent") == "" {
 			// Get last created token when User-Agent is empty
 			token = app.db.FetchLastAccessToken(u.ID)
 			if token == "" {
-				token, err = app.db.GetAccessToken(u.ID)
+				token, err = app.db.GetClientAccessToken(u.ID, "", requestIP(r))
 			}
 		} else {
-			token, err = app.db.GetAccessToken(u.ID)
+			token, err = app.db.GetClientAccessToken(u.ID, r.UserAgent(), requestIP(r))
 		}
 		if err != nil {
 			log.Error("Login: Unable to create access token: %v", err)
@@ -881,7 +922,10 @@ func viewEditCollection(app *App, u *User, w http.ResponseWriter, r *http.Reques
 		Silenced bool
 
 		config.EmailCfg
-		LetterReplyTo string
+		LetterReplyTo     string
+		LetterTemplate    *LetterTemplate
+		DefaultLetterHTML string
+		DefaultLetterText string
 	}{
 		UserPage:   NewUserPage(app, r, u, "Edit "+c.DisplayTitle(), flashes),
 		Collection: c,
@@ -891,6 +935,15 @@ func viewEditCollection(app *App, u *User, w http.ResponseWriter, r *http.Reques
 	obj.UserPage.CollAlias = c.Alias
 	if obj.EmailCfg.Enabled() {
 		obj.LetterReplyTo = app.db.GetCollectionAttribute(c.ID, collAttrLetterReplyTo)
+		obj.LetterTemplate, err = app.db.GetLetterTemplate(c.ID)
+		if err != nil {
+			log.Error("Unable to get letter templates for %s: %v", c.Alias, err)
+		}
+		if obj.LetterTemplate == nil {
+			obj.LetterTemplate = &LetterTemplate{}
+		}
+		obj.DefaultLetterHTML = defaultLetterHTMLTemplate
+		obj.DefaultLetterText = defaultLetterTextTemplate
 	}
 
 	showUserPage(w, "collection", obj)
@@ -953,11 +1006,21 @@ func updateSettings(app *App, w http.ResponseWriter, r *http.Request) error {
 		redirectTo = postUpdateReturn
 	}
 
+	// An admin may have changed the username since this session started
+	cur, err := app.db.GetUserByID(u.ID)
+	if err != nil {
+		return err
+	}
+	u.Username = cur.Username
+
 	// Only do updates on values we need
 	if s.Username != "" && s.Username == u.Username {
 		// Username hasn't actually changed; blank it out
 		s.Username = ""
 	}
+	prevUsername := u.Username
+	// Only a new email address needs verifying
+	emailChanged := s.Email != "" && cur.EmailClear(app.keys) != s.Email
 	err = app.db.ChangeSettings(app, u, &s)
 	if err != nil {
 		if reqJSON {
@@ -969,6 +1032,12 @@ func updateSettings(app *App, w http.ResponseWriter, r *http.Request) error {
 		}
 	} else {
 		// Successful update.
+		if emailChanged {
+			startEmailVerification(app, u.ID, s.Email)
+		}
+		if u.Username != prevUsername {
+			go federateUsernameChange(app, u.ID, prevUsername, u.Username)
+		}
 		if reqJSON {
 			return impart.WriteSuccess(w, u, http.StatusOK)
 		}
@@ -1113,8 +1182,13 @@ func handleViewSubscribers(app *App, u *User, w http.ResponseWriter, r *http.Req
 		Collection CollectionNav
 		EmailSubs  []*EmailSubscriber
 		Followers  *[]RemoteUser
+		EmailSends []*EmailSend
 		Silenced   bool
 
+		// Recipients of a single email send, if one was requested
+		SendID     int64
+		Recipients []*EmailSendRecipient
+
 		Filter            string
 		FederationEnabled bool
 		CanEmailSub       bool
@@ -1144,6 +1218,21 @@ func handleViewSubscribers(app *App, u *User, w http.ResponseWriter, r *http.Req
 		return err
 	}
 
+	obj.EmailSends, err = app.db.GetEmailSends(c.ID)
+	if err != nil {
+		return err
+	}
+
+	if obj.Filter == "sent" {
+		obj.SendID, _ = strconv.ParseInt(r.FormValue("send"), 10, 64)
+		if obj.SendID > 0 {
+			obj.Recipients, err = app.db.GetEmailSendRecipients(obj.SendID, c.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	if obj.Filter == "" {
 		// Set permission to add email subscribers
 		//obj.CanAddSubs = app.db.GetUserAttribute(c.OwnerID, userAttrCanAddEmailSubs) == "1"
@@ -1176,6 +1265,7 @@ func viewSettings(app *App, u *User, w http.ResponseWriter, r *http.Request) err
 	enableOauthGitLab := app.Config().GitlabOauth.ClientID != ""
 	enableOauthGeneric := app.Config().GenericOauth.ClientID != ""
 	enableOauthGitea := app.Config().GiteaOauth.ClientID != ""
+	linkedGeneric := map[string]bool{}
 
 	oauthAccounts, err := app.db.GetOauthAccounts(r.Context(), u.ID)
 	if err != nil {
@@ -1196,18 +1286,50 @@ func viewSettings(app *App, u *User, w http.ResponseWriter, r *http.Request) err
 			enableOauthGeneric = false
 		case "gitea":
 			enableOauthGitea = false
+		default:
+			for _, p := range app.Config().GenericOauths {
+				if oauthAccount.Provider == genericOauthProviderName(p.Name) {
+					oauthAccounts[idx].DisplayName = config.OrDefaultString(p.DisplayName, genericOauthDisplayName)
+					oauthAccounts[idx].AllowDisconnect = p.AllowDisconnect
+					linkedGeneric[oauthAccount.Provider] = true
+				}
+			}
 		}
 	}
+	var oauthGenericProviders []GenericOAuthButton
+	for _, p := range NewOAuthButtons(app.Config()).GenericProviders {
+		if !linkedGeneric[p.Provider] {
+			oauthGenericProviders = append(oauthGenericProviders, p)
+		}
+	}
+
+	var postingAddrs []PostingAddress
+	if app.cfg.Email.InboundEnabled() {
+		postingAddrs, err = getPostingAddresses(app, u)
+		if err != nil {
+			log.Error("Unable to get posting addresses for settings: %s", err)
+			return impart.HTTPError{http.StatusInternalServerError, "Unable to retrieve user data. The humans have been alerted."}
+		}
+	}
+
+	twoFactorEnabled, err := app.db.IsTwoFactorEnabled(u.ID)
+	if err != nil {
+		log.Error("Unable to check two-factor auth for settings: %s", err)
+	}
 
-	displayOauthSection := enableOauthSlack || enableOauthWriteAs || enableOauthGitLab || enableOauthGeneric || enableOauthGitea || len(oauthAccounts) > 0
+	displayOauthSection := enableOauthSlack || enableOauthWriteAs || enableOauthGitLab || enableOauthGeneric || enableOauthGitea || len(oauthGenericProviders) > 0 || len(oauthAccounts) > 0
 
 	obj := struct {
 		*UserPage
 		Email                   string
+		EmailVerified           bool
+		EmailEnabled            bool
+		NeedsVerification       bool
 		HasPass                 bool
 		IsLogOut                bool
 		Silenced                bool
 		CSRFField               template.HTML
+		TwoFactorEnabled        bool
 		OauthSection            bool
 		OauthAccounts           []oauthAccountInfo
 		OauthSlack              bool
@@ -1216,15 +1338,22 @@ func viewSettings(app *App, u *User, w http.ResponseWriter, r *http.Request) err
 		GitLabDisplayName       string
 		OauthGeneric            bool
 		OauthGenericDisplayName string
+		OauthGenericProviders   []GenericOAuthButton
 		OauthGitea              bool
 		GiteaDisplayName        string
+		PostingAddresses        []PostingAddress
+		NotificationPrefs       []NotificationPref
 	}{
 		UserPage:                NewUserPage(app, r, u, "Account Settings", flashes),
 		Email:                   fullUser.EmailClear(app.keys),
+		EmailVerified:           app.db.IsUserEmailVerified(u.ID),
+		EmailEnabled:            app.cfg.Email.Enabled(),
+		NeedsVerification:       needsEmailVerification(app, u.ID),
 		HasPass:                 passIsSet,
 		IsLogOut:                r.FormValue("logout") == "1",
 		Silenced:                fullUser.IsSilenced(),
 		CSRFField:               csrf.TemplateField(r),
+		TwoFactorEnabled:        twoFactorEnabled,
 		OauthSection:            displayOauthSection,
 		OauthAccounts:           oauthAccounts,
 		OauthSlack:              enableOauthSlack,
@@ -1233,8 +1362,13 @@ func viewSettings(app *App, u *User, w http.ResponseWriter, r *http.Request) err
 		GitLabDisplayName:       config.OrDefaultString(app.Config().GitlabOauth.DisplayName, gitlabDisplayName),
 		OauthGeneric:            enableOauthGeneric,
 		OauthGenericDisplayName: config.OrDefaultString(app.Config().GenericOauth.DisplayName, genericOauthDisplayName),
+		OauthGenericProviders:   oauthGenericProviders,
 		OauthGitea:              enableOauthGitea,
 		GiteaDisplayName:        config.OrDefaultString(app.Config().GiteaOauth.DisplayName, giteaDisplayName),
+		PostingAddresses:        postingAddrs,
+	}
+	if app.cfg.Email.Enabled() {
+		obj.NotificationPrefs = getNotificationPrefs(app, u.ID)
 	}
 
 	showUserPage(w, "settings", obj)
@@ -1326,9 +1460,14 @@ func handleResetPasswordInit(app *App, w http.ResponseWriter, r *http.Request) e
 		return returnLoc
 	}
 
-	ip := spam.GetIP(r)
+	ip := requestIP(r)
 	alias := r.FormValue("alias")
 
+	if ok, wait := app.limits.resetIP.allow(ip); !ok {
+		log.Info("Reset: Too many requests from %s", ip)
+		return tooManyRequests(w, wait, "Too many password reset requests.")
+	}
+
 	u, err := app.db.GetUserForAuth(alias)
 	if err != nil {
 		if strings.IndexAny(alias, "@") > 0 {
@@ -1338,6 +1477,10 @@ func handleResetPasswordInit(app *App, w http.ResponseWriter, r *http.Request) e
 		addSessionFlash(app, w, r, ErrUserNotFound.Message, nil)
 		return returnLoc
 	}
+	if ok, wait := app.limits.resetAccount.allow(strconv.FormatInt(u.ID, 10)); !ok {
+		log.Info("Reset: Too many requests for %s", u.Username)
+		return tooManyRequests(w, wait, "Too many password reset requests for this account.")
+	}
 	if u.IsAdmin() {
 		// Prevent any reset emails on admin accounts
 		log.Error("Admin reset attempt", `Someone just tried to reset the password for an admin (ID %d - %s). IP address: %s`, u.ID, u.Username, ip)
@@ -1348,6 +1491,12 @@ func handleResetPasswordInit(app *App, w http.ResponseWriter, r *http.Request) e
 		addSessionFlash(app, w, r, err.Message, nil)
 		return returnLoc
 	}
+	if !app.db.IsUserEmailVerified(u.ID) {
+		// Only send reset links to addresses the user proved they own
+		err := impart.HTTPError{http.StatusPreconditionFailed, "User hasn't verified their email address. Please contact us (" + app.cfg.App.Host + "/contact) to reset your password."}
+		addSessionFlash(app, w, r, err.Message, nil)
+		return returnLoc
+	}
 	if isSet, _ := app.db.IsUserPassSet(u.ID); !isSet {
 		err = loginViaEmail(app, u.Username, "/me/settings")
 		if err != nil {
@@ -1398,6 +1547,46 @@ func emailPasswordReset(app *App, toEmail, token string) error {
 	return err
 }
 
+// loginViaPassword logs in the user with the given credentials using their
+// local password.
+func loginViaPassword(app *App, w http.ResponseWriter, r *http.Request, signin userCredentials) (*User, error) {
+	// Retrieve password
+	u, err := app.db.GetUserForAuth(signin.Alias)
+	if err != nil {
+		log.Info("Unable to getUserForAuth on %s: %v", signin.Alias, err)
+		if strings.IndexAny(signin.Alias, "@") > 0 {
+			log.Info("Suggesting: %s", ErrUserNotFoundEmail.Message)
+			return nil, ErrUserNotFoundEmail
+		}
+		return nil, err
+	}
+	// Authenticate
+	if u.Email.String == "" {
+		// User has no email set, so check if they haven't added a password, either,
+		// so we can return a more helpful error message.
+		if hasPass, _ := app.db.IsUserPassSet(u.ID); !hasPass {
+			log.Info("Tried logging into %s, but no password or email.", signin.Alias)
+			return nil, impart.HTTPError{http.StatusPreconditionFailed, "This user never added a password or email address. Please contact us for help."}
+		}
+	}
+	if len(u.HashedPass) == 0 {
+		return nil, impart.HTTPError{http.StatusUnauthorized, "This user never set a password. Perhaps try logging in via OAuth?"}
+	}
+	ip := requestIP(r)
+	if wait := app.limits.lockouts.check(u.ID, ip); wait > 0 {
+		return nil, tooManyRequests(w, wait, msgAccountLocked)
+	}
+	if !auth.Authenticated(u.HashedPass, []byte(signin.Pass)) {
+		if wait := app.limits.lockouts.fail(u.ID, u.Username, ip); wait > 0 {
+			log.Info("Login: Locking %s from %s for %s after too many failed attempts", u.Username, ip, wait)
+			return nil, tooManyRequests(w, wait, msgAccountLocked)
+		}
+		return nil, impart.HTTPError{http.StatusUnauthorized, "Incorrect password."}
+	}
+	app.limits.lockouts.reset(u.ID, ip)
+	return u, nil
+}
+
 func loginViaEmail(app *App, alias, redirectTo string) error {
 	if !app.cfg.Email.Enabled() {
 		return fmt.Errorf("EMAIL ISN'T CONFIGURED on this server")
@@ -1415,6 +1604,9 @@ func loginViaEmail(app *App, alias, redirectTo string) error {
 	if u.Email.String == "" {
 		return impart.HTTPError{http.StatusPreconditionFailed, "User doesn't have an email address. Log in with password, instead."}
 	}
+	if !app.db.IsUserEmailVerified(u.ID) {
+		return impart.HTTPError{http.StatusPreconditionFailed, "User hasn't verified their email address. Log in with password, instead."}
+	}
 
 	// Generate one-time login token
 	t, err := app.db.GetTemporaryOneTimeAccessToken(u.ID, 60*15, true)
@@ -1499,7 +1691,17 @@ func handleUserDelete(app *App, u *User, w http.ResponseWriter, r *http.Request)
 		return impart.HTTPError{http.StatusForbidden, "Cannot delete admin."}
 	}
 
-	err := app.db.DeleteAccount(u.ID)
+	// Give the user some time to change their mind, if the instance allows it
+	if app.cfg.App.DeletionGraceDays > 0 {
+		err := scheduleAccountDeletion(app, u.ID)
+		if err != nil {
+			log.Error("user schedule account deletion: %v", err)
+			return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not delete account: %v", err)}
+		}
+		return impart.HTTPError{http.StatusFound, "/me/logout"}
+	}
+
+	err := purgeAccount(app, u.ID)
 	if err != nil {
 		log.Error("user delete account: %v", err)
 		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not delete account: %v", err)}
@@ -123,23 +123,34 @@ func handleFetchCollectionActivities(app *App, w http.ResponseWriter, r *http.Re
 	} else {
 		c, err = app.db.GetCollection(alias)
 	}
+	var prevAlias string
+	if err == ErrCollectionNotFound && !app.cfg.App.SingleUser {
+		// The owner may have recently changed their username
+		c, err = app.db.GetRenamedCollection(alias)
+		prevAlias = alias
+	}
 	if err != nil {
 		return err
 	}
 	c.hostName = app.cfg.App.Host
 
 	if !c.IsInstanceColl() {
-		silenced, err := app.db.IsUserSilenced(c.OwnerID)
+		hidden, err := app.db.IsUserHidden(c.OwnerID)
 		if err != nil {
 			log.Error("fetch collection activities: %v", err)
 			return ErrInternalGeneral
 		}
-		if silenced {
+		if hidden {
 			return ErrCollectionNotFound
 		}
 	}
 
-	p := c.PersonObject()
+	var p interface{}
+	if prevAlias != "" {
+		p = renamedActor(c, prevAlias)
+	} else {
+		p = collectionActor(app, c)
+	}
 
 	setCacheControl(w, apCacheTime)
 	return impart.RenderActivityJSON(w, p, http.StatusOK)
@@ -163,12 +174,12 @@ func handleFetchCollectionOutbox(app *App, w http.ResponseWriter, r *http.Reques
 	if err != nil {
 		return err
 	}
-	silenced, err := app.db.IsUserSilenced(c.OwnerID)
+	hidden, err := app.db.IsUserHidden(c.OwnerID)
 	if err != nil {
 		log.Error("fetch collection outbox: %v", err)
 		return ErrInternalGeneral
 	}
-	if silenced {
+	if hidden {
 		return ErrCollectionNotFound
 	}
 	c.hostName = app.cfg.App.Host
@@ -226,12 +237,12 @@ func handleFetchCollectionFollowers(app *App, w http.ResponseWriter, r *http.Req
 	if err != nil {
 		return err
 	}
-	silenced, err := app.db.IsUserSilenced(c.OwnerID)
+	hidden, err := app.db.IsUserHidden(c.OwnerID)
 	if err != nil {
 		log.Error("fetch collection followers: %v", err)
 		return ErrInternalGeneral
 	}
-	if silenced {
+	if hidden {
 		return ErrCollectionNotFound
 	}
 	c.hostName = app.cfg.App.Host
@@ -281,12 +292,12 @@ func handleFetchCollectionFollowing(app *App, w http.ResponseWriter, r *http.Req
 	if err != nil {
 		return err
 	}
-	silenced, err := app.db.IsUserSilenced(c.OwnerID)
+	hidden, err := app.db.IsUserHidden(c.OwnerID)
 	if err != nil {
 		log.Error("fetch collection following: %v", err)
 		return ErrInternalGeneral
 	}
-	if silenced {
+	if hidden {
 		return ErrCollectionNotFound
 	}
 	c.hostName = app.cfg.App.Host
@@ -324,12 +335,12 @@ func handleFetchCollectionInbox(app *App, w http.ResponseWriter, r *http.Request
 		// TODO: return Reject?
 		return err
 	}
-	silenced, err := app.db.IsUserSilenced(c.OwnerID)
+	hidden, err := app.db.IsUserHidden(c.OwnerID)
 	if err != nil {
 		log.Error("fetch collection inbox: %v", err)
 		return ErrInternalGeneral
 	}
-	if silenced {
+	if hidden {
 		return ErrCollectionNotFound
 	}
 	c.hostName = app.cfg.App.Host
@@ -393,6 +404,11 @@ func handleFetchCollectionInbox(app *App, w http.ResponseWriter, r *http.Request
 			}
 			return impart.RenderActivityJSON(w, m, http.StatusOK)
 		},
+		CreateCallback: func(cr *streams.Create) error {
+			// Only replies to this collection's posts are handled here
+			handleCollectionReply(app, c, m)
+			return impart.RenderActivityJSON(w, m, http.StatusOK)
+		},
 		UndoCallback: func(u *streams.Undo) error {
 			isUnfollow = true
 
@@ -487,7 +503,7 @@ func handleFetchCollectionInbox(app *App, w http.ResponseWriter, r *http.Request
 				}
 
 				// Add in key
-				_, err = t.Exec("INSERT INTO remoteuserkeys (id, remote_user_id, public_key) VALUES (?, ?, ?)", fullActor.PublicKey.ID, followerID, fullActor.PublicKey.PublicKeyPEM)
+				_, err = t.Exec("INSERT INTO remoteuserkeys (id, remote_user_id, public_key) VALUES (?, ?, ?)"+app.db.ignoreDuplicates(), fullActor.PublicKey.ID, followerID, fullActor.PublicKey.PublicKeyPEM)
 				if err != nil {
 					if !app.db.isDuplicateKeyErr(err) {
 						t.Rollback()
@@ -498,13 +514,17 @@ func handleFetchCollectionInbox(app *App, w http.ResponseWriter, r *http.Request
 			}
 
 			// Add follow
-			_, err = t.Exec("INSERT INTO remotefollows (collection_id, remote_user_id, created) VALUES (?, ?, "+app.db.now()+")", c.ID, followerID)
+			isNewFollow := true
+			res, err := t.Exec("INSERT INTO remotefollows (collection_id, remote_user_id, created) VALUES (?, ?, "+app.db.now()+")"+app.db.ignoreDuplicates(), c.ID, followerID)
 			if err != nil {
 				if !app.db.isDuplicateKeyErr(err) {
 					t.Rollback()
 					log.Error("Couldn't add follower in DB: %v\n", err)
 					return
 				}
+				isNewFollow = false
+			} else if n, _ := res.RowsAffected(); n == 0 {
+				isNewFollow = false
 			}
 
 			err = t.Commit()
@@ -513,6 +533,14 @@ func handleFetchCollectionInbox(app *App, w http.ResponseWriter, r *http.Request
 				log.Error("Rolling back after Commit(): %v\n", err)
 				return
 			}
+
+			if isNewFollow {
+				follower := remoteUser
+				if follower == nil {
+					follower = &RemoteUser{ActorID: fullActor.ID}
+				}
+				notifyUser(app, c, notifyFollower, follower.EstimatedHandle(), fullActor.URL, "")
+			}
 		} else if isUnfollow {
 			// Remove follower locally
 			_, err = app.db.Exec("DELETE FROM remotefollows WHERE collection_id = ? AND remote_user_id = (SELECT id FROM remoteusers WHERE actor_id = ?)", c.ID, to.String())
@@ -525,6 +553,37 @@ func handleFetchCollectionInbox(app *App, w http.ResponseWriter, r *http.Request
 	return nil
 }
 
+// handleCollectionReply notifies the collection's owner when an incoming
+// Create activity is a reply to one of the collection's posts.
+func handleCollectionReply(app *App, c *Collection, m map[string]interface{}) {
+	obj, ok := m["object"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	inReplyTo, _ := obj["inReplyTo"].(string)
+	postsBase := c.FederatedAPIBase() + "api/posts/"
+	if !strings.HasPrefix(inReplyTo, postsBase) {
+		return
+	}
+	if _, err := app.db.GetPost(strings.TrimPrefix(inReplyTo, postsBase), c.ID); err != nil {
+		return
+	}
+
+	actor, _ := obj["attributedTo"].(string)
+	if actor == "" {
+		actor, _ = m["actor"].(string)
+	}
+	if actor == "" {
+		return
+	}
+	replyURL, _ := obj["url"].(string)
+	if replyURL == "" {
+		replyURL, _ = obj["id"].(string)
+	}
+	content, _ := obj["content"].(string)
+	go notifyUser(app, c, notifyReply, (&RemoteUser{ActorID: actor}).EstimatedHandle(), replyURL, strings.TrimSpace(stripHTMLWithoutEscaping(content)))
+}
+
 func makeActivityPost(hostName string, p *activitystreams.Person, url string, m interface{}) error {
 	log.Info("POST %s", url)
 	b, err := json.Marshal(m)
@@ -687,6 +746,11 @@ func federatePost(app *App, p *PublicPost, collID int64, isUpdate bool) error {
 		return nil
 	}
 
+	// Do not federate posts from users who still need to verify their email
+	if needsEmailVerification(app, p.Collection.OwnerID) {
+		return nil
+	}
+
 	if debugging {
 		if isUpdate {
 			log.Info("Federating updated post!")
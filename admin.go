@@ -199,6 +199,8 @@ func handleViewAdminUsers(app *App, u *User, w http.ResponseWriter, r *http.Requ
 		CurPage    int
 		TotalUsers int64
 		TotalPages []int
+		Locked     []loginLockout
+		Pending    []pendingUser
 	}{
 		UserPage:  NewUserPage(app, r, u, "Users", nil),
 		AdminPage: NewAdminPage(app),
@@ -226,6 +228,11 @@ func handleViewAdminUsers(app *App, u *User, w http.ResponseWriter, r *http.Requ
 	if err != nil {
 		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not get users: %v", err)}
 	}
+	p.Locked = app.limits.lockouts.locked()
+	p.Pending, err = app.db.GetPendingUsers()
+	if err != nil {
+		return err
+	}
 
 	showUserPage(w, "users", p)
 	return nil
@@ -244,12 +251,17 @@ func handleViewAdminUser(app *App, u *User, w http.ResponseWriter, r *http.Reque
 		Config  config.AppCfg
 		Message string
 
+		Flashes     []string
 		User        *User
 		Colls       []inspectedCollection
 		LastPost    string
 		NewPassword string
 		TotalPosts  int64
 		ClearEmail  string
+		SignupIP    string
+		SpamScore   string
+		InviteCode  string
+		DeletesOn   string
 	}{
 		AdminPage: NewAdminPage(app),
 		Config:    app.cfg.App,
@@ -272,10 +284,20 @@ func handleViewAdminUser(app *App, u *User, w http.ResponseWriter, r *http.Reque
 		if strings.HasPrefix(flash, "SUCCESS: ") {
 			p.NewPassword = strings.TrimPrefix(flash, "SUCCESS: ")
 			p.ClearEmail = p.User.EmailClear(app.keys)
+		} else {
+			p.Flashes = append(p.Flashes, flash)
 		}
 	}
 	p.UserPage = NewUserPage(app, r, u, p.User.Username, nil)
 	p.TotalPosts = app.db.GetUserPostsCount(p.User.ID)
+	p.SignupIP = app.db.GetUserAttribute(p.User.ID, userAttrSignupIP)
+	p.SpamScore = app.db.GetUserAttribute(p.User.ID, userAttrSpamScore)
+	p.InviteCode = app.db.GetUserInviteUsed(p.User.ID)
+	if p.User.IsDeleting() {
+		if t := app.db.GetAccountDeletionTime(p.User.ID); t != nil {
+			p.DeletesOn = t.Format("January 2, 2006, 3:04 PM")
+		}
+	}
 	lp, err := app.db.GetUserLastPostTime(p.User.ID)
 	if err != nil {
 		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not get user's last post time: %v", err)}
@@ -339,7 +361,7 @@ func handleAdminDeleteUser(app *App, u *User, w http.ResponseWriter, r *http.Req
 		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not get user with username '%s': %v", username, err)}
 	}
 
-	err = app.db.DeleteAccount(user.ID)
+	err = purgeAccount(app, user.ID)
 	if err != nil {
 		log.Error("delete user %s: %v", user.Username, err)
 		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not delete user account for '%s': %v", username, err)}
@@ -349,6 +371,27 @@ func handleAdminDeleteUser(app *App, u *User, w http.ResponseWriter, r *http.Req
 	return impart.HTTPError{http.StatusFound, "/admin/users"}
 }
 
+func handleAdminRestoreUser(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	username := mux.Vars(r)["username"]
+	user, err := app.db.GetUserForAuth(username)
+	if err == ErrUserNotFound {
+		return impart.HTTPError{http.StatusNotFound, fmt.Sprintf("User '%s' was not found", username)}
+	} else if err != nil {
+		log.Error("failed to get user: %v", err)
+		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not get user from username: %v", err)}
+	}
+
+	err = app.db.CancelAccountDeletion(user.ID)
+	if err != nil {
+		log.Error("restore user %s: %v", user.Username, err)
+		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not restore user account: %v", err)}
+	}
+	log.Info("ADMIN: Restored %s, who was waiting to be deleted", user.Username)
+
+	_ = addSessionFlash(app, w, r, fmt.Sprintf("Restored %s. Their account won't be deleted.", user.Username), nil)
+	return impart.HTTPError{http.StatusFound, "/admin/user/" + user.Username}
+}
+
 func handleAdminToggleUserStatus(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
 	vars := mux.Vars(r)
 	username := vars["username"]
@@ -362,9 +405,9 @@ func handleAdminToggleUserStatus(app *App, u *User, w http.ResponseWriter, r *ht
 		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not get user from username: %v", err)}
 	}
 	if user.IsSilenced() {
-		err = app.db.SetUserStatus(user.ID, UserActive)
+		err = app.db.SetUserStatus(user.ID, user.Status&^UserSilenced)
 	} else {
-		err = app.db.SetUserStatus(user.ID, UserSilenced)
+		err = app.db.SetUserStatus(user.ID, user.Status|UserSilenced)
 
 		// reset the cache to removed silence user posts
 		updateTimelineCache(app.timeline, true)
@@ -376,6 +419,24 @@ func handleAdminToggleUserStatus(app *App, u *User, w http.ResponseWriter, r *ht
 	return impart.HTTPError{http.StatusFound, fmt.Sprintf("/admin/user/%s#status", username)}
 }
 
+func handleAdminUnlockUser(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	username := vars["username"]
+	if username == "" {
+		return impart.HTTPError{http.StatusFound, "/admin/users"}
+	}
+
+	user, err := app.db.GetUserForAuth(username)
+	if err != nil {
+		log.Error("failed to get user: %v", err)
+		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not get user from username: %v", err)}
+	}
+	log.Info("ADMIN: Unlocking user %s", user.Username)
+	app.limits.lockouts.unlock(user.ID)
+	addSessionFlash(app, w, r, fmt.Sprintf("Unlocked %s.", user.Username), nil)
+	return impart.HTTPError{http.StatusFound, "/admin/users"}
+}
+
 func handleAdminResetUserPass(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
 	vars := mux.Vars(r)
 	username := vars["username"]
@@ -573,7 +634,12 @@ func handleAdminUpdateConfig(apper Apper, u *User, w http.ResponseWriter, r *htt
 	apper.App().cfg.App.SiteDesc = r.FormValue("site_desc")
 	apper.App().cfg.App.Landing = r.FormValue("landing")
 	apper.App().cfg.App.OpenRegistration = r.FormValue("open_registration") == "on"
+	apper.App().cfg.App.ApproveRegistrations = r.FormValue("approve_registrations") == "on"
 	apper.App().cfg.App.OpenDeletion = r.FormValue("open_deletion") == "on"
+	dgd, err := strconv.Atoi(r.FormValue("deletion_grace_days"))
+	if err == nil && dgd >= 0 {
+		apper.App().cfg.App.DeletionGraceDays = dgd
+	}
 	mul, err := strconv.Atoi(r.FormValue("min_username_len"))
 	if err == nil {
 		apper.App().cfg.App.MinUsernameLen = mul
@@ -586,6 +652,8 @@ func handleAdminUpdateConfig(apper Apper, u *User, w http.ResponseWriter, r *htt
 	apper.App().cfg.App.PublicStats = r.FormValue("public_stats") == "on"
 	apper.App().cfg.App.Monetization = r.FormValue("monetization") == "on"
 	apper.App().cfg.App.Private = r.FormValue("private") == "on"
+	apper.App().cfg.App.AdminsRequire2FA = r.FormValue("admins_require_2fa") == "on"
+	apper.App().cfg.App.RequireEmailVerification = r.FormValue("require_email_verification") == "on"
 	apper.App().cfg.App.LocalTimeline = r.FormValue("local_timeline") == "on"
 	if apper.App().cfg.App.LocalTimeline && apper.App().timeline == nil {
 		log.Info("Initializing local timeline...")
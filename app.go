@@ -25,6 +25,7 @@ import (
 	"regexp"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -75,6 +76,7 @@ type App struct {
 	sessionStore sessions.Store
 	formDecoder  *schema.Decoder
 	updates      *updatesCache
+	limits       rateLimits
 
 	timeline *localTimeline
 }
@@ -213,6 +215,20 @@ func (app *App) LoadKeys() error {
 		return err
 	}
 
+	// Load any keys replaced by the last rotation
+	app.keys.PrevCookieAuthKey, err = readPrevKey(cookieAuthKeyPath)
+	if err != nil {
+		return err
+	}
+	app.keys.PrevCookieKey, err = readPrevKey(cookieKeyPath)
+	if err != nil {
+		return err
+	}
+	app.keys.PrevCSRFKey, err = readPrevKey(csrfKeyPath)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -417,28 +433,39 @@ func Initialize(apper Apper, debug bool) (*App, error) {
 	}
 	apper.App().InitUpdates()
 
-	apper.App().InitSession()
-
 	apper.App().InitDecoder()
+	apper.App().InitRateLimits()
+	err = initTrustedProxies(apper.App())
+	if err != nil {
+		return nil, err
+	}
 
 	err = ConnectToDatabase(apper.App())
 	if err != nil {
 		return nil, fmt.Errorf("connect to DB: %s", err)
 	}
 
+	// Sessions need to know how long rotated keys are still good for
+	loadKeyGracePeriods(apper.App())
+	apper.App().InitSession()
+
 	initActivityPub(apper.App())
 
 	if apper.App().cfg.Email.Domain != "" || apper.App().cfg.Email.MailgunPrivate != "" {
 		if apper.App().cfg.Email.Domain == "" {
-			log.Error("[FAILED] Starting publish jobs queue: no [letters]domain config value set.")
+			log.Error("[FAILED] Starting email jobs: no [letters]domain config value set.")
 		} else if apper.App().cfg.Email.MailgunPrivate == "" {
-			log.Error("[FAILED] Starting publish jobs queue: no [letters]mailgun_private config value set.")
+			log.Error("[FAILED] Starting email jobs: no [letters]mailgun_private config value set.")
 		} else {
-			log.Info("Starting publish jobs queue...")
-			go startPublishJobsQueue(apper.App())
+			log.Info("Starting notifications queue...")
+			go startNotificationsQueue(apper.App())
 		}
 	}
 
+	// Jobs also purge deleted accounts, so they run even without email
+	log.Info("Starting publish jobs queue...")
+	go startPublishJobsQueue(apper.App())
+
 	// Handle local timeline, if enabled
 	if apper.App().cfg.App.LocalTimeline {
 		log.Info("Initializing local timeline...")
@@ -470,6 +497,11 @@ func Serve(app *App, r *mux.Router) {
 		go initGopher(app)
 	}
 
+	// Start inbound mail server
+	if app.cfg.Email.InboundSMTPBind != "" {
+		go initInboundSMTP(app)
+	}
+
 	// Start web application server
 	var bindAddress = app.cfg.Server.Bind
 	if bindAddress == "" {
@@ -585,7 +617,7 @@ func (app *App) InitDecoder() {
 // tests the connection.
 func ConnectToDatabase(app *App) error {
 	// Check database configuration
-	if app.cfg.Database.Type == driverMySQL && app.cfg.Database.User == "" {
+	if (app.cfg.Database.Type == driverMySQL || app.cfg.Database.Type == driverPostgres) && app.cfg.Database.User == "" {
 		return fmt.Errorf("Database user not set.")
 	}
 	if app.cfg.Database.Host == "" {
@@ -750,6 +782,77 @@ func Migrate(apper Apper) error {
 	return nil
 }
 
+// MigrateDryRun prints the SQL that Migrate would run, without changing the
+// database.
+func MigrateDryRun(apper Apper) error {
+	apper.LoadConfig()
+	connectToDatabase(apper.App())
+	defer shutdown(apper.App())
+
+	err := migrations.DryRun(migrations.NewDatastore(apper.App().db.DB, apper.App().db.driverName), os.Stdout)
+	if err != nil {
+		return fmt.Errorf("migrate: %s", err)
+	}
+	return nil
+}
+
+// Rollback reverts database migrations applied after the given version. With
+// dryRun, it only prints the SQL it would run. Migrations whose rollback
+// deletes data are only reverted with force.
+func Rollback(apper Apper, to int, dryRun, force bool) error {
+	apper.LoadConfig()
+	connectToDatabase(apper.App())
+	defer shutdown(apper.App())
+
+	db := migrations.NewDatastore(apper.App().db.DB, apper.App().db.driverName)
+	var err error
+	if dryRun {
+		err = migrations.RollbackDryRun(db, to, os.Stdout)
+	} else {
+		err = migrations.Rollback(db, to, force)
+	}
+	if err != nil {
+		return fmt.Errorf("rollback: %s", err)
+	}
+	return nil
+}
+
+// MigrationStatus prints every database migration and whether it's been
+// applied.
+func MigrationStatus(apper Apper) error {
+	apper.LoadConfig()
+	connectToDatabase(apper.App())
+	defer shutdown(apper.App())
+
+	ss, err := migrations.GetStatus(migrations.NewDatastore(apper.App().db.DB, apper.App().db.driverName))
+	if err != nil {
+		return fmt.Errorf("status: %s", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATUS\tMIGRATED\tREVERSIBLE\tDESCRIPTION")
+	pending := 0
+	for _, s := range ss {
+		status, migrated, reversible := "pending", "", "no"
+		if s.Applied {
+			status = "applied"
+			migrated = s.Migrated.Format("2006-01-02 15:04:05")
+		} else {
+			pending++
+		}
+		if s.LosesData {
+			reversible = "with --force"
+		} else if s.Reversible {
+			reversible = "yes"
+		}
+		fmt.Fprintf(w, "V%d\t%s\t%s\t%s\t%s\n", s.Version, status, migrated, reversible, s.Description)
+	}
+	w.Flush()
+	if pending > 0 {
+		fmt.Printf("\n%d pending migration(s). Run: writefreely db migrate\n", pending)
+	}
+	return nil
+}
+
 // ResetPassword runs the interactive password reset process.
 func ResetPassword(apper Apper, username string) error {
 	// Connect to the database
@@ -854,8 +957,11 @@ func connectToDatabase(app *App) {
 		}
 		db, err = sql.Open("sqlite3_with_regex", app.cfg.Database.FileName+"?parseTime=true&cached=shared")
 		db.SetMaxOpenConns(2)
+	} else if app.cfg.Database.Type == driverPostgres {
+		db, err = sql.Open("postgres_with_placeholders", postgresDSN(app.cfg.Database))
+		db.SetMaxOpenConns(50)
 	} else {
-		log.Error("Invalid database type '%s'. Only 'mysql' and 'sqlite3' are supported right now.", app.cfg.Database.Type)
+		log.Error("Invalid database type '%s'. Only 'mysql', 'sqlite3', and 'postgres' are supported right now.", app.cfg.Database.Type)
 		os.Exit(1)
 	}
 	if err != nil {
@@ -865,6 +971,25 @@ func connectToDatabase(app *App) {
 	app.db = &datastore{db, app.cfg.Database.Type}
 }
 
+// postgresDSN builds a lib/pq connection string from the given configuration.
+func postgresDSN(cfg config.DatabaseCfg) string {
+	if cfg.Port == 0 {
+		cfg.Port = 5432
+	}
+	sslMode := "disable"
+	if cfg.TLS {
+		sslMode = "require"
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Path:     "/" + cfg.Database,
+		RawQuery: "sslmode=" + sslMode,
+	}
+	return u.String()
+}
+
 func shutdown(app *App) {
 	log.Info("Closing database connection...")
 	app.db.Close()
@@ -946,15 +1071,20 @@ var schemaSql string
 //go:embed sqlite.sql
 var sqliteSql string
 
+//go:embed postgres.sql
+var postgresSql string
+
 func adminInitDatabase(app *App) error {
 	var schema string
 	if app.cfg.Database.Type == driverSQLite {
 		schema = sqliteSql
+	} else if app.cfg.Database.Type == driverPostgres {
+		schema = postgresSql
 	} else {
 		schema = schemaSql
 	}
 
-	tblReg := regexp.MustCompile("CREATE TABLE (IF NOT EXISTS )?`([a-z_]+)`")
+	tblReg := regexp.MustCompile("CREATE TABLE (IF NOT EXISTS )?`?([a-z_]+)`?")
 
 	queries := strings.Split(string(schema), ";\n")
 	for _, q := range queries {
@@ -0,0 +1,133 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mailgun/mailgun-go"
+	"github.com/writeas/impart"
+	"github.com/writeas/web-core/log"
+)
+
+// maxSignupReasonLen is the most we'll keep of why someone wants to join.
+const maxSignupReasonLen = 1000
+
+// pendingUser is a user waiting for an admin to approve their registration.
+type pendingUser struct {
+	User
+	Reason string
+}
+
+// needsApproval returns whether a new account should wait for an admin's
+// approval. Invited users were already vetted by whoever invited them.
+func needsApproval(app *App, inviteCode string) bool {
+	return app.cfg.App.ApproveRegistrations && inviteCode == ""
+}
+
+// recordSignupReason saves why a pending user wants to join, for admins to see.
+func recordSignupReason(app *App, userID int64, reason string) error {
+	if r := []rune(reason); len(r) > maxSignupReasonLen {
+		reason = string(r[:maxSignupReasonLen])
+	}
+	if reason == "" {
+		return nil
+	}
+	return app.db.SetUserAttribute(userID, userAttrSignupReason, reason)
+}
+
+func handleAdminApproveUser(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	user, err := getPendingUser(app, mux.Vars(r)["username"])
+	if err != nil {
+		return err
+	}
+
+	log.Info("ADMIN: Approving user %s", user.Username)
+	err = app.db.SetUserStatus(user.ID, user.Status&^UserPending)
+	if err != nil {
+		log.Error("approve user %s: %v", user.Username, err)
+		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not approve user: %v", err)}
+	}
+	app.db.DeleteUserAttribute(user.ID, userAttrSignupReason)
+	emailRegistrationDecision(app, user, true)
+
+	_ = addSessionFlash(app, w, r, fmt.Sprintf("Approved %s.", user.Username), nil)
+	return impart.HTTPError{http.StatusFound, "/admin/users"}
+}
+
+func handleAdminRejectUser(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	user, err := getPendingUser(app, mux.Vars(r)["username"])
+	if err != nil {
+		return err
+	}
+
+	log.Info("ADMIN: Rejecting user %s", user.Username)
+	// Email first, since the address goes away with the account
+	emailRegistrationDecision(app, user, false)
+	err = app.db.DeleteAccount(user.ID)
+	if err != nil {
+		log.Error("reject user %s: %v", user.Username, err)
+		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not delete user account for '%s': %v", user.Username, err)}
+	}
+
+	_ = addSessionFlash(app, w, r, fmt.Sprintf("Rejected %s.", user.Username), nil)
+	return impart.HTTPError{http.StatusFound, "/admin/users"}
+}
+
+// getPendingUser returns the user with the given username, as long as they're
+// still waiting for approval.
+func getPendingUser(app *App, username string) (*User, error) {
+	if username == "" {
+		return nil, impart.HTTPError{http.StatusFound, "/admin/users"}
+	}
+	user, err := app.db.GetUserForAuth(username)
+	if err == ErrUserNotFound {
+		return nil, impart.HTTPError{http.StatusNotFound, fmt.Sprintf("User '%s' was not found", username)}
+	} else if err != nil {
+		log.Error("failed to get user: %v", err)
+		return nil, impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not get user from username: %v", err)}
+	}
+	if !user.IsPending() {
+		return nil, impart.HTTPError{http.StatusConflict, fmt.Sprintf("User '%s' isn't waiting for approval", username)}
+	}
+	return user, nil
+}
+
+// emailRegistrationDecision tells the user whether an admin approved their
+// registration, if we have a way to reach them.
+func emailRegistrationDecision(app *App, u *User, approved bool) {
+	if !app.cfg.Email.Enabled() {
+		return
+	}
+	to := u.EmailClear(app.keys)
+	if to == "" {
+		return
+	}
+
+	var subject, plainMsg string
+	if approved {
+		subject = "Welcome to " + app.cfg.App.SiteName
+		plainMsg = fmt.Sprintf("Your account on %s was approved! You can now log in as %s and start writing: %s/login", app.cfg.App.SiteName, u.Username, app.cfg.App.Host)
+	} else {
+		subject = "Your " + app.cfg.App.SiteName + " registration"
+		plainMsg = fmt.Sprintf("Thanks for your interest in %s. Unfortunately, your registration wasn't approved, and your account request has been removed.", app.cfg.App.SiteName)
+	}
+
+	gun := mailgun.NewMailgun(app.cfg.Email.Domain, app.cfg.Email.MailgunPrivate)
+	m := mailgun.NewMessage(app.cfg.App.SiteName+" <noreply-registration@"+app.cfg.Email.Domain+">", subject, plainMsg, fmt.Sprintf("<%s>", to))
+	m.AddTag("Registration")
+	_, _, err := gun.Send(m)
+	if err != nil {
+		log.Error("Unable to send registration decision to user %d: %v", u.ID, err)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/writeas/impart"
+)
+
+func TestRegistrationApproval(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.cfg.App.ApproveRegistrations = true
+		app.InitRateLimits()
+		admin := createTestUser(t, app, "admin", "password")
+
+		signUp := func(username string) (*AuthUser, error) {
+			req := httptest.NewRequest("POST", "/api/auth/signup", nil)
+			req.Header.Set("Content-Type", "application/json")
+			return signupWithRegistration(app, userRegistration{
+				userCredentials: userCredentials{Alias: username, Pass: "password", Email: username + "@example.com"},
+				Reason:          "I like to write",
+			}, httptest.NewRecorder(), req)
+		}
+		logIn := func(username string) error {
+			body, _ := json.Marshal(userCredentials{Alias: username, Pass: "password"})
+			req := httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("User-Agent", "test")
+			return login(app, httptest.NewRecorder(), req)
+		}
+		decide := func(h func(*App, *User, http.ResponseWriter, *http.Request) error, username string) error {
+			req := httptest.NewRequest("POST", "/admin/user/"+username+"/approve", nil)
+			req = mux.SetURLVars(req, map[string]string{"username": username})
+			return h(app, admin, httptest.NewRecorder(), req)
+		}
+		viewBlog := func(alias string) error {
+			_, err := processCollectionPermissions(app, &collectionReq{alias: alias}, nil, httptest.NewRecorder(), httptest.NewRequest("GET", "/"+alias+"/", nil))
+			return err
+		}
+
+		// Signups wait for approval, and need an email to hear back on
+		req := httptest.NewRequest("POST", "/api/auth/signup", nil)
+		_, err := signupWithRegistration(app, userRegistration{userCredentials: userCredentials{Alias: "noemail", Pass: "password"}}, httptest.NewRecorder(), req)
+		assert.Error(t, err)
+
+		for _, name := range []string{"carol", "dave"} {
+			au, err := signUp(name)
+			assert.NoError(t, err)
+			if assert.NotNil(t, au) {
+				assert.True(t, au.User.IsPending())
+				assert.Empty(t, au.AccessToken)
+			}
+		}
+		pending, err := db.GetPendingUsers()
+		assert.NoError(t, err)
+		if assert.Len(t, pending, 2) {
+			assert.Equal(t, "carol", pending[0].Username)
+			assert.Equal(t, "I like to write", pending[0].Reason)
+		}
+
+		// Pending users can't log in, and their blogs are hidden
+		assert.Equal(t, ErrUserPending, logIn("carol"))
+		assert.Equal(t, ErrCollectionNotFound, viewBlog("carol"))
+
+		// Still pending if they're silenced, too
+		carol, err := db.GetUserForAuth("carol")
+		assert.NoError(t, err)
+		assert.NoError(t, db.SetUserStatus(carol.ID, carol.Status|UserSilenced))
+		pending, err = db.GetPendingUsers()
+		assert.NoError(t, err)
+		assert.Len(t, pending, 2)
+		// or waiting to be deleted
+		assert.NoError(t, db.SetUserStatus(carol.ID, carol.Status|UserDeleting))
+		pending, err = db.GetPendingUsers()
+		assert.NoError(t, err)
+		assert.Len(t, pending, 2)
+		assert.NoError(t, db.SetUserStatus(carol.ID, UserPending))
+
+		// Approving lets them in
+		assert.Equal(t, impart.HTTPError{http.StatusFound, "/admin/users"}, decide(handleAdminApproveUser, "carol"))
+		assert.NoError(t, logIn("carol"))
+		assert.NoError(t, viewBlog("carol"))
+		assert.Empty(t, db.GetUserAttribute(carol.ID, userAttrSignupReason))
+		assert.Equal(t, http.StatusConflict, decide(handleAdminApproveUser, "carol").(impart.HTTPError).Status)
+
+		// Rejecting deletes the account
+		assert.Equal(t, impart.HTTPError{http.StatusFound, "/admin/users"}, decide(handleAdminRejectUser, "dave"))
+		_, err = db.GetUserForAuth("dave")
+		assert.Equal(t, ErrUserNotFound, err)
+		pending, err = db.GetPendingUsers()
+		assert.NoError(t, err)
+		assert.Empty(t, pending)
+
+		// Invited users skip the wait
+		assert.NoError(t, db.CreateUserInvite("abc123", admin.ID, 0, nil))
+		req = httptest.NewRequest("POST", "/api/auth/signup", nil)
+		au, err := signupWithRegistration(app, userRegistration{userCredentials: userCredentials{Alias: "erin", Pass: "password"}, InviteCode: "abc123"}, httptest.NewRecorder(), req)
+		assert.NoError(t, err)
+		if assert.NotNil(t, au) {
+			assert.False(t, au.User.IsPending())
+		}
+	})
+}
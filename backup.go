@@ -0,0 +1,739 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/writeas/web-core/data"
+	"github.com/writeas/web-core/log"
+	"github.com/writefreely/writefreely/key"
+	"github.com/writefreely/writefreely/migrations"
+)
+
+const (
+	backupManifestFile = "manifest.json"
+	backupConfigFile   = "config.ini"
+	backupKeysDir      = "keys"
+	backupDatabaseDir  = "database"
+	backupSQLiteFile   = "writefreely.db"
+
+	// backupEmailChecks is how many of each kind of encrypted value, like
+	// users' emails, a restore tries to decrypt to make sure the restored keys
+	// match the database.
+	backupEmailChecks = 20
+)
+
+// requiredKeys are the key files an instance can't run without.
+var requiredKeys = []string{"email.aes256", "cookies_auth.aes256", "cookies_enc.aes256", "csrf.aes256"}
+
+// backupManifest describes the contents of a backup archive.
+type backupManifest struct {
+	Version   string           `json:"version"`
+	Created   time.Time        `json:"created"`
+	Database  string           `json:"database"`
+	Migration int              `json:"migration"`
+	Tables    map[string]int64 `json:"tables"`
+}
+
+// tableNames returns the names of the backed up tables in order.
+func (m *backupManifest) tableNames() []string {
+	tables := make([]string, 0, len(m.Tables))
+	for t := range m.Tables {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// backupTableHeader is the first line of each exported table.
+type backupTableHeader struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+}
+
+// backupBinary holds binary data in an exported table. Some databases keep
+// binary data in text columns, so it's marked value by value.
+type backupBinary struct {
+	Base64 string `json:"base64"`
+}
+
+// Backup writes the app's configuration, keys and a consistent snapshot of its
+// database to a new gzipped tar archive at outFile. SQLite databases are copied
+// with SQLite's online backup, and other databases are exported row by row
+// within a single read-only transaction.
+func Backup(apper Apper, outFile string) error {
+	apper.LoadConfig()
+	app := apper.App()
+	connectToDatabase(app)
+	defer shutdown(app)
+
+	ver, err := app.db.migrationVersion()
+	if err != nil {
+		return fmt.Errorf("Unable to get database version: %s", err)
+	}
+	m := &backupManifest{
+		Version:   softwareVer,
+		Created:   time.Now().UTC(),
+		Database:  app.cfg.Database.Type,
+		Migration: ver,
+		Tables:    map[string]int64{},
+	}
+
+	cfgData, err := os.ReadFile(app.cfgFile)
+	if err != nil {
+		return fmt.Errorf("Unable to read config: %s", err)
+	}
+	keyFiles, err := readKeyFiles(filepath.Join(app.cfg.Server.KeysParentDir, keysDir))
+	if err != nil {
+		return err
+	}
+
+	// Take the database snapshot first, so we know how big each file is
+	tmpDir, err := os.MkdirTemp("", "writefreely-backup")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	log.Info("Backing up %s database...", app.cfg.Database.Type)
+	var dbFiles []string
+	if app.cfg.Database.Type == driverSQLite {
+		f := filepath.Join(tmpDir, backupSQLiteFile)
+		err = app.db.backupSQLite(f)
+		if err != nil {
+			return fmt.Errorf("Unable to back up database: %s", err)
+		}
+		err = countSQLiteBackup(f, m.Tables)
+		if err != nil {
+			return fmt.Errorf("Unable to check database backup: %s", err)
+		}
+		dbFiles = append(dbFiles, f)
+	} else {
+		dbFiles, err = exportTables(app.db, tmpDir, m.Tables)
+		if err != nil {
+			return fmt.Errorf("Unable to export database: %s", err)
+		}
+	}
+
+	// Archive everything. Keys are in here, so keep it private.
+	f, err := os.OpenFile(outFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = addTarFile(tw, backupManifestFile, manifest)
+	if err == nil {
+		err = addTarFile(tw, backupConfigFile, cfgData)
+	}
+	keyNames := make([]string, 0, len(keyFiles))
+	for name := range keyFiles {
+		keyNames = append(keyNames, name)
+	}
+	sort.Strings(keyNames)
+	for _, name := range keyNames {
+		if err != nil {
+			break
+		}
+		err = addTarFile(tw, path.Join(backupKeysDir, name), keyFiles[name])
+	}
+	for _, dbf := range dbFiles {
+		if err != nil {
+			break
+		}
+		err = copyTarFile(tw, path.Join(backupDatabaseDir, filepath.Base(dbf)), dbf)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(outFile)
+		return fmt.Errorf("Unable to write backup: %s", err)
+	}
+
+	log.Info("Backed up %d table(s) and %d key(s) to %s", len(m.Tables), len(keyFiles), outFile)
+	return nil
+}
+
+// Restore rebuilds an instance from a backup archive created by Backup. If the
+// app's config file already exists, data is restored into the database it
+// points to; otherwise the archived config is used. Keys are restored next to
+// the config, and checked against the restored data before finishing.
+func Restore(apper Apper, archiveFile string) error {
+	app := apper.App()
+	f, err := os.Open(archiveFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("Unable to read backup: %s", err)
+	}
+	tr := tar.NewReader(gz)
+
+	var m *backupManifest
+	var restoredKeys []string
+	connected := false
+	// Exported tables are all imported in one transaction, so a failed restore
+	// leaves the database empty and it can just be run again
+	var tx *sql.Tx
+	var kinds map[string]map[string]columnKind
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("Unable to read backup: %s", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		dir, base := path.Split(name)
+		dir = strings.TrimSuffix(dir, "/")
+
+		switch {
+		case m == nil && name != backupManifestFile:
+			return fmt.Errorf("Backup is missing its %s", backupManifestFile)
+		case name == backupManifestFile:
+			m = &backupManifest{}
+			err = json.NewDecoder(tr).Decode(m)
+			if err != nil {
+				return fmt.Errorf("Unable to read backup manifest: %s", err)
+			}
+			log.Info("Restoring WriteFreely %s backup from %s, on database V%d...", m.Version, m.Created.Format(time.RFC1123), m.Migration)
+			if m.Migration > migrations.CurrentVer() {
+				return fmt.Errorf("Backup is from database V%d, but this version of WriteFreely only knows up to V%d. Restore it with a newer version.", m.Migration, migrations.CurrentVer())
+			}
+		case name == backupConfigFile:
+			err = restoreConfig(app, tr)
+		case dir == backupKeysDir:
+			if app.cfg == nil {
+				return fmt.Errorf("Backup has keys before its config")
+			}
+			err = restoreKeyFile(filepath.Join(app.cfg.Server.KeysParentDir, keysDir, base), tr)
+			restoredKeys = append(restoredKeys, base)
+		case dir == backupDatabaseDir && base == backupSQLiteFile:
+			err = restoreSQLite(app, tr)
+			if err == nil {
+				connectToDatabase(app)
+				connected = true
+			}
+		case dir == backupDatabaseDir && strings.HasSuffix(base, ".jsonl"):
+			if app.cfg == nil {
+				return fmt.Errorf("Backup has data before its config")
+			}
+			if !connected {
+				if m.Migration != migrations.CurrentVer() {
+					return fmt.Errorf("Backup is from database V%d, but this version of WriteFreely needs V%d. Restore it with WriteFreely %s, then upgrade.", m.Migration, migrations.CurrentVer(), m.Version)
+				}
+				connectToDatabase(app)
+				connected = true
+				err = prepareEmptyDatabase(app, m.tableNames())
+				if err != nil {
+					return err
+				}
+				kinds, err = app.db.allColumnKinds(m.tableNames())
+				if err != nil {
+					return err
+				}
+				tx, err = app.db.Begin()
+				if err != nil {
+					return err
+				}
+				err = clearMigrations(tx)
+				if err != nil {
+					return err
+				}
+			}
+			err = importTable(app.db, tx, kinds, tr)
+		default:
+			log.Info("Skipping unknown file %s", name)
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to restore %s: %s", name, err)
+		}
+	}
+	if m == nil {
+		return fmt.Errorf("Backup is empty")
+	}
+	if !connected {
+		return fmt.Errorf("Backup has no database")
+	}
+	defer app.db.Close()
+	if tx != nil {
+		err = tx.Commit()
+		tx = nil
+		if err != nil {
+			return fmt.Errorf("Unable to save restored data: %s", err)
+		}
+	}
+
+	log.Info("Verifying...")
+	var mismatches []string
+	for _, t := range m.tableNames() {
+		n, err := app.db.countRows(t)
+		if err != nil {
+			return err
+		}
+		if n != m.Tables[t] {
+			mismatches = append(mismatches, fmt.Sprintf("%s (%d in backup, %d restored)", t, m.Tables[t], n))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("Row counts don't match: %s", strings.Join(mismatches, ", "))
+	}
+	err = checkRestoredKeys(app)
+	if err != nil {
+		return err
+	}
+
+	if m.Migration < migrations.CurrentVer() {
+		log.Info("Restored database is on V%d. Run: writefreely -c %s db migrate", m.Migration, app.cfgFile)
+	}
+	log.Info("Done! Restored %d table(s) and %d key(s).", len(m.Tables), len(restoredKeys))
+	return nil
+}
+
+// readKeyFiles reads every file in the given keys directory, making sure the
+// required ones are there.
+func readKeyFiles(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read keys: %s", err)
+	}
+	keys := map[string][]byte{}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		keys[e.Name()], err = os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read keys: %s", err)
+		}
+	}
+	for _, k := range requiredKeys {
+		if _, ok := keys[k]; !ok {
+			return nil, fmt.Errorf("Missing key %s. Run: writefreely keys generate", filepath.Join(dir, k))
+		}
+	}
+	return keys, nil
+}
+
+// exportTables writes each table in the database to its own file in dir,
+// recording how many rows each had, and returns the files' paths. Everything
+// is read in one transaction so the export is consistent.
+func exportTables(db *datastore, dir string, counts map[string]int64) ([]string, error) {
+	tables, err := db.tableNames()
+	if err != nil {
+		return nil, err
+	}
+	kinds, err := db.allColumnKinds(tables)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var files []string
+	for _, t := range tables {
+		f := filepath.Join(dir, t+".jsonl")
+		n, err := exportTable(tx, db.quoteIdent(t), t, kinds[t], f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", t, err)
+		}
+		log.Info("Exported %d row(s) from %s.", n, t)
+		counts[t] = n
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// exportTable writes a header line describing the table, then one JSON array
+// per row.
+func exportTable(tx *sql.Tx, quotedTable, table string, kinds map[string]columnKind, file string) (int64, error) {
+	rows, err := tx.Query("SELECT * FROM " + quotedTable)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	binary := make([]bool, len(cols))
+	for i, c := range cols {
+		binary[i] = kinds[strings.ToLower(c)] == columnBinary
+	}
+	err = enc.Encode(backupTableHeader{Table: table, Columns: cols})
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	vals := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	for rows.Next() {
+		err = rows.Scan(ptrs...)
+		if err != nil {
+			return n, err
+		}
+		for i := range vals {
+			switch v := vals[i].(type) {
+			case []byte:
+				if binary[i] || !utf8.Valid(v) {
+					vals[i] = backupBinary{base64.StdEncoding.EncodeToString(v)}
+				} else {
+					vals[i] = string(v)
+				}
+			case string:
+				if binary[i] {
+					vals[i] = backupBinary{base64.StdEncoding.EncodeToString([]byte(v))}
+				}
+			}
+		}
+		err = enc.Encode(vals)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err = rows.Err(); err != nil {
+		return n, err
+	}
+	return n, w.Flush()
+}
+
+// importTable reads a table exported by exportTable into the database, within
+// the given transaction. kinds holds the column kinds of each table.
+func importTable(db *datastore, tx *sql.Tx, kinds map[string]map[string]columnKind, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	h := backupTableHeader{}
+	err := dec.Decode(&h)
+	if err != nil {
+		return err
+	}
+	log.Info("Restoring %s...", h.Table)
+	if _, ok := kinds[h.Table]; !ok {
+		return fmt.Errorf("%s isn't in the backup manifest", h.Table)
+	}
+	ti, err := db.newTableInserter(tx, h.Table, h.Columns, kinds[h.Table])
+	if err != nil {
+		return err
+	}
+	for dec.More() {
+		var vals []interface{}
+		err = dec.Decode(&vals)
+		if err == nil && len(vals) != len(h.Columns) {
+			err = fmt.Errorf("row %d has %d values, expected %d", ti.n+1, len(vals), len(h.Columns))
+		}
+		if err != nil {
+			ti.abort()
+			return err
+		}
+		for i, c := range h.Columns {
+			vals[i], err = decodeBackupValue(vals[i], ti.kind(i))
+			if err != nil {
+				ti.abort()
+				return fmt.Errorf("row %d, %s: %s", ti.n+1, c, err)
+			}
+		}
+		err = ti.insert(vals)
+		if err != nil {
+			ti.abort()
+			return err
+		}
+	}
+	n, err := ti.finish()
+	if err != nil {
+		return err
+	}
+	log.Info("Restored %d row(s).", n)
+	return nil
+}
+
+// decodeBackupValue turns a JSON value from an exported table back into one
+// the database driver accepts.
+func decodeBackupValue(v interface{}, kind columnKind) (interface{}, error) {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i, nil
+		}
+		return val.Float64()
+	case map[string]interface{}:
+		b64, ok := val["base64"].(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object")
+		}
+		return base64.StdEncoding.DecodeString(b64)
+	case string:
+		if kind == columnTime {
+			if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return v, nil
+}
+
+// countSQLiteBackup records how many rows each table in the given SQLite
+// database file has.
+func countSQLiteBackup(file string, counts map[string]int64) error {
+	sdb, err := sql.Open("sqlite3", file)
+	if err != nil {
+		return err
+	}
+	db := &datastore{sdb, driverSQLite}
+	defer db.Close()
+
+	tables, err := db.tableNames()
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		counts[t], err = db.countRows(t)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreConfig writes the archived config to the app's config file, unless
+// one already exists, and loads it.
+func restoreConfig(app *App, r io.Reader) error {
+	if _, err := os.Stat(app.cfgFile); err == nil {
+		log.Info("Keeping existing %s, and restoring into the database it configures.", app.cfgFile)
+	} else if os.IsNotExist(err) {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		log.Info("Writing %s...", app.cfgFile)
+		err = os.WriteFile(app.cfgFile, b, 0600)
+		if err != nil {
+			return err
+		}
+	} else {
+		return err
+	}
+	return app.LoadConfig()
+}
+
+// restoreKeyFile writes a key file, unless a different one already exists
+// there.
+func restoreKeyFile(file string, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if existing, err := os.ReadFile(file); err == nil {
+		if !bytes.Equal(existing, b) {
+			return fmt.Errorf("%s already exists with a different key. Move it out of the way first.", file)
+		}
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return err
+	}
+	log.Info("Writing %s...", file)
+	return os.WriteFile(file, b, 0600)
+}
+
+// restoreSQLite writes the archived SQLite database to the configured file,
+// which must not exist yet.
+func restoreSQLite(app *App, r io.Reader) error {
+	if app.cfg == nil {
+		return fmt.Errorf("backup has data before its config")
+	}
+	if app.cfg.Database.Type != driverSQLite {
+		return fmt.Errorf("backup has a SQLite database, but %s is configured for %s. Restore into a SQLite config, then use db convert.", app.cfgFile, app.cfg.Database.Type)
+	}
+	dest := app.cfg.Database.FileName
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists. Move it out of the way first.", dest)
+	}
+
+	// Write it somewhere temporary first, so a failed restore doesn't leave
+	// a partial database behind.
+	tmp := dest + ".restoring"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	log.Info("Writing %s...", dest)
+	return os.Rename(tmp, dest)
+}
+
+// checkRestoredKeys makes sure all required keys were restored and can decrypt
+// the users' emails, two-factor secrets and emailed invites in the restored
+// database.
+func checkRestoredKeys(app *App) error {
+	dir := filepath.Join(app.cfg.Server.KeysParentDir, keysDir)
+	for _, k := range requiredKeys {
+		b, err := os.ReadFile(filepath.Join(dir, k))
+		if err != nil {
+			return fmt.Errorf("Missing key: %s", err)
+		}
+		if len(b) != key.EncKeysBytes {
+			return fmt.Errorf("Key %s is %d bytes, expected %d", k, len(b), key.EncKeysBytes)
+		}
+	}
+
+	emailKey, err := os.ReadFile(filepath.Join(dir, "email.aes256"))
+	if err != nil {
+		return err
+	}
+	checks := []struct {
+		what, query string
+	}{
+		{"email(s)", "SELECT email FROM users WHERE email IS NOT NULL LIMIT ?"},
+		{"two-factor secret(s)", "SELECT secret FROM usertwofactor LIMIT ?"},
+		{"invite email(s)", "SELECT email FROM userinvites WHERE email IS NOT NULL LIMIT ?"},
+	}
+	for _, c := range checks {
+		checked, failed, err := checkDecrypts(app.db, emailKey, c.query)
+		if err != nil {
+			return fmt.Errorf("Unable to check %s: %s", c.what, err)
+		}
+		if failed > 0 {
+			return fmt.Errorf("The email key can't decrypt %d of %d %s checked. Make sure %s holds the keys this database was used with.", failed, checked, c.what, dir)
+		}
+		log.Info("Keys decrypt all %d %s checked.", checked, c.what)
+	}
+	return nil
+}
+
+// checkDecrypts tries to decrypt up to backupEmailChecks values selected by
+// query with the given key, returning how many it checked and how many
+// failed.
+func checkDecrypts(db *datastore, k []byte, query string) (checked, failed int, err error) {
+	rows, err := db.Query(query, backupEmailChecks)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var val []byte
+		err = rows.Scan(&val)
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(val) == 0 {
+			continue
+		}
+		checked++
+		if _, err = data.Decrypt(k, val); err != nil {
+			failed++
+		}
+	}
+	return checked, failed, rows.Err()
+}
+
+func addTarFile(tw *tar.Writer, name string, b []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(b)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(b)
+	return err
+}
+
+// copyTarFile adds the file at src to the archive as name, streaming it
+// rather than reading it all into memory.
+func copyTarFile(tw *tar.Writer, name, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    fi.Size(),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
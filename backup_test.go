@@ -0,0 +1,148 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/guregu/null/zero"
+	"github.com/stretchr/testify/assert"
+	"github.com/writeas/web-core/data"
+)
+
+// writeTestKeys writes the required key files, holding the test keys, to the
+// keys directory in dir.
+func writeTestKeys(t *testing.T, dir string) {
+	keys := map[string][]byte{
+		"email.aes256":        testKey(1),
+		"cookies_auth.aes256": testKey(2),
+		"cookies_enc.aes256":  testKey(3),
+		"csrf.aes256":         testKey(4),
+	}
+	if err := os.MkdirAll(filepath.Join(dir, keysDir), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, k := range keys {
+		if err := os.WriteFile(filepath.Join(dir, keysDir, name), k, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	if !SQLiteEnabled {
+		t.Skip("skipping backup tests without SQLite")
+	}
+
+	// Set up an instance with some encrypted data
+	src := t.TempDir()
+	writeTestKeys(t, src)
+	app := NewApp(newTestSQLiteConfig(t, src))
+	assert.NoError(t, app.LoadConfig())
+	connectToDatabase(app)
+	assert.NoError(t, adminInitDatabase(app))
+	app.keys = newTestApp(app.db).keys
+	alice := createTestUser(t, app, "alice", "password")
+	assert.NoError(t, app.db.UpdateUserEmail(app.keys, alice.ID, "alice@example.com"))
+	assert.NoError(t, app.db.SetPendingTwoFactor(alice.ID, "JBSWY3DPEHPK3PXP", app.keys.EmailKey))
+	enc, err := data.Encrypt(app.keys.EmailKey, "invitee@example.com")
+	assert.NoError(t, err)
+	assert.NoError(t, app.db.CreateLabeledUserInvite("emailed", alice.ID, 1, nil, "Workshop", zero.StringFrom(string(enc))))
+	app.db.Close()
+
+	archive := filepath.Join(t.TempDir(), "backup.tar.gz")
+	assert.NoError(t, Backup(app, archive))
+	fi, err := os.Stat(archive)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	}
+	// It won't overwrite an existing archive
+	assert.Error(t, Backup(app, archive))
+
+	// Restore into a new instance, keeping its config
+	dest := t.TempDir()
+	restored := NewApp(newTestSQLiteConfig(t, dest))
+	assert.NoError(t, Restore(restored, archive))
+	assert.FileExists(t, filepath.Join(dest, "writefreely.db"))
+	for _, k := range requiredKeys {
+		b, err := os.ReadFile(filepath.Join(dest, keysDir, k))
+		if assert.NoError(t, err) {
+			src, _ := os.ReadFile(filepath.Join(src, keysDir, k))
+			assert.Equal(t, src, b)
+		}
+	}
+
+	connectToDatabase(restored)
+	defer restored.db.Close()
+	restored.keys = app.keys
+	u, err := restored.db.GetUserByID(alice.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", u.Username)
+		assert.Equal(t, "alice@example.com", u.EmailClear(restored.keys))
+	}
+	tf, err := restored.db.GetUserTwoFactor(alice.ID, restored.keys.EmailKey)
+	if assert.NoError(t, err) && assert.NotNil(t, tf) {
+		assert.Equal(t, "JBSWY3DPEHPK3PXP", tf.Secret)
+	}
+	i, err := restored.db.GetUserInvite("emailed")
+	if assert.NoError(t, err) {
+		i.decryptEmail(restored.keys)
+		assert.Equal(t, "invitee@example.com", i.SentTo())
+	}
+
+	// Restoring again won't overwrite the database
+	assert.Error(t, Restore(NewApp(filepath.Join(dest, "config.ini")), archive))
+}
+
+func TestCheckRestoredKeys(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		dir := t.TempDir()
+		app.cfg.Server.KeysParentDir = dir
+
+		// Keys must all be there
+		assert.Error(t, checkRestoredKeys(app))
+		writeTestKeys(t, dir)
+		assert.NoError(t, checkRestoredKeys(app))
+
+		alice := createTestUser(t, app, "alice", "password")
+		assert.NoError(t, db.UpdateUserEmail(app.keys, alice.ID, "alice@example.com"))
+		assert.NoError(t, checkRestoredKeys(app))
+
+		// Each kind of encrypted value is checked
+		assert.NoError(t, db.SetPendingTwoFactor(alice.ID, "JBSWY3DPEHPK3PXP", testKey(9)))
+		err := checkRestoredKeys(app)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "two-factor")
+		}
+		assert.NoError(t, db.SetPendingTwoFactor(alice.ID, "JBSWY3DPEHPK3PXP", app.keys.EmailKey))
+		assert.NoError(t, checkRestoredKeys(app))
+
+		enc, err := data.Encrypt(testKey(9), "invitee@example.com")
+		assert.NoError(t, err)
+		assert.NoError(t, db.CreateLabeledUserInvite("emailed", alice.ID, 1, nil, "Workshop", zero.StringFrom(string(enc))))
+		err = checkRestoredKeys(app)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "invite")
+		}
+
+		enc, err = data.Encrypt(testKey(9), "alice@example.com")
+		assert.NoError(t, err)
+		_, err = db.Exec("UPDATE users SET email = ? WHERE id = ?", enc, alice.ID)
+		assert.NoError(t, err)
+		err = checkRestoredKeys(app)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "email")
+		}
+	})
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/writefreely/writefreely"
+)
+
+var (
+	cmdBackup cli.Command = cli.Command{
+		Name:  "backup",
+		Usage: "Back up the database, keys and config to a single archive",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "write the archive to `FILE` (default: writefreely-backup-<date>.tar.gz)",
+			},
+		},
+		Action: backupAction,
+	}
+
+	cmdRestore cli.Command = cli.Command{
+		Name:      "restore",
+		Usage:     "Rebuild an instance from a backup archive",
+		ArgsUsage: "ARCHIVE",
+		Action:    restoreAction,
+	}
+)
+
+func backupAction(c *cli.Context) error {
+	out := c.String("output")
+	if out == "" {
+		out = fmt.Sprintf("writefreely-backup-%s.tar.gz", time.Now().Format("20060102-150405"))
+	}
+	app := writefreely.NewApp(c.String("c"))
+	return writefreely.Backup(app, out)
+}
+
+func restoreAction(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("usage: writefreely restore ARCHIVE")
+	}
+	app := writefreely.NewApp(c.String("c"))
+	return writefreely.Restore(app, c.Args().First())
+}
@@ -22,6 +22,9 @@ var (
 		Subcommands: []*cli.Command{
 			&cmdDBInit,
 			&cmdDBMigrate,
+			&cmdDBStatus,
+			&cmdDBRollback,
+			&cmdDBConvert,
 		},
 	}
 
@@ -32,10 +35,56 @@ var (
 	}
 
 	cmdDBMigrate cli.Command = cli.Command{
-		Name:   "migrate",
-		Usage:  "Migrate Database",
+		Name:  "migrate",
+		Usage: "Migrate Database",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "print the SQL that would run, without changing anything",
+			},
+		},
 		Action: migrateDBAction,
 	}
+
+	cmdDBStatus cli.Command = cli.Command{
+		Name:   "status",
+		Usage:  "List applied and pending migrations",
+		Action: statusDBAction,
+	}
+
+	cmdDBRollback cli.Command = cli.Command{
+		Name:  "rollback",
+		Usage: "Revert the most recent migrations",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "to",
+				Usage: "version to roll back to (default: the one before the current version)",
+				Value: -1,
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "print the SQL that would run, without changing anything",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "roll back migrations even if that deletes data",
+			},
+		},
+		Action: rollbackDBAction,
+	}
+
+	cmdDBConvert cli.Command = cli.Command{
+		Name:  "convert",
+		Usage: "Copy all data into the empty database configured in another config file",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "to",
+				Usage:    "config file for the destination database",
+				Required: true,
+			},
+		},
+		Action: convertDBAction,
+	}
 )
 
 func initDBAction(c *cli.Context) error {
@@ -45,5 +94,23 @@ func initDBAction(c *cli.Context) error {
 
 func migrateDBAction(c *cli.Context) error {
 	app := writefreely.NewApp(c.String("c"))
+	if c.Bool("dry-run") {
+		return writefreely.MigrateDryRun(app)
+	}
 	return writefreely.Migrate(app)
 }
+
+func statusDBAction(c *cli.Context) error {
+	app := writefreely.NewApp(c.String("c"))
+	return writefreely.MigrationStatus(app)
+}
+
+func rollbackDBAction(c *cli.Context) error {
+	app := writefreely.NewApp(c.String("c"))
+	return writefreely.Rollback(app, c.Int("to"), c.Bool("dry-run"), c.Bool("force"))
+}
+
+func convertDBAction(c *cli.Context) error {
+	app := writefreely.NewApp(c.String("c"))
+	return writefreely.ConvertDatabase(app, c.String("to"))
+}
@@ -11,6 +11,9 @@
 package main
 
 import (
+	"strings"
+	"time"
+
 	"github.com/urfave/cli/v2"
 	"github.com/writefreely/writefreely"
 )
@@ -21,6 +24,7 @@ var (
 		Usage: "key management tools",
 		Subcommands: []*cli.Command{
 			&cmdGenerateKeys,
+			&cmdRotateKeys,
 		},
 	}
 
@@ -30,9 +34,38 @@ var (
 		Usage:   "Generate encryption and authentication keys",
 		Action:  genKeysAction,
 	}
+
+	cmdRotateKeys cli.Command = cli.Command{
+		Name:  "rotate",
+		Usage: "Replace keys with new ones, re-encrypting stored data. Stop WriteFreely first when rotating the email key",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "keys",
+				Value: "email,cookies,csrf",
+				Usage: "Comma-separated keys to rotate: email, cookies, csrf",
+			},
+			&cli.DurationFlag{
+				Name:  "grace",
+				Value: 7 * 24 * time.Hour,
+				Usage: "How long previous cookie and CSRF keys are still accepted",
+			},
+		},
+		Action: rotateKeysAction,
+	}
 )
 
 func genKeysAction(c *cli.Context) error {
 	app := writefreely.NewApp(c.String("c"))
 	return writefreely.GenerateKeyFiles(app)
 }
+
+func rotateKeysAction(c *cli.Context) error {
+	app := writefreely.NewApp(c.String("c"))
+	var names []string
+	for _, n := range strings.Split(c.String("keys"), ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return writefreely.RotateKeys(app, names, c.Duration("grace"))
+}
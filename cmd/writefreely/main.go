@@ -112,6 +112,8 @@ func main() {
 		&cmdDB,
 		&cmdConfig,
 		&cmdKeys,
+		&cmdBackup,
+		&cmdRestore,
 		&cmdServe,
 	}
 
@@ -25,6 +25,7 @@ var (
 			&cmdAddUser,
 			&cmdDelUser,
 			&cmdResetPass,
+			&cmdResetTwoFactor,
 			// TODO: possibly add a user list command
 		},
 	}
@@ -56,6 +57,12 @@ var (
 		Aliases: []string{"resetpass", "reset"},
 		Action:  resetPassAction,
 	}
+
+	cmdResetTwoFactor cli.Command = cli.Command{
+		Name:   "reset-2fa",
+		Usage:  "Turn off user's two-factor authentication",
+		Action: resetTwoFactorAction,
+	}
 )
 
 func addUserAction(c *cli.Context) error {
@@ -94,3 +101,14 @@ func resetPassAction(c *cli.Context) error {
 	app := writefreely.NewApp(c.String("c"))
 	return writefreely.ResetPassword(app, username)
 }
+
+func resetTwoFactorAction(c *cli.Context) error {
+	username := ""
+	if c.NArg() > 0 {
+		username = c.Args().Get(0)
+	} else {
+		return fmt.Errorf("No user passed. Example: writefreely user reset-2fa [USER]")
+	}
+	app := writefreely.NewApp(c.String("c"))
+	return writefreely.ResetTwoFactor(app, username)
+}
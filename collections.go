@@ -41,6 +41,7 @@ import (
 
 const (
 	collAttrLetterReplyTo = "letter_reply_to"
+	collAttrPostByEmail   = "post_by_email"
 
 	collMaxLengthTitle       = 255
 	collMaxLengthDescription = 160
@@ -120,6 +121,8 @@ type (
 		Monetization *string         `schema:"monetization_pointer" json:"monetization_pointer"`
 		Verification *string         `schema:"verification_link" json:"verification_link"`
 		LetterReply  *string         `schema:"letter_reply" json:"letter_reply"`
+		LetterHTML   *string         `schema:"letter_html_template" json:"letter_html_template"`
+		LetterText   *string         `schema:"letter_text_template" json:"letter_text_template"`
 		Visibility   *int            `schema:"visibility" json:"public"`
 		Format       *sql.NullString `schema:"format" json:"format"`
 	}
@@ -765,7 +768,8 @@ func processCollectionPermissions(app *App, cr *collectionReq, u *User, w http.R
 
 	// Check permissions
 	if !cr.isCollOwner {
-		if c.IsPrivate() {
+		if c.IsPrivate() || app.db.IsUserPending(c.OwnerID) {
+			// Blogs of users waiting for approval stay hidden, too
 			return nil, ErrCollectionNotFound
 		} else if c.IsProtected() {
 			uname := ""
@@ -774,12 +778,12 @@ func processCollectionPermissions(app *App, cr *collectionReq, u *User, w http.R
 			}
 
 			// TODO: move this to all permission checks?
-			suspended, err := app.db.IsUserSilenced(c.OwnerID)
+			hidden, err := app.db.IsUserHidden(c.OwnerID)
 			if err != nil {
 				log.Error("process protected collection permissions: %v", err)
 				return nil, err
 			}
-			if suspended {
+			if hidden {
 				return nil, ErrCollectionNotFound
 			}
 
@@ -872,7 +876,7 @@ func handleViewCollection(app *App, w http.ResponseWriter, r *http.Request) erro
 	}
 	c.hostName = app.cfg.App.Host
 
-	silenced, err := app.db.IsUserSilenced(c.OwnerID)
+	hidden, err := app.db.IsUserHidden(c.OwnerID)
 	if err != nil {
 		log.Error("view collection: %v", err)
 		return ErrInternalGeneral
@@ -943,10 +947,10 @@ func handleViewCollection(app *App, w http.ResponseWriter, r *http.Request) erro
 			log.Error("Error getting user for collection: %v", err)
 		}
 	}
-	if !isOwner && silenced {
+	if !isOwner && hidden {
 		return ErrCollectionNotFound
 	}
-	displayPage.Silenced = isOwner && silenced
+	displayPage.Silenced = isOwner && hidden
 	displayPage.Owner = owner
 	coll.Owner = displayPage.Owner
 
@@ -1075,7 +1079,7 @@ func handleViewCollectionTag(app *App, w http.ResponseWriter, r *http.Request) e
 			// Log the error and just continue
 			log.Error("Error getting user for collection: %v", err)
 		}
-		if owner.IsSilenced() {
+		if owner != nil && owner.IsHidden() {
 			return ErrCollectionNotFound
 		}
 	}
@@ -1176,7 +1180,7 @@ func handleViewCollectionLang(app *App, w http.ResponseWriter, r *http.Request)
 			// Log the error and just continue
 			log.Error("Error getting user for collection: %v", err)
 		}
-		if owner.IsSilenced() {
+		if owner != nil && owner.IsHidden() {
 			return ErrCollectionNotFound
 		}
 	}
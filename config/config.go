@@ -12,7 +12,9 @@
 package config
 
 import (
+	"fmt"
 	"net/url"
+	"regexp"
 	"strings"
 
 	"github.com/go-ini/ini"
@@ -26,8 +28,16 @@ const (
 
 	UserNormal UserType = "user"
 	UserAdmin           = "admin"
+
+	// genericOauthSectionPrefix starts the name of each section configuring
+	// another generic OAuth provider, like [oauth.generic.staff].
+	genericOauthSectionPrefix = "oauth.generic."
 )
 
+// genericOauthName is what a named generic OAuth provider can be called. It's
+// short enough to fit, prefixed, in the provider column of oauth_users.
+var genericOauthName = regexp.MustCompile("^[a-z0-9_-]{1,16}$")
+
 type (
 	UserType string
 
@@ -48,6 +58,10 @@ type (
 
 		HashSeed string `ini:"hash_seed"`
 
+		// Comma-separated IP addresses and ranges of reverse proxies whose
+		// X-Forwarded-For headers are trusted. Defaults to the local machine.
+		TrustedProxies string `ini:"trusted_proxies"`
+
 		GopherPort int `ini:"gopher_port"`
 
 		Dev bool `ini:"-"`
@@ -102,6 +116,11 @@ type (
 	}
 
 	GenericOauthCfg struct {
+		// Mode is "oidc" for OpenID Connect providers, whose endpoints are
+		// discovered from the issuer URL in Host. Otherwise, endpoints have to
+		// be configured below.
+		Mode string `ini:"mode"`
+
 		ClientID         string `ini:"client_id"`
 		ClientSecret     string `ini:"client_secret"`
 		Host             string `ini:"host"`
@@ -117,6 +136,52 @@ type (
 		MapUsername      string `ini:"map_username"`
 		MapDisplayName   string `ini:"map_display_name"`
 		MapEmail         string `ini:"map_email"`
+
+		// MapGroups is the claim that lists the groups a user is in. When
+		// AllowedGroups is set, only users in one of those groups can sign
+		// up. When AdminGroups is set, each login makes a user an admin if
+		// they're in one of those groups, and takes admin away if not. Both
+		// are comma-separated.
+		MapGroups     string `ini:"map_groups"`
+		AllowedGroups string `ini:"allowed_groups"`
+		AdminGroups   string `ini:"admin_groups"`
+	}
+
+	// LDAPCfg configures logging in with accounts from an LDAP directory.
+	// Accounts are created for directory users the first time they log in,
+	// without going through registration approval or signup blocks.
+	LDAPCfg struct {
+		// URL is the directory server, like ldaps://ldap.example.com.
+		URL      string `ini:"url"`
+		StartTLS bool   `ini:"start_tls"`
+
+		// BindDN and BindPassword are the account used to search for users,
+		// or empty to search anonymously.
+		BindDN       string `ini:"bind_dn"`
+		BindPassword string `ini:"bind_password"`
+
+		// UserFilter finds the user logging in under BaseDN, with %s in place
+		// of the username they gave.
+		BaseDN     string `ini:"base_dn"`
+		UserFilter string `ini:"user_filter"`
+
+		MapUserID      string `ini:"map_user_id"`
+		MapUsername    string `ini:"map_username"`
+		MapDisplayName string `ini:"map_display_name"`
+		MapEmail       string `ini:"map_email"`
+
+		// MapGroups is the attribute listing the groups a user is in. When
+		// AllowedGroups is set, only users in one of those groups can log in.
+		// Group DNs contain commas, so these are separated by semicolons.
+		MapGroups     string `ini:"map_groups"`
+		AllowedGroups string `ini:"allowed_groups"`
+	}
+
+	// NamedGenericOauthCfg is a generic OAuth provider configured in its own
+	// [oauth.generic.<name>] section.
+	NamedGenericOauthCfg struct {
+		Name string
+		GenericOauthCfg
 	}
 
 	// AppCfg holds values that affect how the application functions
@@ -146,6 +211,15 @@ type (
 		MinUsernameLen   int  `ini:"min_username_len"`
 		MaxBlogs         int  `ini:"max_blogs"`
 
+		// DeletionGraceDays is how long a deleted account stays hidden, and
+		// can be restored by logging in, before it's gone for good. With 0,
+		// accounts are deleted right away.
+		DeletionGraceDays int `ini:"deletion_grace_days"`
+
+		// ApproveRegistrations holds accounts created through open
+		// registration until an admin approves them.
+		ApproveRegistrations bool `ini:"approve_registrations"`
+
 		// Options for public instances
 		// Federation
 		Federation   bool `ini:"federation"`
@@ -154,7 +228,13 @@ type (
 		NotesOnly    bool `ini:"notes_only"`
 
 		// Access
-		Private bool `ini:"private"`
+		Private          bool `ini:"private"`
+		AdminsRequire2FA bool `ini:"admins_require_2fa"`
+
+		// RequireEmailVerification keeps users from publishing or federating
+		// until they verify their email address. It only applies when email
+		// is configured.
+		RequireEmailVerification bool `ini:"require_email_verification"`
 
 		// Additional functions
 		LocalTimeline bool   `ini:"local_timeline"`
@@ -173,6 +253,49 @@ type (
 	EmailCfg struct {
 		Domain         string `ini:"domain"`
 		MailgunPrivate string `ini:"mailgun_private"`
+
+		// Key Mailgun uses to sign delivery event webhooks
+		WebhookSigningKey string `ini:"webhook_signing_key"`
+
+		// Inbound mail, for publishing by email and forwarding letter replies
+		InboundDomain     string `ini:"inbound_domain"`
+		InboundSMTPBind   string `ini:"inbound_smtp_bind"`
+		InboundWebhookKey string `ini:"inbound_webhook_key"`
+	}
+
+	// RateLimitCfg holds limits on how often clients can log in, sign up,
+	// reset passwords, publish and reply to letters. Counts are per hour. Zero
+	// uses the default limit, and a negative value turns the limit off.
+	RateLimitCfg struct {
+		LoginsPerIP int `ini:"logins_per_ip"`
+
+		// Failed logins an account can have from one IP address before it's
+		// locked there, and how long the first lockout lasts. Each further
+		// failure doubles it.
+		LoginFailures  int `ini:"login_failures"`
+		LockoutMinutes int `ini:"lockout_minutes"`
+
+		SignupsPerIP     int `ini:"signups_per_ip"`
+		ResetsPerIP      int `ini:"resets_per_ip"`
+		ResetsPerAccount int `ini:"resets_per_account"`
+		PostsPerIP       int `ini:"posts_per_ip"`
+		PostsPerAccount  int `ini:"posts_per_account"`
+
+		// Replies to a blog's letters that are forwarded to its owner
+		LetterRepliesPerBlog int `ini:"letter_replies_per_blog"`
+	}
+
+	// SpamCfg holds defenses against spam accounts, on top of the signup
+	// blocklists admins manage from the admin panel.
+	SpamCfg struct {
+		// Reject signups with addresses at known disposable email providers
+		BlockDisposableEmails bool `ini:"block_disposable_emails"`
+
+		// Spam score at which new accounts are automatically silenced. Accounts
+		// score 2 points for each other account signed up from the same IP
+		// address in the past day, and more for links in their first post.
+		// Zero turns this off.
+		SilenceScore int `ini:"silence_score"`
 	}
 
 	// Config holds the complete configuration for running a writefreely instance
@@ -181,11 +304,18 @@ type (
 		Database     DatabaseCfg     `ini:"database"`
 		App          AppCfg          `ini:"app"`
 		Email        EmailCfg        `ini:"email"`
+		RateLimit    RateLimitCfg    `ini:"rate_limit"`
+		Spam         SpamCfg         `ini:"spam"`
 		SlackOauth   SlackOauthCfg   `ini:"oauth.slack"`
 		WriteAsOauth WriteAsOauthCfg `ini:"oauth.writeas"`
 		GitlabOauth  GitlabOauthCfg  `ini:"oauth.gitlab"`
 		GiteaOauth   GiteaOauthCfg   `ini:"oauth.gitea"`
 		GenericOauth GenericOauthCfg `ini:"oauth.generic"`
+		LDAP         LDAPCfg         `ini:"ldap"`
+
+		// GenericOauths are any more generic OAuth providers, in the order
+		// they're configured.
+		GenericOauths []NamedGenericOauthCfg `ini:"-"`
 	}
 )
 
@@ -205,6 +335,8 @@ func New() *Config {
 			MaxBlogs:       1,
 			Federation:     true,
 			PublicStats:    true,
+
+			DeletionGraceDays: 30,
 		},
 	}
 	c.UseMySQL(true)
@@ -220,6 +352,15 @@ func (cfg *Config) UseMySQL(fresh bool) {
 	}
 }
 
+// UsePostgres resets the Config's Database to use default values for a PostgreSQL setup.
+func (cfg *Config) UsePostgres(fresh bool) {
+	cfg.Database.Type = "postgres"
+	if fresh {
+		cfg.Database.Host = "localhost"
+		cfg.Database.Port = 5432
+	}
+}
+
 // UseSQLite resets the Config's Database to use default values for a SQLite setup.
 func (cfg *Config) UseSQLite(fresh bool) {
 	cfg.Database.Type = "sqlite3"
@@ -245,6 +386,31 @@ func (lc EmailCfg) Enabled() bool {
 	return lc.Domain != "" && lc.MailgunPrivate != ""
 }
 
+// EventsEnabled returns whether or not delivery events (bounces, complaints,
+// etc.) can be received from the mail provider.
+func (lc EmailCfg) EventsEnabled() bool {
+	return lc.Enabled() && lc.WebhookSigningKey != ""
+}
+
+// InboundEnabled returns whether or not the instance can receive email, either
+// via the built-in SMTP listener or the inbound webhook.
+func (lc EmailCfg) InboundEnabled() bool {
+	return lc.InboundSMTPBind != "" || lc.InboundWebhookKey != ""
+}
+
+// InboundHost returns the domain that inbound addresses are generated on.
+func (lc EmailCfg) InboundHost() string {
+	if lc.InboundDomain != "" {
+		return lc.InboundDomain
+	}
+	return lc.Domain
+}
+
+// Enabled returns whether or not users can log in with LDAP accounts.
+func (lc LDAPCfg) Enabled() bool {
+	return lc.URL != ""
+}
+
 func (ac AppCfg) SignupPath() string {
 	if !ac.OpenRegistration {
 		return ""
@@ -271,6 +437,10 @@ func Load(fname string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	uc.GenericOauths, err = loadGenericOauths(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	// Do any transformations
 	u, err := url.Parse(uc.App.Host)
@@ -298,8 +468,67 @@ func Save(uc *Config, fname string) error {
 		return err
 	}
 
+	for _, p := range uc.GenericOauths {
+		// Reflect each provider on its own, so its keys aren't mistaken for
+		// the [oauth.generic] keys they'd otherwise fall back to.
+		own, err := ini.Empty().NewSection(genericOauthSectionPrefix + p.Name)
+		if err != nil {
+			return err
+		}
+		if err = own.ReflectFrom(&p.GenericOauthCfg); err != nil {
+			return err
+		}
+		sec, err := cfg.NewSection(own.Name())
+		if err != nil {
+			return err
+		}
+		if err = copyKeys(sec, own); err != nil {
+			return err
+		}
+	}
+
 	if fname == "" {
 		fname = FileName
 	}
 	return cfg.SaveTo(fname)
 }
+
+func loadGenericOauths(cfg *ini.File) ([]NamedGenericOauthCfg, error) {
+	var providers []NamedGenericOauthCfg
+	for _, sec := range cfg.Sections() {
+		if !strings.HasPrefix(sec.Name(), genericOauthSectionPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(sec.Name(), genericOauthSectionPrefix)
+		if !genericOauthName.MatchString(name) {
+			return nil, fmt.Errorf("[%s]: OAuth provider names can only have up to 16 lowercase letters, numbers, dashes and underscores", sec.Name())
+		}
+
+		// Child sections fall back to their parent's keys, but this provider
+		// shouldn't get any of the [oauth.generic] provider's settings.
+		own, err := ini.Empty().NewSection(sec.Name())
+		if err != nil {
+			return nil, err
+		}
+		if err = copyKeys(own, sec); err != nil {
+			return nil, err
+		}
+		p := NamedGenericOauthCfg{Name: name}
+		if err = own.MapTo(&p.GenericOauthCfg); err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+// copyKeys copies the keys set in one section, and not any it falls back to,
+// into another.
+func copyKeys(to, from *ini.Section) error {
+	for _, k := range from.Keys() {
+		if _, err := to.NewKey(k.Name(), k.Value()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
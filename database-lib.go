@@ -16,6 +16,8 @@
 
 package writefreely
 
+import "errors"
+
 func (db *datastore) isDuplicateKeyErr(err error) bool {
 	return false
 }
@@ -27,3 +29,7 @@ func (db *datastore) isIgnorableError(err error) bool {
 func (db *datastore) isHighLoadError(err error) bool {
 	return false
 }
+
+func (db *datastore) backupSQLite(path string) error {
+	return errors.New("SQLite backups aren't supported")
+}
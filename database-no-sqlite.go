@@ -14,6 +14,8 @@
 package writefreely
 
 import (
+	"errors"
+
 	"github.com/go-sql-driver/mysql"
 	"github.com/writeas/web-core/log"
 )
@@ -23,6 +25,8 @@ func (db *datastore) isDuplicateKeyErr(err error) bool {
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
 			return mysqlErr.Number == mySQLErrDuplicateKey
 		}
+	} else if db.driverName == driverPostgres {
+		return pgErrorCode(err) == pgErrDuplicateKey
 	} else {
 		log.Error("isDuplicateKeyErr: failed check for unrecognized driver '%s'", db.driverName)
 	}
@@ -35,6 +39,8 @@ func (db *datastore) isIgnorableError(err error) bool {
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
 			return mysqlErr.Number == mySQLErrCollationMix
 		}
+	} else if db.driverName == driverPostgres {
+		return false
 	} else {
 		log.Error("isIgnorableError: failed check for unrecognized driver '%s'", db.driverName)
 	}
@@ -47,7 +53,13 @@ func (db *datastore) isHighLoadError(err error) bool {
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
 			return mysqlErr.Number == mySQLErrMaxUserConns || mysqlErr.Number == mySQLErrTooManyConns
 		}
+	} else if db.driverName == driverPostgres {
+		return pgErrorCode(err) == pgErrTooManyConns
 	}
 
 	return false
 }
+
+func (db *datastore) backupSQLite(path string) error {
+	return errors.New("binary wasn't compiled with SQLite3 support")
+}
@@ -0,0 +1,259 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	pgErrDuplicateKey = "23505"
+	pgErrTooManyConns = "53300"
+)
+
+// pgSerialTables are the tables with an auto-incrementing id column. Postgres
+// doesn't report the last inserted ID, so inserts into these tables return it
+// instead.
+var pgSerialTables = map[string]bool{
+	"collections":   true,
+	"emailsends":    true,
+	"letters":       true,
+	"notifications": true,
+	"publishjobs":   true,
+	"remoteusers":   true,
+	"users":         true,
+}
+
+var pgInsertReg = regexp.MustCompile(`(?i)^\s*INSERT\s+INTO\s+([a-z_]+)`)
+
+func init() {
+	sql.Register("postgres_with_placeholders", &pgDriver{})
+}
+
+// pgDriver wraps lib/pq so that the rest of the app can use the same queries
+// it uses with MySQL and SQLite. It rewrites ? placeholders into Postgres'
+// numbered ones, stores booleans as 0 or 1 like the other databases do, and
+// makes LastInsertId work for inserts into tables with serial IDs.
+type pgDriver struct{}
+
+type pgConn interface {
+	driver.Conn
+	driver.ConnPrepareContext
+	driver.ConnBeginTx
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+}
+
+type pgWrappedConn struct {
+	pgConn
+}
+
+type pgStmt struct {
+	driver.Stmt
+	returnsID bool
+}
+
+type pgResult struct {
+	id       int64
+	affected int64
+}
+
+func (d *pgDriver) Open(name string) (driver.Conn, error) {
+	c, err := pq.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	pc, ok := c.(pgConn)
+	if !ok {
+		c.Close()
+		return nil, errors.New("unsupported postgres connection")
+	}
+	return &pgWrappedConn{pc}, nil
+}
+
+func (c *pgWrappedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *pgWrappedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	query, returnsID := pgQuery(query)
+	s, err := c.pgConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &pgStmt{s, returnsID}, nil
+}
+
+func (c *pgWrappedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	query, returnsID := pgQuery(query)
+	args = pgArgs(args)
+	if !returnsID {
+		return c.pgConn.ExecContext(ctx, query, args)
+	}
+	rows, err := c.pgConn.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return pgInsertResult(rows)
+}
+
+func (c *pgWrappedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	query, _ = pgQuery(query)
+	return c.pgConn.QueryContext(ctx, query, pgArgs(args))
+}
+
+func (c *pgWrappedConn) ResetSession(ctx context.Context) error {
+	if sr, ok := c.pgConn.(driver.SessionResetter); ok {
+		return sr.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *pgWrappedConn) IsValid() bool {
+	if v, ok := c.pgConn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (s *pgStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), pgNamedValues(args))
+}
+
+func (s *pgStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), pgNamedValues(args))
+}
+
+func (s *pgStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	args = pgArgs(args)
+	if !s.returnsID {
+		return s.Stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+	}
+	rows, err := s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return pgInsertResult(rows)
+}
+
+func (s *pgStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, pgArgs(args))
+}
+
+func (r pgResult) LastInsertId() (int64, error) {
+	return r.id, nil
+}
+
+func (r pgResult) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
+
+// pgInsertResult reads the IDs returned by an insert.
+func pgInsertResult(rows driver.Rows) (driver.Result, error) {
+	defer rows.Close()
+	res := pgResult{}
+	dest := make([]driver.Value, len(rows.Columns()))
+	for {
+		err := rows.Next(dest)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if id, ok := dest[0].(int64); ok {
+			res.id = id
+		}
+		res.affected++
+	}
+	return res, nil
+}
+
+// pgQuery converts the given query into one Postgres understands, also
+// returning whether it was changed to return the ID of an inserted row.
+func pgQuery(query string) (string, bool) {
+	query = pgRebind(query)
+	m := pgInsertReg.FindStringSubmatch(query)
+	if m == nil || !pgSerialTables[strings.ToLower(m[1])] || strings.Contains(strings.ToUpper(query), "RETURNING") {
+		return query, false
+	}
+	return strings.TrimRight(strings.TrimSpace(query), ";") + " RETURNING id", true
+}
+
+// pgRebind replaces ? placeholders outside of quoted strings and identifiers
+// with numbered $1, $2, ... placeholders.
+func pgRebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// pgArgs stores booleans as integers, since boolean columns are SMALLINTs in
+// our Postgres schema, just as they're TINYINTs in MySQL.
+func pgArgs(args []driver.NamedValue) []driver.NamedValue {
+	for i := range args {
+		if v, ok := args[i].Value.(bool); ok {
+			if v {
+				args[i].Value = int64(1)
+			} else {
+				args[i].Value = int64(0)
+			}
+		}
+	}
+	return args
+}
+
+func pgNamedValues(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return nv
+}
+
+func pgErrorCode(err error) string {
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		return string(pgErr.Code)
+	}
+	return ""
+}
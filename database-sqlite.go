@@ -14,7 +14,9 @@
 package writefreely
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"github.com/go-sql-driver/mysql"
 	"github.com/mattn/go-sqlite3"
 	"github.com/writeas/web-core/log"
@@ -43,6 +45,8 @@ func (db *datastore) isDuplicateKeyErr(err error) bool {
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
 			return mysqlErr.Number == mySQLErrDuplicateKey
 		}
+	} else if db.driverName == driverPostgres {
+		return pgErrorCode(err) == pgErrDuplicateKey
 	} else {
 		log.Error("isDuplicateKeyErr: failed check for unrecognized driver '%s'", db.driverName)
 	}
@@ -55,6 +59,8 @@ func (db *datastore) isIgnorableError(err error) bool {
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
 			return mysqlErr.Number == mySQLErrCollationMix
 		}
+	} else if db.driverName == driverPostgres {
+		return false
 	} else {
 		log.Error("isIgnorableError: failed check for unrecognized driver '%s'", db.driverName)
 	}
@@ -67,7 +73,56 @@ func (db *datastore) isHighLoadError(err error) bool {
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
 			return mysqlErr.Number == mySQLErrMaxUserConns || mysqlErr.Number == mySQLErrTooManyConns
 		}
+	} else if db.driverName == driverPostgres {
+		return pgErrorCode(err) == pgErrTooManyConns
 	}
 
 	return false
 }
+
+// backupSQLite copies the SQLite database to a new file at the given path with
+// SQLite's online backup API, so the copy is consistent even while the
+// database is in use.
+func (db *datastore) backupSQLite(path string) error {
+	ctx := context.Background()
+	destDB, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	return destConn.Raw(func(dc interface{}) error {
+		return srcConn.Raw(func(sc interface{}) error {
+			destSQLite, ok := dc.(*sqlite3.SQLiteConn)
+			srcSQLite, ok2 := sc.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("not a SQLite connection")
+			}
+			b, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			done, err := b.Step(-1)
+			if err != nil {
+				b.Finish()
+				return err
+			}
+			if !done {
+				b.Finish()
+				return errors.New("backup didn't finish")
+			}
+			return b.Finish()
+		})
+	})
+}
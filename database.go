@@ -14,6 +14,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"html/template"
 	"net/http"
 	"net/url"
 	"strings"
@@ -46,8 +47,9 @@ const (
 	mySQLErrTooManyConns = 1040
 	mySQLErrMaxUserConns = 1203
 
-	driverMySQL  = "mysql"
-	driverSQLite = "sqlite3"
+	driverMySQL    = "mysql"
+	driverSQLite   = "sqlite3"
+	driverPostgres = "postgres"
 )
 
 var (
@@ -71,7 +73,12 @@ type writestore interface {
 	GetAccessToken(userID int64) (string, error)
 	GetTemporaryAccessToken(userID int64, validSecs int) (string, error)
 	GetTemporaryOneTimeAccessToken(userID int64, validSecs int, oneTime bool) (string, error)
+	GetClientAccessToken(userID int64, userAgent, ip string) (string, error)
 	DeleteAccount(userID int64) error
+	ScheduleAccountDeletion(userID int64, days int) error
+	CancelAccountDeletion(userID int64) error
+	GetAccountDeletionTime(userID int64) *time.Time
+	GetAccountsToPurge() ([]int64, error)
 	ChangeSettings(app *App, u *User, s *userSettings) error
 	ChangePassphrase(userID int64, sudo bool, curPass string, hashedPass []byte) error
 
@@ -123,6 +130,10 @@ type writestore interface {
 	GetAPFollowers(c *Collection) (*[]RemoteUser, error)
 	GetAPActorKeys(collectionID int64) ([]byte, []byte)
 	CreateUserInvite(id string, userID int64, maxUses int, expires *time.Time) error
+	CreateLabeledUserInvite(id string, userID int64, maxUses int, expires *time.Time, label string, email zero.String) error
+	GetAllInvites() ([]Invite, error)
+	GetInvitedUsers(id string) ([]User, error)
+	RevokeUserInvite(id string) error
 	GetUserInvites(userID int64) (*[]Invite, error)
 	GetUserInvite(id string) (*Invite, error)
 	GetUsersInvitedCount(id string) int64
@@ -132,6 +143,10 @@ type writestore interface {
 	UpdateDynamicContent(id, title, content, contentType string) error
 	GetAllUsers(page uint) (*[]User, error)
 	GetAllUsersCount() int64
+	GetPendingUsers() ([]pendingUser, error)
+	GetSignupBlocks() ([]signupBlock, error)
+	AddSignupBlock(kind, value string) error
+	RemoveSignupBlock(kind, value string) error
 	GetUserLastPostTime(id int64) (*time.Time, error)
 	GetCollectionLastPostTime(id int64) (*time.Time, error)
 
@@ -167,7 +182,7 @@ func (db *datastore) clip(field string, l int) string {
 }
 
 func (db *datastore) upsert(indexedCols ...string) string {
-	if db.driverName == driverSQLite {
+	if db.driverName == driverSQLite || db.driverName == driverPostgres {
 		// NOTE: SQLite UPSERT syntax only works in v3.24.0 (2018-06-04) or later
 		// Leaving this for whenever we can upgrade and include it in our binary
 		cc := strings.Join(indexedCols, ", ")
@@ -179,6 +194,8 @@ func (db *datastore) upsert(indexedCols ...string) string {
 func (db *datastore) dateAdd(l int, unit string) string {
 	if db.driverName == driverSQLite {
 		return fmt.Sprintf("DATETIME('now', '%d %s')", l, unit)
+	} else if db.driverName == driverPostgres {
+		return fmt.Sprintf("(NOW() + INTERVAL '%d %s')", l, unit)
 	}
 	return fmt.Sprintf("DATE_ADD(NOW(), INTERVAL %d %s)", l, unit)
 }
@@ -186,15 +203,30 @@ func (db *datastore) dateAdd(l int, unit string) string {
 func (db *datastore) dateSub(l int, unit string) string {
 	if db.driverName == driverSQLite {
 		return fmt.Sprintf("DATETIME('now', '-%d %s')", l, unit)
+	} else if db.driverName == driverPostgres {
+		return fmt.Sprintf("(NOW() - INTERVAL '%d %s')", l, unit)
 	}
 	return fmt.Sprintf("DATE_SUB(NOW(), INTERVAL %d %s)", l, unit)
 }
 
+// ignoreDuplicates returns a clause that makes an INSERT skip rows that would
+// violate a unique constraint, for databases where that error would otherwise
+// abort the whole transaction. Callers should still check isDuplicateKeyErr.
+func (db *datastore) ignoreDuplicates() string {
+	if db.driverName == driverPostgres {
+		return " ON CONFLICT DO NOTHING"
+	}
+	return ""
+}
+
 // CreateUser creates a new user in the database from the given User, UPDATING it in the process with the user's ID.
 func (db *datastore) CreateUser(cfg *config.Config, u *User, collectionTitle string, collectionDesc string) error {
 	if db.PostIDExists(u.Username) {
 		return impart.HTTPError{http.StatusConflict, "Invalid collection name."}
 	}
+	if db.IsUsernameReserved(u.Username, 0) {
+		return impart.HTTPError{http.StatusConflict, "Username is already taken."}
+	}
 
 	// New users get a `users` and `collections` row.
 	t, err := db.Begin()
@@ -204,7 +236,7 @@ func (db *datastore) CreateUser(cfg *config.Config, u *User, collectionTitle str
 
 	// 1. Add to `users` table
 	// NOTE: Assumes User's Password is already hashed!
-	res, err := t.Exec("INSERT INTO users (username, password, email) VALUES (?, ?, ?)", u.Username, u.HashedPass, u.Email)
+	res, err := t.Exec("INSERT INTO users (username, password, email, status) VALUES (?, ?, ?, ?)", u.Username, u.HashedPass, u.Email, u.Status)
 	if err != nil {
 		t.Rollback()
 		if db.isDuplicateKeyErr(err) {
@@ -294,6 +326,9 @@ func (db *datastore) CreateCollection(cfg *config.Config, alias, title string, u
 	if db.PostIDExists(alias) {
 		return nil, impart.HTTPError{http.StatusConflict, "Invalid collection name."}
 	}
+	if db.IsUsernameReserved(alias, userID) {
+		return nil, impart.HTTPError{http.StatusConflict, "Collection already exists."}
+	}
 
 	// All good, so create new collection
 	res, err := db.Exec("INSERT INTO collections (alias, title, description, privacy, owner_id, view_count) VALUES (?, ?, ?, ?, ?, ?)", alias, title, "", defaultVisibility(cfg), userID, 0)
@@ -333,9 +368,24 @@ func (db *datastore) GetUserByID(id int64) (*User, error) {
 		return nil, err
 	}
 
+	u.Admin = db.IsUserAdmin(u.ID)
 	return u, nil
 }
 
+// IsUserAdmin returns whether the user with the given ID is an admin.
+func (db *datastore) IsUserAdmin(id int64) bool {
+	return id == 1 || db.GetUserAttribute(id, userAttrAdmin) == "1"
+}
+
+// SetUserAdmin makes the user with the given ID an admin, or takes admin
+// away. The instance's first user stays an admin regardless.
+func (db *datastore) SetUserAdmin(id int64, admin bool) error {
+	if admin {
+		return db.SetUserAttribute(id, userAttrAdmin, "1")
+	}
+	return db.DeleteUserAttribute(id, userAttrAdmin)
+}
+
 // IsUserSilenced returns true if the user account associated with id is
 // currently silenced.
 func (db *datastore) IsUserSilenced(id int64) (bool, error) {
@@ -353,6 +403,33 @@ func (db *datastore) IsUserSilenced(id int64) (bool, error) {
 	return u.IsSilenced(), nil
 }
 
+// IsUserHidden returns whether the blogs and posts of the user with the given
+// ID are hidden from everyone else and don't federate, because the user is
+// silenced or their account is waiting to be deleted.
+func (db *datastore) IsUserHidden(id int64) (bool, error) {
+	var status UserStatus
+	err := db.QueryRow("SELECT status FROM users WHERE id = ?", id).Scan(&status)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, ErrUserNotFound
+	case err != nil:
+		log.Error("Couldn't SELECT user status: %v", err)
+		return false, fmt.Errorf("is user hidden: %v", err)
+	}
+	return status&(UserSilenced|UserDeleting) != 0, nil
+}
+
+// IsUserPending returns whether the user with the given ID is waiting for an
+// admin to approve their registration.
+func (db *datastore) IsUserPending(id int64) bool {
+	var status UserStatus
+	err := db.QueryRow("SELECT status FROM users WHERE id = ?", id).Scan(&status)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error("Couldn't SELECT user status: %v", err)
+	}
+	return status&UserPending != 0
+}
+
 // DoesUserNeedAuth returns true if the user hasn't provided any methods for
 // authenticating with the account, such a passphrase or email address.
 // Any errors are reported to admin and silently quashed, returning false as the
@@ -409,6 +486,7 @@ func (db *datastore) GetUserForAuth(username string) (*User, error) {
 		return nil, err
 	}
 
+	u.Admin = db.IsUserAdmin(u.ID)
 	return u, nil
 }
 
@@ -424,6 +502,7 @@ func (db *datastore) GetUserForAuthByID(userID int64) (*User, error) {
 		return nil, err
 	}
 
+	u.Admin = db.IsUserAdmin(u.ID)
 	return u, nil
 }
 
@@ -446,6 +525,8 @@ func (db *datastore) GetUserNameFromToken(accessToken string) (string, error) {
 	// Delete token if it was one-time
 	if oneTime {
 		db.DeleteToken(t[:])
+	} else {
+		db.touchAccessToken(t)
 	}
 
 	return username, nil
@@ -471,6 +552,8 @@ func (db *datastore) GetUserDataFromToken(accessToken string) (int64, string, er
 	// Delete token if it was one-time
 	if oneTime {
 		db.DeleteToken(t[:])
+	} else {
+		db.touchAccessToken(t)
 	}
 
 	return userID, username, nil
@@ -510,11 +593,21 @@ func (db *datastore) GetUserIDPrivilege(accessToken string) (userID int64, sudo
 	// Delete token if it was one-time
 	if oneTime {
 		db.DeleteToken(t[:])
+	} else {
+		db.touchAccessToken(t)
 	}
 
 	return
 }
 
+// touchAccessToken updates when the given access token was last used.
+func (db *datastore) touchAccessToken(accessToken []byte) {
+	_, err := db.Exec("UPDATE accesstokens SET last_used = "+db.now()+" WHERE token LIKE ? AND (last_used IS NULL OR last_used < "+db.dateSub(sessionTouchMins, "MINUTE")+")", accessToken)
+	if err != nil {
+		log.Error("Couldn't UPDATE accesstoken: %v", err)
+	}
+}
+
 func (db *datastore) DeleteToken(accessToken []byte) error {
 	res, err := db.Exec("DELETE FROM accesstokens WHERE token LIKE ?", accessToken)
 	if err != nil {
@@ -565,6 +658,26 @@ func (db *datastore) GetTemporaryAccessToken(userID int64, validSecs int) (strin
 // once if oneTime is true. If validSecs is 0, the access token doesn't
 // automatically expire.
 func (db *datastore) GetTemporaryOneTimeAccessToken(userID int64, validSecs int, oneTime bool) (string, error) {
+	return db.createAccessToken(userID, accessTokenOpts{validSecs: validSecs, oneTime: oneTime})
+}
+
+// GetClientAccessToken creates a new non-expiring, valid access token for the
+// given userID, recording the user agent and IP address it was created for.
+func (db *datastore) GetClientAccessToken(userID int64, userAgent, ip string) (string, error) {
+	return db.createAccessToken(userID, accessTokenOpts{userAgent: userAgent, ip: ip})
+}
+
+// accessTokenOpts describes an access token to create. Tokens without scopes
+// have full access to the account.
+type accessTokenOpts struct {
+	validSecs     int
+	oneTime       bool
+	userAgent, ip string
+	name          string
+	scopes        []tokenScope
+}
+
+func (db *datastore) createAccessToken(userID int64, opts accessTokenOpts) (string, error) {
 	u, err := uuid.NewV4()
 	if err != nil {
 		log.Error("Unable to generate token: %v", err)
@@ -575,11 +688,11 @@ func (db *datastore) GetTemporaryOneTimeAccessToken(userID int64, validSecs int,
 	binTok := u[:]
 
 	expirationVal := "NULL"
-	if validSecs > 0 {
-		expirationVal = db.dateAdd(validSecs, "SECOND")
+	if opts.validSecs > 0 {
+		expirationVal = db.dateAdd(opts.validSecs, "SECOND")
 	}
 
-	_, err = db.Exec("INSERT INTO accesstokens (token, user_id, one_time, expires) VALUES (?, ?, ?, "+expirationVal+")", string(binTok), userID, oneTime)
+	_, err = db.Exec("INSERT INTO accesstokens (token, user_id, one_time, expires, user_agent, ip, name, scopes) VALUES (?, ?, ?, "+expirationVal+", ?, ?, ?, ?)", string(binTok), userID, opts.oneTime, zero.StringFrom(clipString(opts.userAgent, 255)), zero.StringFrom(clipString(opts.ip, 45)), zero.StringFrom(clipString(opts.name, 100)), zero.StringFrom(joinScopes(opts.scopes)))
 	if err != nil {
 		log.Error("Couldn't INSERT accesstoken: %v", err)
 		return "", err
@@ -619,6 +732,58 @@ func (db *datastore) ConsumePasswordResetToken(t string) error {
 	return nil
 }
 
+// IsUserEmailVerified returns whether the user with the given ID proved they
+// own their email address.
+func (db *datastore) IsUserEmailVerified(userID int64) bool {
+	var verified bool
+	err := db.QueryRow("SELECT email_verified FROM users WHERE id = ?", userID).Scan(&verified)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error("Couldn't SELECT email_verified: %v", err)
+	}
+	return verified
+}
+
+// SetUserEmailVerified marks whether the user with the given ID owns their
+// email address, discarding any verification links already sent.
+func (db *datastore) SetUserEmailVerified(userID int64, verified bool) error {
+	v := 0
+	if verified {
+		v = 1
+	}
+	_, err := db.Exec("UPDATE users SET email_verified = ? WHERE id = ?", v, userID)
+	if err != nil {
+		log.Error("Couldn't UPDATE email_verified: %v", err)
+		return err
+	}
+	_, err = db.Exec("DELETE FROM emailverifications WHERE user_id = ?", userID)
+	if err != nil {
+		log.Error("Couldn't DELETE emailverifications: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (db *datastore) CreateEmailVerificationToken(userID int64) (string, error) {
+	t := id.Generate62RandomString(32)
+
+	_, err := db.Exec("INSERT INTO emailverifications (user_id, token, created) VALUES (?, ?, "+db.now()+")", userID, t)
+	if err != nil {
+		log.Error("Couldn't INSERT emailverifications: %v", err)
+		return "", err
+	}
+
+	return t, nil
+}
+
+func (db *datastore) GetUserFromEmailVerification(token string) int64 {
+	var userID int64
+	err := db.QueryRow("SELECT user_id FROM emailverifications WHERE token = ? AND created > "+db.dateSub(emailVerificationHours, "HOUR"), token).Scan(&userID)
+	if err != nil {
+		return 0
+	}
+	return userID
+}
+
 func (db *datastore) CreateOwnedPost(post *SubmittedPost, accessToken, collAlias, hostName string) (*PublicPost, error) {
 	var userID, collID int64 = -1, -1
 	var coll *Collection
@@ -902,6 +1067,19 @@ func (db *datastore) UpdateCollection(app *App, c *SubmittedCollection, alias st
 	if c.Description != nil {
 		*c.Description = parse.Truncate(*c.Description, collMaxLengthDescription)
 	}
+	// Reject broken letter templates before anything is saved
+	if c.LetterHTML != nil || c.LetterText != nil {
+		var html, text string
+		if c.LetterHTML != nil {
+			html = *c.LetterHTML
+		}
+		if c.LetterText != nil {
+			text = *c.LetterText
+		}
+		if err := validateLetterTemplates(html, text); err != nil {
+			return err
+		}
+	}
 
 	q := query.NewUpdate().
 		SetStringPtr(c.Title, "title").
@@ -1056,6 +1234,32 @@ func (db *datastore) UpdateCollection(app *App, c *SubmittedCollection, alias st
 		}
 	}
 
+	// Update letter templates
+	if c.LetterHTML != nil || c.LetterText != nil {
+		var ownedID int64
+		err = db.QueryRow("SELECT id FROM collections WHERE alias = ? AND owner_id = ?", alias, c.OwnerID).Scan(&ownedID)
+		if err == nil {
+			lt, err := db.GetLetterTemplate(ownedID)
+			if err != nil {
+				return err
+			}
+			html, text := "", ""
+			if lt != nil {
+				html, text = lt.HTML, lt.Text
+			}
+			if c.LetterHTML != nil {
+				html = *c.LetterHTML
+			}
+			if c.LetterText != nil {
+				text = *c.LetterText
+			}
+			err = db.UpdateLetterTemplate(ownedID, html, text)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	// Update rest of the collection data
 	if q.Updates != "" {
 		res, err = db.Exec("UPDATE collections SET "+q.Updates+" WHERE "+q.Conditions, q.Params...)
@@ -1279,7 +1483,7 @@ func (db *datastore) GetPosts(cfg *config.Config, c *Collection, page int, inclu
 
 	limitStr := ""
 	if page > 0 {
-		limitStr = fmt.Sprintf(" LIMIT %d, %d", start, pagePosts)
+		limitStr = fmt.Sprintf(" LIMIT %d OFFSET %d", pagePosts, start)
 	}
 	timeCondition := ""
 	if !includeFuture {
@@ -1336,6 +1540,8 @@ func (db *datastore) GetAllPostsTaggedIDs(c *Collection, tag string, includeFutu
 	var err error
 	if db.driverName == driverSQLite {
 		rows, err = db.Query("SELECT id FROM posts WHERE collection_id = ? AND LOWER(content) regexp ? "+timeCondition+" ORDER BY created "+order, collID, `.*#`+strings.ToLower(tag)+`\b.*`)
+	} else if db.driverName == driverPostgres {
+		rows, err = db.Query("SELECT id FROM posts WHERE collection_id = ? AND LOWER(content) ~ ? "+timeCondition+" ORDER BY created "+order, collID, "#"+strings.ToLower(tag)+`\y`)
 	} else {
 		rows, err = db.Query("SELECT id FROM posts WHERE collection_id = ? AND LOWER(content) RLIKE ? "+timeCondition+" ORDER BY created "+order, collID, "#"+strings.ToLower(tag)+"[[:>:]]")
 	}
@@ -1386,7 +1592,7 @@ func (db *datastore) GetPostsTagged(cfg *config.Config, c *Collection, tag strin
 
 	limitStr := ""
 	if page > 0 {
-		limitStr = fmt.Sprintf(" LIMIT %d, %d", start, pagePosts)
+		limitStr = fmt.Sprintf(" LIMIT %d OFFSET %d", pagePosts, start)
 	}
 	timeCondition := ""
 	if !includeFuture {
@@ -1397,6 +1603,8 @@ func (db *datastore) GetPostsTagged(cfg *config.Config, c *Collection, tag strin
 	var err error
 	if db.driverName == driverSQLite {
 		rows, err = db.Query("SELECT "+postCols+" FROM posts WHERE collection_id = ? AND LOWER(content) regexp ? "+timeCondition+" ORDER BY created "+order+limitStr, collID, `.*#`+strings.ToLower(tag)+`\b.*`)
+	} else if db.driverName == driverPostgres {
+		rows, err = db.Query("SELECT "+postCols+" FROM posts WHERE collection_id = ? AND LOWER(content) ~ ? "+timeCondition+" ORDER BY created "+order+limitStr, collID, "#"+strings.ToLower(tag)+`\y`)
 	} else {
 		rows, err = db.Query("SELECT "+postCols+" FROM posts WHERE collection_id = ? AND LOWER(content) RLIKE ? "+timeCondition+" ORDER BY created "+order+limitStr, collID, "#"+strings.ToLower(tag)+"[[:>:]]")
 	}
@@ -1457,7 +1665,7 @@ func (db *datastore) GetLangPosts(cfg *config.Config, c *Collection, lang string
 
 	limitStr := ""
 	if page > 0 {
-		limitStr = fmt.Sprintf(" LIMIT %d, %d", start, pagePosts)
+		limitStr = fmt.Sprintf(" LIMIT %d OFFSET %d", pagePosts, start)
 	}
 	timeCondition := ""
 	if !includeFuture {
@@ -2068,7 +2276,7 @@ func (db *datastore) GetAnonymousPosts(u *User, page int) (*[]PublicPost, error)
 
 	limitStr := ""
 	if page > 0 {
-		limitStr = fmt.Sprintf(" LIMIT %d, %d", start, pagePosts)
+		limitStr = fmt.Sprintf(" LIMIT %d OFFSET %d", pagePosts, start)
 	}
 	rows, err := db.Query("SELECT id, view_count, title, language, created, updated, content FROM posts WHERE owner_id = ? AND collection_id IS NULL ORDER BY created DESC"+limitStr, u.ID)
 	if err != nil {
@@ -2158,6 +2366,146 @@ func (db *datastore) GetUserPostsCount(userID int64) int64 {
 	return count
 }
 
+// ChangeUsername renames the given user and their default blog, leaving a
+// redirect from the old blog alias. It MODIFIES THE USER on success.
+func (db *datastore) ChangeUsername(app *App, u *User, reqName string) error {
+	newUsername, ie := getValidUsername(app, reqName, u.Username)
+	if ie != nil {
+		// Username is invalid
+		return *ie
+	}
+	if !author.IsValidUsername(app.cfg, newUsername) {
+		// Ensure the username is syntactically correct.
+		return impart.HTTPError{http.StatusPreconditionFailed, "Username isn't valid."}
+	}
+	if db.IsUsernameReserved(newUsername, u.ID) {
+		return impart.HTTPError{http.StatusConflict, "Username is already taken."}
+	}
+
+	t, err := db.Begin()
+	if err != nil {
+		log.Error("Couldn't start username change transaction: %v", err)
+		return err
+	}
+
+	_, err = t.Exec("UPDATE users SET username = ? WHERE id = ?", newUsername, u.ID)
+	if err != nil {
+		t.Rollback()
+		if db.isDuplicateKeyErr(err) {
+			return impart.HTTPError{http.StatusConflict, "Username is already taken."}
+		}
+		log.Error("Unable to update users table: %v", err)
+		return ErrInternalGeneral
+	}
+
+	_, err = t.Exec("UPDATE collections SET alias = ? WHERE alias = ? AND owner_id = ?", newUsername, u.Username, u.ID)
+	if err != nil {
+		t.Rollback()
+		if db.isDuplicateKeyErr(err) {
+			return impart.HTTPError{http.StatusConflict, "Username is already taken."}
+		}
+		log.Error("Unable to update collection: %v", err)
+		return ErrInternalGeneral
+	}
+
+	// Keep track of name changes for redirection
+	db.RemoveCollectionRedirect(t, newUsername)
+	_, err = t.Exec("UPDATE collectionredirects SET new_alias = ? WHERE new_alias = ?", newUsername, u.Username)
+	if err != nil {
+		log.Error("Unable to update collectionredirects: %v", err)
+	}
+	_, err = t.Exec("INSERT INTO collectionredirects (prev_alias, new_alias) VALUES (?, ?)", u.Username, newUsername)
+	if err != nil {
+		log.Error("Unable to add new collectionredirect: %v", err)
+	}
+
+	// Keep track of when, so the old handle keeps resolving for a while
+	_, err = t.Exec("INSERT INTO usernamechanges (user_id, prev_username, new_username, created) VALUES (?, ?, ?, "+db.now()+")", u.ID, u.Username, newUsername)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to add username change: %v", err)
+		return ErrInternalGeneral
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		log.Error("Rolling back after Commit(): %v\n", err)
+		return err
+	}
+
+	u.Username = newUsername
+	return nil
+}
+
+// GetRenamedUserID returns the ID of the user who changed their username from
+// the given one within the grace period, or 0 if nobody did.
+func (db *datastore) GetRenamedUserID(prevUsername string) int64 {
+	var userID int64
+	err := db.QueryRow("SELECT user_id FROM usernamechanges WHERE prev_username = ? AND created > "+db.dateSub(usernameGraceDays, "DAY")+" ORDER BY created DESC LIMIT 1", prevUsername).Scan(&userID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error("Failed selecting username change for %s: %v", prevUsername, err)
+	}
+	return userID
+}
+
+// GetPreviousAliases returns the usernames the given user has changed from
+// within the grace period that still redirect to the given blog, most recent
+// first.
+func (db *datastore) GetPreviousAliases(userID int64, alias string) []string {
+	rows, err := db.Query(`SELECT uc.prev_username
+	FROM usernamechanges uc
+	INNER JOIN collectionredirects cr ON cr.prev_alias = uc.prev_username
+	WHERE uc.user_id = ? AND cr.new_alias = ? AND uc.created > `+db.dateSub(usernameGraceDays, "DAY")+`
+	GROUP BY uc.prev_username
+	ORDER BY MAX(uc.created) DESC`, userID, alias)
+	if err != nil {
+		log.Error("Failed selecting previous aliases: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			log.Error("Failed scanning GetPreviousAliases() row: %v", err)
+			break
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// GetRenamedCollection returns the blog whose alias used to be the given
+// username, as long as it changed within the grace period.
+func (db *datastore) GetRenamedCollection(prevAlias string) (*Collection, error) {
+	userID := db.GetRenamedUserID(prevAlias)
+	if userID == 0 {
+		return nil, ErrCollectionNotFound
+	}
+	alias := db.GetCollectionRedirect(prevAlias)
+	if alias == "" {
+		return nil, ErrCollectionNotFound
+	}
+	c, err := db.GetCollection(alias)
+	if err != nil {
+		return nil, err
+	}
+	if c.OwnerID != userID {
+		return nil, ErrCollectionNotFound
+	}
+	return c, nil
+}
+
+// IsUsernameReserved returns whether the given name was recently given up by
+// someone other than the given user, and so can't be taken yet. Pass 0 as
+// the user ID for new accounts and blogs.
+func (db *datastore) IsUsernameReserved(name string, userID int64) bool {
+	renamedID := db.GetRenamedUserID(name)
+	return renamedID != 0 && renamedID != userID
+}
+
 // ChangeSettings takes a User and applies the changes in the given
 // userSettings, MODIFYING THE USER with successful changes.
 func (db *datastore) ChangeSettings(app *App, u *User, s *userSettings) error {
@@ -2183,64 +2531,10 @@ func (db *datastore) ChangeSettings(app *App, u *User, s *userSettings) error {
 	}
 
 	// Update username if given
-	var newUsername string
 	if s.Username != "" {
-		var ie *impart.HTTPError
-		newUsername, ie = getValidUsername(app, s.Username, u.Username)
-		if ie != nil {
-			// Username is invalid
-			return *ie
-		}
-		if !author.IsValidUsername(app.cfg, newUsername) {
-			// Ensure the username is syntactically correct.
-			return impart.HTTPError{http.StatusPreconditionFailed, "Username isn't valid."}
-		}
-
-		t, err := db.Begin()
-		if err != nil {
-			log.Error("Couldn't start username change transaction: %v", err)
-			return err
-		}
-
-		_, err = t.Exec("UPDATE users SET username = ? WHERE id = ?", newUsername, u.ID)
-		if err != nil {
-			t.Rollback()
-			if db.isDuplicateKeyErr(err) {
-				return impart.HTTPError{http.StatusConflict, "Username is already taken."}
-			}
-			log.Error("Unable to update users table: %v", err)
-			return ErrInternalGeneral
-		}
-
-		_, err = t.Exec("UPDATE collections SET alias = ? WHERE alias = ? AND owner_id = ?", newUsername, u.Username, u.ID)
-		if err != nil {
-			t.Rollback()
-			if db.isDuplicateKeyErr(err) {
-				return impart.HTTPError{http.StatusConflict, "Username is already taken."}
-			}
-			log.Error("Unable to update collection: %v", err)
-			return ErrInternalGeneral
-		}
-
-		// Keep track of name changes for redirection
-		db.RemoveCollectionRedirect(t, newUsername)
-		_, err = t.Exec("UPDATE collectionredirects SET new_alias = ? WHERE new_alias = ?", newUsername, u.Username)
-		if err != nil {
-			log.Error("Unable to update collectionredirects: %v", err)
-		}
-		_, err = t.Exec("INSERT INTO collectionredirects (prev_alias, new_alias) VALUES (?, ?)", u.Username, newUsername)
-		if err != nil {
-			log.Error("Unable to add new collectionredirect: %v", err)
-		}
-
-		err = t.Commit()
-		if err != nil {
-			t.Rollback()
-			log.Error("Rolling back after Commit(): %v\n", err)
+		if err := db.ChangeUsername(app, u, s.Username); err != nil {
 			return err
 		}
-
-		u.Username = newUsername
 	}
 
 	// Update passphrase if given
@@ -2409,6 +2703,13 @@ func (db *datastore) DeleteCollection(alias string, userID int64) error {
 		return err
 	}
 
+	// Remove any custom letter templates
+	_, err = t.Exec("DELETE FROM lettertemplates WHERE collection_id = ?", c.ID)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
 	// Finally, delete collection itself
 	_, err = t.Exec("DELETE FROM collections WHERE id = ?", c.ID)
 	if err != nil {
@@ -2473,44 +2774,229 @@ func (db *datastore) SetCollectionAttribute(id int64, attr, v string) error {
 	return nil
 }
 
-// DeleteAccount will delete the entire account for userID
-func (db *datastore) DeleteAccount(userID int64) error {
-	// Get all collections
-	rows, err := db.Query("SELECT id, alias FROM collections WHERE owner_id = ?", userID)
+func (db *datastore) GetUserAttribute(id int64, attr string) string {
+	var v string
+	err := db.QueryRow("SELECT value FROM userattributes WHERE user_id = ? AND attribute = ?", id, attr).Scan(&v)
+	switch {
+	case err == sql.ErrNoRows:
+		return ""
+	case err != nil:
+		log.Error("Couldn't SELECT value in getUserAttribute for attribute '%s': %v", attr, err)
+		return ""
+	}
+	return v
+}
+
+func (db *datastore) SetUserAttribute(id int64, attr, v string) error {
+	_, err := db.Exec("INSERT INTO userattributes (user_id, attribute, value) VALUES (?, ?, ?) "+db.upsert("user_id", "attribute")+" value = ?", id, attr, v, v)
 	if err != nil {
-		log.Error("Unable to get collections: %v", err)
+		log.Error("Unable to INSERT into userattributes: %v", err)
 		return err
 	}
-	defer rows.Close()
-	colls := []Collection{}
-	var c Collection
-	for rows.Next() {
-		err = rows.Scan(&c.ID, &c.Alias)
-		if err != nil {
-			log.Error("Unable to scan collection cols: %v", err)
-			return err
-		}
-		colls = append(colls, c)
+	return nil
+}
+
+func (db *datastore) DeleteUserAttribute(id int64, attr string) error {
+	_, err := db.Exec("DELETE FROM userattributes WHERE user_id = ? AND attribute = ?", id, attr)
+	if err != nil {
+		log.Error("Unable to DELETE from userattributes: %v", err)
+		return err
 	}
+	return nil
+}
 
-	// Start transaction
+func (db *datastore) DeleteCollectionAttribute(id int64, attr string) error {
+	_, err := db.Exec("DELETE FROM collectionattributes WHERE collection_id = ? AND attribute = ?", id, attr)
+	if err != nil {
+		log.Error("Unable to DELETE from collectionattributes: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetCollectionIDByAttribute returns the ID of the collection with the given
+// attribute set to the given value, or 0 if there isn't one.
+func (db *datastore) GetCollectionIDByAttribute(attr, v string) int64 {
+	var id int64
+	err := db.QueryRow("SELECT collection_id FROM collectionattributes WHERE attribute = ? AND value = ?", attr, v).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0
+	case err != nil:
+		log.Error("Couldn't SELECT collection_id in getCollectionIDByAttribute for attribute '%s': %v", attr, err)
+		return 0
+	}
+	return id
+}
+
+// GetUserIDByAttribute returns the ID of the user with the given attribute set
+// to the given value, or 0 if there isn't one.
+func (db *datastore) GetUserIDByAttribute(attr, v string) int64 {
+	var id int64
+	err := db.QueryRow("SELECT user_id FROM userattributes WHERE attribute = ? AND value = ?", attr, v).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0
+	case err != nil:
+		log.Error("Couldn't SELECT user_id in getUserIDByAttribute for attribute '%s': %v", attr, err)
+		return 0
+	}
+	return id
+}
+
+// ScheduleAccountDeletion hides the given user's account until it's purged
+// the given number of days from now, unless they log in and restore it first.
+func (db *datastore) ScheduleAccountDeletion(userID int64, days int) error {
 	t, err := db.Begin()
 	if err != nil {
 		log.Error("Unable to begin: %v", err)
 		return err
 	}
 
-	// Clean up all collection related information
-	var res sql.Result
-	for _, c := range colls {
-		// Delete tokens
-		res, err = t.Exec("DELETE FROM collectionattributes WHERE collection_id = ?", c.ID)
-		if err != nil {
-			t.Rollback()
-			log.Error("Unable to delete attributes on %s: %v", c.Alias, err)
-			return err
+	var status UserStatus
+	err = t.QueryRow("SELECT status FROM users WHERE id = ?", userID).Scan(&status)
+	if err != nil {
+		t.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
 		}
-		rs, _ := res.RowsAffected()
+		log.Error("Couldn't SELECT user status: %v", err)
+		return err
+	}
+	_, err = t.Exec("UPDATE users SET status = ? WHERE id = ?", status|UserDeleting, userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to mark user %d for deletion: %v", userID, err)
+		return err
+	}
+
+	_, err = t.Exec("DELETE FROM userdeletions WHERE user_id = ?", userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to clear scheduled deletion: %v", err)
+		return err
+	}
+	_, err = t.Exec("INSERT INTO userdeletions (user_id, created, purge_after) VALUES (?, "+db.now()+", "+db.dateAdd(days, "DAY")+")", userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to schedule deletion: %v", err)
+		return err
+	}
+
+	return t.Commit()
+}
+
+// CancelAccountDeletion restores an account that was waiting to be deleted.
+func (db *datastore) CancelAccountDeletion(userID int64) error {
+	t, err := db.Begin()
+	if err != nil {
+		log.Error("Unable to begin: %v", err)
+		return err
+	}
+
+	var status UserStatus
+	err = t.QueryRow("SELECT status FROM users WHERE id = ?", userID).Scan(&status)
+	if err != nil {
+		t.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		}
+		log.Error("Couldn't SELECT user status: %v", err)
+		return err
+	}
+	_, err = t.Exec("UPDATE users SET status = ? WHERE id = ?", status&^UserDeleting, userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to restore user %d: %v", userID, err)
+		return err
+	}
+
+	_, err = t.Exec("DELETE FROM userdeletions WHERE user_id = ?", userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to cancel scheduled deletion: %v", err)
+		return err
+	}
+
+	return t.Commit()
+}
+
+// GetAccountDeletionTime returns when the given user's account will be
+// purged, or nil if it isn't scheduled to be.
+func (db *datastore) GetAccountDeletionTime(userID int64) *time.Time {
+	var purgeAfter time.Time
+	err := db.QueryRow("SELECT purge_after FROM userdeletions WHERE user_id = ?", userID).Scan(&purgeAfter)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil
+	case err != nil:
+		log.Error("Couldn't SELECT scheduled deletion for user %d: %v", userID, err)
+		return nil
+	}
+	return &purgeAfter
+}
+
+// GetAccountsToPurge returns the IDs of users whose deletion grace period is
+// over.
+func (db *datastore) GetAccountsToPurge() ([]int64, error) {
+	rows, err := db.Query("SELECT user_id FROM userdeletions WHERE purge_after <= " + db.now())
+	if err != nil {
+		log.Error("Failed selecting from userdeletions: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			log.Error("Failed scanning GetAccountsToPurge() row: %v", err)
+			break
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// DeleteAccount will delete the entire account for userID
+func (db *datastore) DeleteAccount(userID int64) error {
+	// Get all collections
+	rows, err := db.Query("SELECT id, alias FROM collections WHERE owner_id = ?", userID)
+	if err != nil {
+		log.Error("Unable to get collections: %v", err)
+		return err
+	}
+	defer rows.Close()
+	colls := []Collection{}
+	var c Collection
+	for rows.Next() {
+		err = rows.Scan(&c.ID, &c.Alias)
+		if err != nil {
+			log.Error("Unable to scan collection cols: %v", err)
+			return err
+		}
+		colls = append(colls, c)
+	}
+
+	// Start transaction
+	t, err := db.Begin()
+	if err != nil {
+		log.Error("Unable to begin: %v", err)
+		return err
+	}
+
+	// Clean up all collection related information
+	var res sql.Result
+	for _, c := range colls {
+		// Delete tokens
+		res, err = t.Exec("DELETE FROM collectionattributes WHERE collection_id = ?", c.ID)
+		if err != nil {
+			t.Rollback()
+			log.Error("Unable to delete attributes on %s: %v", c.Alias, err)
+			return err
+		}
+		rs, _ := res.RowsAffected()
 		log.Info("Deleted %d for %s from collectionattributes", rs, c.Alias)
 
 		// Remove any optional collection password
@@ -2523,6 +3009,16 @@ func (db *datastore) DeleteAccount(userID int64) error {
 		rs, _ = res.RowsAffected()
 		log.Info("Deleted %d for %s from collectionpasswords", rs, c.Alias)
 
+		// Remove any custom letter templates
+		res, err = t.Exec("DELETE FROM lettertemplates WHERE collection_id = ?", c.ID)
+		if err != nil {
+			t.Rollback()
+			log.Error("Unable to delete letter templates on %s: %v", c.Alias, err)
+			return err
+		}
+		rs, _ = res.RowsAffected()
+		log.Info("Deleted %d for %s from lettertemplates", rs, c.Alias)
+
 		// Remove redirects to this collection
 		res, err = t.Exec("DELETE FROM collectionredirects WHERE new_alias = ?", c.Alias)
 		if err != nil {
@@ -2576,6 +3072,75 @@ func (db *datastore) DeleteAccount(userID int64) error {
 	rs, _ = res.RowsAffected()
 	log.Info("Deleted %d from accesstokens", rs)
 
+	// Delete sessions
+	res, err = t.Exec("DELETE FROM usersessions WHERE user_id = ?", userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to delete sessions: %v", err)
+		return err
+	}
+	rs, _ = res.RowsAffected()
+	log.Info("Deleted %d from usersessions", rs)
+
+	// Delete two-factor auth
+	res, err = t.Exec("DELETE FROM usertwofactor WHERE user_id = ?", userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to delete two-factor auth: %v", err)
+		return err
+	}
+	rs, _ = res.RowsAffected()
+	log.Info("Deleted %d from usertwofactor", rs)
+
+	res, err = t.Exec("DELETE FROM userrecoverycodes WHERE user_id = ?", userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to delete recovery codes: %v", err)
+		return err
+	}
+	rs, _ = res.RowsAffected()
+	log.Info("Deleted %d from userrecoverycodes", rs)
+
+	// Delete passkeys
+	res, err = t.Exec("DELETE FROM userpasskeys WHERE user_id = ?", userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to delete passkeys: %v", err)
+		return err
+	}
+	rs, _ = res.RowsAffected()
+	log.Info("Deleted %d from userpasskeys", rs)
+
+	// Delete username changes, freeing up any old names
+	res, err = t.Exec("DELETE FROM usernamechanges WHERE user_id = ?", userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to delete username changes: %v", err)
+		return err
+	}
+	rs, _ = res.RowsAffected()
+	log.Info("Deleted %d from usernamechanges", rs)
+
+	// Delete email verification links
+	res, err = t.Exec("DELETE FROM emailverifications WHERE user_id = ?", userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to delete email verifications: %v", err)
+		return err
+	}
+	rs, _ = res.RowsAffected()
+	log.Info("Deleted %d from emailverifications", rs)
+
+	// Delete any scheduled deletion, now that it's happening
+	res, err = t.Exec("DELETE FROM userdeletions WHERE user_id = ?", userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to delete scheduled deletion: %v", err)
+		return err
+	}
+	rs, _ = res.RowsAffected()
+	log.Info("Deleted %d from userdeletions", rs)
+
 	// Delete user attributes
 	res, err = t.Exec("DELETE FROM oauth_users WHERE user_id = ?", userID)
 	if err != nil {
@@ -2608,6 +3173,16 @@ func (db *datastore) DeleteAccount(userID int64) error {
 	rs, _ = res.RowsAffected()
 	log.Info("Deleted %d from userattributes", rs)
 
+	// Delete notifications
+	res, err = t.Exec("DELETE FROM notifications WHERE user_id = ?", userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to delete notifications: %v", err)
+		return err
+	}
+	rs, _ = res.RowsAffected()
+	log.Info("Deleted %d from notifications", rs)
+
 	// Delete user invites
 	res, err = t.Exec("DELETE FROM userinvites WHERE owner_id = ?", userID)
 	if err != nil {
@@ -2662,12 +3237,18 @@ func (db *datastore) GetAPActorKeys(collectionID int64) ([]byte, []byte) {
 }
 
 func (db *datastore) CreateUserInvite(id string, userID int64, maxUses int, expires *time.Time) error {
-	_, err := db.Exec("INSERT INTO userinvites (id, owner_id, max_uses, created, expires, inactive) VALUES (?, ?, ?, "+db.now()+", ?, 0)", id, userID, maxUses, expires)
+	return db.CreateLabeledUserInvite(id, userID, maxUses, expires, "", zero.String{})
+}
+
+// CreateLabeledUserInvite creates an invite with a label to tell it apart,
+// and the already encrypted email address it was sent to, if any.
+func (db *datastore) CreateLabeledUserInvite(id string, userID int64, maxUses int, expires *time.Time, label string, email zero.String) error {
+	_, err := db.Exec("INSERT INTO userinvites (id, owner_id, max_uses, created, expires, inactive, label, email) VALUES (?, ?, ?, "+db.now()+", ?, 0, ?, ?)", id, userID, maxUses, expires, zero.NewString(label, label != ""), email)
 	return err
 }
 
 func (db *datastore) GetUserInvites(userID int64) (*[]Invite, error) {
-	rows, err := db.Query("SELECT id, max_uses, created, expires, inactive FROM userinvites WHERE owner_id = ? ORDER BY created DESC", userID)
+	rows, err := db.Query("SELECT id, max_uses, created, expires, inactive, label, email FROM userinvites WHERE owner_id = ? ORDER BY created DESC", userID)
 	if err != nil {
 		log.Error("Failed selecting from userinvites: %v", err)
 		return nil, impart.HTTPError{http.StatusInternalServerError, "Couldn't retrieve user invites."}
@@ -2677,15 +3258,75 @@ func (db *datastore) GetUserInvites(userID int64) (*[]Invite, error) {
 	is := []Invite{}
 	for rows.Next() {
 		i := Invite{}
-		err = rows.Scan(&i.ID, &i.MaxUses, &i.Created, &i.Expires, &i.Inactive)
+		err = rows.Scan(&i.ID, &i.MaxUses, &i.Created, &i.Expires, &i.Inactive, &i.Label, &i.Email)
 		is = append(is, i)
 	}
 	return &is, nil
 }
 
+// GetAllInvites returns every user's invites, newest first, along with who
+// created them and how many times they've been used.
+func (db *datastore) GetAllInvites() ([]Invite, error) {
+	rows, err := db.Query(`SELECT i.id, i.max_uses, i.created, i.expires, i.inactive, i.label, i.email, u.username, (SELECT COUNT(*) FROM usersinvited ui WHERE ui.invite_id = i.id)
+	FROM userinvites i
+	LEFT JOIN users u ON u.id = i.owner_id
+	ORDER BY i.created DESC`)
+	if err != nil {
+		log.Error("Failed selecting all invites: %v", err)
+		return nil, impart.HTTPError{http.StatusInternalServerError, "Couldn't retrieve invites."}
+	}
+	defer rows.Close()
+
+	is := []Invite{}
+	for rows.Next() {
+		i := Invite{}
+		var owner sql.NullString
+		err = rows.Scan(&i.ID, &i.MaxUses, &i.Created, &i.Expires, &i.Inactive, &i.Label, &i.Email, &owner, &i.uses)
+		if err != nil {
+			log.Error("Failed scanning GetAllInvites() row: %v", err)
+			return nil, err
+		}
+		i.Owner = owner.String
+		is = append(is, i)
+	}
+	return is, rows.Err()
+}
+
+// GetInvitedUsers returns the users who signed up with the given invite.
+func (db *datastore) GetInvitedUsers(id string) ([]User, error) {
+	rows, err := db.Query("SELECT u.id, u.username, u.created, u.status FROM usersinvited ui INNER JOIN users u ON u.id = ui.user_id WHERE ui.invite_id = ? ORDER BY u.created ASC", id)
+	if err != nil {
+		log.Error("Failed selecting invited users: %v", err)
+		return nil, impart.HTTPError{http.StatusInternalServerError, "Couldn't retrieve invited users."}
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		u := User{}
+		err = rows.Scan(&u.ID, &u.Username, &u.Created, &u.Status)
+		if err != nil {
+			log.Error("Failed scanning GetInvitedUsers() row: %v", err)
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// RevokeUserInvite stops the given invite from being used any more.
+func (db *datastore) RevokeUserInvite(id string) error {
+	_, err := db.Exec("UPDATE userinvites SET inactive = 1 WHERE id = ?", id)
+	if err != nil {
+		log.Error("Unable to revoke invite %s: %v", id, err)
+		return err
+	}
+	return nil
+}
+
 func (db *datastore) GetUserInvite(id string) (*Invite, error) {
 	var i Invite
-	err := db.QueryRow("SELECT id, max_uses, created, expires, inactive FROM userinvites WHERE id = ?", id).Scan(&i.ID, &i.MaxUses, &i.Created, &i.Expires, &i.Inactive)
+	err := db.QueryRow("SELECT id, max_uses, created, expires, inactive, label, email FROM userinvites WHERE id = ?", id).Scan(&i.ID, &i.MaxUses, &i.Created, &i.Expires, &i.Inactive, &i.Label, &i.Email)
 	switch {
 	case err == sql.ErrNoRows, db.isIgnorableError(err):
 		return nil, impart.HTTPError{http.StatusNotFound, "Invite doesn't exist."}
@@ -2724,6 +3365,17 @@ func (db *datastore) GetUsersInvitedCount(id string) int64 {
 	return count
 }
 
+// GetUserInviteUsed returns the code of the invite the given user signed up
+// with, or an empty string if they didn't use one.
+func (db *datastore) GetUserInviteUsed(userID int64) string {
+	var code string
+	err := db.QueryRow("SELECT invite_id FROM usersinvited WHERE user_id = ?", userID).Scan(&code)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error("Failed selecting invite used by user %d: %v", userID, err)
+	}
+	return code
+}
+
 func (db *datastore) CreateInvitedUser(inviteID string, userID int64) error {
 	_, err := db.Exec("INSERT INTO usersinvited (invite_id, user_id) VALUES (?, ?)", inviteID, userID)
 	return err
@@ -2794,9 +3446,9 @@ func (db *datastore) UpdateDynamicContent(id, title, content, contentType string
 }
 
 func (db *datastore) GetAllUsers(page uint) (*[]User, error) {
-	limitStr := fmt.Sprintf("0, %d", adminUsersPerPage)
+	limitStr := fmt.Sprintf("%d", adminUsersPerPage)
 	if page > 1 {
-		limitStr = fmt.Sprintf("%d, %d", (page-1)*adminUsersPerPage, adminUsersPerPage)
+		limitStr = fmt.Sprintf("%d OFFSET %d", adminUsersPerPage, (page-1)*adminUsersPerPage)
 	}
 
 	rows, err := db.Query("SELECT id, username, created, status FROM users ORDER BY created DESC LIMIT " + limitStr)
@@ -2833,6 +3485,89 @@ func (db *datastore) GetAllUsersCount() int64 {
 	return count
 }
 
+// GetPendingUsers returns the users waiting for an admin to approve their
+// registration, oldest first.
+func (db *datastore) GetPendingUsers() ([]pendingUser, error) {
+	rows, err := db.Query(`SELECT u.id, u.username, u.created, u.status, a.value
+	FROM users u
+	LEFT JOIN userattributes a ON a.user_id = u.id AND a.attribute = ?
+	WHERE u.status IN (?, ?, ?, ?)
+	ORDER BY u.created ASC`, userAttrSignupReason, UserPending, UserPending|UserSilenced, UserPending|UserDeleting, UserPending|UserSilenced|UserDeleting)
+	if err != nil {
+		log.Error("Failed selecting pending users: %v", err)
+		return nil, impart.HTTPError{http.StatusInternalServerError, "Couldn't retrieve pending users."}
+	}
+	defer rows.Close()
+
+	users := []pendingUser{}
+	for rows.Next() {
+		pu := pendingUser{}
+		var reason sql.NullString
+		err = rows.Scan(&pu.ID, &pu.Username, &pu.Created, &pu.Status, &reason)
+		if err != nil {
+			log.Error("Failed scanning GetPendingUsers() row: %v", err)
+			return nil, err
+		}
+		pu.Reason = reason.String
+		users = append(users, pu)
+	}
+	return users, rows.Err()
+}
+
+// GetSignupBlocks returns everything that's blocked from signing up, most
+// recently blocked first.
+func (db *datastore) GetSignupBlocks() ([]signupBlock, error) {
+	rows, err := db.Query("SELECT type, value, created FROM signupblocks ORDER BY created DESC")
+	if err != nil {
+		log.Error("Failed selecting signup blocks: %v", err)
+		return nil, impart.HTTPError{http.StatusInternalServerError, "Couldn't retrieve signup blocks."}
+	}
+	defer rows.Close()
+
+	blocks := []signupBlock{}
+	for rows.Next() {
+		b := signupBlock{}
+		err = rows.Scan(&b.Type, &b.Value, &b.Created)
+		if err != nil {
+			log.Error("Failed scanning GetSignupBlocks() row: %v", err)
+			break
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// AddSignupBlock blocks the given, already normalized, value from signing up.
+func (db *datastore) AddSignupBlock(kind, value string) error {
+	_, err := db.Exec("INSERT INTO signupblocks (type, value, created) VALUES (?, ?, "+db.now()+") "+db.upsert("type", "value")+" value = ?", kind, value, value)
+	if err != nil {
+		log.Error("Unable to INSERT into signupblocks: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (db *datastore) RemoveSignupBlock(kind, value string) error {
+	_, err := db.Exec("DELETE FROM signupblocks WHERE type = ? AND value = ?", kind, value)
+	if err != nil {
+		log.Error("Unable to DELETE from signupblocks: %v", err)
+		return err
+	}
+	return nil
+}
+
+// CountRecentSignupsFromIP returns how many accounts signed up from the given
+// IP address in the past number of hours.
+func (db *datastore) CountRecentSignupsFromIP(ip string, hours int) int {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM userattributes a INNER JOIN users u ON u.id = a.user_id WHERE a.attribute = ? AND a.value = ? AND u.created > "+db.dateSub(hours, "HOUR"), userAttrSignupIP, ip).Scan(&count)
+	if err != nil {
+		log.Error("Failed counting recent signups from IP: %v", err)
+		return 0
+	}
+	return count
+}
+
 func (db *datastore) GetUserLastPostTime(id int64) (*time.Time, error) {
 	var t time.Time
 	err := db.QueryRow("SELECT created FROM posts WHERE owner_id = ? ORDER BY created DESC LIMIT 1", id).Scan(&t)
@@ -2872,7 +3607,7 @@ func (db *datastore) GenerateOAuthState(ctx context.Context, provider string, cl
 	state := id.Generate62RandomString(24)
 	attachUserVal := sql.NullInt64{Valid: attachUser > 0, Int64: attachUser}
 	inviteCodeVal := sql.NullString{Valid: inviteCode != "", String: inviteCode}
-	_, err := db.ExecContext(ctx, "INSERT INTO oauth_client_states (state, provider, client_id, used, created_at, attach_user_id, invite_code) VALUES (?, ?, ?, FALSE, "+db.now()+", ?, ?)", state, provider, clientID, attachUserVal, inviteCodeVal)
+	_, err := db.ExecContext(ctx, "INSERT INTO oauth_client_states (state, provider, client_id, used, created_at, attach_user_id, invite_code) VALUES (?, ?, ?, 0, "+db.now()+", ?, ?)", state, provider, clientID, attachUserVal, inviteCodeVal)
 	if err != nil {
 		return "", fmt.Errorf("unable to record oauth client state: %w", err)
 	}
@@ -2886,13 +3621,13 @@ func (db *datastore) ValidateOAuthState(ctx context.Context, state string) (stri
 	var inviteCode sql.NullString
 	err := wf_db.RunTransactionWithOptions(ctx, db.DB, &sql.TxOptions{}, func(ctx context.Context, tx *sql.Tx) error {
 		err := tx.
-			QueryRowContext(ctx, "SELECT provider, client_id, attach_user_id, invite_code FROM oauth_client_states WHERE state = ? AND used = FALSE", state).
+			QueryRowContext(ctx, "SELECT provider, client_id, attach_user_id, invite_code FROM oauth_client_states WHERE state = ? AND used = 0", state).
 			Scan(&provider, &clientID, &attachUserID, &inviteCode)
 		if err != nil {
 			return err
 		}
 
-		res, err := tx.ExecContext(ctx, "UPDATE oauth_client_states SET used = TRUE WHERE state = ?", state)
+		res, err := tx.ExecContext(ctx, "UPDATE oauth_client_states SET used = 1 WHERE state = ?", state)
 		if err != nil {
 			return err
 		}
@@ -2906,7 +3641,7 @@ func (db *datastore) ValidateOAuthState(ctx context.Context, state string) (stri
 		return nil
 	})
 	if err != nil {
-		return "", "", 0, "", nil
+		return "", "", 0, "", err
 	}
 	return provider, clientID, attachUserID.Int64, inviteCode.String, nil
 }
@@ -2916,7 +3651,7 @@ func (db *datastore) RecordRemoteUserID(ctx context.Context, localUserID int64,
 	if db.driverName == driverSQLite {
 		_, err = db.ExecContext(ctx, "INSERT OR REPLACE INTO oauth_users (user_id, remote_user_id, provider, client_id, access_token) VALUES (?, ?, ?, ?, ?)", localUserID, remoteUserID, provider, clientID, accessToken)
 	} else {
-		_, err = db.ExecContext(ctx, "INSERT INTO oauth_users (user_id, remote_user_id, provider, client_id, access_token) VALUES (?, ?, ?, ?, ?) "+db.upsert("user")+" access_token = ?", localUserID, remoteUserID, provider, clientID, accessToken, accessToken)
+		_, err = db.ExecContext(ctx, "INSERT INTO oauth_users (user_id, remote_user_id, provider, client_id, access_token) VALUES (?, ?, ?, ?, ?) "+db.upsert("user_id", "provider", "client_id")+" access_token = ?", localUserID, remoteUserID, provider, clientID, accessToken, accessToken)
 	}
 	if err != nil {
 		log.Error("Unable to INSERT oauth_users for '%d': %v", localUserID, err)
@@ -2974,6 +3709,8 @@ func (db *datastore) DatabaseInitialized() bool {
 	var err error
 	if db.driverName == driverSQLite {
 		err = db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'users'").Scan(&dummy)
+	} else if db.driverName == driverPostgres {
+		err = db.QueryRow("SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'users'").Scan(&dummy)
 	} else {
 		err = db.QueryRow("SHOW TABLES LIKE 'users'").Scan(&dummy)
 	}
@@ -3200,20 +3937,51 @@ func (db *datastore) DeleteEmailSubscriberByUser(email string, userID, collID in
 	return nil
 }
 
-func (db *datastore) UpdateSubscriberConfirmed(subID, token string) error {
+// UpdateSubscriberConfirmed confirms the given subscriber's email address for
+// all of its subscriptions, returning the IDs of the blogs whose subscriptions
+// weren't already confirmed.
+func (db *datastore) UpdateSubscriberConfirmed(subID, token string) ([]int64, error) {
 	email, err := db.FetchEmailSubscriberEmail(subID, token)
 	if err != nil {
 		log.Error("Didn't fetch email subscriber: %v", err)
-		return err
+		return nil, err
+	}
+
+	t, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := t.Query("SELECT collection_id FROM emailsubscribers WHERE email = ? AND confirmed = 0", email)
+	if err != nil {
+		t.Rollback()
+		log.Error("Could not select unconfirmed subscriptions: %v", err)
+		return nil, err
+	}
+	var collIDs []int64
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			t.Rollback()
+			return nil, err
+		}
+		collIDs = append(collIDs, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		t.Rollback()
+		return nil, err
 	}
 
 	// TODO: ensure all addresses with original name are also confirmed, e.g. matt+fake@write.as and matt@write.as are now confirmed
-	_, err = db.Exec("UPDATE emailsubscribers SET confirmed = 1 WHERE email = ?", email)
+	_, err = t.Exec("UPDATE emailsubscribers SET confirmed = 1 WHERE email = ?", email)
 	if err != nil {
+		t.Rollback()
 		log.Error("Could not update email subscriber confirmation status: %v", err)
-		return err
+		return nil, err
 	}
-	return nil
+	return collIDs, t.Commit()
 }
 
 func (db *datastore) IsSubscriberConfirmed(email string) bool {
@@ -3230,16 +3998,401 @@ func (db *datastore) IsSubscriberConfirmed(email string) bool {
 	return true
 }
 
+// InsertEmailSend records that the given post was sent to the given
+// subscribers, along with each recipient's initial delivery status.
+func (db *datastore) InsertEmailSend(es *EmailSend, recipients []*EmailSendRecipient) error {
+	msgIDVal := sql.NullString{
+		String: es.MessageID,
+		Valid:  es.MessageID != "",
+	}
+	errVal := sql.NullString{
+		String: es.Error,
+		Valid:  es.Error != "",
+	}
+
+	t, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	res, err := t.Exec("INSERT INTO emailsends (post_id, collection_id, message_id, recipients, failures, error, sent) VALUES (?, ?, ?, ?, ?, ?, "+db.now()+")", es.PostID, es.CollectionID, msgIDVal, es.Recipients, es.Failures, errVal)
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to INSERT into emailsends: %v", err)
+		return err
+	}
+	es.ID, err = res.LastInsertId()
+	if err != nil {
+		t.Rollback()
+		log.Error("Unable to get emailsends ID: %v", err)
+		return err
+	}
+
+	for _, r := range recipients {
+		hashVal := sql.NullString{
+			String: r.EmailHash,
+			Valid:  r.EmailHash != "",
+		}
+		_, err = t.Exec("INSERT INTO emailrecipients (send_id, subscriber_id, email_hash, status, details, updated) VALUES (?, ?, ?, ?, ?, "+db.now()+")", es.ID, r.SubscriberID, hashVal, r.Status, r.Details)
+		if err != nil {
+			t.Rollback()
+			log.Error("Unable to INSERT into emailrecipients: %v", err)
+			return err
+		}
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+	return nil
+}
+
+// GetEmailSendByMessageID returns the send log for the message with the given
+// mail provider ID, or nil if it doesn't exist.
+func (db *datastore) GetEmailSendByMessageID(msgID string) (*EmailSend, error) {
+	es := &EmailSend{}
+	var msgIDVal, errVal sql.NullString
+	err := db.QueryRow("SELECT id, post_id, collection_id, message_id, recipients, failures, error, sent FROM emailsends WHERE message_id = ?", msgID).Scan(&es.ID, &es.PostID, &es.CollectionID, &msgIDVal, &es.Recipients, &es.Failures, &errVal, &es.Sent)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Error("Couldn't SELECT from emailsends: %v", err)
+		return nil, err
+	}
+	es.MessageID = msgIDVal.String
+	es.Error = errVal.String
+	return es, nil
+}
+
+// GetEmailSends returns all logged sends for the given collection, most recent first.
+func (db *datastore) GetEmailSends(collID int64) ([]*EmailSend, error) {
+	rows, err := db.Query(`SELECT es.id, es.post_id, es.collection_id, es.message_id, es.recipients, es.failures, es.error, es.sent, p.title, p.slug,
+  (SELECT COUNT(*) FROM emailrecipients r WHERE r.send_id = es.id AND r.status = ?),
+  (SELECT COUNT(*) FROM emailrecipients r WHERE r.send_id = es.id AND r.status IN (?, ?, ?))
+FROM emailsends es
+LEFT JOIN posts p
+  ON p.id = es.post_id
+WHERE es.collection_id = ?
+ORDER BY es.sent DESC`, emailStatusDelivered, emailStatusBounced, emailStatusComplained, emailStatusUnsubscribed, collID)
+	if err != nil {
+		log.Error("Failed selecting email sends for collection %d: %v", collID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sends []*EmailSend
+	for rows.Next() {
+		es := &EmailSend{}
+		var msgIDVal, errVal, title, slug sql.NullString
+		err = rows.Scan(&es.ID, &es.PostID, &es.CollectionID, &msgIDVal, &es.Recipients, &es.Failures, &errVal, &es.Sent, &title, &slug, &es.Delivered, &es.Bounced)
+		if err != nil {
+			log.Error("Failed scanning row from email sends: %v", err)
+			continue
+		}
+		es.MessageID = msgIDVal.String
+		es.Error = errVal.String
+		es.PostTitle = title.String
+		es.PostSlug = slug.String
+		sends = append(sends, es)
+	}
+	return sends, nil
+}
+
+// GetEmailSendRecipients returns the delivery status of every recipient of
+// the given send, as long as it belongs to the given collection.
+func (db *datastore) GetEmailSendRecipients(sendID, collID int64) ([]*EmailSendRecipient, error) {
+	rows, err := db.Query(`SELECT r.subscriber_id, s.email, r.status, r.details, r.updated
+FROM emailrecipients r
+INNER JOIN emailsends es
+  ON es.id = r.send_id
+LEFT JOIN emailsubscribers s
+  ON s.id = r.subscriber_id
+WHERE r.send_id = ? AND es.collection_id = ?
+ORDER BY r.updated DESC`, sendID, collID)
+	if err != nil {
+		log.Error("Failed selecting email recipients for send %d: %v", sendID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recips []*EmailSendRecipient
+	for rows.Next() {
+		r := &EmailSendRecipient{}
+		err = rows.Scan(&r.SubscriberID, &r.Email, &r.Status, &r.Details, &r.Updated)
+		if err != nil {
+			log.Error("Failed scanning row from email recipients: %v", err)
+			continue
+		}
+		recips = append(recips, r)
+	}
+	return recips, nil
+}
+
+// GetEmailSendSubscriber returns the current subscriber that the given send
+// went to at the address with the given emailLookupHash, or nil if there
+// isn't one.
+func (db *datastore) GetEmailSendSubscriber(sendID int64, emailHash string) (*EmailSubscriber, error) {
+	s := &EmailSubscriber{}
+	err := db.QueryRow(`SELECT s.id, s.collection_id, s.user_id, s.email, u.email, s.subscribed, s.token, s.confirmed, s.allow_export
+FROM emailrecipients r
+INNER JOIN emailsubscribers s
+  ON s.id = r.subscriber_id
+LEFT JOIN users u
+  ON u.id = s.user_id
+WHERE r.send_id = ? AND r.email_hash = ?`, sendID, emailHash).Scan(&s.ID, &s.CollID, &s.UserID, &s.Email, &s.acctEmail, &s.Subscribed, &s.Token, &s.Confirmed, &s.AllowExport)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Error("Couldn't SELECT subscriber for email send %d: %v", sendID, err)
+		return nil, err
+	}
+	return s, nil
+}
+
+// IsLetterRecipient returns whether a confirmed subscriber of the given
+// collection was sent a letter at the address with the given emailLookupHash.
+func (db *datastore) IsLetterRecipient(collID int64, emailHash string) (bool, error) {
+	var dummy int
+	err := db.QueryRow(`SELECT 1
+FROM emailrecipients r
+INNER JOIN emailsends es
+  ON es.id = r.send_id
+INNER JOIN emailsubscribers s
+  ON s.id = r.subscriber_id
+WHERE es.collection_id = ? AND r.email_hash = ? AND s.confirmed = 1
+LIMIT 1`, collID, emailHash).Scan(&dummy)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		log.Error("Couldn't SELECT letter recipient for collection %d: %v", collID, err)
+		return false, err
+	}
+	return true, nil
+}
+
+// UpdateEmailRecipientStatus sets the latest delivery status of a subscriber
+// for the given send.
+func (db *datastore) UpdateEmailRecipientStatus(sendID int64, subID, status, details string) error {
+	detailsVal := sql.NullString{
+		String: details,
+		Valid:  details != "",
+	}
+	_, err := db.Exec("UPDATE emailrecipients SET status = ?, details = ?, updated = "+db.now()+" WHERE send_id = ? AND subscriber_id = ?", status, detailsVal, sendID, subID)
+	if err != nil {
+		log.Error("Unable to UPDATE emailrecipients: %v", err)
+		return err
+	}
+	return nil
+}
+
+// InsertLetter records a letter that was sent to a collection's subscribers,
+// UPDATING it in the process with the letter's ID.
+func (db *datastore) InsertLetter(l *Letter) error {
+	sendIDVal := sql.NullInt64{
+		Int64: l.SendID,
+		Valid: l.SendID > 0,
+	}
+	res, err := db.Exec("INSERT INTO letters (collection_id, post_id, send_id, subject, content, sent) VALUES (?, ?, ?, ?, ?, "+db.now()+")", l.CollectionID, l.PostID, sendIDVal, l.Subject, string(l.Content))
+	if err != nil {
+		log.Error("Unable to INSERT into letters: %v", err)
+		return err
+	}
+	l.ID, err = res.LastInsertId()
+	if err != nil {
+		log.Error("Unable to get letters ID: %v", err)
+	}
+	return nil
+}
+
+const letterCols = "l.id, l.collection_id, l.post_id, l.subject, l.content, l.sent, p.slug"
+
+func scanLetter(row interface{ Scan(...interface{}) error }) (*Letter, error) {
+	l := &Letter{}
+	var content string
+	var slug sql.NullString
+	err := row.Scan(&l.ID, &l.CollectionID, &l.PostID, &l.Subject, &content, &l.Sent, &slug)
+	if err != nil {
+		return nil, err
+	}
+	l.Content = template.HTML(content)
+	l.PostSlug = slug.String
+	return l, nil
+}
+
+// GetLetters returns all letters sent from the given collection, most recent
+// first. Letters whose posts have since been deleted or moved aren't included.
+func (db *datastore) GetLetters(collID int64) ([]*Letter, error) {
+	rows, err := db.Query(`SELECT `+letterCols+`
+FROM letters l
+INNER JOIN posts p
+  ON p.id = l.post_id AND p.collection_id = l.collection_id
+WHERE l.collection_id = ?
+ORDER BY l.sent DESC`, collID)
+	if err != nil {
+		log.Error("Failed selecting letters for collection %d: %v", collID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := []*Letter{}
+	for rows.Next() {
+		l, err := scanLetter(rows)
+		if err != nil {
+			log.Error("Failed scanning row from letters: %v", err)
+			continue
+		}
+		letters = append(letters, l)
+	}
+	return letters, nil
+}
+
+// GetLetter returns the letter with the given ID from the given collection.
+func (db *datastore) GetLetter(id, collID int64) (*Letter, error) {
+	l, err := scanLetter(db.QueryRow(`SELECT `+letterCols+`
+FROM letters l
+INNER JOIN posts p
+  ON p.id = l.post_id AND p.collection_id = l.collection_id
+WHERE l.id = ? AND l.collection_id = ?`, id, collID))
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrPostNotFound
+	case err != nil:
+		log.Error("Couldn't SELECT from letters: %v", err)
+		return nil, err
+	}
+	return l, nil
+}
+
+// GetLetterTemplate returns the collection's custom letter templates, or nil if
+// it doesn't have any.
+func (db *datastore) GetLetterTemplate(collID int64) (*LetterTemplate, error) {
+	lt := &LetterTemplate{CollectionID: collID}
+	err := db.QueryRow("SELECT html_template, text_template, updated FROM lettertemplates WHERE collection_id = ?", collID).Scan(&lt.HTML, &lt.Text, &lt.Updated)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Error("Couldn't SELECT from lettertemplates: %v", err)
+		return nil, err
+	}
+	return lt, nil
+}
+
+// UpdateLetterTemplate saves the collection's custom letter templates,
+// removing them entirely when both are empty.
+func (db *datastore) UpdateLetterTemplate(collID int64, html, text string) error {
+	var err error
+	if strings.TrimSpace(html) == "" && strings.TrimSpace(text) == "" {
+		_, err = db.Exec("DELETE FROM lettertemplates WHERE collection_id = ?", collID)
+	} else {
+		_, err = db.Exec("INSERT INTO lettertemplates (collection_id, html_template, text_template, updated) VALUES (?, ?, ?, "+db.now()+") "+db.upsert("collection_id")+" html_template = ?, text_template = ?, updated = "+db.now(), collID, html, text, html, text)
+	}
+	if err != nil {
+		log.Error("Unable to update lettertemplates: %v", err)
+		return err
+	}
+	return nil
+}
+
+// InsertNotification queues a notification for a user, UPDATING it in the
+// process with the notification's ID.
+func (db *datastore) InsertNotification(n *Notification) error {
+	res, err := db.Exec("INSERT INTO notifications (user_id, collection_id, kind, actor, url, excerpt, created) VALUES (?, ?, ?, ?, ?, ?, "+db.now()+")", n.UserID, n.CollectionID, n.Kind, n.Actor, n.URL, n.Excerpt)
+	if err != nil {
+		log.Error("Unable to INSERT into notifications: %v", err)
+		return err
+	}
+	n.ID, err = res.LastInsertId()
+	if err != nil {
+		log.Error("Unable to get notifications ID: %v", err)
+	}
+	return nil
+}
+
+// GetPendingNotifications returns all of the user's notifications that
+// haven't been sent yet, oldest first.
+func (db *datastore) GetPendingNotifications(userID int64) ([]*Notification, error) {
+	rows, err := db.Query(`SELECT n.id, n.user_id, n.collection_id, n.kind, n.actor, n.url, n.excerpt, n.created, c.alias, c.title
+FROM notifications n
+LEFT JOIN collections c
+  ON c.id = n.collection_id
+WHERE n.user_id = ? AND n.sent IS NULL
+ORDER BY n.created ASC`, userID)
+	if err != nil {
+		log.Error("Failed selecting from notifications: %v", err)
+		return nil, impart.HTTPError{http.StatusInternalServerError, "Couldn't retrieve notifications."}
+	}
+	defer rows.Close()
+
+	ns := []*Notification{}
+	for rows.Next() {
+		n := &Notification{}
+		var urlVal, excerpt, alias, title sql.NullString
+		err = rows.Scan(&n.ID, &n.UserID, &n.CollectionID, &n.Kind, &n.Actor, &urlVal, &excerpt, &n.Created, &alias, &title)
+		if err != nil {
+			log.Error("Failed scanning notification: %v", err)
+			return nil, err
+		}
+		n.URL = urlVal.String
+		n.Excerpt = excerpt.String
+		n.CollectionAlias = alias.String
+		n.CollectionTitle = title.String
+		ns = append(ns, n)
+	}
+	return ns, nil
+}
+
+// GetUsersWithDueNotifications returns the IDs of users with unsent
+// notifications that were created more than the given number of hours ago.
+func (db *datastore) GetUsersWithDueNotifications(hours int) ([]int64, error) {
+	rows, err := db.Query("SELECT user_id FROM notifications WHERE sent IS NULL GROUP BY user_id HAVING MIN(created) < " + db.dateSub(hours, "HOUR"))
+	if err != nil {
+		log.Error("Failed selecting from notifications: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			log.Error("Failed scanning notification user: %v", err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// MarkNotificationsSent records that the given notifications were sent.
+func (db *datastore) MarkNotificationsSent(ns []*Notification) error {
+	for _, n := range ns {
+		_, err := db.Exec("UPDATE notifications SET sent = "+db.now()+" WHERE id = ?", n.ID)
+		if err != nil {
+			log.Error("Unable to UPDATE notifications: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertJob queues the given job, UPDATING it in the process with the job's ID.
 func (db *datastore) InsertJob(j *PostJob) error {
 	res, err := db.Exec("INSERT INTO publishjobs (post_id, action, delay) VALUES (?, ?, ?)", j.PostID, j.Action, j.Delay)
 	if err != nil {
 		return err
 	}
-	jobID, err := res.LastInsertId()
+	j.ID, err = res.LastInsertId()
 	if err != nil {
 		log.Error("[jobs] Couldn't get last insert ID! %s", err)
 	}
-	log.Info("[jobs] Queued %s job #%d for post %s, delayed %d minutes", j.Action, jobID, j.PostID, j.Delay)
+	log.Info("[jobs] Queued %s job #%d for post %s, delayed %d minutes", j.Action, j.ID, j.PostID, j.Delay)
 	return nil
 }
 
@@ -3270,10 +4423,35 @@ func (db *datastore) DeleteJobByPost(postID string) error {
 	return nil
 }
 
+// GetQueuedJobs returns all queued jobs with the given action, oldest first,
+// for jobs that aren't tied to when a post was published.
+func (db *datastore) GetQueuedJobs(action string) ([]*PostJob, error) {
+	rows, err := db.Query("SELECT id, post_id, action, delay FROM publishjobs WHERE action = ? ORDER BY id ASC", action)
+	if err != nil {
+		log.Error("Failed selecting from publishjobs: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*PostJob{}
+	for rows.Next() {
+		j := &PostJob{}
+		err = rows.Scan(&j.ID, &j.PostID, &j.Action, &j.Delay)
+		if err != nil {
+			log.Error("Failed scanning GetQueuedJobs() row: %v", err)
+			break
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
 func (db *datastore) GetJobsToRun(action string) ([]*PostJob, error) {
 	timeWhere := "created < DATE_SUB(NOW(), INTERVAL delay MINUTE) AND created > DATE_SUB(NOW(), INTERVAL delay + 5 MINUTE)"
 	if db.driverName == driverSQLite {
 		timeWhere = "created < DATETIME('now', '-' || delay || ' MINUTE') AND created > DATETIME('now', '-' || (delay+5) || ' MINUTE')"
+	} else if db.driverName == driverPostgres {
+		timeWhere = "created < NOW() - delay * INTERVAL '1 MINUTE' AND created > NOW() - (delay + 5) * INTERVAL '1 MINUTE'"
 	}
 	rows, err := db.Query(`SELECT pj.id, post_id, action, delay
 		FROM publishjobs pj
@@ -8,43 +8,60 @@ import (
 )
 
 func TestOAuthDatastore(t *testing.T) {
-	if !runMySQLTests() {
-		t.Skip("skipping mysql tests")
+	if !runDatabaseTests() {
+		t.Skip("skipping database tests")
 	}
 	withTestDB(t, func(db *sql.DB) {
 		ctx := context.Background()
 		ds := &datastore{
 			DB:         db,
-			driverName: "",
+			driverName: testDriver,
 		}
 
 		state, err := ds.GenerateOAuthState(ctx, "test", "development", 0, "")
 		assert.NoError(t, err)
 		assert.Len(t, state, 24)
 
-		countRows(t, ctx, db, 1, "SELECT COUNT(*) FROM `oauth_client_states` WHERE `state` = ? AND `used` = false", state)
+		countRows(t, ctx, db, 1, "SELECT COUNT(*) FROM oauth_client_states WHERE state = ? AND used = 0", state)
 
 		_, _, _, _, err = ds.ValidateOAuthState(ctx, state)
 		assert.NoError(t, err)
 
-		countRows(t, ctx, db, 1, "SELECT COUNT(*) FROM `oauth_client_states` WHERE `state` = ? AND `used` = true", state)
+		countRows(t, ctx, db, 1, "SELECT COUNT(*) FROM oauth_client_states WHERE state = ? AND used = 1", state)
 
 		var localUserID int64 = 99
 		var remoteUserID = "100"
 		err = ds.RecordRemoteUserID(ctx, localUserID, remoteUserID, "test", "test", "access_token_a")
 		assert.NoError(t, err)
 
-		countRows(t, ctx, db, 1, "SELECT COUNT(*) FROM `oauth_users` WHERE `user_id` = ? AND `remote_user_id` = ? AND access_token = 'access_token_a'", localUserID, remoteUserID)
+		countRows(t, ctx, db, 1, "SELECT COUNT(*) FROM oauth_users WHERE user_id = ? AND remote_user_id = ? AND access_token = 'access_token_a'", localUserID, remoteUserID)
 
 		err = ds.RecordRemoteUserID(ctx, localUserID, remoteUserID, "test", "test", "access_token_b")
 		assert.NoError(t, err)
 
-		countRows(t, ctx, db, 1, "SELECT COUNT(*) FROM `oauth_users` WHERE `user_id` = ? AND `remote_user_id` = ? AND access_token = 'access_token_b'", localUserID, remoteUserID)
+		countRows(t, ctx, db, 1, "SELECT COUNT(*) FROM oauth_users WHERE user_id = ? AND remote_user_id = ? AND access_token = 'access_token_b'", localUserID, remoteUserID)
 
-		countRows(t, ctx, db, 1, "SELECT COUNT(*) FROM `oauth_users`")
+		countRows(t, ctx, db, 1, "SELECT COUNT(*) FROM oauth_users")
 
 		foundUserID, err := ds.GetIDForRemoteUser(ctx, remoteUserID, "test", "test")
 		assert.NoError(t, err)
 		assert.Equal(t, localUserID, foundUserID)
 	})
 }
+
+func TestPostgresQuery(t *testing.T) {
+	tests := []struct {
+		in, out   string
+		returnsID bool
+	}{
+		{"SELECT id FROM users WHERE username = ?", "SELECT id FROM users WHERE username = $1", false},
+		{"UPDATE posts SET title = ?, content = '?' WHERE id = ? AND \"slug?\" = ?", "UPDATE posts SET title = $1, content = '?' WHERE id = $2 AND \"slug?\" = $3", false},
+		{"INSERT INTO users (username, password, email) VALUES (?, ?, ?)", "INSERT INTO users (username, password, email) VALUES ($1, $2, $3) RETURNING id", true},
+		{"INSERT INTO remotefollows (collection_id, remote_user_id, created) VALUES (?, ?, NOW()) ON CONFLICT DO NOTHING", "INSERT INTO remotefollows (collection_id, remote_user_id, created) VALUES ($1, $2, NOW()) ON CONFLICT DO NOTHING", false},
+	}
+	for _, test := range tests {
+		out, returnsID := pgQuery(test.in)
+		assert.Equal(t, test.out, out)
+		assert.Equal(t, test.returnsID, returnsID, test.in)
+	}
+}
@@ -19,12 +19,32 @@ func (b *AlterTableSqlBuilder) AddColumn(col *Column) *AlterTableSqlBuilder {
 }
 
 func (b *AlterTableSqlBuilder) ChangeColumn(name string, col *Column) *AlterTableSqlBuilder {
+	if b.Dialect == DialectPostgres {
+		// Postgres changes a column's type and nullability separately, and
+		// can't rename it in the same statement.
+		typeStr, err := col.Type.Format(col.Dialect, col.Size)
+		if err != nil {
+			return b
+		}
+		b.Changes = append(b.Changes, fmt.Sprintf("ALTER COLUMN %s TYPE %s USING %s::%s", name, typeStr, name, typeStr))
+		if col.Nullable {
+			b.Changes = append(b.Changes, fmt.Sprintf("ALTER COLUMN %s DROP NOT NULL", name))
+		} else {
+			b.Changes = append(b.Changes, fmt.Sprintf("ALTER COLUMN %s SET NOT NULL", name))
+		}
+		return b
+	}
 	if colVal, err := col.String(); err == nil {
 		b.Changes = append(b.Changes, fmt.Sprintf("CHANGE COLUMN %s %s", name, colVal))
 	}
 	return b
 }
 
+func (b *AlterTableSqlBuilder) DropColumn(name string) *AlterTableSqlBuilder {
+	b.Changes = append(b.Changes, fmt.Sprintf("DROP COLUMN %s", name))
+	return b
+}
+
 func (b *AlterTableSqlBuilder) AddUniqueConstraint(name string, columns ...string) *AlterTableSqlBuilder {
 	b.Changes = append(b.Changes, fmt.Sprintf("ADD CONSTRAINT %s UNIQUE (%s)", name, strings.Join(columns, ", ")))
 	return b
@@ -40,6 +40,30 @@ func TestAlterTableSqlBuilder_ToSQL(t *testing.T) {
 			want:    "ALTER TABLE the_table ADD COLUMN first_col INT NOT NULL, ADD COLUMN second_col VARCHAR(128) NOT NULL",
 			wantErr: false,
 		},
+		{
+			name: "Postgres add int",
+			builder: DialectPostgres.
+				AlterTable("the_table").
+				AddColumn(DialectPostgres.Column("the_col", ColumnTypeInteger, OptionalInt{true, 24})),
+			want:    "ALTER TABLE the_table ADD COLUMN the_col INTEGER NOT NULL",
+			wantErr: false,
+		},
+		{
+			name: "Postgres change column",
+			builder: DialectPostgres.
+				AlterTable("the_table").
+				ChangeColumn("the_col", DialectPostgres.Column("the_col", ColumnTypeVarChar, OptionalInt{true, 128})),
+			want:    "ALTER TABLE the_table ALTER COLUMN the_col TYPE VARCHAR(128) USING the_col::VARCHAR(128), ALTER COLUMN the_col SET NOT NULL",
+			wantErr: false,
+		},
+		{
+			name: "SQLite drop column",
+			builder: DialectSQLite.
+				AlterTable("the_table").
+				DropColumn("the_col"),
+			want:    "ALTER TABLE the_table DROP COLUMN the_col",
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
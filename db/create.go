@@ -50,6 +50,11 @@ type CreateTableSqlBuilder struct {
 	Constraints []string
 }
 
+type DropTableSqlBuilder struct {
+	Dialect DialectType
+	Name    string
+}
+
 const (
 	ColumnTypeBool     ColumnType = iota
 	ColumnTypeSmallInt ColumnType = iota
@@ -61,12 +66,13 @@ const (
 )
 
 var _ SQLBuilder = &CreateTableSqlBuilder{}
+var _ SQLBuilder = &DropTableSqlBuilder{}
 
 var UnsetSize OptionalInt = OptionalInt{Set: false, Value: 0}
 var UnsetDefault OptionalString = OptionalString{Set: false, Value: ""}
 
 func (d ColumnType) Format(dialect DialectType, size OptionalInt) (string, error) {
-	if dialect != DialectMySQL && dialect != DialectSQLite {
+	if dialect != DialectMySQL && dialect != DialectSQLite && dialect != DialectPostgres {
 		return "", fmt.Errorf("unsupported column type %d for dialect %d and size %v", d, dialect, size)
 	}
 	switch d {
@@ -76,7 +82,7 @@ func (d ColumnType) Format(dialect DialectType, size OptionalInt) (string, error
 				return "INTEGER", nil
 			}
 			mod := ""
-			if size.Set {
+			if size.Set && dialect != DialectPostgres {
 				mod = fmt.Sprintf("(%d)", size.Value)
 			}
 			return "SMALLINT" + mod, nil
@@ -86,6 +92,10 @@ func (d ColumnType) Format(dialect DialectType, size OptionalInt) (string, error
 			if dialect == DialectSQLite {
 				return "INTEGER", nil
 			}
+			if dialect == DialectPostgres {
+				// Postgres doesn't take a display width
+				return "INTEGER", nil
+			}
 			mod := ""
 			if size.Set {
 				mod = fmt.Sprintf("(%d)", size.Value)
@@ -101,6 +111,11 @@ func (d ColumnType) Format(dialect DialectType, size OptionalInt) (string, error
 			if size.Set {
 				mod = fmt.Sprintf("(%d)", size.Value)
 			}
+			if dialect == DialectPostgres {
+				// Postgres pads CHAR values with spaces when reading them
+				// back, unlike MySQL
+				return "VARCHAR" + mod, nil
+			}
 			return "CHAR" + mod, nil
 		}
 	case ColumnTypeVarChar:
@@ -119,9 +134,16 @@ func (d ColumnType) Format(dialect DialectType, size OptionalInt) (string, error
 			if dialect == DialectSQLite {
 				return "INTEGER", nil
 			}
+			if dialect == DialectPostgres {
+				// Booleans are stored as 0 or 1 everywhere
+				return "SMALLINT", nil
+			}
 			return "TINYINT(1)", nil
 		}
 	case ColumnTypeDateTime:
+		if dialect == DialectPostgres {
+			return "TIMESTAMPTZ", nil
+		}
 		return "DATETIME", nil
 	case ColumnTypeText:
 		return "TEXT", nil
@@ -261,3 +283,7 @@ func (b *CreateTableSqlBuilder) ToSQL() (string, error) {
 
 	return str.String(), nil
 }
+
+func (b *DropTableSqlBuilder) ToSQL() (string, error) {
+	return fmt.Sprintf("DROP TABLE %s", b.Name), nil
+}
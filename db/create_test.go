@@ -10,6 +10,8 @@ func TestDialect_Column(t *testing.T) {
 	assert.Equal(t, DialectSQLite, c1.Dialect)
 	c2 := DialectMySQL.Column("foo", ColumnTypeBool, UnsetSize)
 	assert.Equal(t, DialectMySQL, c2.Dialect)
+	c3 := DialectPostgres.Column("foo", ColumnTypeBool, UnsetSize)
+	assert.Equal(t, DialectPostgres, c3.Dialect)
 }
 
 func TestColumnType_Format(t *testing.T) {
@@ -44,6 +46,16 @@ func TestColumnType_Format(t *testing.T) {
 		{"MySQL text", ColumnTypeText, args{dialect: DialectMySQL}, "TEXT", false},
 		{"MySQL datetime", ColumnTypeDateTime, args{dialect: DialectMySQL}, "DATETIME", false},
 
+		{"Postgres bool", ColumnTypeBool, args{dialect: DialectPostgres}, "SMALLINT", false},
+		{"Postgres small int", ColumnTypeSmallInt, args{dialect: DialectPostgres}, "SMALLINT", false},
+		{"Postgres small int with param", ColumnTypeSmallInt, args{dialect: DialectPostgres, size: OptionalInt{true, 3}}, "SMALLINT", false},
+		{"Postgres int", ColumnTypeInteger, args{dialect: DialectPostgres}, "INTEGER", false},
+		{"Postgres int with param", ColumnTypeInteger, args{dialect: DialectPostgres, size: OptionalInt{true, 11}}, "INTEGER", false},
+		{"Postgres char with param", ColumnTypeChar, args{dialect: DialectPostgres, size: OptionalInt{true, 4}}, "VARCHAR(4)", false},
+		{"Postgres varchar with param", ColumnTypeVarChar, args{dialect: DialectPostgres, size: OptionalInt{true, 25}}, "VARCHAR(25)", false},
+		{"Postgres text", ColumnTypeText, args{dialect: DialectPostgres}, "TEXT", false},
+		{"Postgres datetime", ColumnTypeDateTime, args{dialect: DialectPostgres}, "TIMESTAMPTZ", false},
+
 		{"invalid column type", 10000, args{dialect: DialectMySQL}, "", true},
 		{"invalid dialect", ColumnTypeBool, args{dialect: 10000}, "", true},
 	}
@@ -106,6 +118,11 @@ func TestColumn_Build(t *testing.T) {
 		{"MySQL text nullable", fields{DialectMySQL, "foo", true, UnsetDefault, ColumnTypeText, UnsetSize, false}, "foo TEXT", false},
 		{"MySQL datetime", fields{DialectMySQL, "foo", false, UnsetDefault, ColumnTypeDateTime, UnsetSize, false}, "foo DATETIME NOT NULL", false},
 		{"MySQL datetime nullable", fields{DialectMySQL, "foo", true, UnsetDefault, ColumnTypeDateTime, UnsetSize, false}, "foo DATETIME", false},
+
+		{"Postgres bool", fields{DialectPostgres, "foo", false, UnsetDefault, ColumnTypeBool, UnsetSize, false}, "foo SMALLINT NOT NULL", false},
+		{"Postgres int", fields{DialectPostgres, "foo", false, UnsetDefault, ColumnTypeInteger, UnsetSize, true}, "foo INTEGER NOT NULL PRIMARY KEY", false},
+		{"Postgres varchar nullable", fields{DialectPostgres, "foo", true, UnsetDefault, ColumnTypeVarChar, OptionalInt{true, 128}, false}, "foo VARCHAR(128)", false},
+		{"Postgres datetime", fields{DialectPostgres, "foo", false, UnsetDefault, ColumnTypeDateTime, UnsetSize, false}, "foo TIMESTAMPTZ NOT NULL", false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
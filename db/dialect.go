@@ -5,8 +5,9 @@ import "fmt"
 type DialectType int
 
 const (
-	DialectSQLite DialectType = iota
-	DialectMySQL  DialectType = iota
+	DialectSQLite   DialectType = iota
+	DialectMySQL    DialectType = iota
+	DialectPostgres DialectType = iota
 )
 
 func (d DialectType) Column(name string, t ColumnType, size OptionalInt) *Column {
@@ -15,6 +16,8 @@ func (d DialectType) Column(name string, t ColumnType, size OptionalInt) *Column
 		return &Column{Dialect: DialectSQLite, Name: name, Type: t, Size: size}
 	case DialectMySQL:
 		return &Column{Dialect: DialectMySQL, Name: name, Type: t, Size: size}
+	case DialectPostgres:
+		return &Column{Dialect: DialectPostgres, Name: name, Type: t, Size: size}
 	default:
 		panic(fmt.Sprintf("unexpected dialect: %d", d))
 	}
@@ -26,6 +29,8 @@ func (d DialectType) Table(name string) *CreateTableSqlBuilder {
 		return &CreateTableSqlBuilder{Dialect: DialectSQLite, Name: name}
 	case DialectMySQL:
 		return &CreateTableSqlBuilder{Dialect: DialectMySQL, Name: name}
+	case DialectPostgres:
+		return &CreateTableSqlBuilder{Dialect: DialectPostgres, Name: name}
 	default:
 		panic(fmt.Sprintf("unexpected dialect: %d", d))
 	}
@@ -37,6 +42,8 @@ func (d DialectType) AlterTable(name string) *AlterTableSqlBuilder {
 		return &AlterTableSqlBuilder{Dialect: DialectSQLite, Name: name}
 	case DialectMySQL:
 		return &AlterTableSqlBuilder{Dialect: DialectMySQL, Name: name}
+	case DialectPostgres:
+		return &AlterTableSqlBuilder{Dialect: DialectPostgres, Name: name}
 	default:
 		panic(fmt.Sprintf("unexpected dialect: %d", d))
 	}
@@ -48,6 +55,8 @@ func (d DialectType) CreateUniqueIndex(name, table string, columns ...string) *C
 		return &CreateIndexSqlBuilder{Dialect: DialectSQLite, Name: name, Table: table, Unique: true, Columns: columns}
 	case DialectMySQL:
 		return &CreateIndexSqlBuilder{Dialect: DialectMySQL, Name: name, Table: table, Unique: true, Columns: columns}
+	case DialectPostgres:
+		return &CreateIndexSqlBuilder{Dialect: DialectPostgres, Name: name, Table: table, Unique: true, Columns: columns}
 	default:
 		panic(fmt.Sprintf("unexpected dialect: %d", d))
 	}
@@ -59,6 +68,8 @@ func (d DialectType) CreateIndex(name, table string, columns ...string) *CreateI
 		return &CreateIndexSqlBuilder{Dialect: DialectSQLite, Name: name, Table: table, Unique: false, Columns: columns}
 	case DialectMySQL:
 		return &CreateIndexSqlBuilder{Dialect: DialectMySQL, Name: name, Table: table, Unique: false, Columns: columns}
+	case DialectPostgres:
+		return &CreateIndexSqlBuilder{Dialect: DialectPostgres, Name: name, Table: table, Unique: false, Columns: columns}
 	default:
 		panic(fmt.Sprintf("unexpected dialect: %d", d))
 	}
@@ -70,6 +81,21 @@ func (d DialectType) DropIndex(name, table string) *DropIndexSqlBuilder {
 		return &DropIndexSqlBuilder{Dialect: DialectSQLite, Name: name, Table: table}
 	case DialectMySQL:
 		return &DropIndexSqlBuilder{Dialect: DialectMySQL, Name: name, Table: table}
+	case DialectPostgres:
+		return &DropIndexSqlBuilder{Dialect: DialectPostgres, Name: name, Table: table}
+	default:
+		panic(fmt.Sprintf("unexpected dialect: %d", d))
+	}
+}
+
+func (d DialectType) DropTable(name string) *DropTableSqlBuilder {
+	switch d {
+	case DialectSQLite:
+		return &DropTableSqlBuilder{Dialect: DialectSQLite, Name: name}
+	case DialectMySQL:
+		return &DropTableSqlBuilder{Dialect: DialectMySQL, Name: name}
+	case DialectPostgres:
+		return &DropTableSqlBuilder{Dialect: DialectPostgres, Name: name}
 	default:
 		panic(fmt.Sprintf("unexpected dialect: %d", d))
 	}
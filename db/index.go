@@ -49,5 +49,8 @@ func (b *CreateIndexSqlBuilder) ToSQL() (string, error) {
 }
 
 func (b *DropIndexSqlBuilder) ToSQL() (string, error) {
+	if b.Dialect != DialectMySQL {
+		return fmt.Sprintf("DROP INDEX %s", b.Name), nil
+	}
 	return fmt.Sprintf("DROP INDEX %s on %s", b.Name, b.Table), nil
 }
@@ -0,0 +1,379 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/writeas/web-core/log"
+	"github.com/writefreely/writefreely/migrations"
+)
+
+// ConvertDatabase copies every table from the app's configured database into
+// the database configured in destCfgFile, which must be empty. Both databases
+// end up on the same migration version, with the same row IDs and encrypted
+// data, so the destination configuration should use the same keys as the
+// source.
+func ConvertDatabase(apper Apper, destCfgFile string) error {
+	apper.LoadConfig()
+	src := apper.App()
+	connectToDatabase(src)
+	defer shutdown(src)
+
+	dest := NewApp(destCfgFile)
+	dest.LoadConfig()
+	if dest.cfg.Database == src.cfg.Database {
+		return fmt.Errorf("Source and destination databases are the same")
+	}
+	connectToDatabase(dest)
+	defer dest.db.Close()
+
+	// Both databases need the same schema before copying anything
+	srcVer, err := src.db.migrationVersion()
+	if err != nil {
+		return fmt.Errorf("Unable to get source database version: %s", err)
+	}
+	if srcVer != migrations.CurrentVer() {
+		return fmt.Errorf("Source database is on V%d, but this version of WriteFreely needs V%d. Run: writefreely -c %s db migrate", srcVer, migrations.CurrentVer(), src.cfgFile)
+	}
+
+	tables, err := src.db.tableNames()
+	if err != nil {
+		return fmt.Errorf("Unable to list source tables: %s", err)
+	}
+	err = prepareEmptyDatabase(dest, tables)
+	if err != nil {
+		return err
+	}
+	kinds, err := dest.db.allColumnKinds(tables)
+	if err != nil {
+		return fmt.Errorf("Unable to read destination tables: %s", err)
+	}
+
+	// Copy everything in one transaction, so if anything goes wrong the
+	// destination is left empty and the conversion can just be run again
+	tx, err := dest.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = clearMigrations(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, t := range tables {
+		log.Info("Copying %s...", t)
+		n, err := copyTable(src.db, dest.db, tx, t, kinds[t])
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Unable to copy %s: %s", t, err)
+		}
+		log.Info("Copied %d row(s).", n)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("Unable to save copied data: %s", err)
+	}
+
+	log.Info("Verifying...")
+	var mismatches []string
+	for _, t := range tables {
+		srcN, err := src.db.countRows(t)
+		if err != nil {
+			return err
+		}
+		destN, err := dest.db.countRows(t)
+		if err != nil {
+			return err
+		}
+		if srcN != destN {
+			mismatches = append(mismatches, fmt.Sprintf("%s (%d in source, %d in destination)", t, srcN, destN))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("Row counts don't match: %s", strings.Join(mismatches, ", "))
+	}
+
+	log.Info("Done! Copied %d tables. Point WriteFreely at %s to start using the new database, keeping the same keys.", len(tables), destCfgFile)
+	return nil
+}
+
+// prepareEmptyDatabase sets up and migrates the app's database if needed, then
+// makes sure it has all the given tables and that they're empty, so rows can
+// be copied in with their original IDs. Migration state is left alone, so the
+// database stays usable if copying fails; clear it with clearMigrations in the
+// same transaction the rows are copied in.
+func prepareEmptyDatabase(app *App, tables []string) error {
+	var err error
+	if !app.db.DatabaseInitialized() {
+		log.Info("Initializing destination database...")
+		err = adminInitDatabase(app)
+	} else {
+		err = migrations.Migrate(migrations.NewDatastore(app.db.DB, app.db.driverName))
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to set up destination database: %s", err)
+	}
+
+	destTables, err := app.db.tableNames()
+	if err != nil {
+		return fmt.Errorf("Unable to list destination tables: %s", err)
+	}
+	destHas := map[string]bool{}
+	for _, t := range destTables {
+		destHas[t] = true
+	}
+	for _, t := range tables {
+		if !destHas[t] {
+			return fmt.Errorf("Destination database has no %s table", t)
+		}
+		if t == "appmigrations" {
+			continue
+		}
+		n, err := app.db.countRows(t)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("Destination database isn't empty: %s has %d row(s)", t, n)
+		}
+	}
+	return nil
+}
+
+// clearMigrations deletes the destination's migration state, since it gets
+// copied along with everything else.
+func clearMigrations(tx *sql.Tx) error {
+	_, err := tx.Exec("DELETE FROM appmigrations")
+	if err != nil {
+		return fmt.Errorf("Unable to clear destination appmigrations: %s", err)
+	}
+	return nil
+}
+
+// copyTable copies all rows in the given table from one datastore to another
+// within the given transaction on dest, returning the number of rows copied.
+func copyTable(src, dest *datastore, tx *sql.Tx, table string, kinds map[string]columnKind) (int64, error) {
+	rows, err := src.Query("SELECT * FROM " + src.quoteIdent(table))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	ti, err := dest.newTableInserter(tx, table, cols, kinds)
+	if err != nil {
+		return 0, err
+	}
+	vals := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	for rows.Next() {
+		err = rows.Scan(ptrs...)
+		if err != nil {
+			ti.abort()
+			return ti.n, err
+		}
+		err = ti.insert(vals)
+		if err != nil {
+			ti.abort()
+			return ti.n, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		ti.abort()
+		return ti.n, err
+	}
+	return ti.finish()
+}
+
+// tableInserter adds rows to a table within a transaction, keeping their
+// original IDs.
+type tableInserter struct {
+	db    *datastore
+	table string
+	cols  []string
+	kinds map[string]columnKind
+	t     *sql.Tx
+	stmt  *sql.Stmt
+	n     int64
+}
+
+// newTableInserter prepares to insert rows with the given columns into table,
+// which has the given column kinds, as returned by columnKinds.
+func (db *datastore) newTableInserter(t *sql.Tx, table string, cols []string, kinds map[string]columnKind) (*tableInserter, error) {
+	quotedCols := make([]string, len(cols))
+	for i, c := range cols {
+		quotedCols[i] = db.quoteIdent(c)
+	}
+	q := "INSERT INTO " + db.quoteIdent(table) + " (" + strings.Join(quotedCols, ", ") + ") VALUES (" + strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ") + ")"
+
+	stmt, err := t.Prepare(q)
+	if err != nil {
+		return nil, err
+	}
+	return &tableInserter{db: db, table: table, cols: cols, kinds: kinds, t: t, stmt: stmt}, nil
+}
+
+// kind returns the kind of data the given column holds in the destination.
+func (ti *tableInserter) kind(i int) columnKind {
+	return ti.kinds[strings.ToLower(ti.cols[i])]
+}
+
+func (ti *tableInserter) insert(vals []interface{}) error {
+	for i := range vals {
+		// Drivers hand back text as either strings or bytes, so store it
+		// as whatever the destination column expects. SQLite keeps some
+		// binary data in text columns, so that stays as bytes.
+		switch v := vals[i].(type) {
+		case []byte:
+			if ti.kind(i) != columnBinary && utf8.Valid(v) {
+				vals[i] = string(v)
+			}
+		case string:
+			if ti.kind(i) == columnBinary {
+				vals[i] = []byte(v)
+			}
+		}
+	}
+	_, err := ti.stmt.Exec(vals...)
+	if err != nil {
+		return err
+	}
+	ti.n++
+	return nil
+}
+
+// abort stops inserting rows. The caller rolls back the transaction.
+func (ti *tableInserter) abort() {
+	ti.stmt.Close()
+}
+
+// finish wraps up inserting rows, returning how many there were. They're saved
+// when the caller commits the transaction.
+func (ti *tableInserter) finish() (int64, error) {
+	defer ti.stmt.Close()
+	if ti.db.driverName == driverPostgres && pgSerialTables[ti.table] && ti.n > 0 {
+		// Inserting IDs directly doesn't advance the ID sequence
+		_, err := ti.t.Exec("SELECT setval(pg_get_serial_sequence('" + ti.table + "', 'id'), (SELECT MAX(id) FROM " + ti.table + "))")
+		if err != nil {
+			return ti.n, err
+		}
+	}
+	return ti.n, nil
+}
+
+// tableNames returns the names of all WriteFreely tables in the database.
+func (db *datastore) tableNames() ([]string, error) {
+	var rows *sql.Rows
+	var err error
+	if db.driverName == driverSQLite {
+		rows, err = db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	} else if db.driverName == driverPostgres {
+		rows, err = db.Query("SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name")
+	} else {
+		rows, err = db.Query("SHOW TABLES")
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var t string
+		err = rows.Scan(&t)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+type columnKind int
+
+const (
+	columnOther columnKind = iota
+	columnBinary
+	columnTime
+)
+
+// columnKinds returns what kind of data each column in the given table holds,
+// keyed by lowercase column name.
+func (db *datastore) columnKinds(table string) (map[string]columnKind, error) {
+	rows, err := db.Query("SELECT * FROM " + db.quoteIdent(table) + " WHERE 1 = 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	kinds := map[string]columnKind{}
+	for _, ct := range types {
+		t := strings.ToUpper(ct.DatabaseTypeName())
+		k := columnOther
+		if strings.Contains(t, "BLOB") || strings.Contains(t, "BINARY") || t == "BYTEA" {
+			k = columnBinary
+		} else if strings.Contains(t, "DATE") || strings.Contains(t, "TIME") {
+			// Backups hold these as text, which needs parsing back on restore
+			k = columnTime
+		}
+		kinds[strings.ToLower(ct.Name())] = k
+	}
+	return kinds, nil
+}
+
+// allColumnKinds returns the column kinds of each of the given tables.
+func (db *datastore) allColumnKinds(tables []string) (map[string]map[string]columnKind, error) {
+	kinds := map[string]map[string]columnKind{}
+	for _, t := range tables {
+		k, err := db.columnKinds(t)
+		if err != nil {
+			return nil, err
+		}
+		kinds[t] = k
+	}
+	return kinds, nil
+}
+
+func (db *datastore) countRows(table string) (int64, error) {
+	var n int64
+	err := db.QueryRow("SELECT COUNT(*) FROM " + db.quoteIdent(table)).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to count %s rows: %s", table, err)
+	}
+	return n, nil
+}
+
+func (db *datastore) migrationVersion() (int, error) {
+	var v sql.NullInt64
+	err := db.QueryRow("SELECT MAX(version) FROM appmigrations").Scan(&v)
+	return int(v.Int64), err
+}
+
+func (db *datastore) quoteIdent(name string) string {
+	if db.driverName == driverMySQL {
+		return "`" + name + "`"
+	}
+	return `"` + name + `"`
+}
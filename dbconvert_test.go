@@ -0,0 +1,164 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	uuid "github.com/nu7hatch/gouuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/writefreely/writefreely/config"
+	"github.com/writefreely/writefreely/migrations"
+)
+
+// newTestSQLiteConfig saves a config for a SQLite database and keys in dir,
+// and returns the config file's path.
+func newTestSQLiteConfig(t *testing.T, dir string) string {
+	cfg := config.New()
+	cfg.UseSQLite(true)
+	cfg.Database.FileName = filepath.Join(dir, "writefreely.db")
+	cfg.Server.KeysParentDir = dir
+	cfgFile := filepath.Join(dir, "config.ini")
+	if err := config.Save(cfg, cfgFile); err != nil {
+		t.Fatal(err)
+	}
+	return cfgFile
+}
+
+// newTestSQLiteApp returns an app with a new, initialized SQLite database in
+// its own directory, connected.
+func newTestSQLiteApp(t *testing.T) *App {
+	app := NewApp(newTestSQLiteConfig(t, t.TempDir()))
+	assert.NoError(t, app.LoadConfig())
+	connectToDatabase(app)
+	if err := adminInitDatabase(app); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestConvertDatabase(t *testing.T) {
+	if !SQLiteEnabled {
+		t.Skip("skipping conversion tests without SQLite")
+	}
+
+	src := newTestSQLiteApp(t)
+	alice := createTestUser(t, src, "alice", "password")
+	createTestUser(t, src, "bob", "password")
+	title, content := "Hello", "Some words"
+	c, err := src.db.GetCollection("alice")
+	assert.NoError(t, err)
+	_, err = src.db.CreatePost(alice.ID, c.ID, &SubmittedPost{Title: &title, Content: &content})
+	assert.NoError(t, err)
+	src.db.Close()
+
+	dest := newTestSQLiteApp(t)
+	defer dest.db.Close()
+	rowsIn := func(app *App, table string) int64 {
+		n, err := app.db.countRows(table)
+		assert.NoError(t, err)
+		return n
+	}
+
+	// Make copying fail partway through, after collections are copied
+	_, err = dest.db.Exec("CREATE TRIGGER fail_copy BEFORE INSERT ON posts BEGIN SELECT RAISE(ABORT, 'copy failed'); END")
+	assert.NoError(t, err)
+	err = ConvertDatabase(NewApp(src.cfgFile), dest.cfgFile)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "copy failed")
+	}
+	// which leaves the destination empty, and still migrated
+	assert.Equal(t, int64(0), rowsIn(dest, "collections"))
+	assert.Equal(t, int64(0), rowsIn(dest, "users"))
+	v, err := dest.db.migrationVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, migrations.CurrentVer(), v)
+
+	// so it can just be run again
+	_, err = dest.db.Exec("DROP TRIGGER fail_copy")
+	assert.NoError(t, err)
+	assert.NoError(t, ConvertDatabase(NewApp(src.cfgFile), dest.cfgFile))
+	assert.Equal(t, int64(2), rowsIn(dest, "users"))
+	u, err := dest.db.GetUserByID(alice.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", u.Username)
+	}
+	assert.Equal(t, int64(1), rowsIn(dest, "posts"))
+	v, err = dest.db.migrationVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, migrations.CurrentVer(), v)
+
+	// Now it isn't empty, so it won't be copied into again
+	err = ConvertDatabase(NewApp(src.cfgFile), dest.cfgFile)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "isn't empty")
+	}
+	assert.Equal(t, int64(2), rowsIn(dest, "users"))
+}
+
+func TestConvertDatabaseToMySQL(t *testing.T) {
+	if !runMySQLTests() || !SQLiteEnabled {
+		t.Skip("skipping MySQL conversion tests")
+	}
+
+	src := newTestSQLiteApp(t)
+	alice := createTestUser(t, src, "alice", "password")
+	src.keys = newTestApp(src.db).keys
+	bob := createTestUser(t, src, "bob", "password")
+	assert.NoError(t, src.db.UpdateUserEmail(src.keys, bob.ID, "bob@example.com"))
+	srcAlice, err := src.db.GetUserByID(alice.ID)
+	assert.NoError(t, err)
+	srcBob, err := src.db.GetUserByID(bob.ID)
+	assert.NoError(t, err)
+	src.db.Close()
+
+	// Convert into a new, empty MySQL database
+	tUUID, _ := uuid.NewV4()
+	dbName := "wfconvert_" + strings.Replace(tUUID.String(), "-", "_", -1)
+	_, err = testDB.Exec("CREATE DATABASE " + dbName)
+	assert.NoError(t, err)
+	defer testDB.Exec("DROP DATABASE " + dbName)
+	dir := t.TempDir()
+	cfg := config.New()
+	cfg.Database.User = os.Getenv("WF_USER")
+	cfg.Database.Password = os.Getenv("WF_PASSWORD")
+	cfg.Database.Database = dbName
+	if host := os.Getenv("WF_HOST"); host != "" {
+		cfg.Database.Host = host
+	}
+	cfgFile := filepath.Join(dir, "config.ini")
+	assert.NoError(t, config.Save(cfg, cfgFile))
+	assert.NoError(t, ConvertDatabase(NewApp(src.cfgFile), cfgFile))
+
+	dest := NewApp(cfgFile)
+	assert.NoError(t, dest.LoadConfig())
+	connectToDatabase(dest)
+	defer dest.db.Close()
+	v, err := dest.db.migrationVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, migrations.CurrentVer(), v)
+
+	// Times and NULLs come through as they were
+	u, err := dest.db.GetUserByID(alice.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", u.Username)
+		assert.False(t, u.Email.Valid)
+		assert.True(t, srcAlice.Created.Equal(u.Created), "created %s, expected %s", u.Created, srcAlice.Created)
+	}
+	u, err = dest.db.GetUserByID(bob.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, srcBob.Email, u.Email)
+		assert.True(t, srcBob.Created.Equal(u.Created), "created %s, expected %s", u.Created, srcBob.Created)
+	}
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/writeas/web-core/activitystreams"
+	"github.com/writeas/web-core/log"
+)
+
+// actorDelete is a blog actor to announce the deletion of, and where to.
+type actorDelete struct {
+	actor   *activitystreams.Person
+	inboxes []string
+}
+
+// scheduleAccountDeletion hides the given user's account and logs them out
+// everywhere. The account is purged after the configured grace period, unless
+// they log back in first.
+func scheduleAccountDeletion(app *App, userID int64) error {
+	err := app.db.ScheduleAccountDeletion(userID, app.cfg.App.DeletionGraceDays)
+	if err != nil {
+		return err
+	}
+	if err = app.db.DeleteAllUserSessions(userID); err != nil {
+		log.Error("Unable to log out user %d after scheduling deletion: %v", userID, err)
+	}
+	if app.timeline != nil {
+		updateTimelineCache(app.timeline, true)
+	}
+	log.Info("Scheduled user %d for deletion in %d days", userID, app.cfg.App.DeletionGraceDays)
+	return nil
+}
+
+// restoreAccount cancels the pending deletion of the given user's account, if
+// there is one, as they log in.
+func restoreAccount(app *App, w http.ResponseWriter, r *http.Request, u *User) error {
+	if !u.IsDeleting() {
+		return nil
+	}
+	err := app.db.CancelAccountDeletion(u.ID)
+	if err != nil {
+		log.Error("Login: Unable to restore account %d: %v", u.ID, err)
+		return ErrInternalGeneral
+	}
+	u.Status &^= UserDeleting
+	log.Info("Login: Restored account %d, which was waiting to be deleted", u.ID)
+	_ = addSessionFlash(app, w, r, "Welcome back! Your account was restored and won't be deleted.", nil)
+	return nil
+}
+
+// purgeAccount deletes the given user's account for good, and tells their
+// blogs' followers that those blogs are gone.
+func purgeAccount(app *App, userID int64) error {
+	// The deletion takes blogs' keys and followers with it, so gather what's
+	// needed to announce it first
+	deletes := prepareActorDeletes(app, userID)
+
+	err := app.db.DeleteAccount(userID)
+	if err != nil {
+		return err
+	}
+	go federateActorDeletes(app, deletes)
+	return nil
+}
+
+func prepareActorDeletes(app *App, userID int64) []actorDelete {
+	if app.cfg.App.Private || !app.cfg.App.Federation {
+		return nil
+	}
+	colls, err := app.db.GetCollections(&User{ID: userID}, app.cfg.App.Host)
+	if err != nil {
+		log.Error("Couldn't get collections to announce deletion: %v", err)
+		return nil
+	}
+
+	deletes := []actorDelete{}
+	for _, c := range *colls {
+		followers, err := app.db.GetAPFollowers(&c)
+		if err != nil {
+			log.Error("Couldn't get followers to announce deletion of %s: %v", c.Alias, err)
+			continue
+		}
+		seen := map[string]bool{}
+		d := actorDelete{}
+		for _, f := range *followers {
+			inbox := f.SharedInbox
+			if inbox == "" {
+				inbox = f.Inbox
+			}
+			if !seen[inbox] {
+				seen[inbox] = true
+				d.inboxes = append(d.inboxes, inbox)
+			}
+		}
+		if len(d.inboxes) == 0 {
+			continue
+		}
+		c.db = app.db
+		d.actor = c.PersonObject()
+		deletes = append(deletes, d)
+	}
+	return deletes
+}
+
+func federateActorDeletes(app *App, deletes []actorDelete) {
+	for _, d := range deletes {
+		del := &actorActivity{
+			BaseObject: activitystreams.BaseObject{
+				Context: []interface{}{activitystreams.Namespace},
+				ID:      d.actor.ID + "#delete",
+				Type:    "Delete",
+			},
+			Actor:  d.actor.ID,
+			Object: d.actor.ID,
+			To:     []string{"https://www.w3.org/ns/activitystreams#Public"},
+		}
+		log.Info("Announcing deletion of %s to %d inboxes", d.actor.ID, len(d.inboxes))
+		for _, inbox := range d.inboxes {
+			if err := makeActivityPost(app.cfg.App.Host, d.actor, inbox, del); err != nil {
+				log.Error("Couldn't post Delete! %v", err)
+			}
+		}
+	}
+}
+
+// runAccountPurgeJobs queues a job to purge each account whose deletion grace
+// period is over, then runs the queued jobs. Jobs that fail stay queued, to be
+// tried again the next time the jobs queue runs.
+func runAccountPurgeJobs(app *App) {
+	ids, err := app.db.GetAccountsToPurge()
+	if err != nil {
+		log.Error("[jobs] %s - Skipping account purges.", err)
+		return
+	}
+	jobs, err := app.db.GetQueuedJobs(jobPurgeAccount)
+	if err != nil {
+		log.Error("[jobs] %s - Skipping account purges.", err)
+		return
+	}
+	due := map[string]bool{}
+	for _, id := range ids {
+		due[strconv.FormatInt(id, 10)] = true
+	}
+	queued := map[string]bool{}
+	for _, j := range jobs {
+		queued[j.PostID] = true
+	}
+	for _, id := range ids {
+		uid := strconv.FormatInt(id, 10)
+		if queued[uid] {
+			continue
+		}
+		j := &PostJob{PostID: uid, Action: jobPurgeAccount}
+		if err = app.db.InsertJob(j); err != nil {
+			log.Error("[jobs] Unable to queue purge of user %s: %v", uid, err)
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+
+	for _, j := range jobs {
+		if !due[j.PostID] {
+			// The account was restored, or is already gone
+			log.Info("[job #%d] User %s no longer waiting to be purged", j.ID, j.PostID)
+			app.db.DeleteJob(j.ID)
+			continue
+		}
+		id, _ := strconv.ParseInt(j.PostID, 10, 64)
+		if err = purgeAccount(app, id); err != nil {
+			log.Error("[job #%d] Unable to purge user %d: %v", j.ID, id, err)
+			continue
+		}
+		log.Info("[job #%d] Purged user %d.", j.ID, id)
+		app.db.DeleteJob(j.ID)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountDeletion(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.cfg.App.Host = "https://example.com"
+		app.cfg.App.Federation = true
+		app.cfg.App.DeletionGraceDays = 30
+		app.InitRateLimits()
+		alice := createTestUser(t, app, "alice", "password")
+		bob := createTestUser(t, app, "bob", "password")
+		_, err := db.CreateUserSession(alice.ID, "test", "192.0.2.1")
+		assert.NoError(t, err)
+
+		wfr := wfResolver{db: db, cfg: app.cfg}
+		_, err = wfr.FindUser("alice", "example.com", "example.com", nil)
+		assert.NoError(t, err)
+
+		// Scheduling hides the account and logs it out, but keeps it around
+		assert.NoError(t, scheduleAccountDeletion(app, alice.ID))
+		u, err := db.GetUserByID(alice.ID)
+		assert.NoError(t, err)
+		assert.True(t, u.IsDeleting())
+		hidden, err := db.IsUserHidden(alice.ID)
+		assert.NoError(t, err)
+		assert.True(t, hidden)
+		silenced, err := db.IsUserSilenced(alice.ID)
+		assert.NoError(t, err)
+		assert.False(t, silenced)
+		if purgeAfter := db.GetAccountDeletionTime(alice.ID); assert.NotNil(t, purgeAfter) {
+			assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), *purgeAfter, time.Hour)
+		}
+		sessions, err := db.GetUserSessions(alice.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, sessions)
+		_, err = wfr.FindUser("alice", "example.com", "example.com", nil)
+		assert.Equal(t, wfUserNotFoundErr, err)
+		ids, err := db.GetAccountsToPurge()
+		assert.NoError(t, err)
+		assert.Empty(t, ids)
+
+		// Its blog pages are all hidden
+		c, err := db.GetCollection("alice")
+		assert.NoError(t, err)
+		assert.NoError(t, db.SetCollectionAttribute(c.ID, "email_subs", "1"))
+		for _, view := range []struct {
+			handler func(*App, http.ResponseWriter, *http.Request) error
+			vars    map[string]string
+		}{
+			{handleViewCollectionLang, map[string]string{"collection": "alice", "lang": "en"}},
+			{handleViewCollectionLetters, map[string]string{"collection": "alice"}},
+		} {
+			req := mux.SetURLVars(httptest.NewRequest("GET", "/alice/", nil), view.vars)
+			assert.Equal(t, ErrCollectionNotFound, view.handler(app, httptest.NewRecorder(), req))
+		}
+		// and nothing can be published by email
+		assert.NoError(t, db.SetUserAttribute(alice.ID, userAttrPostByEmail, "alicetoken"))
+		assert.Equal(t, errInboundUnknownRecipient, postFromEmail(app, "alicetoken", &inboundMessage{Subject: "Hello", Body: "Still here"}))
+
+		// Logging back in restores it
+		body, _ := json.Marshal(userCredentials{Alias: "alice", Pass: "password"})
+		req := httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "test")
+		assert.NoError(t, login(app, httptest.NewRecorder(), req))
+		u, err = db.GetUserByID(alice.ID)
+		assert.NoError(t, err)
+		assert.False(t, u.IsDeleting())
+		assert.Nil(t, db.GetAccountDeletionTime(alice.ID))
+		_, err = wfr.FindUser("alice", "example.com", "example.com", nil)
+		assert.NoError(t, err)
+
+		// Once the grace period is over, the account is purged by the jobs
+		// queue
+		app.cfg.App.DeletionGraceDays = 0
+		assert.NoError(t, scheduleAccountDeletion(app, alice.ID))
+		ids, err = db.GetAccountsToPurge()
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{alice.ID}, ids)
+
+		runAccountPurgeJobs(app)
+		_, err = db.GetUserByID(alice.ID)
+		assert.Equal(t, ErrUserNotFound, err)
+		ids, err = db.GetAccountsToPurge()
+		assert.NoError(t, err)
+		assert.Empty(t, ids)
+		jobs, err := db.GetQueuedJobs(jobPurgeAccount)
+		assert.NoError(t, err)
+		assert.Empty(t, jobs)
+		_, err = db.GetUserByID(bob.ID)
+		assert.NoError(t, err)
+	})
+}
+
+func TestAccountPurgeJobs(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.cfg.App.DeletionGraceDays = 0
+		alice := createTestUser(t, app, "alice", "password")
+
+		// A purge queued for an account that's since been restored is dropped
+		assert.NoError(t, scheduleAccountDeletion(app, alice.ID))
+		assert.NoError(t, db.InsertJob(&PostJob{PostID: strconv.FormatInt(alice.ID, 10), Action: jobPurgeAccount}))
+		assert.NoError(t, db.CancelAccountDeletion(alice.ID))
+		runAccountPurgeJobs(app)
+		_, err := db.GetUserByID(alice.ID)
+		assert.NoError(t, err)
+		jobs, err := db.GetQueuedJobs(jobPurgeAccount)
+		assert.NoError(t, err)
+		assert.Empty(t, jobs)
+
+		// A purge that fails stays queued, to be tried again
+		assert.NoError(t, scheduleAccountDeletion(app, alice.ID))
+		_, err = db.Exec("CREATE TRIGGER fail_purge BEFORE DELETE ON users BEGIN SELECT RAISE(ABORT, 'purge failed'); END")
+		assert.NoError(t, err)
+		runAccountPurgeJobs(app)
+		runAccountPurgeJobs(app)
+		jobs, err = db.GetQueuedJobs(jobPurgeAccount)
+		assert.NoError(t, err)
+		if assert.Len(t, jobs, 1) {
+			assert.Equal(t, strconv.FormatInt(alice.ID, 10), jobs[0].PostID)
+		}
+
+		_, err = db.Exec("DROP TRIGGER fail_purge")
+		assert.NoError(t, err)
+		runAccountPurgeJobs(app)
+		_, err = db.GetUserByID(alice.ID)
+		assert.Equal(t, ErrUserNotFound, err)
+		jobs, err = db.GetQueuedJobs(jobPurgeAccount)
+		assert.NoError(t, err)
+		assert.Empty(t, jobs)
+	})
+}
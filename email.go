@@ -11,15 +11,18 @@
 package writefreely
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/aymerick/douceur/inliner"
 	"github.com/gorilla/mux"
 	"github.com/mailgun/mailgun-go"
 	stripmd "github.com/writeas/go-strip-markdown/v2"
@@ -32,6 +35,15 @@ import (
 
 const (
 	emailSendDelay = 15
+
+	// Delivery statuses of a single email recipient
+	emailStatusAccepted     = "accepted"
+	emailStatusFailed       = "failed"
+	emailStatusDeferred     = "deferred"
+	emailStatusDelivered    = "delivered"
+	emailStatusBounced      = "bounced"
+	emailStatusComplained   = "complained"
+	emailStatusUnsubscribed = "unsubscribed"
 )
 
 type (
@@ -56,6 +68,38 @@ type (
 		AllowExport bool
 		acctEmail   sql.NullString
 	}
+
+	// EmailSend is a record of a single post being sent out to a collection's
+	// email subscribers.
+	EmailSend struct {
+		ID           int64
+		PostID       string
+		CollectionID int64
+		MessageID    string
+		Recipients   int
+		Failures     int
+		Error        string
+		Sent         time.Time
+
+		// Extra data, only populated when listing sends
+		PostTitle string
+		PostSlug  string
+		Delivered int
+		Bounced   int
+	}
+
+	// EmailSendRecipient is the delivery status of an EmailSend for a single
+	// subscriber.
+	EmailSendRecipient struct {
+		SubscriberID string
+		Email        sql.NullString
+		// EmailHash identifies the address this was sent to, for matching
+		// delivery events to it. See emailLookupHash.
+		EmailHash string
+		Status    string
+		Details   sql.NullString
+		Updated   time.Time
+	}
 )
 
 func (es *EmailSubscriber) FinalEmail(keys *key.Keychain) string {
@@ -75,6 +119,29 @@ func (es *EmailSubscriber) SubscribedFriendly() string {
 	return es.Subscribed.Format("January 2, 2006")
 }
 
+func (es *EmailSend) SentFriendly() string {
+	return es.Sent.Format("January 2, 2006 15:04")
+}
+
+func (es *EmailSend) DisplayTitle() string {
+	if es.PostTitle != "" {
+		return es.PostTitle
+	}
+	if es.PostSlug != "" {
+		return es.PostSlug
+	}
+	return es.PostID
+}
+
+func (r *EmailSendRecipient) UpdatedFriendly() string {
+	return r.Updated.Format("January 2, 2006 15:04")
+}
+
+// IsFailure returns whether or not the email never reached this recipient.
+func (r *EmailSendRecipient) IsFailure() bool {
+	return r.Status == emailStatusFailed || r.Status == emailStatusBounced
+}
+
 func handleCreateEmailSubscription(app *App, w http.ResponseWriter, r *http.Request) error {
 	reqJSON := IsJSON(r)
 	vars := mux.Vars(r)
@@ -117,9 +184,9 @@ func handleCreateEmailSubscription(app *App, w http.ResponseWriter, r *http.Requ
 	c.hostName = app.cfg.App.Host
 
 	from := c.CanonicalURL()
-	isAuthorBanned, err := app.db.IsUserSilenced(c.OwnerID)
-	if isAuthorBanned {
-		log.Info("Author is silenced, so subscription is blocked.")
+	hidden, err := app.db.IsUserHidden(c.OwnerID)
+	if hidden {
+		log.Info("Author is hidden, so subscription is blocked.")
 		return impart.HTTPError{http.StatusFound, from}
 	}
 
@@ -141,11 +208,19 @@ func handleCreateEmailSubscription(app *App, w http.ResponseWriter, r *http.Requ
 	}
 
 	confirmed := app.db.IsSubscriberConfirmed(ss.Email)
+	existing := app.db.IsEmailSubscriber(ss.Email, ss.UserID, c.ID)
 	es, err := app.db.AddEmailSubscription(c.ID, ss.UserID, ss.Email, confirmed)
 	if err != nil {
 		log.Error("addEmailSubscription: %s", err)
 		return err
 	}
+	if confirmed && !existing {
+		subscriber := ss.Email
+		if subscriber == "" && u != nil {
+			subscriber = u.Username
+		}
+		go notifyUser(app, c, notifySubscriber, subscriber, "", "")
+	}
 
 	// Send confirmation email if needed
 	if !confirmed {
@@ -272,17 +347,169 @@ func handleConfirmEmailSubscription(app *App, w http.ResponseWriter, r *http.Req
 
 	from := c.CanonicalURL()
 
-	err = app.db.UpdateSubscriberConfirmed(subID, token)
+	email, _ := app.db.FetchEmailSubscriberEmail(subID, token)
+	collIDs, err := app.db.UpdateSubscriberConfirmed(subID, token)
 	if err != nil {
 		addSessionFlash(app, w, r, err.Error(), nil)
 		return impart.HTTPError{http.StatusFound, from}
 	}
+	// Let each blog's owner know about their new subscriber, once
+	for _, id := range collIDs {
+		subColl := c
+		if id != c.ID {
+			subColl, err = app.db.GetCollectionByID(id)
+			if err != nil {
+				log.Error("Get collection %d to notify: %s", id, err)
+				continue
+			}
+		}
+		go notifyUser(app, subColl, notifySubscriber, email, "", "")
+	}
 
 	addSessionFlash(app, w, r, "<strong>Confirmed</strong>! Thanks. Now you'll receive future blog posts via email.", nil)
 	return impart.HTTPError{http.StatusFound, from}
 }
 
-func emailPost(app *App, p *PublicPost, collID int64) error {
+// mailgunEvent is a delivery event webhook payload sent by Mailgun.
+type mailgunEvent struct {
+	Signature struct {
+		Timestamp string `json:"timestamp"`
+		Token     string `json:"token"`
+		Signature string `json:"signature"`
+	} `json:"signature"`
+	EventData struct {
+		Event     string `json:"event"`
+		Severity  string `json:"severity"`
+		Reason    string `json:"reason"`
+		Recipient string `json:"recipient"`
+		Message   struct {
+			Headers struct {
+				MessageID string `json:"message-id"`
+			} `json:"headers"`
+		} `json:"message"`
+		DeliveryStatus struct {
+			Code        int    `json:"code"`
+			Message     string `json:"message"`
+			Description string `json:"description"`
+		} `json:"delivery-status"`
+	} `json:"event-data"`
+}
+
+// verify checks that the event was signed with the given webhook signing key,
+// and that it was sent recently enough.
+func (e *mailgunEvent) verify(signingKey string) bool {
+	ts, err := strconv.ParseInt(e.Signature.Timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if time.Since(time.Unix(ts, 0)) > 15*time.Minute {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(e.Signature.Timestamp + e.Signature.Token))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(e.Signature.Signature))
+}
+
+// status returns the recipient status this event represents, and whether or
+// not the recipient should be unsubscribed because of it.
+func (e *mailgunEvent) status() (string, bool) {
+	switch e.EventData.Event {
+	case "delivered":
+		return emailStatusDelivered, false
+	case "failed":
+		if e.EventData.Severity == "permanent" {
+			return emailStatusBounced, true
+		}
+		return emailStatusDeferred, false
+	case "complained":
+		return emailStatusComplained, true
+	case "unsubscribed":
+		return emailStatusUnsubscribed, true
+	}
+	return "", false
+}
+
+func (e *mailgunEvent) details() string {
+	ds := e.EventData.DeliveryStatus
+	d := ds.Description
+	if d == "" {
+		d = ds.Message
+	}
+	if ds.Code != 0 {
+		d = fmt.Sprintf("%d %s", ds.Code, d)
+	}
+	d = strings.TrimSpace(d)
+	if len(d) > 255 {
+		d = d[:255]
+	}
+	return d
+}
+
+// handleMailgunEvent receives delivery events for letters from Mailgun,
+// updating the send log and automatically unsubscribing any addresses that
+// hard-bounce or complain.
+func handleMailgunEvent(app *App, w http.ResponseWriter, r *http.Request) error {
+	if !app.cfg.Email.EventsEnabled() {
+		return impart.HTTPError{http.StatusNotFound, "Email events aren't enabled on this instance."}
+	}
+
+	e := &mailgunEvent{}
+	err := json.NewDecoder(r.Body).Decode(e)
+	if err != nil {
+		log.Error("Couldn't parse mailgun event: %v", err)
+		return ErrBadJSON
+	}
+	if !e.verify(app.cfg.Email.WebhookSigningKey) {
+		log.Info("[email] Rejecting mailgun event with invalid signature")
+		return impart.HTTPError{http.StatusUnauthorized, "Invalid signature."}
+	}
+
+	status, unsubscribe := e.status()
+	if status == "" {
+		// Not an event we track, but acknowledge it so it isn't retried
+		return impart.WriteSuccess(w, "", http.StatusOK)
+	}
+
+	msgID := normalizeMessageID(e.EventData.Message.Headers.MessageID)
+	send, err := app.db.GetEmailSendByMessageID(msgID)
+	if err != nil {
+		return err
+	}
+	if send == nil {
+		log.Info("[email] Ignoring %s event for unknown message %s", e.EventData.Event, msgID)
+		return impart.WriteSuccess(w, "", http.StatusOK)
+	}
+
+	sub, err := app.db.GetEmailSendSubscriber(send.ID, emailLookupHash(app.keys, e.EventData.Recipient))
+	if err != nil {
+		return err
+	}
+	if sub == nil {
+		log.Info("[email] No current subscriber for %s event on message %s", e.EventData.Event, msgID)
+		return impart.WriteSuccess(w, "", http.StatusOK)
+	}
+
+	err = app.db.UpdateEmailRecipientStatus(send.ID, sub.ID, status, e.details())
+	if err != nil {
+		return err
+	}
+
+	if unsubscribe {
+		log.Info("[email] Unsubscribing %s from collection %d after %s event", sub.ID, send.CollectionID, status)
+		err = app.db.DeleteEmailSubscriber(sub.ID, sub.Token)
+		if err != nil {
+			log.Error("Unable to delete subscriber %s: %v", sub.ID, err)
+			return err
+		}
+	}
+
+	return impart.WriteSuccess(w, "", http.StatusOK)
+}
+
+// prepareLetterPost formats the given post's content for sending as a letter.
+func prepareLetterPost(app *App, p *PublicPost) {
 	p.augmentContent()
 
 	// Do some shortcode replacement.
@@ -293,23 +520,26 @@ func emailPost(app *App, p *PublicPost, collID int64) error {
 		p.formatContent(app.cfg, false, false)
 	}
 	p.augmentReadingDestination()
+}
 
-	title := p.Title.String
-	if title != "" {
-		title = p.Title.String + "\n\n"
-	}
-	plainMsg := title + "A new post from " + p.CanonicalURL(app.cfg.App.Host) + "\n\n" + stripmd.Strip(p.Content)
-	plainMsg += `
-
----------------------------------------------------------------------------------
-
-Originally published on ` + p.Collection.DisplayTitle() + ` (` + p.Collection.CanonicalURL() + `), a blog you subscribe to.
+// emailPost sends the given post to all confirmed email subscribers of the
+// given collection, returning the Letter that went out, if any.
+func emailPost(app *App, p *PublicPost, collID int64) (*Letter, error) {
+	prepareLetterPost(app, p)
 
-Sent to %recipient.to%. Unsubscribe: ` + p.Collection.CanonicalURL() + `email/unsubscribe/%recipient.id%?t=%recipient.token%`
+	html, plainMsg, err := renderLetter(app, p, collID)
+	if err != nil {
+		log.Error("Unable to render letter: %v", err)
+		return nil, err
+	}
 
 	gun := mailgun.NewMailgun(app.cfg.Email.Domain, app.cfg.Email.MailgunPrivate)
 	m := mailgun.NewMessage(p.Collection.DisplayTitle()+" <"+p.Collection.Alias+"@"+app.cfg.Email.Domain+">", stripmd.Strip(p.DisplayTitle()), plainMsg)
 	replyTo := app.db.GetCollectionAttribute(collID, collAttrLetterReplyTo)
+	if replyTo == "" && app.cfg.Email.InboundEnabled() {
+		// Route replies back through the instance to the author
+		replyTo = letterReplyAddress(app.cfg, p.Collection.Alias)
+	}
 	if replyTo != "" {
 		m.SetReplyTo(replyTo)
 	}
@@ -317,100 +547,31 @@ Sent to %recipient.to%. Unsubscribe: ` + p.Collection.CanonicalURL() + `email/un
 	subs, err := app.db.GetEmailSubscribers(collID, true)
 	if err != nil {
 		log.Error("Unable to get email subscribers: %v", err)
-		return err
+		return nil, err
 	}
 	if len(subs) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	if title != "" {
-		title = string(`<h2 id="title">` + p.FormattedDisplayTitle() + `</h2>`)
-	}
 	m.AddTag("New post")
 
-	fontFam := "Lora, Palatino, Baskerville, serif"
-	if p.IsSans() {
-		fontFam = `"Open Sans", Tahoma, Arial, sans-serif`
-	} else if p.IsMonospace() {
-		fontFam = `Hack, consolas, Menlo-Regular, Menlo, Monaco, monospace, monospace`
-	}
-
-	// TODO: move this to a templated file and LESS-generated stylesheet
-	fullHTML := `<html>
-	<head>
-		<style>
-		body {
-			font-size: 120%;
-			font-family: ` + fontFam + `;
-			margin: 1em 2em;
-		}
-		#article {
-			line-height: 1.5;
-			margin: 1.5em 0;
-			white-space: pre-wrap;
-			word-wrap: break-word;
-		}
-		h1, h2, h3, h4, h5, h6, p, code {
-			display: inline
-		}
-		img, iframe, video {
-			max-width: 100%
-		}
-		#title {
-			margin-bottom: 1em;
-			display: block;
-		}
-		.intro {
-			font-style: italic;
-			font-size: 0.95em;
-		}
-		div#footer {
-			text-align: center;
-			max-width: 35em;
-			margin: 2em auto;
-		}
-		div#footer p {
-			display: block;
-			font-size: 0.86em;
-			color: #666;
-		}
-		hr {
-			border: 1px solid #ccc;
-			margin: 2em 1em;
-		}
-		p#emailsub {
-			text-align: center;
-			display: inline-block !important;
-			width: 100%;
-			font-style: italic;
-		}
-		</style>
-	</head>
-	<body>
-		<div id="article">` + title + `<p class="intro">From <a href="` + p.CanonicalURL(app.cfg.App.Host) + `">` + p.DisplayCanonicalURL() + `</a></p>
-
-` + string(p.HTMLContent) + `</div>
-		<hr />
-		<div id="footer">
-			<p>Originally published on <a href="` + p.Collection.CanonicalURL() + `">` + p.Collection.DisplayTitle() + `</a>, a blog you subscribe to.</p>
-			<p>Sent to %recipient.to%. <a href="` + p.Collection.CanonicalURL() + `email/unsubscribe/%recipient.id%?t=%recipient.token%">Unsubscribe</a>.</p>
-		</div>
-	</body>
-</html>`
-
-	// inline CSS
-	html, err := inliner.Inline(fullHTML)
-	if err != nil {
-		log.Error("Unable to inline email HTML: %v", err)
-		return err
-	}
-
 	m.SetHtml(html)
 
 	log.Info("[email] Adding %d recipient(s)", len(subs))
+	send := &EmailSend{
+		PostID:       p.ID,
+		CollectionID: collID,
+		Recipients:   len(subs),
+	}
+	recipients := make([]*EmailSendRecipient, 0, len(subs))
 	for _, s := range subs {
 		e := s.FinalEmail(app.keys)
 		log.Info("[email] Adding %s", e)
+		r := &EmailSendRecipient{
+			SubscriberID: s.ID,
+			EmailHash:    emailLookupHash(app.keys, e),
+			Status:       emailStatusAccepted,
+		}
 		err = m.AddRecipientAndVariables(e, map[string]interface{}{
 			"id":    s.ID,
 			"to":    e,
@@ -418,17 +579,57 @@ Sent to %recipient.to%. Unsubscribe: ` + p.Collection.CanonicalURL() + `email/un
 		})
 		if err != nil {
 			log.Error("Unable to add receipient %s: %s", e, err)
+			r.Status = emailStatusFailed
+			r.Details = sql.NullString{String: err.Error(), Valid: true}
+			send.Failures++
 		}
+		recipients = append(recipients, r)
 	}
 
-	res, _, err := gun.Send(m)
+	res, msgID, err := gun.Send(m)
 	log.Info("[email] Send result: %s", res)
 	if err != nil {
 		log.Error("Unable to send post email: %v", err)
-		return err
+		send.Error = err.Error()
+		if len(send.Error) > 255 {
+			send.Error = send.Error[:255]
+		}
+		send.Failures = len(subs)
+		for _, r := range recipients {
+			r.Status = emailStatusFailed
+		}
 	}
+	send.MessageID = normalizeMessageID(msgID)
 
-	return nil
+	if logErr := app.db.InsertEmailSend(send, recipients); logErr != nil {
+		log.Error("Unable to log email send for post %s: %v", p.ID, logErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Letter{
+		CollectionID: collID,
+		PostID:       p.ID,
+		SendID:       send.ID,
+		Subject:      stripmd.Strip(p.DisplayTitle()),
+		Content:      archivedLetterHTML(&p.Collection.Collection, html),
+	}, nil
+}
+
+// emailLookupHash returns a hash of the given email address, keyed with the
+// email key, so the address can be found again without storing it in the
+// clear or decrypting every address it could be.
+func emailLookupHash(keys *key.Keychain, email string) string {
+	mac := hmac.New(sha256.New, keys.EmailKey)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// normalizeMessageID strips the angle brackets that the mail provider returns
+// around message IDs on sending, but not in delivery events.
+func normalizeMessageID(id string) string {
+	return strings.Trim(strings.TrimSpace(id), "<>")
 }
 
 func sendSubConfirmEmail(app *App, c *Collection, email, subID, token string) error {
@@ -0,0 +1,680 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mailgun/mailgun-go"
+	"github.com/writeas/impart"
+	"github.com/writeas/web-core/id"
+	"github.com/writeas/web-core/log"
+	"github.com/writefreely/writefreely/config"
+)
+
+const (
+	// Local-part prefixes of the addresses this instance receives mail on
+	inboundPostPrefix  = "post"
+	inboundReplyPrefix = "reply"
+
+	inboundMaxMessageSize = 10 << 20
+	inboundMaxRecipients  = 50
+
+	// Posting tokens are lowercase, since mail servers don't reliably
+	// preserve the case of local parts.
+	postingTokenChars = "0123456789bcdfghjklmnpqrstvwxyz"
+	postingTokenLen   = 20
+)
+
+var (
+	errInboundUnknownRecipient = errors.New("unknown recipient")
+	errInboundUnknownSender    = errors.New("sender isn't a subscriber")
+	errInboundTooManyReplies   = errors.New("too many replies")
+
+	inboundHTMLBreaks  = regexp.MustCompile(`(?i)<br\s*/?>`)
+	inboundHTMLBlocks  = regexp.MustCompile(`(?i)</(p|div|h[1-6]|li|blockquote|pre)>`)
+	inboundExtraBreaks = regexp.MustCompile(`\n{3,}`)
+	// Signature separators ("-- ") lose their trailing space in
+	// quoted-printable bodies, so either form is accepted after a blank line.
+	inboundSignature = regexp.MustCompile(`(?:^|\n\s*\n)-- ?(?:\n|$)`)
+)
+
+type (
+	// inboundMessage is an email received by the instance, reduced to the
+	// parts we use.
+	inboundMessage struct {
+		Header  mail.Header
+		From    string
+		Subject string
+		Body    string
+	}
+
+	// PostingAddress is a secret address that a user can send email to in
+	// order to publish to a collection, or to their drafts when Collection is
+	// nil.
+	PostingAddress struct {
+		Collection *Collection
+		Address    string
+	}
+)
+
+// postingAddress returns the full email address for the given posting token.
+func postingAddress(cfg *config.Config, token string) string {
+	return inboundPostPrefix + "+" + token + "@" + cfg.Email.InboundHost()
+}
+
+// letterReplyAddress returns the address that replies to the given
+// collection's letters are sent to, to be forwarded on to its owner.
+func letterReplyAddress(cfg *config.Config, alias string) string {
+	return inboundReplyPrefix + "+" + alias + "@" + cfg.Email.InboundHost()
+}
+
+// parseInboundAddress splits an address on the instance's inbound domain into
+// its kind (e.g. inboundPostPrefix) and value. It returns empty strings for
+// any other address.
+func parseInboundAddress(addr, host string) (string, string) {
+	addr = strings.ToLower(strings.Trim(strings.TrimSpace(addr), "<>"))
+	at := strings.LastIndex(addr, "@")
+	if at == -1 || !strings.EqualFold(addr[at+1:], host) {
+		return "", ""
+	}
+	parts := strings.SplitN(addr[:at], "+", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", ""
+	}
+	switch parts[0] {
+	case inboundPostPrefix, inboundReplyPrefix:
+		return parts[0], parts[1]
+	}
+	return "", ""
+}
+
+// parseInboundMessage reads a raw MIME message, keeping its subject and a
+// plain-text version of its body. Attachments are ignored.
+func parseInboundMessage(r io.Reader) (*inboundMessage, error) {
+	m, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := new(mime.WordDecoder)
+	msg := &inboundMessage{
+		Header: m.Header,
+	}
+	msg.Subject, err = dec.DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		msg.Subject = m.Header.Get("Subject")
+	}
+	msg.Subject = strings.TrimSpace(msg.Subject)
+	if from, err := mail.ParseAddress(m.Header.Get("From")); err == nil {
+		msg.From = from.Address
+	}
+
+	text, html, err := readInboundBody(m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Body)
+	if err != nil {
+		return nil, err
+	}
+	if text == "" && html != "" {
+		text = inboundHTMLBreaks.ReplaceAllString(html, "\n")
+		text = inboundHTMLBlocks.ReplaceAllString(text, "$0\n\n")
+		text = stripHTMLWithoutEscaping(text)
+	}
+	msg.Body = cleanInboundBody(text)
+
+	return msg, nil
+}
+
+// readInboundBody returns the first plain-text and HTML parts found in the
+// given (possibly multipart) body.
+func readInboundBody(contentType, encoding string, body io.Reader) (text, html string, err error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return text, html, err
+			}
+			if disp, _, _ := mime.ParseMediaType(p.Header.Get("Content-Disposition")); disp == "attachment" {
+				continue
+			}
+			t, h, err := readInboundBody(p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p)
+			if err != nil {
+				return text, html, err
+			}
+			if text == "" {
+				text = t
+			}
+			if html == "" {
+				html = h
+			}
+		}
+		return text, html, nil
+	}
+
+	if mediaType != "text/plain" && mediaType != "text/markdown" && mediaType != "text/html" {
+		return "", "", nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(body, inboundMaxMessageSize))
+	if err != nil {
+		return "", "", err
+	}
+	if mediaType == "text/html" {
+		return "", string(b), nil
+	}
+	return string(b), "", nil
+}
+
+// cleanInboundBody normalizes line endings and strips any signature from the
+// body of an email.
+func cleanInboundBody(s string) string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	if loc := inboundSignature.FindStringIndex(s); loc != nil {
+		s = s[:loc[0]]
+	}
+	s = inboundExtraBreaks.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
+
+// recipient finds the first address on the given inbound domain that the
+// message was sent to, for when the recipient isn't given by the transport.
+func (m *inboundMessage) recipient(host string) string {
+	for _, h := range []string{"Delivered-To", "X-Original-To", "To", "Cc"} {
+		addrs, err := m.Header.AddressList(h)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if kind, _ := parseInboundAddress(a.Address, host); kind != "" {
+				return a.Address
+			}
+		}
+	}
+	return ""
+}
+
+// inboundRecipientExists returns whether or not the given address is one
+// that mail can be delivered to.
+func inboundRecipientExists(app *App, addr string) bool {
+	kind, v := parseInboundAddress(addr, app.cfg.Email.InboundHost())
+	switch kind {
+	case inboundPostPrefix:
+		return app.db.GetCollectionIDByAttribute(collAttrPostByEmail, v) != 0 || app.db.GetUserIDByAttribute(userAttrPostByEmail, v) != 0
+	case inboundReplyPrefix:
+		c, err := app.db.GetCollection(v)
+		return err == nil && c.EmailSubsEnabled()
+	}
+	return false
+}
+
+// receiveInboundEmail delivers the given message to the given recipient.
+func receiveInboundEmail(app *App, rcpt string, msg *inboundMessage) error {
+	kind, v := parseInboundAddress(rcpt, app.cfg.Email.InboundHost())
+	switch kind {
+	case inboundPostPrefix:
+		return postFromEmail(app, v, msg)
+	case inboundReplyPrefix:
+		return forwardLetterReply(app, v, msg)
+	}
+	return errInboundUnknownRecipient
+}
+
+// postFromEmail publishes the given message as a post, to whichever
+// collection (or user's drafts) the posting token belongs to.
+func postFromEmail(app *App, token string, msg *inboundMessage) error {
+	var userID int64
+	var coll *Collection
+	if collID := app.db.GetCollectionIDByAttribute(collAttrPostByEmail, token); collID != 0 {
+		var err error
+		coll, err = app.db.GetCollectionByID(collID)
+		if err != nil {
+			return err
+		}
+		userID = coll.OwnerID
+	} else {
+		userID = app.db.GetUserIDByAttribute(userAttrPostByEmail, token)
+	}
+	if userID == 0 {
+		return errInboundUnknownRecipient
+	}
+
+	u, err := app.db.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if u.IsSilenced() {
+		return ErrUserSilenced
+	}
+	if u.IsDeleting() {
+		// Nothing gets published while the account waits to be deleted
+		return errInboundUnknownRecipient
+	}
+	if needsEmailVerification(app, userID) {
+		return ErrEmailNotVerified
+	}
+	if msg.Subject == "" && msg.Body == "" {
+		return ErrNoPublishableContent
+	}
+
+	p := &SubmittedPost{
+		Title:   &msg.Subject,
+		Content: &msg.Body,
+		Font:    "norm",
+	}
+	var collID int64
+	if coll != nil {
+		collID = coll.ID
+	}
+	post, err := app.db.CreatePost(userID, collID, p)
+	if err != nil {
+		return err
+	}
+	log.Info("[email] Created post %s from email for user %d", post.ID, userID)
+
+	if scoreFirstPost(app, userID, msg.Body) || coll == nil {
+		return nil
+	}
+	coll.hostName = app.cfg.App.Host
+	coll.ForPublic()
+	newPost := &PublicPost{Post: post, Collection: &CollectionObj{Collection: *coll}}
+	newPost.extractData()
+
+	if !app.cfg.App.Private && app.cfg.App.Federation {
+		go federatePost(app, newPost, coll.ID, false)
+	}
+	if app.cfg.Email.Enabled() && coll.EmailSubsEnabled() {
+		go app.db.InsertJob(&PostJob{
+			PostID: newPost.ID,
+			Action: "email",
+			Delay:  emailSendDelay,
+		})
+	}
+	return nil
+}
+
+// forwardLetterReply sends a reply to one of the given collection's letters
+// on to the collection owner.
+func forwardLetterReply(app *App, alias string, msg *inboundMessage) error {
+	if !app.cfg.Email.Enabled() {
+		return errInboundUnknownRecipient
+	}
+	c, err := app.db.GetCollection(alias)
+	if err != nil {
+		return errInboundUnknownRecipient
+	}
+	err = checkLetterReply(app, c, msg.From)
+	if err != nil {
+		log.Info("[email] Dropping reply to %s from %q: %v", c.Alias, msg.From, err)
+		return err
+	}
+	u, err := app.db.GetUserByID(c.OwnerID)
+	if err != nil {
+		return err
+	}
+	to := u.EmailClear(app.keys)
+	if to == "" {
+		log.Info("[email] Dropping reply to %s: owner has no email address", c.Alias)
+		return nil
+	}
+
+	from := msg.From
+	if from == "" {
+		from = "Someone"
+	}
+	plainMsg := from + " replied to a letter from " + c.DisplayTitle() + ` (` + c.CanonicalURL() + `):
+
+` + msg.Body
+
+	gun := mailgun.NewMailgun(app.cfg.Email.Domain, app.cfg.Email.MailgunPrivate)
+	m := mailgun.NewMessage(c.DisplayTitle()+" <"+c.Alias+"@"+app.cfg.Email.Domain+">", msg.Subject, plainMsg, fmt.Sprintf("<%s>", to))
+	if msg.From != "" {
+		m.SetReplyTo(msg.From)
+	}
+	m.AddTag("Letter reply")
+	_, _, err = gun.Send(m)
+	if err != nil {
+		log.Error("Unable to forward letter reply for %s: %v", c.Alias, err)
+		return err
+	}
+	return nil
+}
+
+// checkLetterReply returns an error if a reply from the given sender shouldn't
+// be forwarded to the collection's owner. Only so many replies to each
+// collection are looked at an hour, and only ones from confirmed subscribers
+// that were sent a letter at that address are forwarded, so the reply address
+// can't be used to send owners spam.
+func checkLetterReply(app *App, c *Collection, from string) error {
+	if ok, _ := app.limits.letterReply.allow(strconv.FormatInt(c.ID, 10)); !ok {
+		return errInboundTooManyReplies
+	}
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return errInboundUnknownSender
+	}
+	subscribed, err := app.db.IsLetterRecipient(c.ID, emailLookupHash(app.keys, addr.Address))
+	if err != nil {
+		return err
+	}
+	if !subscribed {
+		return errInboundUnknownSender
+	}
+	return nil
+}
+
+// handleInboundEmail receives raw MIME messages over HTTP, either directly as
+// the request body, or as the `body-mime` field that Mailgun routes post.
+func handleInboundEmail(app *App, w http.ResponseWriter, r *http.Request) error {
+	cfg := app.cfg.Email
+	if cfg.InboundWebhookKey == "" {
+		return impart.HTTPError{http.StatusNotFound, "Inbound email isn't enabled on this instance."}
+	}
+	if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("key")), []byte(cfg.InboundWebhookKey)) != 1 {
+		return impart.HTTPError{http.StatusUnauthorized, "Invalid key."}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, inboundMaxMessageSize)
+	rcpt := r.URL.Query().Get("recipient")
+	var raw io.Reader
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" || mediaType == "application/x-www-form-urlencoded" {
+		if rcpt == "" {
+			rcpt = r.FormValue("recipient")
+		}
+		raw = strings.NewReader(r.FormValue("body-mime"))
+	} else {
+		raw = r.Body
+	}
+
+	msg, err := parseInboundMessage(raw)
+	if err != nil {
+		log.Error("Unable to parse inbound email: %v", err)
+		return impart.HTTPError{http.StatusBadRequest, "Unable to parse message."}
+	}
+	if rcpt == "" {
+		rcpt = msg.recipient(cfg.InboundHost())
+	}
+
+	err = receiveInboundEmail(app, rcpt, msg)
+	if err != nil {
+		if err == errInboundUnknownRecipient {
+			// Mailgun stops retrying on 406
+			return impart.HTTPError{http.StatusNotAcceptable, "Unknown recipient."}
+		}
+		if herr, ok := err.(impart.HTTPError); ok {
+			return herr
+		}
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to receive message."}
+	}
+	return impart.WriteSuccess(w, "", http.StatusOK)
+}
+
+// handlePostingAddress generates, resets, or disables the user's posting
+// address for a collection, or for their drafts.
+func handlePostingAddress(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	if !app.cfg.Email.InboundEnabled() {
+		return impart.HTTPError{http.StatusNotFound, "Inbound email isn't enabled on this instance."}
+	}
+
+	alias := r.FormValue("collection")
+	disable := r.FormValue("disable") == "1"
+	token := id.GenerateRandomString(postingTokenChars, postingTokenLen)
+	var err error
+	if alias == "" {
+		if disable {
+			err = app.db.DeleteUserAttribute(u.ID, userAttrPostByEmail)
+		} else {
+			err = app.db.SetUserAttribute(u.ID, userAttrPostByEmail, token)
+		}
+	} else {
+		var c *Collection
+		c, err = app.db.GetCollection(alias)
+		if err != nil {
+			return err
+		}
+		if c.OwnerID != u.ID {
+			return ErrForbiddenCollection
+		}
+		if disable {
+			err = app.db.DeleteCollectionAttribute(c.ID, collAttrPostByEmail)
+		} else {
+			err = app.db.SetCollectionAttribute(c.ID, collAttrPostByEmail, token)
+		}
+	}
+	if err != nil {
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to update posting address."}
+	}
+
+	if disable {
+		_ = addSessionFlash(app, w, r, "Posting address disabled.", nil)
+	} else {
+		_ = addSessionFlash(app, w, r, "New posting address generated.", nil)
+	}
+	return impart.HTTPError{http.StatusFound, "/me/settings"}
+}
+
+// getPostingAddresses returns the user's drafts posting address, followed by
+// the posting address of each of their collections. Addresses that haven't
+// been generated are left empty.
+func getPostingAddresses(app *App, u *User) ([]PostingAddress, error) {
+	addrs := []PostingAddress{}
+	if t := app.db.GetUserAttribute(u.ID, userAttrPostByEmail); t != "" {
+		addrs = append(addrs, PostingAddress{Address: postingAddress(app.cfg, t)})
+	} else {
+		addrs = append(addrs, PostingAddress{})
+	}
+
+	colls, err := app.db.GetCollections(u, app.cfg.App.Host)
+	if err != nil {
+		return nil, err
+	}
+	for i := range *colls {
+		c := &(*colls)[i]
+		pa := PostingAddress{Collection: c}
+		if t := app.db.GetCollectionAttribute(c.ID, collAttrPostByEmail); t != "" {
+			pa.Address = postingAddress(app.cfg, t)
+		}
+		addrs = append(addrs, pa)
+	}
+	return addrs, nil
+}
+
+// initInboundSMTP starts the built-in SMTP listener for receiving mail.
+func initInboundSMTP(app *App) {
+	bind := app.cfg.Email.InboundSMTPBind
+	l, err := net.Listen("tcp", bind)
+	if err != nil {
+		log.Error("Unable to start inbound SMTP listener: %v", err)
+		return
+	}
+	log.Info("Receiving email on smtp://%s", bind)
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			log.Error("[smtp] Accept: %v", err)
+			continue
+		}
+		go serveInboundSMTP(app, c)
+	}
+}
+
+// serveInboundSMTP speaks just enough SMTP to accept messages for known
+// inbound addresses. It never relays mail anywhere else.
+func serveInboundSMTP(app *App, c net.Conn) {
+	defer c.Close()
+	tc := textproto.NewConn(c)
+	host := app.cfg.Email.InboundHost()
+
+	var from string
+	var hasFrom bool
+	var rcpts []string
+	reset := func() {
+		from = ""
+		hasFrom = false
+		rcpts = nil
+	}
+
+	c.SetDeadline(time.Now().Add(5 * time.Minute))
+	tc.PrintfLine("220 %s ESMTP WriteFreely", host)
+	for {
+		c.SetDeadline(time.Now().Add(5 * time.Minute))
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i != -1 {
+			cmd, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch strings.ToUpper(cmd) {
+		case "HELO":
+			tc.PrintfLine("250 %s", host)
+		case "EHLO":
+			tc.PrintfLine("250-%s", host)
+			tc.PrintfLine("250-SIZE %d", inboundMaxMessageSize)
+			tc.PrintfLine("250 8BITMIME")
+		case "MAIL":
+			if !strings.HasPrefix(strings.ToUpper(arg), "FROM:") {
+				tc.PrintfLine("501 5.5.4 Syntax: MAIL FROM:<address>")
+				continue
+			}
+			reset()
+			from = smtpPath(arg[5:])
+			hasFrom = true
+			tc.PrintfLine("250 2.1.0 OK")
+		case "RCPT":
+			if !hasFrom {
+				tc.PrintfLine("503 5.5.1 Need MAIL first")
+				continue
+			}
+			if !strings.HasPrefix(strings.ToUpper(arg), "TO:") {
+				tc.PrintfLine("501 5.5.4 Syntax: RCPT TO:<address>")
+				continue
+			}
+			if len(rcpts) >= inboundMaxRecipients {
+				tc.PrintfLine("452 4.5.3 Too many recipients")
+				continue
+			}
+			rcpt := smtpPath(arg[3:])
+			if !inboundRecipientExists(app, rcpt) {
+				tc.PrintfLine("550 5.1.1 No such user")
+				continue
+			}
+			rcpts = append(rcpts, rcpt)
+			tc.PrintfLine("250 2.1.5 OK")
+		case "DATA":
+			if len(rcpts) == 0 {
+				tc.PrintfLine("503 5.5.1 Need RCPT first")
+				continue
+			}
+			tc.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			dr := tc.DotReader()
+			data, err := ioutil.ReadAll(io.LimitReader(dr, inboundMaxMessageSize+1))
+			if err != nil {
+				return
+			}
+			if len(data) > inboundMaxMessageSize {
+				io.Copy(ioutil.Discard, dr)
+				tc.PrintfLine("552 5.3.4 Message too big")
+				reset()
+				continue
+			}
+			tc.PrintfLine("%s", smtpDeliver(app, from, rcpts, data))
+			reset()
+		case "RSET":
+			reset()
+			tc.PrintfLine("250 2.0.0 OK")
+		case "NOOP":
+			tc.PrintfLine("250 2.0.0 OK")
+		case "VRFY":
+			tc.PrintfLine("252 2.5.0 Cannot VRFY user")
+		case "QUIT":
+			tc.PrintfLine("221 2.0.0 Bye")
+			return
+		default:
+			tc.PrintfLine("502 5.5.2 Command not implemented")
+		}
+	}
+}
+
+// smtpDeliver delivers a received message to each recipient, returning the
+// SMTP reply for the transaction.
+func smtpDeliver(app *App, from string, rcpts []string, data []byte) string {
+	msg, err := parseInboundMessage(bytes.NewReader(data))
+	if err != nil {
+		log.Error("[smtp] Unable to parse message from %s: %v", from, err)
+		return "554 5.6.0 Unable to parse message"
+	}
+	if msg.From == "" {
+		msg.From = from
+	}
+
+	delivered := 0
+	for _, rcpt := range rcpts {
+		err = receiveInboundEmail(app, rcpt, msg)
+		if err != nil {
+			log.Error("[smtp] Unable to deliver message to %s: %v", rcpt, err)
+			continue
+		}
+		delivered++
+	}
+	if delivered == 0 {
+		return "554 5.0.0 Unable to deliver message"
+	}
+	return "250 2.0.0 OK"
+}
+
+// smtpPath extracts the address from a MAIL or RCPT path argument, e.g.
+// "<user@example.com> SIZE=1000".
+func smtpPath(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '<'); i != -1 {
+		if j := strings.IndexByte(s[i:], '>'); j != -1 {
+			return s[i+1 : i+j]
+		}
+	}
+	if i := strings.IndexByte(s, ' '); i != -1 {
+		s = s[:i]
+	}
+	return s
+}
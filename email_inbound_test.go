@@ -0,0 +1,199 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseInboundAddress(t *testing.T) {
+	tests := []struct {
+		addr, kind, v string
+	}{
+		{"post+abc123@in.example.com", inboundPostPrefix, "abc123"},
+		{"<Post+ABC123@IN.example.com>", inboundPostPrefix, "abc123"},
+		{"reply+blog@in.example.com", inboundReplyPrefix, "blog"},
+		{"post+abc123@example.com", "", ""},
+		{"post@in.example.com", "", ""},
+		{"admin+abc@in.example.com", "", ""},
+		{"post+@in.example.com", "", ""},
+	}
+	for _, test := range tests {
+		kind, v := parseInboundAddress(test.addr, "in.example.com")
+		if kind != test.kind || v != test.v {
+			t.Errorf("%s: got (%q, %q), expected (%q, %q)", test.addr, kind, v, test.kind, test.v)
+		}
+	}
+}
+
+func TestParseInboundMessage(t *testing.T) {
+	t.Run("plain", func(t *testing.T) {
+		raw := "From: Matt <matt@example.com>\r\n" +
+			"To: post+abc@in.example.com\r\n" +
+			"Subject: =?UTF-8?Q?Caf=C3=A9_notes?=\r\n" +
+			"Content-Type: text/plain; charset=utf-8\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"Some *markdown* with a long line that wraps=\r\n" +
+			" here.\r\n" +
+			"\r\n" +
+			"-- \r\n" +
+			"Matt\r\n"
+		msg, err := parseInboundMessage(strings.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Subject != "Café notes" {
+			t.Errorf("subject: got %q", msg.Subject)
+		}
+		if msg.From != "matt@example.com" {
+			t.Errorf("from: got %q", msg.From)
+		}
+		if msg.Body != "Some *markdown* with a long line that wraps here." {
+			t.Errorf("body: got %q", msg.Body)
+		}
+		if r := msg.recipient("in.example.com"); r != "post+abc@in.example.com" {
+			t.Errorf("recipient: got %q", r)
+		}
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		raw := "From: matt@example.com\r\n" +
+			"Subject: Hello\r\n" +
+			"Content-Type: multipart/mixed; boundary=outer\r\n" +
+			"\r\n" +
+			"--outer\r\n" +
+			"Content-Type: multipart/alternative; boundary=inner\r\n" +
+			"\r\n" +
+			"--inner\r\n" +
+			"Content-Type: text/html\r\n" +
+			"\r\n" +
+			"<p>HTML version</p>\r\n" +
+			"--inner\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			"UGxhaW4g\r\n" +
+			"dmVyc2lvbg==\r\n" +
+			"--inner--\r\n" +
+			"--outer\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"Content-Disposition: attachment; filename=notes.txt\r\n" +
+			"\r\n" +
+			"Attached\r\n" +
+			"--outer--\r\n"
+		msg, err := parseInboundMessage(strings.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Body != "Plain version" {
+			t.Errorf("body: got %q", msg.Body)
+		}
+	})
+
+	t.Run("html only", func(t *testing.T) {
+		raw := "Subject: Hello\r\n" +
+			"Content-Type: text/html\r\n" +
+			"\r\n" +
+			"<div>First &amp; foremost</div><div>Second<br>line</div>\r\n"
+		msg, err := parseInboundMessage(strings.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Body != "First & foremost\n\nSecond\nline" {
+			t.Errorf("body: got %q", msg.Body)
+		}
+	})
+}
+
+func TestCheckLetterReply(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.cfg.RateLimit.LetterRepliesPerBlog = 8
+		app.InitRateLimits()
+		createTestUser(t, app, "alice", "password")
+		bob := createTestUser(t, app, "bob", "password")
+		if err := db.UpdateUserEmail(app.keys, bob.ID, "bob@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		c, err := db.GetCollection("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := db.GetCollection("bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, sub := range []struct {
+			collID, userID int64
+			email, sentTo  string
+			confirmed      bool
+		}{
+			{c.ID, 0, "reader@example.com", "reader@example.com", true},
+			{c.ID, 0, "pending@example.com", "", false},
+			{c.ID, bob.ID, "", "bob@example.com", true},
+			{c.ID, 0, "new@example.com", "", true},
+			{other.ID, 0, "elsewhere@example.com", "elsewhere@example.com", true},
+		} {
+			es, err := db.AddEmailSubscription(sub.collID, sub.userID, sub.email, sub.confirmed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sub.sentTo == "" {
+				continue
+			}
+			send := &EmailSend{PostID: "post" + strconv.Itoa(i), CollectionID: sub.collID, Recipients: 1}
+			err = db.InsertEmailSend(send, []*EmailSendRecipient{
+				{SubscriberID: es.ID, EmailHash: emailLookupHash(app.keys, sub.sentTo), Status: emailStatusDelivered},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			from string
+			err  error
+		}{
+			{"Reader <Reader@Example.com>", nil},
+			{"bob@example.com", nil},
+			{"pending@example.com", errInboundUnknownSender},
+			{"new@example.com", errInboundUnknownSender},
+			{"elsewhere@example.com", errInboundUnknownSender},
+			{"spammer@example.com", errInboundUnknownSender},
+			{"", errInboundUnknownSender},
+			// Only so many replies are looked at each hour, from anyone
+			{"reader@example.com", nil},
+			{"reader@example.com", errInboundTooManyReplies},
+		}
+		for _, test := range tests {
+			if err := checkLetterReply(app, c, test.from); err != test.err {
+				t.Errorf("%q: got %v, expected %v", test.from, err, test.err)
+			}
+		}
+	})
+}
+
+func TestSMTPPath(t *testing.T) {
+	tests := map[string]string{
+		"<post+abc@example.com>":         "post+abc@example.com",
+		" <matt@example.com> SIZE=1000":  "matt@example.com",
+		"<>":                             "",
+		"matt@example.com BODY=8BITMIME": "matt@example.com",
+	}
+	for in, expected := range tests {
+		if out := smtpPath(in); out != expected {
+			t.Errorf("%q: got %q, expected %q", in, out, expected)
+		}
+	}
+}
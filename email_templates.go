@@ -0,0 +1,351 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/aymerick/douceur/inliner"
+	"github.com/gorilla/mux"
+	"github.com/guregu/null/zero"
+	stripmd "github.com/writeas/go-strip-markdown/v2"
+	"github.com/writeas/impart"
+	"github.com/writeas/web-core/log"
+)
+
+const (
+	// Stand-ins for the recipient variables our mail provider fills in for
+	// each subscriber. They survive template escaping untouched, and are
+	// swapped for the real variables after a letter is rendered.
+	letterRecipientTo    = "WFRCPTADDR"
+	letterRecipientID    = "WFRCPTID"
+	letterRecipientToken = "WFRCPTTOKEN"
+
+	letterTemplateMaxLen = 64 * 1024
+)
+
+var letterRecipientVars = strings.NewReplacer(
+	letterRecipientTo, "%recipient.to%",
+	letterRecipientID, "%recipient.id%",
+	letterRecipientToken, "%recipient.token%",
+)
+
+type (
+	// LetterTemplate holds a collection's custom letter templates. Empty
+	// templates fall back to the default ones.
+	LetterTemplate struct {
+		CollectionID int64
+		HTML         string
+		Text         string
+		Updated      time.Time
+	}
+
+	// LetterTemplateData is what letter templates are executed with.
+	LetterTemplateData struct {
+		Post       LetterPost
+		Collection LetterCollection
+		Recipient  LetterRecipient
+
+		// FontFamily is the CSS font stack matching the post's appearance.
+		FontFamily template.CSS
+	}
+
+	LetterPost struct {
+		Title          string
+		DisplayTitle   string
+		FormattedTitle template.HTML
+		URL            string
+		DisplayURL     string
+		Content        template.HTML
+		PlainContent   string
+		Created        time.Time
+	}
+
+	LetterCollection struct {
+		Alias       string
+		Title       string
+		Description string
+		URL         string
+	}
+
+	LetterRecipient struct {
+		Email          string
+		ID             string
+		Token          string
+		UnsubscribeURL string
+	}
+)
+
+const defaultLetterHTMLTemplate = `<html>
+	<head>
+		<style>
+		body {
+			font-size: 120%;
+			font-family: {{.FontFamily}};
+			margin: 1em 2em;
+		}
+		#article {
+			line-height: 1.5;
+			margin: 1.5em 0;
+			white-space: pre-wrap;
+			word-wrap: break-word;
+		}
+		h1, h2, h3, h4, h5, h6, p, code {
+			display: inline
+		}
+		img, iframe, video {
+			max-width: 100%
+		}
+		#title {
+			margin-bottom: 1em;
+			display: block;
+		}
+		.intro {
+			font-style: italic;
+			font-size: 0.95em;
+		}
+		div#footer {
+			text-align: center;
+			max-width: 35em;
+			margin: 2em auto;
+		}
+		div#footer p {
+			display: block;
+			font-size: 0.86em;
+			color: #666;
+		}
+		hr {
+			border: 1px solid #ccc;
+			margin: 2em 1em;
+		}
+		p#emailsub {
+			text-align: center;
+			display: inline-block !important;
+			width: 100%;
+			font-style: italic;
+		}
+		</style>
+	</head>
+	<body>
+		<div id="article">{{if .Post.Title}}<h2 id="title">{{.Post.FormattedTitle}}</h2>{{end}}<p class="intro">From <a href="{{.Post.URL}}">{{.Post.DisplayURL}}</a></p>
+
+{{.Post.Content}}</div>
+		<hr />
+		<div id="footer">
+			<p>Originally published on <a href="{{.Collection.URL}}">{{.Collection.Title}}</a>, a blog you subscribe to.</p>
+			<p>Sent to {{.Recipient.Email}}. <a href="{{.Recipient.UnsubscribeURL}}">Unsubscribe</a>.</p>
+		</div>
+	</body>
+</html>`
+
+const defaultLetterTextTemplate = `{{if .Post.Title}}{{.Post.Title}}
+
+{{end}}A new post from {{.Post.URL}}
+
+{{.Post.PlainContent}}
+
+---------------------------------------------------------------------------------
+
+Originally published on {{.Collection.Title}} ({{.Collection.URL}}), a blog you subscribe to.
+
+Sent to {{.Recipient.Email}}. Unsubscribe: {{.Recipient.UnsubscribeURL}}`
+
+var (
+	defaultLetterHTML = template.Must(template.New("letter").Parse(defaultLetterHTMLTemplate))
+	defaultLetterText = texttemplate.Must(texttemplate.New("letter").Parse(defaultLetterTextTemplate))
+)
+
+// newLetterTemplateData prepares the given post, which must already have its
+// content formatted, for use in a letter template.
+func newLetterTemplateData(app *App, p *PublicPost) *LetterTemplateData {
+	fontFam := "Lora, Palatino, Baskerville, serif"
+	if p.IsSans() {
+		fontFam = `"Open Sans", Tahoma, Arial, sans-serif`
+	} else if p.IsMonospace() {
+		fontFam = `Hack, consolas, Menlo-Regular, Menlo, Monaco, monospace, monospace`
+	}
+
+	c := p.Collection
+	return &LetterTemplateData{
+		Post: LetterPost{
+			Title:          p.Title.String,
+			DisplayTitle:   stripmd.Strip(p.DisplayTitle()),
+			FormattedTitle: p.FormattedDisplayTitle(),
+			URL:            p.CanonicalURL(app.cfg.App.Host),
+			DisplayURL:     p.DisplayCanonicalURL(),
+			Content:        p.HTMLContent,
+			PlainContent:   stripmd.Strip(p.Content),
+			Created:        p.Created,
+		},
+		Collection: LetterCollection{
+			Alias:       c.Alias,
+			Title:       c.DisplayTitle(),
+			Description: c.Description,
+			URL:         c.CanonicalURL(),
+		},
+		Recipient: LetterRecipient{
+			Email:          letterRecipientTo,
+			ID:             letterRecipientID,
+			Token:          letterRecipientToken,
+			UnsubscribeURL: c.CanonicalURL() + "email/unsubscribe/" + letterRecipientID + "?t=" + letterRecipientToken,
+		},
+		FontFamily: template.CSS(fontFam),
+	}
+}
+
+// parseLetterTemplates parses the given custom templates, returning nil for
+// any that are empty.
+func parseLetterTemplates(htmlSrc, textSrc string) (*template.Template, *texttemplate.Template, error) {
+	var ht *template.Template
+	var tt *texttemplate.Template
+	var err error
+	if strings.TrimSpace(htmlSrc) != "" {
+		ht, err = template.New("letter").Parse(htmlSrc)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if strings.TrimSpace(textSrc) != "" {
+		tt, err = texttemplate.New("letter").Parse(textSrc)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return ht, tt, nil
+}
+
+// validateLetterTemplates checks that the given custom templates parse and
+// execute against a sample post.
+func validateLetterTemplates(htmlSrc, textSrc string) error {
+	if len(htmlSrc) > letterTemplateMaxLen || len(textSrc) > letterTemplateMaxLen {
+		return impart.HTTPError{http.StatusBadRequest, "Letter templates are too long."}
+	}
+	ht, tt, err := parseLetterTemplates(htmlSrc, textSrc)
+	if err != nil {
+		return impart.HTTPError{http.StatusBadRequest, "Invalid letter template: " + err.Error()}
+	}
+	d := &LetterTemplateData{}
+	if ht != nil {
+		if err = ht.Execute(&bytes.Buffer{}, d); err != nil {
+			return impart.HTTPError{http.StatusBadRequest, "Invalid HTML letter template: " + err.Error()}
+		}
+	}
+	if tt != nil {
+		if err = tt.Execute(&bytes.Buffer{}, d); err != nil {
+			return impart.HTTPError{http.StatusBadRequest, "Invalid plain text letter template: " + err.Error()}
+		}
+	}
+	return nil
+}
+
+// renderLetter renders the HTML and plain text versions of a letter for the
+// given post, using the collection's custom templates where they exist and
+// work, and the default templates otherwise. The results contain recipient
+// variables for the mail provider to fill in.
+func renderLetter(app *App, p *PublicPost, collID int64) (string, string, error) {
+	d := newLetterTemplateData(app, p)
+
+	var ht *template.Template
+	var tt *texttemplate.Template
+	lt, err := app.db.GetLetterTemplate(collID)
+	if err != nil {
+		log.Error("Unable to get letter templates for collection %d; using defaults: %v", collID, err)
+	} else if lt != nil {
+		ht, tt, err = parseLetterTemplates(lt.HTML, lt.Text)
+		if err != nil {
+			log.Error("Unable to parse letter templates for collection %d; using defaults: %v", collID, err)
+			ht, tt = nil, nil
+		}
+	}
+
+	var htmlBuf, textBuf bytes.Buffer
+	if ht == nil || ht.Execute(&htmlBuf, d) != nil {
+		if ht != nil {
+			log.Error("Unable to execute HTML letter template for collection %d; using default", collID)
+		}
+		htmlBuf.Reset()
+		if err = defaultLetterHTML.Execute(&htmlBuf, d); err != nil {
+			return "", "", err
+		}
+	}
+	if tt == nil || tt.Execute(&textBuf, d) != nil {
+		if tt != nil {
+			log.Error("Unable to execute plain text letter template for collection %d; using default", collID)
+		}
+		textBuf.Reset()
+		if err = defaultLetterText.Execute(&textBuf, d); err != nil {
+			return "", "", err
+		}
+	}
+
+	html, err := inliner.Inline(htmlBuf.String())
+	if err != nil {
+		log.Error("Unable to inline email HTML: %v", err)
+		return "", "", err
+	}
+	return letterRecipientVars.Replace(html), letterRecipientVars.Replace(textBuf.String()), nil
+}
+
+// handleViewLetterPreview renders the collection's letter template with its
+// most recent post, as a subscriber would receive it.
+func handleViewLetterPreview(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	c, err := app.db.GetCollection(mux.Vars(r)["collection"])
+	if err != nil {
+		return err
+	}
+	if c.OwnerID != u.ID {
+		return ErrCollectionNotFound
+	}
+	c.hostName = app.cfg.App.Host
+
+	p := &PublicPost{
+		Post: &Post{
+			ID:      "preview",
+			Title:   zero.StringFrom("A sample post"),
+			Content: "This is how your letters will look. Once you publish a post, it'll show up here instead.\n\nThanks for reading!",
+			Created: time.Now(),
+		},
+	}
+	posts, err := app.db.GetPosts(app.cfg, c, 1, false, true, false)
+	if err == nil && len(*posts) > 0 {
+		p = &(*posts)[0]
+	}
+	c.ForPublic()
+	p.Collection = &CollectionObj{Collection: *c}
+	p.HTMLContent = ""
+	prepareLetterPost(app, p)
+
+	html, text, err := renderLetter(app, p, c.ID)
+	if err != nil {
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to render letter."}
+	}
+	sample := strings.NewReplacer(
+		"%recipient.to%", u.EmailClear(app.keys),
+		"%recipient.id%", "preview",
+		"%recipient.token%", "preview",
+	)
+
+	// Letters are the user's own markup, so keep them from running anything
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	if r.FormValue("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, err = w.Write([]byte(sample.Replace(text)))
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, err = w.Write([]byte(sample.Replace(html)))
+	}
+	return err
+}
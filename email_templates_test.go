@@ -0,0 +1,84 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"testing"
+
+	"github.com/guregu/null"
+	"github.com/guregu/null/zero"
+	"github.com/writefreely/writefreely/config"
+)
+
+func TestDefaultLetterTemplates(t *testing.T) {
+	app := &App{cfg: config.New()}
+	app.cfg.App.Host = "https://example.com"
+	c := &Collection{Alias: "blog", Title: "My Blog", hostName: app.cfg.App.Host}
+	p := &PublicPost{
+		Post: &Post{
+			ID:          "abc",
+			Slug:        null.StringFrom("hello"),
+			Title:       zero.StringFrom("Hello"),
+			Content:     "Some *words*",
+			HTMLContent: template.HTML("<p>Some <em>words</em></p>"),
+			Font:        "sans",
+		},
+		Collection: &CollectionObj{Collection: *c},
+	}
+	d := newLetterTemplateData(app, p)
+
+	var b bytes.Buffer
+	if err := defaultLetterHTML.Execute(&b, d); err != nil {
+		t.Fatal(err)
+	}
+	html := letterRecipientVars.Replace(b.String())
+	for _, s := range []string{
+		`font-family: "Open Sans", Tahoma, Arial, sans-serif;`,
+		`<h2 id="title">Hello</h2>`,
+		`<p>Some <em>words</em></p>`,
+		`Sent to %recipient.to%.`,
+		`href="https://example.com/blog/email/unsubscribe/%recipient.id%?t=%recipient.token%"`,
+	} {
+		if !strings.Contains(html, s) {
+			t.Errorf("HTML letter missing %q:\n%s", s, html)
+		}
+	}
+
+	b.Reset()
+	if err := defaultLetterText.Execute(&b, d); err != nil {
+		t.Fatal(err)
+	}
+	text := letterRecipientVars.Replace(b.String())
+	if !strings.HasPrefix(text, "Hello\n\nA new post from ") || !strings.Contains(text, "\n\nSome words\n\n") {
+		t.Errorf("unexpected text letter:\n%s", text)
+	}
+	if !strings.HasSuffix(text, "Unsubscribe: https://example.com/blog/email/unsubscribe/%recipient.id%?t=%recipient.token%") {
+		t.Errorf("text letter missing unsubscribe link:\n%s", text)
+	}
+}
+
+func TestValidateLetterTemplates(t *testing.T) {
+	if err := validateLetterTemplates("", ""); err != nil {
+		t.Errorf("empty templates: %v", err)
+	}
+	if err := validateLetterTemplates("<p>{{.Post.Content}}</p>", "{{.Post.PlainContent}}"); err != nil {
+		t.Errorf("valid templates: %v", err)
+	}
+	if err := validateLetterTemplates("<p>{{.Post.Content</p>", ""); err == nil {
+		t.Error("expected parse error for HTML template")
+	}
+	if err := validateLetterTemplates("", "{{.Post.Nope}}"); err == nil {
+		t.Error("expected execution error for unknown field")
+	}
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/writeas/impart"
+)
+
+func signedMailgunEvent(key string, ts time.Time, event, severity string) *mailgunEvent {
+	e := &mailgunEvent{}
+	e.Signature.Timestamp = strconv.FormatInt(ts.Unix(), 10)
+	e.Signature.Token = "a8ce0edb2dd8301dee6c2405235584e45aa91d1e9f979f3de0"
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(e.Signature.Timestamp + e.Signature.Token))
+	e.Signature.Signature = hex.EncodeToString(mac.Sum(nil))
+	e.EventData.Event = event
+	e.EventData.Severity = severity
+	return e
+}
+
+func TestMailgunEventVerify(t *testing.T) {
+	e := signedMailgunEvent("key-123", time.Now(), "delivered", "")
+	assert.True(t, e.verify("key-123"))
+	assert.False(t, e.verify("key-456"))
+
+	old := signedMailgunEvent("key-123", time.Now().Add(-time.Hour), "delivered", "")
+	assert.False(t, old.verify("key-123"))
+}
+
+func TestMailgunEventStatus(t *testing.T) {
+	tests := []struct {
+		event       string
+		severity    string
+		status      string
+		unsubscribe bool
+	}{
+		{"delivered", "", emailStatusDelivered, false},
+		{"failed", "temporary", emailStatusDeferred, false},
+		{"failed", "permanent", emailStatusBounced, true},
+		{"complained", "", emailStatusComplained, true},
+		{"unsubscribed", "", emailStatusUnsubscribed, true},
+		{"opened", "", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.event+test.severity, func(t *testing.T) {
+			e := signedMailgunEvent("key", time.Now(), test.event, test.severity)
+			status, unsub := e.status()
+			assert.Equal(t, test.status, status)
+			assert.Equal(t, test.unsubscribe, unsub)
+		})
+	}
+}
+
+func TestNormalizeMessageID(t *testing.T) {
+	assert.Equal(t, "20260101.1@mg.example.com", normalizeMessageID("<20260101.1@mg.example.com>"))
+	assert.Equal(t, "20260101.1@mg.example.com", normalizeMessageID("20260101.1@mg.example.com"))
+}
+
+func TestConfirmEmailSubscriptionNotifies(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.cfg.Email.Domain = "example.com"
+		app.cfg.Email.MailgunPrivate = "key-123"
+		alice := createTestUser(t, app, "alice", "password")
+		bob := createTestUser(t, app, "bob", "password")
+		for _, u := range []*User{alice, bob} {
+			assert.NoError(t, db.SetUserAttribute(u.ID, userAttrNotifyPrefix+notifySubscriber, notifyDaily))
+		}
+		aliceColl, err := db.GetCollection("alice")
+		assert.NoError(t, err)
+		bobColl, err := db.GetCollection("bob")
+		assert.NoError(t, err)
+
+		const email = "reader@example.com"
+		aliceSub, err := db.AddEmailSubscription(aliceColl.ID, 0, email, false)
+		assert.NoError(t, err)
+		bobSub, err := db.AddEmailSubscription(bobColl.ID, 0, email, false)
+		assert.NoError(t, err)
+
+		confirm := func(alias string, es *EmailSubscriber) {
+			req := httptest.NewRequest("GET", "/"+alias+"/email/confirm/"+es.ID+"?t="+es.Token, nil)
+			req = mux.SetURLVars(req, map[string]string{"collection": alias, "subscriber": es.ID})
+			err := handleConfirmEmailSubscription(app, httptest.NewRecorder(), req)
+			assert.Equal(t, http.StatusFound, err.(impart.HTTPError).Status)
+		}
+		notified := func(u *User) int {
+			var n int
+			assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND kind = ?", u.ID, notifySubscriber).Scan(&n))
+			return n
+		}
+
+		// Confirming one subscription confirms the address for both, so
+		// both owners hear about it
+		confirm("alice", aliceSub)
+		assert.Eventually(t, func() bool {
+			return notified(alice) == 1 && notified(bob) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		// but only once, even when the other link is followed too
+		confirm("bob", bobSub)
+		confirm("alice", aliceSub)
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, 1, notified(alice))
+		assert.Equal(t, 1, notified(bob))
+	})
+}
+
+func TestHandleMailgunEvent(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.cfg.Email.Domain = "example.com"
+		app.cfg.Email.MailgunPrivate = "key-123"
+		app.cfg.Email.WebhookSigningKey = "key-456"
+		createTestUser(t, app, "alice", "password")
+		bob := createTestUser(t, app, "bob", "password")
+		assert.NoError(t, db.UpdateUserEmail(app.keys, bob.ID, "bob@example.com"))
+		c, err := db.GetCollection("alice")
+		assert.NoError(t, err)
+
+		reader, err := db.AddEmailSubscription(c.ID, 0, "reader@example.com", true)
+		assert.NoError(t, err)
+		acct, err := db.AddEmailSubscription(c.ID, bob.ID, "", true)
+		assert.NoError(t, err)
+		send := &EmailSend{PostID: "abcdefghijkl", CollectionID: c.ID, MessageID: "20260101.1@mg.example.com", Recipients: 2}
+		assert.NoError(t, db.InsertEmailSend(send, []*EmailSendRecipient{
+			{SubscriberID: reader.ID, EmailHash: emailLookupHash(app.keys, "reader@example.com"), Status: emailStatusAccepted},
+			{SubscriberID: acct.ID, EmailHash: emailLookupHash(app.keys, "bob@example.com"), Status: emailStatusAccepted},
+		}))
+
+		handle := func(recipient, event, severity string) {
+			e := signedMailgunEvent("key-456", time.Now(), event, severity)
+			e.EventData.Recipient = recipient
+			e.EventData.Message.Headers.MessageID = send.MessageID
+			body, _ := json.Marshal(e)
+			req := httptest.NewRequest("POST", "/api/me/email/events", bytes.NewReader(body))
+			assert.NoError(t, handleMailgunEvent(app, httptest.NewRecorder(), req))
+		}
+		statuses := func() map[string]string {
+			recips, err := db.GetEmailSendRecipients(send.ID, c.ID)
+			assert.NoError(t, err)
+			s := map[string]string{}
+			for _, r := range recips {
+				s[r.SubscriberID] = r.Status
+			}
+			return s
+		}
+
+		// Events are matched to the subscriber at that address, including
+		// account subscribers
+		handle("bob@example.com", "delivered", "")
+		handle("someone@example.com", "delivered", "")
+		assert.Equal(t, map[string]string{reader.ID: emailStatusAccepted, acct.ID: emailStatusDelivered}, statuses())
+
+		// and a bounce unsubscribes them
+		handle("Reader@Example.com", "failed", "permanent")
+		assert.Equal(t, map[string]string{reader.ID: emailStatusBounced, acct.ID: emailStatusDelivered}, statuses())
+		assert.False(t, db.IsEmailSubscriber("reader@example.com", 0, c.ID))
+		assert.True(t, db.IsEmailSubscriber("", bob.ID, c.ID))
+	})
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mailgun/mailgun-go"
+	"github.com/writeas/impart"
+	"github.com/writeas/web-core/log"
+)
+
+// emailVerificationHours is how long a verification link works.
+const emailVerificationHours = 48
+
+// needsEmailVerification returns whether the user has to verify their email
+// address before they can publish or federate posts.
+func needsEmailVerification(app *App, userID int64) bool {
+	return app.cfg.App.RequireEmailVerification && app.cfg.Email.Enabled() && !app.db.IsUserEmailVerified(userID)
+}
+
+// startEmailVerification marks the user's new email address as unverified and
+// sends a link to verify it.
+func startEmailVerification(app *App, userID int64, email string) {
+	if err := app.db.SetUserEmailVerified(userID, false); err != nil {
+		return
+	}
+	if email == "" || !app.cfg.Email.Enabled() {
+		return
+	}
+	if err := sendEmailVerification(app, userID, email); err != nil {
+		log.Error("Unable to send email verification to user %d: %v", userID, err)
+	}
+}
+
+func sendEmailVerification(app *App, userID int64, toEmail string) error {
+	token, err := app.db.CreateEmailVerificationToken(userID)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/verify-email?t=%s", app.cfg.App.Host, token)
+
+	gun := mailgun.NewMailgun(app.cfg.Email.Domain, app.cfg.Email.MailgunPrivate)
+	plainMsg := fmt.Sprintf("Please confirm this is your email address on %s by clicking the following link (or copying and pasting it into your browser): %s\n\nThe link works for %d hours. If you didn't add this address, you can safely ignore this email.", app.cfg.App.SiteName, link, emailVerificationHours)
+	m := mailgun.NewMessage(app.cfg.App.SiteName+" <noreply-verify@"+app.cfg.Email.Domain+">", "Verify your "+app.cfg.App.SiteName+" email address", plainMsg, fmt.Sprintf("<%s>", toEmail))
+	m.AddTag("Email Verification")
+	_, _, err = gun.Send(m)
+	return err
+}
+
+func handleVerifyEmail(app *App, w http.ResponseWriter, r *http.Request) error {
+	userID := app.db.GetUserFromEmailVerification(r.FormValue("t"))
+	if userID == 0 {
+		return impart.HTTPError{http.StatusNotFound, "This verification link is invalid or has expired."}
+	}
+	if err := app.db.SetUserEmailVerified(userID, true); err != nil {
+		return ErrInternalGeneral
+	}
+	log.Info("Verified email address for user %d", userID)
+
+	addSessionFlash(app, w, r, "Your email address is verified.", nil)
+	if u := getUserSession(app, r); u != nil && u.ID == userID {
+		return impart.HTTPError{http.StatusFound, "/me/settings"}
+	}
+	return impart.HTTPError{http.StatusFound, "/login"}
+}
+
+func handleResendEmailVerification(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	returnLoc := impart.HTTPError{http.StatusFound, "/me/settings"}
+	if !app.cfg.Email.Enabled() {
+		return returnLoc
+	}
+
+	// Verification emails count against the same limit as reset emails
+	if ok, wait := app.limits.resetAccount.allow("verify:" + strconv.FormatInt(u.ID, 10)); !ok {
+		log.Info("Verify email: Too many requests for %s", u.Username)
+		return tooManyRequests(w, wait, "Too many verification emails requested.")
+	}
+
+	fullUser, err := app.db.GetUserByID(u.ID)
+	if err != nil {
+		return err
+	}
+	email := fullUser.EmailClear(app.keys)
+	if email == "" {
+		addSessionFlash(app, w, r, "Add an email address first.", nil)
+		return returnLoc
+	}
+	if app.db.IsUserEmailVerified(u.ID) {
+		addSessionFlash(app, w, r, "Your email address is already verified.", nil)
+		return returnLoc
+	}
+	if err = sendEmailVerification(app, u.ID, email); err != nil {
+		log.Error("Unable to send email verification to user %d: %v", u.ID, err)
+		addSessionFlash(app, w, r, ErrInternalGeneral.Message, nil)
+		return returnLoc
+	}
+	addSessionFlash(app, w, r, "We sent you a new verification link.", nil)
+	return returnLoc
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/writeas/impart"
+)
+
+func TestEmailVerificationTokens(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		u := createTestUser(t, app, "alice", "password")
+
+		verify := func(token string) error {
+			return handleVerifyEmail(app, httptest.NewRecorder(), httptest.NewRequest("GET", "/verify-email?t="+token, nil))
+		}
+		notFound := impart.HTTPError{http.StatusNotFound, "This verification link is invalid or has expired."}
+
+		// Links expire
+		token, err := db.CreateEmailVerificationToken(u.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, u.ID, db.GetUserFromEmailVerification(token))
+		_, err = db.Exec("UPDATE emailverifications SET created = "+db.dateSub(emailVerificationHours+1, "HOUR")+" WHERE token = ?", token)
+		assert.NoError(t, err)
+		assert.Equal(t, notFound, verify(token))
+		assert.False(t, db.IsUserEmailVerified(u.ID))
+
+		// Each link works once
+		token, err = db.CreateEmailVerificationToken(u.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, impart.HTTPError{http.StatusFound, "/login"}, verify(token))
+		assert.True(t, db.IsUserEmailVerified(u.ID))
+		assert.Equal(t, notFound, verify(token))
+
+		// Changing the address discards links already sent
+		first, err := db.CreateEmailVerificationToken(u.ID)
+		assert.NoError(t, err)
+		second, err := db.CreateEmailVerificationToken(u.ID)
+		assert.NoError(t, err)
+		assert.NoError(t, db.SetUserEmailVerified(u.ID, false))
+		assert.Zero(t, db.GetUserFromEmailVerification(first))
+		assert.Zero(t, db.GetUserFromEmailVerification(second))
+
+		// Deleting the account takes its links with it
+		_, err = db.CreateEmailVerificationToken(u.ID)
+		assert.NoError(t, err)
+		assert.NoError(t, db.DeleteAccount(u.ID))
+		countRows(t, context.Background(), db.DB, 0, "SELECT COUNT(*) FROM emailverifications WHERE user_id = ?", u.ID)
+	})
+}
+
+func TestResetPasswordNeedsVerifiedEmail(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.cfg.Email.Domain = "example.com"
+		app.cfg.Email.MailgunPrivate = "key"
+		app.InitRateLimits()
+		createTestUser(t, app, "admin", "password")
+		u := createTestUser(t, app, "alice", "password")
+		_, err := db.Exec("UPDATE users SET email = ? WHERE id = ?", prepareUserEmail("alice@example.com", app.keys.EmailKey), u.ID)
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest("POST", "/reset", strings.NewReader(url.Values{"alias": {"alice"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		err = handleResetPasswordInit(app, httptest.NewRecorder(), req)
+		assert.Equal(t, impart.HTTPError{http.StatusFound, "/reset"}, err)
+		countRows(t, context.Background(), db.DB, 0, "SELECT COUNT(*) FROM password_resets WHERE user_id = ?", u.ID)
+	})
+}
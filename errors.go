@@ -52,8 +52,17 @@ var (
 	ErrUserNotFoundEmail  = impart.HTTPError{http.StatusNotFound, "Please enter your username instead of your email address."}
 
 	ErrUserSilenced = impart.HTTPError{http.StatusForbidden, "Account is silenced."}
+	ErrUserPending  = impart.HTTPError{http.StatusForbidden, "Your account is waiting for an admin's approval."}
+
+	ErrEmailNotVerified = impart.HTTPError{http.StatusForbidden, "Please verify your email address before publishing."}
+
+	ErrSignupIPBlocked    = impart.HTTPError{http.StatusForbidden, "Signups aren't allowed from your network."}
+	ErrSignupEmailBlocked = impart.HTTPError{http.StatusForbidden, "That email address can't be used to sign up. Please try another one."}
 
 	ErrDisabledPasswordAuth = impart.HTTPError{http.StatusForbidden, "Password authentication is disabled."}
+
+	ErrTwoFactorRequired = impart.HTTPError{http.StatusUnauthorized, "Two-factor code required."}
+	ErrBadTwoFactorCode  = impart.HTTPError{http.StatusUnauthorized, "Incorrect two-factor code."}
 )
 
 // Post operation errors
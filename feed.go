@@ -36,12 +36,12 @@ func ViewFeed(app *App, w http.ResponseWriter, req *http.Request) error {
 		return nil
 	}
 
-	silenced, err := app.db.IsUserSilenced(c.OwnerID)
+	hidden, err := app.db.IsUserHidden(c.OwnerID)
 	if err != nil {
 		log.Error("view feed: get user: %v", err)
 		return ErrInternalGeneral
 	}
-	if silenced {
+	if hidden {
 		return ErrCollectionNotFound
 	}
 	c.hostName = app.cfg.App.Host
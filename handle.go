@@ -20,6 +20,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"github.com/writeas/impart"
 	"github.com/writeas/web-core/log"
@@ -77,6 +78,7 @@ type Handler struct {
 	errors       *ErrorPages
 	sessionStore sessions.Store
 	app          Apper
+	scopes       map[*mux.Route]tokenScope
 }
 
 // ErrorPages hold template HTML error pages for displaying errors to the user.
@@ -102,6 +104,7 @@ func NewHandler(apper Apper) *Handler {
 		},
 		sessionStore: apper.App().SessionStore(),
 		app:          apper,
+		scopes:       map[*mux.Route]tokenScope{},
 	}
 
 	return h
@@ -190,11 +193,18 @@ func (h *Handler) Admin(f userHandlerFunc) http.HandlerFunc {
 			}()
 
 			u := getUserSession(h.app.App(), r)
-			if u == nil || !u.IsAdmin() {
+			// Admin may have been taken away since this session began
+			if u == nil || !u.IsAdmin() || !h.app.App().db.IsUserAdmin(u.ID) {
 				err := impart.HTTPError{http.StatusNotFound, ""}
 				status = err.Status
 				return err
 			}
+			if adminNeedsTwoFactor(h.app.App(), u) {
+				_ = addSessionFlash(h.app.App(), w, r, "Set up two-factor authentication to continue to the admin dashboard.", nil)
+				err := impart.HTTPError{http.StatusFound, "/me/settings/2fa"}
+				status = err.Status
+				return err
+			}
 
 			err := f(h.app.App(), u, w, r)
 			if err == nil {
@@ -228,11 +238,18 @@ func (h *Handler) AdminApper(f userApperHandlerFunc) http.HandlerFunc {
 			}()
 
 			u := getUserSession(h.app.App(), r)
-			if u == nil || !u.IsAdmin() {
+			// Admin may have been taken away since this session began
+			if u == nil || !u.IsAdmin() || !h.app.App().db.IsUserAdmin(u.ID) {
 				err := impart.HTTPError{http.StatusNotFound, ""}
 				status = err.Status
 				return err
 			}
+			if adminNeedsTwoFactor(h.app.App(), u) {
+				_ = addSessionFlash(h.app.App(), w, r, "Set up two-factor authentication to continue to the admin dashboard.", nil)
+				err := impart.HTTPError{http.StatusFound, "/me/settings/2fa"}
+				status = err.Status
+				return err
+			}
 
 			err := f(h.app, u, w, r)
 			if err == nil {
@@ -837,6 +854,9 @@ func (h *Handler) handleHTTPError(w http.ResponseWriter, r *http.Request, err er
 			impart.WriteSuccess(w, "", err.Status)
 			return
 		} else {
+			if err.Status == http.StatusTooManyRequests {
+				w.WriteHeader(err.Status)
+			}
 			p := &struct {
 				page.StaticPage
 				Title   string
@@ -12,38 +12,74 @@ package writefreely
 
 import (
 	"database/sql"
+	"fmt"
 	"html/template"
 	"net/http"
+	"net/mail"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/gorilla/mux"
+	"github.com/guregu/null/zero"
+	"github.com/mailgun/mailgun-go"
 	"github.com/writeas/impart"
+	"github.com/writeas/web-core/data"
 	"github.com/writeas/web-core/id"
 	"github.com/writeas/web-core/log"
+	"github.com/writefreely/writefreely/key"
 	"github.com/writefreely/writefreely/page"
 )
 
+// maxInviteBatch is the most invites an admin can create or send at once.
+const maxInviteBatch = 100
+
 type Invite struct {
 	ID       string
 	MaxUses  sql.NullInt64
 	Created  time.Time
 	Expires  *time.Time
 	Inactive bool
+	Label    zero.String
+	Email    zero.String
+
+	// Owner is the username of whoever created the invite, when listing
+	// everyone's invites.
+	Owner string
 
-	uses int64
+	uses   int64
+	sentTo string
 }
 
 func (i Invite) Uses() int64 {
 	return i.uses
 }
 
+// SentTo returns the email address the invite was sent to, once it's been
+// decrypted with decryptEmail.
+func (i Invite) SentTo() string {
+	return i.sentTo
+}
+
+func (i *Invite) decryptEmail(keys *key.Keychain) {
+	if !i.Email.Valid || i.Email.String == "" {
+		return
+	}
+	email, err := data.Decrypt(keys.EmailKey, []byte(i.Email.String))
+	if err != nil {
+		log.Error("Error decrypting invite email: %v", err)
+		return
+	}
+	i.sentTo = string(email)
+}
+
 func (i Invite) Expired() bool {
 	return i.Expires != nil && i.Expires.Before(time.Now())
 }
 
 func (i Invite) Active(db *datastore) bool {
-	if i.Expired() {
+	if i.Inactive || i.Expired() {
 		return false
 	}
 	if i.MaxUses.Valid && i.MaxUses.Int64 > 0 {
@@ -97,19 +133,35 @@ func handleViewUserInvites(app *App, u *User, w http.ResponseWriter, r *http.Req
 }
 
 func handleCreateUserInvite(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
-	muVal := r.FormValue("uses")
-	expVal := r.FormValue("expires")
-
 	if u.IsSilenced() {
 		return ErrUserSilenced
 	}
 
+	maxUses, expDate, err := inviteLimitsFromForm(r)
+	if err != nil {
+		return err
+	}
+
+	err = app.db.CreateUserInvite(newInviteCode(), u.ID, maxUses, expDate)
+	if err != nil {
+		return err
+	}
+
+	return impart.HTTPError{http.StatusFound, "/me/invites"}
+}
+
+// inviteLimitsFromForm returns the maximum uses and expiry date submitted for
+// a new invite, where "0" means no limit.
+func inviteLimitsFromForm(r *http.Request) (int, *time.Time, error) {
+	muVal := r.FormValue("uses")
+	expVal := r.FormValue("expires")
+
 	var err error
 	var maxUses int
 	if muVal != "0" {
 		maxUses, err = strconv.Atoi(muVal)
 		if err != nil {
-			return impart.HTTPError{http.StatusBadRequest, "Invalid value for 'max_uses'"}
+			return 0, nil, impart.HTTPError{http.StatusBadRequest, "Invalid value for 'max_uses'"}
 		}
 	}
 
@@ -118,19 +170,182 @@ func handleCreateUserInvite(app *App, u *User, w http.ResponseWriter, r *http.Re
 	if expVal != "0" {
 		expires, err = strconv.Atoi(expVal)
 		if err != nil {
-			return impart.HTTPError{http.StatusBadRequest, "Invalid value for 'expires'"}
+			return 0, nil, impart.HTTPError{http.StatusBadRequest, "Invalid value for 'expires'"}
 		}
 		ed := time.Now().Add(time.Duration(expires) * time.Minute)
 		expDate = &ed
 	}
+	return maxUses, expDate, nil
+}
+
+func newInviteCode() string {
+	return id.GenerateRandomString("0123456789BCDFGHJKLMNPQRSTVWXYZbcdfghjklmnpqrstvwxyz", 6)
+}
+
+func handleViewAdminInvites(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	p := struct {
+		*UserPage
+		*AdminPage
+		Flashes      []string
+		EmailEnabled bool
+
+		Invites []Invite
+	}{
+		UserPage:     NewUserPage(app, r, u, "Invites", nil),
+		AdminPage:    NewAdminPage(app),
+		EmailEnabled: app.cfg.Email.Enabled(),
+	}
 
-	inviteID := id.GenerateRandomString("0123456789BCDFGHJKLMNPQRSTVWXYZbcdfghjklmnpqrstvwxyz", 6)
-	err = app.db.CreateUserInvite(inviteID, u.ID, maxUses, expDate)
+	p.Flashes, _ = getSessionFlashes(app, w, r, nil)
+	var err error
+	p.Invites, err = app.db.GetAllInvites()
 	if err != nil {
 		return err
 	}
+	for i := range p.Invites {
+		p.Invites[i].decryptEmail(app.keys)
+	}
 
-	return impart.HTTPError{http.StatusFound, "/me/invites"}
+	showUserPage(w, "invites", p)
+	return nil
+}
+
+func handleViewAdminInvite(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	code := mux.Vars(r)["code"]
+	i, err := app.db.GetUserInvite(code)
+	if err != nil {
+		return err
+	}
+	i.uses = app.db.GetUsersInvitedCount(code)
+	i.decryptEmail(app.keys)
+
+	p := struct {
+		*UserPage
+		*AdminPage
+		Invite *Invite
+		Active bool
+
+		Users []User
+	}{
+		UserPage:  NewUserPage(app, r, u, "Invite "+code, nil),
+		AdminPage: NewAdminPage(app),
+		Invite:    i,
+		Active:    i.Active(app.db),
+	}
+	p.Users, err = app.db.GetInvitedUsers(code)
+	if err != nil {
+		return err
+	}
+
+	showUserPage(w, "view-invite", p)
+	return nil
+}
+
+// handleAdminCreateInvites creates a batch of invites, or emails one to each
+// of a list of addresses.
+func handleAdminCreateInvites(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	returnLoc := impart.HTTPError{http.StatusFound, "/admin/invites"}
+
+	maxUses, expDate, err := inviteLimitsFromForm(r)
+	if err != nil {
+		return err
+	}
+	label := strings.TrimSpace(r.FormValue("label"))
+	if len(label) > 255 {
+		_ = addSessionFlash(app, w, r, "Label is too long.", nil)
+		return returnLoc
+	}
+
+	emails := strings.FieldsFunc(r.FormValue("emails"), func(c rune) bool {
+		return c == ',' || c == ';' || unicode.IsSpace(c)
+	})
+	if len(emails) == 0 {
+		count, err := strconv.Atoi(r.FormValue("count"))
+		if err != nil || count < 1 || count > maxInviteBatch {
+			_ = addSessionFlash(app, w, r, fmt.Sprintf("You can create between 1 and %d invites at a time.", maxInviteBatch), nil)
+			return returnLoc
+		}
+		for n := 0; n < count; n++ {
+			if err = app.db.CreateLabeledUserInvite(newInviteCode(), u.ID, maxUses, expDate, label, zero.String{}); err != nil {
+				log.Error("Unable to create invite: %v", err)
+				return ErrInternalGeneral
+			}
+		}
+		log.Info("ADMIN: %s created %d invites", u.Username, count)
+		_ = addSessionFlash(app, w, r, fmt.Sprintf("Created %d %s.", count, pluralize("invite", "invites", int64(count))), nil)
+		return returnLoc
+	}
+
+	if !app.cfg.Email.Enabled() {
+		_ = addSessionFlash(app, w, r, "Email isn't configured on this instance, so invites can't be sent.", nil)
+		return returnLoc
+	}
+	if len(emails) > maxInviteBatch {
+		_ = addSessionFlash(app, w, r, fmt.Sprintf("You can send up to %d invites at a time.", maxInviteBatch), nil)
+		return returnLoc
+	}
+	// Check every address before sending anything, so a typo doesn't leave a
+	// batch half sent.
+	for n, e := range emails {
+		addr, err := mail.ParseAddress(e)
+		if err != nil {
+			_ = addSessionFlash(app, w, r, fmt.Sprintf("%s isn't a valid email address.", e), nil)
+			return returnLoc
+		}
+		emails[n] = addr.Address
+	}
+
+	sent := 0
+	failed := []string{}
+	for _, e := range emails {
+		code := newInviteCode()
+		if err = app.db.CreateLabeledUserInvite(code, u.ID, maxUses, expDate, label, prepareUserEmail(e, app.keys.EmailKey)); err != nil {
+			log.Error("Unable to create invite: %v", err)
+			return ErrInternalGeneral
+		}
+		if err = sendInviteEmail(app, u, code, e, expDate); err != nil {
+			log.Error("Unable to send invite %s: %v", code, err)
+			failed = append(failed, e)
+			continue
+		}
+		sent++
+	}
+	log.Info("ADMIN: %s sent %d invites", u.Username, sent)
+	msg := fmt.Sprintf("Sent %d %s.", sent, pluralize("invite", "invites", int64(sent)))
+	if len(failed) > 0 {
+		msg += " Couldn't send to " + strings.Join(failed, ", ") + "; their invites are still listed below."
+	}
+	_ = addSessionFlash(app, w, r, msg, nil)
+	return returnLoc
+}
+
+func handleAdminRevokeInvite(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	code := mux.Vars(r)["code"]
+	if _, err := app.db.GetUserInvite(code); err != nil {
+		return err
+	}
+
+	log.Info("ADMIN: Revoking invite %s", code)
+	if err := app.db.RevokeUserInvite(code); err != nil {
+		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not revoke invite: %v", err)}
+	}
+	_ = addSessionFlash(app, w, r, fmt.Sprintf("Revoked invite %s.", code), nil)
+	return impart.HTTPError{http.StatusFound, "/admin/invites"}
+}
+
+// sendInviteEmail emails an invite link to the given address.
+func sendInviteEmail(app *App, from *User, code, to string, expires *time.Time) error {
+	link := fmt.Sprintf("%s/invite/%s", app.cfg.App.Host, code)
+	plainMsg := fmt.Sprintf("%s invited you to join %s! Create your account here: %s", from.Username, app.cfg.App.SiteName, link)
+	if expires != nil {
+		plainMsg += fmt.Sprintf("\n\nThis invite expires on %s UTC.", expires.UTC().Format("January 2, 2006, 3:04 PM"))
+	}
+
+	gun := mailgun.NewMailgun(app.cfg.Email.Domain, app.cfg.Email.MailgunPrivate)
+	m := mailgun.NewMessage(app.cfg.App.SiteName+" <noreply-invite@"+app.cfg.Email.Domain+">", "You're invited to "+app.cfg.App.SiteName, plainMsg, fmt.Sprintf("<%s>", to))
+	m.AddTag("Invite")
+	_, _, err := gun.Send(m)
+	return err
 }
 
 func handleViewInvite(app *App, w http.ResponseWriter, r *http.Request) error {
@@ -141,7 +356,7 @@ func handleViewInvite(app *App, w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	expired := i.Expired()
+	expired := i.Inactive || i.Expired()
 	if !expired && i.MaxUses.Valid && i.MaxUses.Int64 > 0 {
 		// Invite has a max-use number, so check if we're past that limit
 		i.uses = app.db.GetUsersInvitedCount(inviteCode)
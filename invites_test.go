@@ -0,0 +1,113 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/writeas/impart"
+)
+
+func postAdminInvites(t *testing.T, app *App, u *User, form url.Values) error {
+	req := httptest.NewRequest("POST", "/admin/invites", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return handleAdminCreateInvites(app, u, httptest.NewRecorder(), req)
+}
+
+func TestAdminCreateInvitesLimits(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		admin := createTestUser(t, app, "admin", "password")
+		redirect := impart.HTTPError{http.StatusFound, "/admin/invites"}
+
+		for _, count := range []string{"0", "101", "many"} {
+			err := postAdminInvites(t, app, admin, url.Values{"uses": {"1"}, "expires": {"0"}, "count": {count}})
+			assert.Equal(t, redirect, err, "count %s", count)
+		}
+		is, err := db.GetAllInvites()
+		assert.NoError(t, err)
+		assert.Empty(t, is)
+
+		err = postAdminInvites(t, app, admin, url.Values{"uses": {"1"}, "expires": {"0"}, "count": {"3"}, "label": {"Workshop"}})
+		assert.Equal(t, redirect, err)
+		is, err = db.GetAllInvites()
+		assert.NoError(t, err)
+		if assert.Len(t, is, 3) {
+			assert.Equal(t, "Workshop", is[0].Label.String)
+			assert.Equal(t, "admin", is[0].Owner)
+		}
+
+		// Too many addresses are refused before anything is sent
+		app.cfg.Email.Domain = "example.com"
+		app.cfg.Email.MailgunPrivate = "key"
+		emails := make([]string, maxInviteBatch+1)
+		for i := range emails {
+			emails[i] = "user@example.com"
+		}
+		err = postAdminInvites(t, app, admin, url.Values{"uses": {"1"}, "expires": {"0"}, "emails": {strings.Join(emails, "\n")}})
+		assert.Equal(t, redirect, err)
+		is, err = db.GetAllInvites()
+		assert.NoError(t, err)
+		assert.Len(t, is, 3)
+	})
+}
+
+func TestRevokeUserInvite(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		assert.NoError(t, db.CreateUserInvite("abc123", 1, 0, nil))
+
+		i, err := db.GetUserInvite("abc123")
+		assert.NoError(t, err)
+		assert.True(t, i.Active(db))
+
+		assert.NoError(t, db.RevokeUserInvite("abc123"))
+		i, err = db.GetUserInvite("abc123")
+		assert.NoError(t, err)
+		assert.True(t, i.Inactive)
+		assert.False(t, i.Active(db))
+	})
+}
+
+func TestGetInvitedUsers(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		admin := createTestUser(t, app, "admin", "password")
+		assert.NoError(t, db.CreateUserInvite("abc123", admin.ID, 2, nil))
+		assert.NoError(t, db.CreateUserInvite("def456", admin.ID, 0, nil))
+
+		alice := createTestUser(t, app, "alice", "password")
+		bob := createTestUser(t, app, "bob", "password")
+		carol := createTestUser(t, app, "carol", "password")
+		assert.NoError(t, db.CreateInvitedUser("abc123", alice.ID))
+		assert.NoError(t, db.CreateInvitedUser("abc123", bob.ID))
+		assert.NoError(t, db.CreateInvitedUser("def456", carol.ID))
+
+		users, err := db.GetInvitedUsers("abc123")
+		assert.NoError(t, err)
+		if assert.Len(t, users, 2) {
+			assert.ElementsMatch(t, []string{"alice", "bob"}, []string{users[0].Username, users[1].Username})
+		}
+
+		// Both uses are taken
+		i, err := db.GetUserInvite("abc123")
+		assert.NoError(t, err)
+		assert.False(t, i.Active(db))
+
+		users, err = db.GetInvitedUsers("nope")
+		assert.NoError(t, err)
+		assert.Empty(t, users)
+	})
+}
@@ -5,6 +5,10 @@ import (
 	"time"
 )
 
+// jobPurgeAccount is the action of jobs that purge deleted accounts.
+const jobPurgeAccount = "purge"
+
+// PostJob is a queued task. Account purges hold the user's ID in PostID.
 type PostJob struct {
 	ID     int64
 	PostID string
@@ -26,6 +30,10 @@ func startPublishJobsQueue(app *App) {
 	for {
 		log.Info("[jobs] Done.")
 		<-t.C
+		runAccountPurgeJobs(app)
+		if !app.cfg.Email.Enabled() {
+			continue
+		}
 		log.Info("[jobs] Fetching email publish jobs...")
 		jobs, err := app.db.GetJobsToRun("email")
 		if err != nil {
@@ -60,11 +68,18 @@ func runJobs(app *App, jobs []*PostJob, reqColl bool) error {
 		coll.hostName = app.cfg.App.Host
 		coll.ForPublic()
 		p.Collection = &CollectionObj{Collection: *coll}
-		err = emailPost(app, p, p.Collection.ID)
+		l, err := emailPost(app, p, p.Collection.ID)
 		if err != nil {
 			log.Error("[job #%d] Failed to email post %s", j.ID, p.ID)
 			continue
 		}
+		if l != nil {
+			// Record the letter for the collection's public archive
+			err = app.db.InsertLetter(l)
+			if err != nil {
+				log.Error("[job #%d] Unable to record letter for post %s: %s", j.ID, p.ID, err)
+			}
+		}
 		log.Info("[job #%d] Success for post %s.", j.ID, p.ID)
 		app.db.DeleteJob(j.ID)
 	}
@@ -13,6 +13,7 @@ package key
 
 import (
 	"crypto/rand"
+	"time"
 )
 
 const (
@@ -21,6 +22,11 @@ const (
 
 type Keychain struct {
 	EmailKey, CookieAuthKey, CookieKey, CSRFKey []byte
+
+	// Keys replaced by the last rotation, which are still accepted for
+	// existing sessions and forms until their grace periods end.
+	PrevCookieAuthKey, PrevCookieKey, PrevCSRFKey []byte
+	PrevCookiesUntil, PrevCSRFUntil               time.Time
 }
 
 // GenerateKeys generates necessary keys for the app on the given Keychain,
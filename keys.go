@@ -11,16 +11,33 @@
 package writefreely
 
 import (
-	"github.com/writeas/web-core/log"
-	"github.com/writefreely/writefreely/key"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/securecookie"
+	"github.com/writeas/web-core/data"
+	"github.com/writeas/web-core/log"
+	"github.com/writefreely/writefreely/key"
+	"github.com/writefreely/writefreely/migrations"
 )
 
 const (
 	keysDir = "keys"
+
+	// Names of the key sets recorded in the appkeys table
+	keyNameEmail   = "email"
+	keyNameCookies = "cookies"
+	keyNameCSRF    = "csrf"
 )
 
+var errKeyGraceOver = errors.New("grace period for previous key is over")
+
 var (
 	emailKeyPath      = filepath.Join(keysDir, "email.aes256")
 	cookieAuthKeyPath = filepath.Join(keysDir, "cookies_auth.aes256")
@@ -72,3 +89,374 @@ func generateKey(path string) error {
 	log.Info("Success.")
 	return nil
 }
+
+// readPrevKey reads the key that the one at the given path replaced, if it
+// still exists.
+func readPrevKey(path string) ([]byte, error) {
+	b, err := os.ReadFile(path + ".prev")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// loadKeyGracePeriods sets how long the app's previous cookie and CSRF keys
+// are still accepted, dropping any that have expired.
+func loadKeyGracePeriods(app *App) {
+	graces, err := app.db.GetKeyGracePeriods()
+	if err != nil {
+		log.Error("Unable to load key grace periods: %v", err)
+	}
+	app.keys.PrevCookiesUntil = graces[keyNameCookies]
+	app.keys.PrevCSRFUntil = graces[keyNameCSRF]
+	if time.Now().After(app.keys.PrevCookiesUntil) {
+		app.keys.PrevCookieAuthKey, app.keys.PrevCookieKey = nil, nil
+	}
+	if time.Now().After(app.keys.PrevCSRFUntil) {
+		app.keys.PrevCSRFKey = nil
+	}
+}
+
+// graceCodec decodes cookies made with a previous key until its grace period
+// ends.
+type graceCodec struct {
+	securecookie.Codec
+	until time.Time
+}
+
+func (c *graceCodec) Decode(name, value string, dst interface{}) error {
+	if time.Now().After(c.until) {
+		return errKeyGraceOver
+	}
+	return c.Codec.Decode(name, value, dst)
+}
+
+// csrfProtect adds CSRF protection to the given handler. Forms made with the
+// previous CSRF key are still accepted until its grace period ends.
+func (app *App) csrfProtect(h http.Handler) http.Handler {
+	if len(app.keys.PrevCSRFKey) == 0 {
+		return csrf.Protect(app.keys.CSRFKey)(h)
+	}
+	prev := csrf.Protect(app.keys.PrevCSRFKey)(h)
+	until := app.keys.PrevCSRFUntil
+	return csrf.Protect(app.keys.CSRFKey, csrf.ErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if time.Now().Before(until) {
+			prev.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, fmt.Sprintf("%s - %s", http.StatusText(http.StatusForbidden), csrf.FailureReason(r)), http.StatusForbidden)
+	})))(h)
+}
+
+// RotateKeys replaces the named keys ("email", "cookies" and "csrf") with new
+// ones. Stored emails are re-encrypted under the new email key, and the
+// previous cookie and CSRF keys keep working for the given grace period. Each
+// rotation bumps the key's version in the database.
+func RotateKeys(apper Apper, names []string, grace time.Duration) error {
+	apper.LoadConfig()
+	app := apper.App()
+	initKeyPaths(app)
+	err := app.LoadKeys()
+	if err != nil {
+		return fmt.Errorf("Unable to load keys: %s", err)
+	}
+	connectToDatabase(app)
+	defer shutdown(app)
+
+	ver, err := app.db.migrationVersion()
+	if err != nil {
+		return err
+	}
+	if ver < migrations.CurrentVer() {
+		return fmt.Errorf("Database needs to be migrated first. Run: writefreely db migrate")
+	}
+
+	for _, name := range names {
+		switch name {
+		case keyNameEmail:
+			err = rotateEmailKey(app)
+		case keyNameCookies:
+			err = rotateKeyFiles(app, keyNameCookies, grace, cookieAuthKeyPath, cookieKeyPath)
+		case keyNameCSRF:
+			err = rotateKeyFiles(app, keyNameCSRF, grace, csrfKeyPath)
+		default:
+			err = fmt.Errorf("unknown key %q; expected email, cookies or csrf", name)
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to rotate %s keys: %s", name, err)
+		}
+	}
+	log.Info("Restart WriteFreely to start using the new keys.")
+	return nil
+}
+
+// rotateEmailKey re-encrypts every stored email under a new email key in a
+// single transaction. The new key is written out before anything changes, and
+// only replaces the old one, which is kept as email.aes256.v<version>, once
+// the transaction commits. If that last step is interrupted, running the
+// rotation again finishes it.
+func rotateEmailKey(app *App) error {
+	nextPath := emailKeyPath + ".next"
+	newKey, err := os.ReadFile(nextPath)
+	if err == nil {
+		done, err := app.db.emailsEncryptedWith(newKey)
+		if err != nil {
+			return err
+		}
+		if done {
+			log.Info("Finishing interrupted email key rotation...")
+			ver, err := app.db.GetKeyVersion(keyNameEmail)
+			if err != nil {
+				return err
+			}
+			return swapEmailKey(nextPath, ver-1)
+		}
+		log.Info("Discarding unused %s", nextPath)
+		if err = os.Remove(nextPath); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	newKey, err = key.GenerateBytes(key.EncKeysBytes)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(nextPath, newKey, 0600)
+	if err != nil {
+		return err
+	}
+
+	ver, err := app.db.GetKeyVersion(keyNameEmail)
+	if err != nil {
+		return err
+	}
+	log.Info("Re-encrypting emails under email key v%d...", ver+1)
+	n, err := app.db.ReencryptEmails(app.keys.EmailKey, newKey, ver+1)
+	if err != nil {
+		os.Remove(nextPath)
+		return err
+	}
+	log.Info("Re-encrypted %d email(s).", n)
+	return swapEmailKey(nextPath, ver)
+}
+
+// swapEmailKey archives the current email key under its version and puts the
+// new one in its place.
+func swapEmailKey(nextPath string, oldVer int) error {
+	oldPath := fmt.Sprintf("%s.v%d", emailKeyPath, oldVer)
+	if _, err := os.Stat(oldPath); err == nil {
+		return fmt.Errorf("%s already exists. Move it out of the way, then run this again.", oldPath)
+	}
+	err := os.Rename(emailKeyPath, oldPath)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(nextPath, emailKeyPath)
+	if err != nil {
+		return err
+	}
+	log.Info("Rotated email key to v%d. The previous key is in %s.", oldVer+1, oldPath)
+	return nil
+}
+
+// rotateKeyFiles replaces the given key files with new keys, keeping the old
+// ones as .prev files to accept until the grace period ends.
+func rotateKeyFiles(app *App, name string, grace time.Duration, paths ...string) error {
+	for _, p := range paths {
+		b, err := key.GenerateBytes(key.EncKeysBytes)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(p+".next", b, 0600)
+		if err != nil {
+			return err
+		}
+	}
+	for _, p := range paths {
+		if grace > 0 {
+			err := os.Rename(p, p+".prev")
+			if err != nil {
+				return err
+			}
+		} else {
+			err := os.Remove(p + ".prev")
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		err := os.Rename(p+".next", p)
+		if err != nil {
+			return err
+		}
+	}
+
+	ver, err := app.db.GetKeyVersion(name)
+	if err != nil {
+		return err
+	}
+	var graceUntil sql.NullTime
+	if grace > 0 {
+		graceUntil = sql.NullTime{Time: time.Now().Add(grace).UTC(), Valid: true}
+	}
+	err = app.db.UpdateKeyVersion(name, ver+1, graceUntil)
+	if err != nil {
+		return err
+	}
+	if grace > 0 {
+		log.Info("Rotated %s keys to v%d. Previous keys work until %s.", name, ver+1, graceUntil.Time.Format(time.RFC1123))
+	} else {
+		log.Info("Rotated %s keys to v%d.", name, ver+1)
+	}
+	return nil
+}
+
+// GetKeyVersion returns the current version of the named keys. Keys that have
+// never been rotated are on version 1.
+func (db *datastore) GetKeyVersion(name string) (int, error) {
+	var ver int
+	err := db.QueryRow("SELECT version FROM appkeys WHERE name = ?", name).Scan(&ver)
+	switch {
+	case err == sql.ErrNoRows:
+		return 1, nil
+	case err != nil:
+		log.Error("Couldn't SELECT from appkeys: %v", err)
+		return 0, err
+	}
+	return ver, nil
+}
+
+// UpdateKeyVersion records that the named keys were rotated to the given
+// version, with previous keys accepted until graceUntil.
+func (db *datastore) UpdateKeyVersion(name string, ver int, graceUntil sql.NullTime) error {
+	_, err := db.Exec("INSERT INTO appkeys (name, version, rotated, grace_until) VALUES (?, ?, "+db.now()+", ?) "+db.upsert("name")+" version = ?, rotated = "+db.now()+", grace_until = ?", name, ver, graceUntil, ver, graceUntil)
+	if err != nil {
+		log.Error("Unable to update appkeys: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetKeyGracePeriods returns when each set of previous keys stops being
+// accepted.
+func (db *datastore) GetKeyGracePeriods() (map[string]time.Time, error) {
+	graces := map[string]time.Time{}
+	rows, err := db.Query("SELECT name, grace_until FROM appkeys WHERE grace_until IS NOT NULL")
+	if err != nil {
+		return graces, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var until time.Time
+		err = rows.Scan(&name, &until)
+		if err != nil {
+			return graces, err
+		}
+		graces[name] = until
+	}
+	return graces, rows.Err()
+}
+
+// ReencryptEmails decrypts every user's email and two-factor secret, and every
+// emailed invite's address, with oldKey and encrypts them with newKey,
+// recording the new email key version, all in one transaction. It returns the
+// number of user emails re-encrypted.
+func (db *datastore) ReencryptEmails(oldKey, newKey []byte, ver int) (int, error) {
+	t, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := reencryptRows(t, "user %s's email", "SELECT id, email FROM users WHERE email IS NOT NULL", "UPDATE users SET email = ? WHERE id = ?", oldKey, newKey)
+	if err != nil {
+		t.Rollback()
+		return 0, err
+	}
+	_, err = reencryptRows(t, "user %s's two-factor secret", "SELECT user_id, secret FROM usertwofactor", "UPDATE usertwofactor SET secret = ? WHERE user_id = ?", oldKey, newKey)
+	if err != nil {
+		t.Rollback()
+		return 0, err
+	}
+	_, err = reencryptRows(t, "invite %s's email", "SELECT id, email FROM userinvites WHERE email IS NOT NULL", "UPDATE userinvites SET email = ? WHERE id = ?", oldKey, newKey)
+	if err != nil {
+		t.Rollback()
+		return 0, err
+	}
+
+	_, err = t.Exec("INSERT INTO appkeys (name, version, rotated, grace_until) VALUES (?, ?, "+db.now()+", NULL) "+db.upsert("name")+" version = ?, rotated = "+db.now(), keyNameEmail, ver, ver)
+	if err != nil {
+		t.Rollback()
+		return 0, err
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return 0, err
+	}
+	return n, nil
+}
+
+// reencryptRows re-encrypts each non-empty value selected by query, which
+// returns an ID and the encrypted value, writing it back with update. IDs are
+// read as strings, so both numeric and string keys work. what describes a
+// value for errors, with a %s for its ID.
+func reencryptRows(t *sql.Tx, what, query, update string, oldKey, newKey []byte) (int, error) {
+	type encRow struct {
+		id  string
+		val []byte
+	}
+	var encRows []encRow
+	rows, err := t.Query(query)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		er := encRow{}
+		err = rows.Scan(&er.id, &er.val)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if len(er.val) > 0 {
+			encRows = append(encRows, er)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, er := range encRows {
+		clear, err := data.Decrypt(oldKey, er.val)
+		if err != nil {
+			return 0, fmt.Errorf("%s can't be decrypted with the current key: %s", fmt.Sprintf(what, er.id), err)
+		}
+		enc, err := data.Encrypt(newKey, string(clear))
+		if err != nil {
+			return 0, err
+		}
+		_, err = t.Exec(update, enc, er.id)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(encRows), nil
+}
+
+// emailsEncryptedWith returns whether stored emails are encrypted with the
+// given key, checking the first one found.
+func (db *datastore) emailsEncryptedWith(k []byte) (bool, error) {
+	var email []byte
+	err := db.QueryRow("SELECT email FROM users WHERE email IS NOT NULL AND email <> ''").Scan(&email)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	_, err = data.Decrypt(k, email)
+	return err == nil, nil
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/securecookie"
+	"github.com/guregu/null/zero"
+	"github.com/stretchr/testify/assert"
+	"github.com/writeas/web-core/data"
+	"github.com/writefreely/writefreely/key"
+)
+
+func TestReencryptInviteEmails(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		oldKey, newKey := testKey(1), testKey(2)
+		enc, err := data.Encrypt(oldKey, "invitee@example.com")
+		assert.NoError(t, err)
+		assert.NoError(t, db.CreateLabeledUserInvite("emailed", 1, 1, nil, "Workshop", zero.StringFrom(string(enc))))
+		assert.NoError(t, db.CreateUserInvite("plain", 1, 0, nil))
+
+		_, err = db.ReencryptEmails(oldKey, newKey, 2)
+		assert.NoError(t, err)
+
+		i, err := db.GetUserInvite("emailed")
+		assert.NoError(t, err)
+		i.decryptEmail(&key.Keychain{EmailKey: newKey})
+		assert.Equal(t, "invitee@example.com", i.SentTo())
+
+		i, err = db.GetUserInvite("plain")
+		assert.NoError(t, err)
+		assert.False(t, i.Email.Valid)
+	})
+}
+
+// useTestEmailKey points the email key path at a new file holding k, for the
+// rest of the test.
+func useTestEmailKey(t *testing.T, k []byte) {
+	prev := emailKeyPath
+	emailKeyPath = filepath.Join(t.TempDir(), "email.aes256")
+	t.Cleanup(func() {
+		emailKeyPath = prev
+	})
+	if err := os.WriteFile(emailKeyPath, k, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotateEmailKey(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		oldKey := app.keys.EmailKey
+		useTestEmailKey(t, oldKey)
+
+		alice := createTestUser(t, app, "alice", "password")
+		bob := createTestUser(t, app, "bob", "password")
+		for _, u := range []*User{alice, bob} {
+			_, err := db.Exec("UPDATE users SET email = ? WHERE id = ?", prepareUserEmail(u.Username+"@example.com", oldKey), u.ID)
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, db.SetPendingTwoFactor(alice.ID, "JBSWY3DPEHPK3PXP", oldKey))
+
+		assert.NoError(t, rotateEmailKey(app))
+
+		newKey, err := os.ReadFile(emailKeyPath)
+		assert.NoError(t, err)
+		assert.NotEqual(t, oldKey, newKey)
+		archived, err := os.ReadFile(emailKeyPath + ".v1")
+		assert.NoError(t, err)
+		assert.Equal(t, oldKey, archived)
+		assert.NoFileExists(t, emailKeyPath+".next")
+
+		keys := &key.Keychain{EmailKey: newKey}
+		for _, id := range []int64{alice.ID, bob.ID} {
+			u, err := db.GetUserByID(id)
+			assert.NoError(t, err)
+			assert.Equal(t, u.Username+"@example.com", u.EmailClear(keys))
+		}
+		tf, err := db.GetUserTwoFactor(alice.ID, newKey)
+		assert.NoError(t, err)
+		if assert.NotNil(t, tf) {
+			assert.Equal(t, "JBSWY3DPEHPK3PXP", tf.Secret)
+		}
+		ver, err := db.GetKeyVersion(keyNameEmail)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, ver)
+	})
+}
+
+func TestRotateEmailKeyRollback(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		oldKey := app.keys.EmailKey
+		useTestEmailKey(t, oldKey)
+
+		alice := createTestUser(t, app, "alice", "password")
+		_, err := db.Exec("UPDATE users SET email = ? WHERE id = ?", prepareUserEmail("alice@example.com", oldKey), alice.ID)
+		assert.NoError(t, err)
+		// Bob's email can't be decrypted, so alice's has to be put back
+		bob := createTestUser(t, app, "bob", "password")
+		_, err = db.Exec("UPDATE users SET email = ? WHERE id = ?", prepareUserEmail("bob@example.com", testKey(9)), bob.ID)
+		assert.NoError(t, err)
+
+		assert.Error(t, rotateEmailKey(app))
+
+		k, err := os.ReadFile(emailKeyPath)
+		assert.NoError(t, err)
+		assert.Equal(t, oldKey, k)
+		assert.NoFileExists(t, emailKeyPath+".next")
+		assert.NoFileExists(t, emailKeyPath+".v1")
+
+		u, err := db.GetUserByID(alice.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "alice@example.com", u.EmailClear(app.keys))
+		ver, err := db.GetKeyVersion(keyNameEmail)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, ver)
+	})
+}
+
+func TestGraceCodec(t *testing.T) {
+	prev := securecookie.New(testKey(5), testKey(6))
+	val, err := prev.Encode(cookieName, "hello")
+	assert.NoError(t, err)
+
+	var s string
+	c := &graceCodec{Codec: prev, until: time.Now().Add(time.Hour)}
+	assert.NoError(t, c.Decode(cookieName, val, &s))
+	assert.Equal(t, "hello", s)
+
+	c.until = time.Now().Add(-time.Second)
+	assert.Equal(t, errKeyGraceOver, c.Decode(cookieName, val, &s))
+}
+
+func TestCSRFProtectGrace(t *testing.T) {
+	prevKey := testKey(7)
+
+	// Get a token and cookie made with the previous key
+	var token string
+	rr := httptest.NewRecorder()
+	csrf.Protect(prevKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = csrf.Token(r)
+	})).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	cookies := rr.Result().Cookies()
+
+	post := func(until time.Time) int {
+		app := &App{keys: &key.Keychain{CSRFKey: testKey(8), PrevCSRFKey: prevKey, PrevCSRFUntil: until}}
+		h := app.csrfProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("X-CSRF-Token", token)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusNoContent, post(time.Now().Add(time.Hour)))
+	assert.Equal(t, http.StatusForbidden, post(time.Now().Add(-time.Second)))
+}
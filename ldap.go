@@ -0,0 +1,305 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/writeas/impart"
+	"github.com/writeas/web-core/log"
+	"github.com/writefreely/writefreely/author"
+	"github.com/writefreely/writefreely/config"
+)
+
+const (
+	// ldapProvider is how users from the directory are recorded in oauth_users.
+	ldapProvider = "ldap"
+
+	// ldapTimeout is how long we'll wait on the directory server.
+	ldapTimeout = 10 * time.Second
+)
+
+var errLDAPBadPassword = errors.New("ldap: incorrect password")
+
+// ldapDirectory is the LDAP server users can log in with.
+type ldapDirectory struct {
+	URL          string
+	StartTLS     bool
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	UserFilter   string
+
+	MapUserID      string
+	MapUsername    string
+	MapDisplayName string
+	MapEmail       string
+	MapGroups      string
+	AllowedGroups  []string
+}
+
+// clientID identifies the directory in oauth_users, so users are only linked
+// to accounts from the same part of the same directory. It's a hash of the
+// base DN, which can be longer than the column holding it.
+func (d ldapDirectory) clientID() string {
+	h := sha256.Sum256([]byte(d.BaseDN))
+	return hex.EncodeToString(h[:])
+}
+
+func newLDAPDirectory(cfg config.LDAPCfg) ldapDirectory {
+	return ldapDirectory{
+		URL:            cfg.URL,
+		StartTLS:       cfg.StartTLS,
+		BindDN:         cfg.BindDN,
+		BindPassword:   cfg.BindPassword,
+		BaseDN:         cfg.BaseDN,
+		UserFilter:     config.OrDefaultString(cfg.UserFilter, "(uid=%s)"),
+		MapUserID:      config.OrDefaultString(cfg.MapUserID, "uid"),
+		MapUsername:    config.OrDefaultString(cfg.MapUsername, "uid"),
+		MapDisplayName: config.OrDefaultString(cfg.MapDisplayName, "cn"),
+		MapEmail:       config.OrDefaultString(cfg.MapEmail, "mail"),
+		MapGroups:      config.OrDefaultString(cfg.MapGroups, "memberOf"),
+		AllowedGroups:  splitLDAPGroups(cfg.AllowedGroups),
+	}
+}
+
+// splitLDAPGroups parses a semicolon-separated list of group DNs.
+func splitLDAPGroups(s string) []string {
+	var groups []string
+	for _, g := range strings.Split(s, ";") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// ldapUser is a user's entry in the directory.
+type ldapUser struct {
+	DN          string
+	ID          string
+	Username    string
+	DisplayName string
+	Email       string
+	Groups      []string
+}
+
+// dial connects to the directory, binding as the configured search account
+// if there is one.
+func (d ldapDirectory) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(d.URL, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+	if d.StartTLS {
+		u, err := url.Parse(d.URL)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err = conn.StartTLS(&tls.Config{ServerName: u.Hostname()}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if d.BindDN != "" {
+		if err = conn.Bind(d.BindDN, d.BindPassword); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// findUser looks up the user with the given username, returning nil if
+// there isn't one.
+func (d ldapDirectory) findUser(conn *ldap.Conn, username string) (*ldapUser, error) {
+	filter := strings.Replace(d.UserFilter, "%s", ldap.EscapeFilter(username), -1)
+	res, err := conn.Search(ldap.NewSearchRequest(d.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		filter, []string{d.MapUserID, d.MapUsername, d.MapDisplayName, d.MapEmail, d.MapGroups}, nil))
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || (err == nil && len(res.Entries) > 1) {
+		return nil, errors.New("ldap: more than one user matches " + filter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) == 0 {
+		return nil, nil
+	}
+
+	e := res.Entries[0]
+	u := &ldapUser{
+		DN:          e.DN,
+		ID:          e.GetEqualFoldAttributeValue(d.MapUserID),
+		Username:    e.GetEqualFoldAttributeValue(d.MapUsername),
+		DisplayName: e.GetEqualFoldAttributeValue(d.MapDisplayName),
+		Email:       e.GetEqualFoldAttributeValue(d.MapEmail),
+		Groups:      e.GetEqualFoldAttributeValues(d.MapGroups),
+	}
+	if u.ID == "" {
+		log.Error("[CONFIGURATION ERROR] LDAP entry %s has no `%s` attribute.\n  Do you need to configure a different `map_user_id` value?", e.DN, d.MapUserID)
+		return nil, errors.New("ldap: user has no ID")
+	}
+	return u, nil
+}
+
+// authenticate checks the given user's password by binding as them.
+func (d ldapDirectory) authenticate(conn *ldap.Conn, u *ldapUser, password string) error {
+	if password == "" {
+		// An empty password would be an unauthenticated bind, which succeeds
+		return errLDAPBadPassword
+	}
+	err := conn.Bind(u.DN, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return errLDAPBadPassword
+	}
+	return err
+}
+
+// canLogIn returns whether the given user is in one of the groups allowed
+// to log in, if only some are.
+func (d ldapDirectory) canLogIn(u *ldapUser) bool {
+	if len(d.AllowedGroups) == 0 {
+		return true
+	}
+	for _, g := range u.Groups {
+		for _, a := range d.AllowedGroups {
+			// Group DNs aren't case-sensitive
+			if strings.EqualFold(g, a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loginViaLDAP logs in the user with the given username and password from
+// the directory, creating a local account for them the first time. It returns
+// a nil User and no error if the directory doesn't have the user, or if a
+// local account that was never linked to the directory already has their
+// username, so they can log in with a local password instead.
+func loginViaLDAP(app *App, w http.ResponseWriter, r *http.Request, username, password string) (*User, error) {
+	d := newLDAPDirectory(app.cfg.LDAP)
+	conn, err := d.dial()
+	if err != nil {
+		log.Error("LDAP: Unable to connect: %v", err)
+		return nil, impart.HTTPError{http.StatusServiceUnavailable, "Unable to reach the login directory. Please try again later."}
+	}
+	defer conn.Close()
+
+	du, err := d.findUser(conn, username)
+	if err != nil {
+		log.Error("LDAP: Unable to find user %s: %v", username, err)
+		return nil, ErrInternalGeneral
+	}
+	if du == nil {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	userID, err := app.db.GetIDForRemoteUser(ctx, du.ID, ldapProvider, d.clientID())
+	if err != nil {
+		log.Error("LDAP: Unable to get local user for %s: %v", du.DN, err)
+		return nil, ErrInternalGeneral
+	}
+	if userID == -1 {
+		// Whoever has this username here may not be the same person, so they
+		// keep using their own password
+		_, err = app.db.GetUserForAuth(getSlug(du.Username, ""))
+		if err == nil {
+			log.Info("LDAP: %s has the same username as a local user who isn't linked; using local password", du.DN)
+			return nil, nil
+		} else if err != ErrUserNotFound {
+			log.Error("LDAP: Unable to check for local user %s: %v", du.Username, err)
+			return nil, ErrInternalGeneral
+		}
+	}
+	ip := requestIP(r)
+	if userID != -1 {
+		if wait := app.limits.lockouts.check(userID, ip); wait > 0 {
+			return nil, tooManyRequests(w, wait, msgAccountLocked)
+		}
+	}
+	if err = d.authenticate(conn, du, password); err == errLDAPBadPassword {
+		if userID != -1 {
+			if wait := app.limits.lockouts.fail(userID, du.Username, ip); wait > 0 {
+				log.Info("Login: Locking %s from %s for %s after too many failed attempts", du.Username, ip, wait)
+				return nil, tooManyRequests(w, wait, msgAccountLocked)
+			}
+		}
+		return nil, impart.HTTPError{http.StatusUnauthorized, "Incorrect password."}
+	} else if err != nil {
+		log.Error("LDAP: Unable to authenticate %s: %v", du.DN, err)
+		return nil, ErrInternalGeneral
+	}
+	if !d.canLogIn(du) {
+		log.Info("LDAP: %s isn't in any group allowed to log in", du.DN)
+		return nil, impart.HTTPError{http.StatusForbidden, "Your account isn't allowed to log in here."}
+	}
+
+	if userID != -1 {
+		app.limits.lockouts.reset(userID, ip)
+		return app.db.GetUserByID(userID)
+	}
+	return createLDAPUser(app, du, d.clientID())
+}
+
+// createLDAPUser creates a local account for a user logging in from the
+// directory for the first time. The directory, along with any allowed groups,
+// already decides who gets an account, so these skip admin approval and signup
+// blocks.
+func createLDAPUser(app *App, du *ldapUser, clientID string) (*User, error) {
+	username := getSlug(du.Username, "")
+	if !author.IsValidUsername(app.cfg, username) {
+		log.Info("LDAP: Can't create user for %s with username '%s'", du.DN, username)
+		return nil, impart.HTTPError{http.StatusPreconditionFailed, "Your directory username isn't valid here. Please contact an admin for help."}
+	}
+
+	u := &User{
+		Username:   username,
+		HashedPass: []byte{},
+		Email:      prepareUserEmail(du.Email, app.keys.EmailKey),
+		Created:    time.Now().Truncate(time.Second).UTC(),
+	}
+	displayName := du.DisplayName
+	if displayName == "" {
+		displayName = username
+	}
+	if err := app.db.CreateUser(app.cfg, u, displayName, ""); err != nil {
+		if herr, ok := err.(impart.HTTPError); ok && herr.Status == http.StatusConflict {
+			log.Info("LDAP: Can't create user for %s; username '%s' is taken", du.DN, username)
+			return nil, impart.HTTPError{http.StatusConflict, "Someone here already has your username. Please contact an admin for help."}
+		}
+		return nil, err
+	}
+	if err := app.db.RecordRemoteUserID(context.Background(), u.ID, du.ID, ldapProvider, clientID, ""); err != nil {
+		return nil, err
+	}
+	if du.Email != "" {
+		// The directory vouches for its users' addresses
+		if err := app.db.SetUserEmailVerified(u.ID, true); err != nil {
+			return nil, err
+		}
+	}
+	log.Info("LDAP: Created user %s for %s", u.Username, du.DN)
+	return u, nil
+}
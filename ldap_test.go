@@ -0,0 +1,285 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/writefreely/writefreely/config"
+)
+
+// testLDAPEntry is a user in a testLDAPServer.
+type testLDAPEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// testLDAPServer is an in-process LDAP server that understands just enough
+// of the protocol to bind and search for users by equality filters.
+type testLDAPServer struct {
+	net.Listener
+	bindDN, bindPassword string
+	entries              []testLDAPEntry
+}
+
+func newTestLDAPServer(t *testing.T, entries ...testLDAPEntry) *testLDAPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testLDAPServer{
+		Listener:     l,
+		bindDN:       "cn=search,dc=example,dc=com",
+		bindPassword: "search-pass",
+		entries:      entries,
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testLDAPServer) URL() string {
+	return "ldap://" + s.Addr().String()
+}
+
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	boundAs := ""
+	for {
+		req, err := ber.ReadPacket(conn)
+		if err != nil || len(req.Children) < 2 {
+			return
+		}
+		id := req.Children[0].Value.(int64)
+		op := req.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := ldap.LDAPResultInvalidCredentials
+			if dn == "" && password == "" {
+				code = ldap.LDAPResultSuccess
+			} else if dn == s.bindDN && password == s.bindPassword {
+				code = ldap.LDAPResultSuccess
+			}
+			for _, e := range s.entries {
+				if dn == e.dn && password == e.password {
+					code = ldap.LDAPResultSuccess
+				}
+			}
+			if code == ldap.LDAPResultSuccess {
+				boundAs = dn
+			}
+			conn.Write(ldapMessage(id, ldapResult(ldap.ApplicationBindResponse, code)))
+		case ldap.ApplicationSearchRequest:
+			if boundAs != s.bindDN {
+				conn.Write(ldapMessage(id, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights)))
+				continue
+			}
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			parts := strings.SplitN(strings.Trim(filter, "()"), "=", 2)
+			for _, e := range s.entries {
+				if len(parts) == 2 && len(e.attrs[parts[0]]) > 0 && e.attrs[parts[0]][0] == parts[1] {
+					conn.Write(ldapMessage(id, ldapEntry(e)))
+				}
+			}
+			conn.Write(ldapMessage(id, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)))
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func ldapMessage(id int64, op *ber.Packet) []byte {
+	p := ber.NewSequence("")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	p.AppendChild(op)
+	return p.Bytes()
+}
+
+func ldapResult(tag ber.Tag, code int) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return p
+}
+
+func ldapEntry(e testLDAPEntry) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, ""))
+	attrs := ber.NewSequence("")
+	for name, vals := range e.attrs {
+		attr := ber.NewSequence("")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range vals {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	p.AppendChild(attrs)
+	return p
+}
+
+func TestLDAPDirectory(t *testing.T) {
+	alice := testLDAPEntry{
+		dn:       "uid=alice,ou=people,dc=example,dc=com",
+		password: "alice-pass",
+		attrs: map[string][]string{
+			"uid":      {"alice"},
+			"cn":       {"Alice Liddell"},
+			"mail":     {"alice@example.com"},
+			"memberOf": {"cn=writers,ou=groups,dc=example,dc=com"},
+		},
+	}
+	twin := func(dn string) testLDAPEntry {
+		return testLDAPEntry{dn: dn, attrs: map[string][]string{"uid": {"twin"}}}
+	}
+	srv := newTestLDAPServer(t, alice, twin("uid=twin,ou=a,dc=example,dc=com"), twin("uid=twin,ou=b,dc=example,dc=com"))
+	d := newLDAPDirectory(config.LDAPCfg{
+		URL:           srv.URL(),
+		BindDN:        srv.bindDN,
+		BindPassword:  srv.bindPassword,
+		BaseDN:        "dc=example,dc=com",
+		AllowedGroups: "cn=editors,ou=groups,dc=example,dc=com; CN=Writers,OU=Groups,DC=example,DC=com",
+	})
+
+	conn, err := d.dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	u, err := d.findUser(conn, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u == nil || u.DN != alice.dn || u.ID != "alice" || u.Username != "alice" || u.DisplayName != "Alice Liddell" || u.Email != "alice@example.com" {
+		t.Fatalf("findUser = %+v", u)
+	}
+	if !d.canLogIn(u) {
+		t.Error("alice should be able to log in")
+	}
+	if err = d.authenticate(conn, u, "wrong"); err != errLDAPBadPassword {
+		t.Errorf("wrong password: got %v", err)
+	}
+	if err = d.authenticate(conn, u, ""); err != errLDAPBadPassword {
+		t.Errorf("empty password: got %v", err)
+	}
+	if err = d.authenticate(conn, u, alice.password); err != nil {
+		t.Errorf("right password: got %v", err)
+	}
+
+	// Searches run as the search account, not whoever last bound
+	conn, err = d.dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, name := range []string{"bob", "*", "alice)(uid=*"} {
+		if u, err := d.findUser(conn, name); u != nil || err != nil {
+			t.Errorf("findUser(%q) = %+v, %v; want no user", name, u, err)
+		}
+	}
+	if _, err = d.findUser(conn, "twin"); err == nil {
+		t.Error("findUser should fail when more than one user matches")
+	}
+
+	d.AllowedGroups = []string{"cn=admins,ou=groups,dc=example,dc=com"}
+	if d.canLogIn(u) {
+		t.Error("alice shouldn't be able to log in without being in an allowed group")
+	}
+
+	d.BindPassword = "wrong"
+	if _, err = d.dial(); err == nil {
+		t.Error("dial should fail with the wrong search account password")
+	}
+
+	// Directories are told apart by base DN, however long it is
+	long := ldapDirectory{BaseDN: strings.Repeat("ou=department,", 20) + "dc=example,dc=com"}
+	if id := long.clientID(); len(id) > 128 || id == d.clientID() {
+		t.Errorf("client ID for long base DN = %q; want a different one that fits in oauth_users", id)
+	}
+}
+
+func TestLoginViaLDAP(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		entry := func(uid, password string) testLDAPEntry {
+			return testLDAPEntry{
+				dn:       "uid=" + uid + ",ou=people,dc=example,dc=com",
+				password: password,
+				attrs:    map[string][]string{"uid": {uid}, "mail": {uid + "@example.com"}},
+			}
+		}
+		srv := newTestLDAPServer(t, entry("alice", "directory-pass"), entry("bob", "bob-pass"))
+
+		app := newTestApp(db)
+		app.InitRateLimits()
+		app.cfg.LDAP = config.LDAPCfg{
+			URL:          srv.URL(),
+			BindDN:       srv.bindDN,
+			BindPassword: srv.bindPassword,
+			BaseDN:       "dc=example,dc=com",
+		}
+		local := createTestUser(t, app, "alice", "local-pass")
+
+		logIn := func(username, password string) (*User, error) {
+			r := httptest.NewRequest("POST", "/auth/login", nil)
+			return loginViaLDAP(app, httptest.NewRecorder(), r, username, password)
+		}
+
+		// A local account with the same name that was never linked keeps
+		// using its own password
+		u, err := logIn("alice", "directory-pass")
+		if u != nil || err != nil {
+			t.Errorf("unlinked local user: got %+v, %v; want to fall back to local password", u, err)
+		}
+		if _, err = loginViaPassword(app, httptest.NewRecorder(), httptest.NewRequest("POST", "/auth/login", nil), userCredentials{Alias: "alice", Pass: "local-pass"}); err != nil {
+			t.Errorf("local password: %v", err)
+		}
+
+		// New directory users get a linked account
+		u, err = logIn("bob", "bob-pass")
+		if err != nil || u == nil || u.Username != "bob" || u.ID == local.ID {
+			t.Fatalf("new directory user: got %+v, %v", u, err)
+		}
+		again, err := logIn("bob", "bob-pass")
+		if err != nil || again == nil || again.ID != u.ID {
+			t.Errorf("logging in again: got %+v, %v; want user %d", again, err, u.ID)
+		}
+		var clientID string
+		if err = db.QueryRow("SELECT client_id FROM oauth_users WHERE user_id = ?", u.ID).Scan(&clientID); err != nil {
+			t.Fatal(err)
+		}
+		if clientID != newLDAPDirectory(app.cfg.LDAP).clientID() {
+			t.Errorf("linked with client ID %q; want a hash of the base DN", clientID)
+		}
+		if _, err = logIn("bob", "wrong"); err == nil {
+			t.Error("wrong directory password should fail")
+		}
+	})
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/feeds"
+	"github.com/gorilla/mux"
+	"github.com/writeas/web-core/log"
+	"github.com/writefreely/writefreely/spam"
+)
+
+// Letter is a post as it was sent out to a collection's email subscribers. Its
+// Content is the HTML email they received, as prepared by archivedLetterHTML.
+type Letter struct {
+	ID           int64
+	CollectionID int64
+	PostID       string
+	SendID       int64
+	Subject      string
+	Content      template.HTML
+	Sent         time.Time
+
+	PostSlug string
+}
+
+func (l *Letter) SentFriendly() string {
+	return l.Sent.Format("January 2, 2006")
+}
+
+func (l *Letter) Created8601() string {
+	return l.Sent.Format("2006-01-02T15:04:05Z")
+}
+
+// archivedLetterHTML returns the HTML of a letter as it was sent, for the
+// collection's public letters archive. The mail provider's recipient variables
+// are swapped for generic text and a link to the archive, where readers can
+// manage their subscriptions, and the HTML is sanitized like post content,
+// since custom letter templates can contain anything.
+func archivedLetterHTML(c *Collection, sent string) template.HTML {
+	archiveURL := c.CanonicalURL() + "letters/"
+	r := strings.NewReplacer(
+		c.CanonicalURL()+"email/unsubscribe/%recipient.id%?t=%recipient.token%", archiveURL,
+		"%recipient.to%", "subscribers",
+		"%recipient.id%", "",
+		"%recipient.token%", "",
+	)
+	return template.HTML(getSanitizationPolicy().Sanitize(r.Replace(sent)))
+}
+
+// LettersCollectionPage is the public archive of a collection's letters.
+type LettersCollectionPage struct {
+	CollectionPage
+	Letters []*Letter
+	Letter  *Letter
+}
+
+// LettersURL returns the path to the letters archive, relative to the
+// collection's host.
+func (lcp LettersCollectionPage) LettersURL() string {
+	if lcp.IsTopLevel {
+		return "/letters/"
+	}
+	return "/" + lcp.Prefix + lcp.Alias + "/letters/"
+}
+
+func handleViewCollectionLetters(app *App, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+
+	cr := &collectionReq{}
+	err := processCollectionRequest(cr, vars, w, r)
+	if err != nil {
+		return err
+	}
+
+	u, err := checkUserForCollection(app, cr, r, false)
+	if err != nil {
+		return err
+	}
+
+	c, err := processCollectionPermissions(app, cr, u, w, r)
+	if c == nil || err != nil {
+		return err
+	}
+	c.hostName = app.cfg.App.Host
+
+	coll := newDisplayCollection(c, cr, 1)
+
+	displayPage := LettersCollectionPage{
+		CollectionPage: CollectionPage{
+			DisplayCollection: coll,
+			StaticPage:        pageForReq(app, r),
+			IsCustomDomain:    cr.isCustomDomain,
+			Honeypot:          spam.HoneypotFieldName(),
+			CollAlias:         c.Alias,
+		},
+	}
+
+	if id := vars["letter"]; id != "" {
+		letterID, _ := strconv.ParseInt(id, 10, 64)
+		displayPage.Letter, err = app.db.GetLetter(letterID, c.ID)
+		if err != nil {
+			return err
+		}
+	} else {
+		displayPage.Letters, err = app.db.GetLetters(c.ID)
+		if err != nil {
+			return err
+		}
+		if len(displayPage.Letters) == 0 && !c.EmailSubsEnabled() {
+			return ErrCollectionPageNotFound
+		}
+	}
+
+	var owner *User
+	if u != nil {
+		displayPage.Username = u.Username
+		displayPage.IsOwner = u.ID == coll.OwnerID
+		displayPage.IsSubscriber = u.IsEmailSubscriber(app, coll.ID)
+		if displayPage.IsOwner {
+			owner = u
+		}
+	}
+	isOwner := owner != nil
+	if !isOwner {
+		// Current user doesn't own collection; retrieve owner information
+		owner, err = app.db.GetUserByID(coll.OwnerID)
+		if err != nil {
+			// Log the error and just continue
+			log.Error("Error getting user for collection: %v", err)
+		}
+		if owner != nil && owner.IsHidden() {
+			return ErrCollectionNotFound
+		}
+	}
+	displayPage.Silenced = owner != nil && owner.IsSilenced()
+	displayPage.Owner = owner
+	coll.Owner = displayPage.Owner
+	displayPage.PinnedPosts, _ = app.db.GetPinnedPosts(coll.CollectionObj, isOwner)
+
+	err = templates["collection-letters"].ExecuteTemplate(w, "collection-letters", displayPage)
+	if err != nil {
+		log.Error("Unable to render collection letters page: %v", err)
+	}
+
+	return nil
+}
+
+// ViewLettersFeed serves an RSS feed of the letters sent from a collection.
+func ViewLettersFeed(app *App, w http.ResponseWriter, req *http.Request) error {
+	alias := collectionAliasFromReq(req)
+
+	var c *Collection
+	var err error
+	if app.cfg.App.SingleUser {
+		c, err = app.db.GetCollectionByID(1)
+	} else {
+		c, err = app.db.GetCollection(alias)
+	}
+	if err != nil {
+		return err
+	}
+
+	hidden, err := app.db.IsUserHidden(c.OwnerID)
+	if err != nil {
+		log.Error("view letters feed: get user: %v", err)
+		return ErrInternalGeneral
+	}
+	if hidden {
+		return ErrCollectionNotFound
+	}
+	c.hostName = app.cfg.App.Host
+
+	if c.IsPrivate() || c.IsProtected() {
+		return ErrCollectionNotFound
+	}
+
+	letters, err := app.db.GetLetters(c.ID)
+	if err != nil {
+		return err
+	}
+
+	baseURL := c.CanonicalURL() + "letters/"
+	feed := &feeds.Feed{
+		Title:       "Letters from " + c.DisplayTitle(),
+		Link:        &feeds.Link{Href: baseURL},
+		Description: c.PlainDescription(),
+		Created:     time.Now(),
+	}
+	for _, l := range letters {
+		permalink := fmt.Sprintf("%s%d", baseURL, l.ID)
+		feed.Items = append(feed.Items, &feeds.Item{
+			Id:      permalink,
+			Title:   l.Subject,
+			Link:    &feeds.Link{Href: permalink},
+			Content: string(l.Content),
+			Created: l.Sent,
+		})
+	}
+
+	rss, err := feed.ToRss()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(w, rss)
+	return nil
+}
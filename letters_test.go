@@ -0,0 +1,196 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// sendTestLetter publishes a post to the given collection and records the
+// letter for it, rendered as it would be when emailed out.
+func sendTestLetter(t *testing.T, app *App, userID int64, alias, title, body string) *Letter {
+	c, err := app.db.GetCollection(alias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := app.db.CreatePost(userID, c.ID, &SubmittedPost{Title: &title, Content: &body, Font: "norm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := app.db.GetPost(post.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.hostName = app.cfg.App.Host
+	c.ForPublic()
+	p.Collection = &CollectionObj{Collection: *c}
+	prepareLetterPost(app, p)
+	html, _, err := renderLetter(app, p, c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := &Letter{
+		CollectionID: c.ID,
+		PostID:       p.ID,
+		Subject:      title,
+		Content:      archivedLetterHTML(c, html),
+	}
+	assert.NoError(t, app.db.InsertLetter(l))
+	return l
+}
+
+func TestArchivedLetter(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.cfg.App.Host = "https://example.com"
+		alice := createTestUser(t, app, "alice", "password")
+		c, err := db.GetCollection("alice")
+		assert.NoError(t, err)
+
+		// The letter is stored as it was sent, with its template, but without
+		// anything meant for a single subscriber
+		assert.NoError(t, db.UpdateLetterTemplate(c.ID, `<html><body><p class="greeting">Hi {{.Recipient.Email}}!</p><script>alert(1)</script>{{.Post.Content}}<p><a href="{{.Recipient.UnsubscribeURL}}">Unsubscribe</a></p></body></html>`, ""))
+		l := sendTestLetter(t, app, alice.ID, "alice", "Hello", "Some *words*")
+		content := string(l.Content)
+		assert.Contains(t, content, `<p class="greeting">Hi subscribers!</p>`)
+		assert.Contains(t, content, `<em>words</em>`)
+		assert.Contains(t, content, `<a href="https://example.com/alice/letters/"`)
+		assert.NotContains(t, content, "%recipient")
+		assert.NotContains(t, content, "<script")
+		assert.NotContains(t, content, "email/unsubscribe")
+
+		// Letters from the default template keep its formatting
+		assert.NoError(t, db.UpdateLetterTemplate(c.ID, "", ""))
+		l = sendTestLetter(t, app, alice.ID, "alice", "Again", "More words")
+		content = string(l.Content)
+		assert.Contains(t, content, `<h2 id="title"`)
+		assert.Contains(t, content, `style="`)
+		assert.Contains(t, content, "Sent to subscribers.")
+		assert.NotContains(t, content, "%recipient")
+	})
+}
+
+func TestGetLetters(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		alice := createTestUser(t, app, "alice", "password")
+		createTestUser(t, app, "bob", "password")
+		c, err := db.GetCollection("alice")
+		assert.NoError(t, err)
+		other, err := db.GetCollection("bob")
+		assert.NoError(t, err)
+
+		first := sendTestLetter(t, app, alice.ID, "alice", "First", "One")
+		second := sendTestLetter(t, app, alice.ID, "alice", "Second", "Two")
+		assert.NotZero(t, first.ID)
+
+		letters, err := db.GetLetters(c.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, letters, 2) {
+			ids := []int64{letters[0].ID, letters[1].ID}
+			assert.ElementsMatch(t, []int64{first.ID, second.ID}, ids)
+		}
+		l, err := db.GetLetter(first.ID, c.ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "First", l.Subject)
+			assert.Equal(t, first.Content, l.Content)
+			assert.Equal(t, "first", l.PostSlug)
+		}
+
+		// Letters only belong to their own collection
+		_, err = db.GetLetter(first.ID, other.ID)
+		assert.Equal(t, ErrPostNotFound, err)
+		letters, err = db.GetLetters(other.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, letters)
+
+		// and go away with their posts
+		_, err = db.Exec("DELETE FROM posts WHERE id = ?", first.PostID)
+		assert.NoError(t, err)
+		_, err = db.GetLetter(first.ID, c.ID)
+		assert.Equal(t, ErrPostNotFound, err)
+		letters, err = db.GetLetters(c.ID)
+		assert.NoError(t, err)
+		assert.Len(t, letters, 1)
+	})
+}
+
+func TestViewCollectionLetters(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.cfg.App.Host = "https://example.com"
+		initTemplate(".", "collection-letters")
+		alice := createTestUser(t, app, "alice", "password")
+
+		view := func(path string, vars map[string]string) (*httptest.ResponseRecorder, error) {
+			req := httptest.NewRequest("GET", path, nil)
+			req = mux.SetURLVars(req, vars)
+			rr := httptest.NewRecorder()
+			return rr, handleViewCollectionLetters(app, rr, req)
+		}
+
+		// There's no archive without letters or subscriptions
+		_, err := view("/alice/letters/", map[string]string{"collection": "alice"})
+		assert.Equal(t, ErrCollectionPageNotFound, err)
+
+		l := sendTestLetter(t, app, alice.ID, "alice", "Hello", "Some *words*")
+		rr, err := view("/alice/letters/", map[string]string{"collection": "alice"})
+		if assert.NoError(t, err) {
+			assert.Contains(t, rr.Body.String(), "Hello")
+			assert.Contains(t, rr.Body.String(), fmt.Sprintf("letters/%d", l.ID))
+		}
+
+		rr, err = view(fmt.Sprintf("/alice/letters/%d", l.ID), map[string]string{"collection": "alice", "letter": fmt.Sprint(l.ID)})
+		if assert.NoError(t, err) {
+			assert.Contains(t, rr.Body.String(), string(l.Content))
+		}
+		_, err = view("/alice/letters/999", map[string]string{"collection": "alice", "letter": "999"})
+		assert.Equal(t, ErrPostNotFound, err)
+	})
+}
+
+func TestViewLettersFeed(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.cfg.App.Host = "https://example.com"
+		alice := createTestUser(t, app, "alice", "password")
+		l := sendTestLetter(t, app, alice.ID, "alice", "Hello", "Some *words*")
+
+		feed := func(alias string) (*httptest.ResponseRecorder, error) {
+			req := httptest.NewRequest("GET", "/"+alias+"/letters/feed/", nil)
+			req = mux.SetURLVars(req, map[string]string{"collection": alias})
+			rr := httptest.NewRecorder()
+			return rr, ViewLettersFeed(app, rr, req)
+		}
+
+		rr, err := feed("alice")
+		if assert.NoError(t, err) {
+			assert.Contains(t, rr.Body.String(), "<title>Letters from alice</title>")
+			assert.Contains(t, rr.Body.String(), "<title>Hello</title>")
+			assert.Contains(t, rr.Body.String(), fmt.Sprintf("https://example.com/alice/letters/%d", l.ID))
+			assert.Contains(t, rr.Body.String(), "Some <em>words</em>")
+		}
+
+		// Private blogs don't have a feed
+		c, err := db.GetCollection("alice")
+		assert.NoError(t, err)
+		_, err = db.Exec("UPDATE collections SET privacy = ? WHERE id = ?", CollPrivate, c.ID)
+		assert.NoError(t, err)
+		_, err = feed("alice")
+		assert.Equal(t, ErrCollectionNotFound, err)
+	})
+}
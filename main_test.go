@@ -1,6 +1,7 @@
 package writefreely
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/gob"
@@ -8,6 +9,9 @@ import (
 	"fmt"
 	uuid "github.com/nu7hatch/gouuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/writeas/web-core/auth"
+	"github.com/writefreely/writefreely/config"
+	"github.com/writefreely/writefreely/key"
 	"math/rand"
 	"os"
 	"strings"
@@ -17,25 +21,40 @@ import (
 
 var testDB *sql.DB
 
+// testDriver is the driver name of the database the tests run against.
+var testDriver string
+
 type ScopedTestBody func(*sql.DB)
 
 // TestMain provides testing infrastructure within this package.
 func TestMain(m *testing.M) {
 	rand.Seed(time.Now().UTC().UnixNano())
 	gob.Register(&User{})
+	gob.Register(&oidcLogin{})
+	gob.Register(&pendingTwoFactor{})
 
 	if runMySQLTests() {
 		var err error
 
+		testDriver = driverMySQL
 		testDB, err = initMySQL(os.Getenv("WF_USER"), os.Getenv("WF_PASSWORD"), os.Getenv("WF_DB"), os.Getenv("WF_HOST"))
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
+	} else if runPostgresTests() {
+		var err error
+
+		testDriver = driverPostgres
+		testDB, err = initPostgres(os.Getenv("WF_USER"), os.Getenv("WF_PASSWORD"), os.Getenv("WF_DB"), os.Getenv("WF_HOST"), "")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 	}
 
 	code := m.Run()
-	if runMySQLTests() {
+	if runDatabaseTests() {
 		if closeErr := testDB.Close(); closeErr != nil {
 			fmt.Println(closeErr)
 		}
@@ -47,6 +66,15 @@ func runMySQLTests() bool {
 	return len(os.Getenv("TEST_MYSQL")) > 0
 }
 
+func runPostgresTests() bool {
+	return len(os.Getenv("TEST_POSTGRES")) > 0
+}
+
+// runDatabaseTests returns whether tests that need a real database should run.
+func runDatabaseTests() bool {
+	return runMySQLTests() || runPostgresTests()
+}
+
 func initMySQL(dbUser, dbPassword, dbName, dbHost string) (*sql.DB, error) {
 	if dbUser == "" || dbPassword == "" {
 		return nil, errors.New("database user or password not set")
@@ -69,6 +97,33 @@ func initMySQL(dbUser, dbPassword, dbName, dbHost string) (*sql.DB, error) {
 	return db, nil
 }
 
+// initPostgres connects to the given Postgres database, optionally using the
+// given schema instead of the default one.
+func initPostgres(dbUser, dbPassword, dbName, dbHost, schema string) (*sql.DB, error) {
+	if dbUser == "" || dbPassword == "" {
+		return nil, errors.New("database user or password not set")
+	}
+	if dbHost == "" {
+		dbHost = "localhost"
+	}
+	if dbName == "" {
+		dbName = "writefreely"
+	}
+
+	dsn := postgresDSN(config.DatabaseCfg{User: dbUser, Password: dbPassword, Database: dbName, Host: dbHost})
+	if schema != "" {
+		dsn += "&search_path=" + schema
+	}
+	db, err := sql.Open("postgres_with_placeholders", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMySQL(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
 func ensureMySQL(db *sql.DB) error {
 	if err := db.Ping(); err != nil {
 		return err
@@ -97,6 +152,10 @@ func withTestDB(t *testing.T, testBody ScopedTestBody) {
 // database connection is returned, it will have created a new database and
 // initialized it with tables from a reference database.
 func newTestDatabase(base *sql.DB, dbUser, dbPassword, dbName, dbHost string) (*sql.DB, func() error, error) {
+	if testDriver == driverPostgres {
+		return newTestSchema(base, dbUser, dbPassword, dbName, dbHost)
+	}
+
 	var err error
 	var baseName = dbName
 
@@ -145,6 +204,103 @@ func newTestDatabase(base *sql.DB, dbUser, dbPassword, dbName, dbHost string) (*
 	return newDB, cleanup, nil
 }
 
+// newTestSchema creates a new temporary schema in a Postgres test database,
+// with tables copied from the default schema, and returns a connection that
+// uses it.
+func newTestSchema(base *sql.DB, dbUser, dbPassword, dbName, dbHost string) (*sql.DB, func() error, error) {
+	tUUID, _ := uuid.NewV4()
+	schema := "test_" + strings.Replace(tUUID.String(), "-", "_", -1)
+	_, err := base.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := base.Query("SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema()")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tableName string
+		if err := rows.Scan(&tableName); err != nil {
+			return nil, nil, err
+		}
+		query := fmt.Sprintf("CREATE TABLE %s.%s (LIKE %s INCLUDING ALL)", schema, tableName, tableName)
+		if _, err := base.Exec(query); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	newDB, err := initPostgres(dbUser, dbPassword, dbName, dbHost, schema)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cleanup := func() error {
+		if closeErr := newDB.Close(); closeErr != nil {
+			fmt.Println(closeErr)
+		}
+
+		_, err := base.Exec("DROP SCHEMA " + schema + " CASCADE")
+		return err
+	}
+	return newDB, cleanup, nil
+}
+
+// withTestDatastore runs the test body against a datastore with the full
+// schema: a temporary MySQL or Postgres database when those tests are enabled,
+// or else a temporary SQLite one when built with SQLite support.
+func withTestDatastore(t *testing.T, testBody func(*datastore)) {
+	if runDatabaseTests() {
+		withTestDB(t, func(db *sql.DB) {
+			testBody(&datastore{DB: db, driverName: testDriver})
+		})
+		return
+	}
+	ds := newSQLiteTestDatastore(t)
+	if ds == nil {
+		t.Skip("skipping database tests")
+	}
+	testBody(ds)
+}
+
+// newTestApp returns a multi-user app backed by the given datastore, with
+// fixed keys and a working session store.
+func newTestApp(db *datastore) *App {
+	app := &App{
+		cfg: config.New(),
+		db:  db,
+		keys: &key.Keychain{
+			EmailKey:      testKey(1),
+			CookieAuthKey: testKey(2),
+			CookieKey:     testKey(3),
+			CSRFKey:       testKey(4),
+		},
+	}
+	app.cfg.App.SingleUser = false
+	app.InitSession()
+	return app
+}
+
+// testKey returns a fixed key made of the given byte.
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+// createTestUser creates a user with the given username and password, and a
+// blog of the same name.
+func createTestUser(t *testing.T, app *App, username, pass string) *User {
+	hashed, err := auth.HashPass([]byte(pass))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &User{Username: username, HashedPass: hashed}
+	if err = app.db.CreateUser(app.cfg, u, username, ""); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
 func countRows(t *testing.T, ctx context.Context, db *sql.DB, count int, query string, args ...interface{}) {
 	var returned int
 	err := db.QueryRowContext(ctx, query, args...).Scan(&returned)
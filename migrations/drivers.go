@@ -12,8 +12,20 @@ package migrations
 
 import (
 	"fmt"
+
+	wf_db "github.com/writefreely/writefreely/db"
 )
 
+func (db *datastore) dialect() wf_db.DialectType {
+	switch db.driverName {
+	case driverSQLite:
+		return wf_db.DialectSQLite
+	case driverPostgres:
+		return wf_db.DialectPostgres
+	}
+	return wf_db.DialectMySQL
+}
+
 // TODO: use now() from writefreely pkg
 func (db *datastore) now() string {
 	if db.driverName == driverSQLite {
@@ -23,7 +35,7 @@ func (db *datastore) now() string {
 }
 
 func (db *datastore) typeInt() string {
-	if db.driverName == driverSQLite {
+	if db.driverName == driverSQLite || db.driverName == driverPostgres {
 		return "INTEGER"
 	}
 	return "INT"
@@ -39,6 +51,8 @@ func (db *datastore) typeSmallInt() string {
 func (db *datastore) typeTinyInt() string {
 	if db.driverName == driverSQLite {
 		return "INTEGER"
+	} else if db.driverName == driverPostgres {
+		return "SMALLINT"
 	}
 	return "TINYINT"
 }
@@ -50,6 +64,9 @@ func (db *datastore) typeText() string {
 func (db *datastore) typeChar(l int) string {
 	if db.driverName == driverSQLite {
 		return "TEXT"
+	} else if db.driverName == driverPostgres {
+		// Postgres pads CHAR values with spaces when reading them back
+		return fmt.Sprintf("VARCHAR(%d)", l)
 	}
 	return fmt.Sprintf("CHAR(%d)", l)
 }
@@ -64,6 +81,8 @@ func (db *datastore) typeVarChar(l int) string {
 func (db *datastore) typeVarBinary(l int) string {
 	if db.driverName == driverSQLite {
 		return "BLOB"
+	} else if db.driverName == driverPostgres {
+		return "BYTEA"
 	}
 	return fmt.Sprintf("VARBINARY(%d)", l)
 }
@@ -71,11 +90,16 @@ func (db *datastore) typeVarBinary(l int) string {
 func (db *datastore) typeBool() string {
 	if db.driverName == driverSQLite {
 		return "INTEGER"
+	} else if db.driverName == driverPostgres {
+		return "SMALLINT"
 	}
 	return "TINYINT(1)"
 }
 
 func (db *datastore) typeDateTime() string {
+	if db.driverName == driverPostgres {
+		return "TIMESTAMPTZ"
+	}
 	return "DATETIME"
 }
 
@@ -84,26 +108,28 @@ func (db *datastore) typeIntPrimaryKey() string {
 		// From docs: "In SQLite, a column with type INTEGER PRIMARY KEY is an alias for the ROWID (except in WITHOUT
 		// ROWID tables) which is always a 64-bit signed integer."
 		return "INTEGER PRIMARY KEY"
+	} else if db.driverName == driverPostgres {
+		return "SERIAL PRIMARY KEY"
 	}
 	return "INT AUTO_INCREMENT PRIMARY KEY"
 }
 
 func (db *datastore) collateMultiByte() string {
-	if db.driverName == driverSQLite {
+	if db.driverName != driverMySQL {
 		return ""
 	}
 	return " COLLATE utf8_bin"
 }
 
 func (db *datastore) engine() string {
-	if db.driverName == driverSQLite {
+	if db.driverName != driverMySQL {
 		return ""
 	}
 	return " ENGINE = InnoDB"
 }
 
 func (db *datastore) after(colName string) string {
-	if db.driverName == driverSQLite {
+	if db.driverName != driverMySQL {
 		return ""
 	}
 	return " AFTER " + colName
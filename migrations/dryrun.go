@@ -0,0 +1,98 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var errDryRunQuery = errors.New("migrations can't read from the database during a dry run")
+
+// dryRun returns a datastore for the same kind of database that writes each
+// statement it's given to w, instead of running it.
+func (db *datastore) dryRun(w io.Writer) *datastore {
+	return &datastore{sql.OpenDB(&recorder{w}), db.driverName}
+}
+
+// recorder is a database/sql driver that writes out statements without
+// running them. Every statement succeeds, and queries fail.
+type recorder struct {
+	w io.Writer
+}
+
+type recorderStmt struct {
+	r     *recorder
+	query string
+}
+
+func (r *recorder) Connect(ctx context.Context) (driver.Conn, error) {
+	return r, nil
+}
+
+func (r *recorder) Driver() driver.Driver {
+	return r
+}
+
+func (r *recorder) Open(name string) (driver.Conn, error) {
+	return r, nil
+}
+
+func (r *recorder) Prepare(query string) (driver.Stmt, error) {
+	return &recorderStmt{r, query}, nil
+}
+
+func (r *recorder) Close() error {
+	return nil
+}
+
+func (r *recorder) Begin() (driver.Tx, error) {
+	return r, nil
+}
+
+func (r *recorder) Commit() error {
+	return nil
+}
+
+func (r *recorder) Rollback() error {
+	return nil
+}
+
+func (r *recorder) write(query string, args []driver.Value) {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	fmt.Fprintf(r.w, "%s;\n", query)
+	if len(args) > 0 {
+		fmt.Fprintf(r.w, "-- with %v\n", args)
+	}
+	fmt.Fprintln(r.w)
+}
+
+func (s *recorderStmt) Close() error {
+	return nil
+}
+
+func (s *recorderStmt) NumInput() int {
+	return -1
+}
+
+func (s *recorderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.r.write(s.query, args)
+	return driver.RowsAffected(0), nil
+}
+
+func (s *recorderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errDryRunQuery
+}
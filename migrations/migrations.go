@@ -12,9 +12,15 @@
 package migrations
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/writeas/web-core/log"
+	wf_db "github.com/writefreely/writefreely/db"
 )
 
 // TODO: refactor to use the datastore struct from writefreely pkg
@@ -29,8 +35,9 @@ func NewDatastore(db *sql.DB, dn string) *datastore {
 
 // TODO: use these consts from writefreely pkg
 const (
-	driverMySQL  = "mysql"
-	driverSQLite = "sqlite3"
+	driverMySQL    = "mysql"
+	driverSQLite   = "sqlite3"
+	driverPostgres = "postgres"
 )
 
 type Migration interface {
@@ -38,15 +45,43 @@ type Migration interface {
 	Migrate(db *datastore) error
 }
 
+// ReversibleMigration is a Migration that can undo its changes.
+type ReversibleMigration interface {
+	Migration
+	Rollback(db *datastore) error
+	// LosesData returns whether undoing the migration deletes data, like the
+	// tables and columns it added.
+	LosesData() bool
+}
+
 type migration struct {
 	description string
 	migrate     func(db *datastore) error
 }
 
+type reversibleMigration struct {
+	migration
+	rollback func(db *datastore) error
+	lossless bool
+}
+
 func New(d string, fn func(db *datastore) error) Migration {
 	return &migration{d, fn}
 }
 
+// NewReversible creates a Migration that runs up to migrate and down to roll
+// the migration back. Rolling it back is assumed to delete data, so it has to
+// be forced.
+func NewReversible(d string, up, down func(db *datastore) error) Migration {
+	return &reversibleMigration{migration{d, up}, down, false}
+}
+
+// NewLosslessReversible creates a reversible Migration whose rollback doesn't
+// delete any data, like one that only adds an index.
+func NewLosslessReversible(d string, up, down func(db *datastore) error) Migration {
+	return &reversibleMigration{migration{d, up}, down, true}
+}
+
 func (m *migration) Description() string {
 	return m.description
 }
@@ -55,22 +90,54 @@ func (m *migration) Migrate(db *datastore) error {
 	return m.migrate(db)
 }
 
+func (m *reversibleMigration) Rollback(db *datastore) error {
+	return m.rollback(db)
+}
+
+func (m *reversibleMigration) LosesData() bool {
+	return !m.lossless
+}
+
+// Status describes a migration and whether it has been applied.
+type Status struct {
+	Version     int
+	Description string
+	Applied     bool
+	Migrated    time.Time
+	Reversible  bool
+	LosesData   bool
+}
+
 var migrations = []Migration{
-	New("support user invites", supportUserInvites),                 // -> V1 (v0.8.0)
-	New("support dynamic instance pages", supportInstancePages),     // V1 -> V2 (v0.9.0)
-	New("support users suspension", supportUserStatus),              // V2 -> V3 (v0.11.0)
-	New("support oauth", oauth),                                     // V3 -> V4
-	New("support slack oauth", oauthSlack),                          // V4 -> v5
-	New("support ActivityPub mentions", supportActivityPubMentions), // V5 -> V6
-	New("support oauth attach", oauthAttach),                        // V6 -> V7
-	New("support oauth via invite", oauthInvites),                   // V7 -> V8 (v0.12.0)
-	New("optimize drafts retrieval", optimizeDrafts),                // V8 -> V9
-	New("support post signatures", supportPostSignatures),           // V9 -> V10 (v0.13.0)
-	New("Widen oauth_users.access_token", widenOauthAcceesToken),    // V10 -> V11
-	New("support verifying fedi profile", fediverseVerifyProfile),   // V11 -> V12 (v0.14.0)
-	New("support newsletters", supportLetters),                      // V12 -> V13
-	New("support password resetting", supportPassReset),             // V13 -> V14
-	New("speed up blog post retrieval", addPostRetrievalIndex),      // V14 -> V15
+	New("support user invites", supportUserInvites),                                                               // -> V1 (v0.8.0)
+	NewReversible("support dynamic instance pages", supportInstancePages, rollbackInstancePages),                  // V1 -> V2 (v0.9.0)
+	NewReversible("support users suspension", supportUserStatus, rollbackUserStatus),                              // V2 -> V3 (v0.11.0)
+	NewReversible("support oauth", oauth, rollbackOauth),                                                          // V3 -> V4
+	NewReversible("support slack oauth", oauthSlack, rollbackOauthSlack),                                          // V4 -> v5
+	NewReversible("support ActivityPub mentions", supportActivityPubMentions, rollbackActivityPubMentions),        // V5 -> V6
+	NewReversible("support oauth attach", oauthAttach, rollbackOauthAttach),                                       // V6 -> V7
+	NewReversible("support oauth via invite", oauthInvites, rollbackOauthInvites),                                 // V7 -> V8 (v0.12.0)
+	New("optimize drafts retrieval", optimizeDrafts),                                                              // V8 -> V9
+	NewReversible("support post signatures", supportPostSignatures, rollbackPostSignatures),                       // V9 -> V10 (v0.13.0)
+	NewLosslessReversible("Widen oauth_users.access_token", widenOauthAcceesToken, rollbackWidenOauthAccessToken), // V10 -> V11
+	NewReversible("support verifying fedi profile", fediverseVerifyProfile, rollbackFediverseVerifyProfile),       // V11 -> V12 (v0.14.0)
+	NewReversible("support newsletters", supportLetters, rollbackLetters),                                         // V12 -> V13
+	NewReversible("support password resetting", supportPassReset, rollbackPassReset),                              // V13 -> V14
+	NewLosslessReversible("speed up blog post retrieval", addPostRetrievalIndex, rollbackPostRetrievalIndex),      // V14 -> V15
+	NewReversible("support email delivery logging", supportEmailDeliveryLog, rollbackEmailDeliveryLog),            // V15 -> V16
+	NewReversible("support letters archive", supportLettersArchive, rollbackLettersArchive),                       // V16 -> V17
+	NewReversible("support user notifications", supportUserNotifications, rollbackUserNotifications),              // V17 -> V18
+	NewReversible("support letter templates", supportLetterTemplates, rollbackLetterTemplates),                    // V18 -> V19
+	NewReversible("support key rotation", supportKeyRotation, rollbackKeyRotation),                                // V19 -> V20
+	NewReversible("support user sessions", supportUserSessions, rollbackUserSessions),                             // V20 -> V21
+	NewReversible("support token scopes", supportTokenScopes, rollbackTokenScopes),                                // V21 -> V22
+	NewReversible("support two-factor auth", supportTwoFactor, rollbackTwoFactor),                                 // V22 -> V23
+	NewReversible("support passkeys", supportPasskeys, rollbackPasskeys),                                          // V23 -> V24
+	NewReversible("support email verification", supportEmailVerification, rollbackEmailVerification),              // V24 -> V25
+	NewReversible("support signup blocklists", supportSignupBlocks, rollbackSignupBlocks),                         // V25 -> V26
+	NewReversible("support invite labels", supportInviteLabels, rollbackInviteLabels),                             // V26 -> V27
+	NewReversible("support username changes", supportUsernameChanges, rollbackUsernameChanges),                    // V27 -> V28
+	NewReversible("support delayed account deletion", supportUserDeletions, rollbackUserDeletions),                // V28 -> V29
 }
 
 // CurrentVer returns the current migration version the application is on
@@ -88,17 +155,35 @@ func SetInitialMigrations(db *datastore) error {
 }
 
 func Migrate(db *datastore) error {
+	return migrate(db, nil)
+}
+
+// DryRun writes the SQL that Migrate would run to w, without changing the
+// database.
+func DryRun(db *datastore, w io.Writer) error {
+	return migrate(db, w)
+}
+
+// migrate brings the database up to the current version. When dryRun is set,
+// statements are written to it instead of being run.
+func migrate(db *datastore, dryRun io.Writer) error {
+	target := db
+	if dryRun != nil {
+		target = db.dryRun(dryRun)
+		defer target.Close()
+	}
+
 	var version int
 	var err error
 	if db.tableExists("appmigrations") {
-		err = db.QueryRow("SELECT MAX(version) FROM appmigrations").Scan(&version)
+		version, err = db.version()
 		if err != nil {
 			return err
 		}
 	} else {
 		log.Info("Initializing appmigrations table...")
 		version = 0
-		_, err = db.Exec(`CREATE TABLE appmigrations (
+		_, err = target.Exec(`CREATE TABLE appmigrations (
 			version ` + db.typeInt() + ` NOT NULL,
 			migrated ` + db.typeDateTime() + ` NOT NULL,
 			result ` + db.typeText() + ` NOT NULL
@@ -111,14 +196,24 @@ func Migrate(db *datastore) error {
 	if len(migrations[version:]) > 0 {
 		for i, m := range migrations[version:] {
 			curVer := version + i + 1
-			log.Info("Migrating to V%d: %s", curVer, m.Description())
-			err = m.Migrate(db)
+			if dryRun != nil {
+				fmt.Fprintf(dryRun, "-- V%d: %s\n", curVer, m.Description())
+			} else {
+				log.Info("Migrating to V%d: %s", curVer, m.Description())
+			}
+			err = m.Migrate(target)
 			if err != nil {
+				if dryRun == nil {
+					db.cleanUpFailed(curVer, m)
+					if curVer > version+1 {
+						log.Error("Migrating to V%d failed. To return to V%d, run: writefreely db rollback --to %d --force", curVer, version, version)
+					}
+				}
 				return err
 			}
 
 			// Update migrations table
-			_, err = db.Exec("INSERT INTO appmigrations (version, migrated, result) VALUES (?, "+db.now()+", ?)", curVer, "")
+			_, err = target.Exec("INSERT INTO appmigrations (version, migrated, result) VALUES (?, "+db.now()+", ?)", curVer, "")
 			if err != nil {
 				return err
 			}
@@ -130,11 +225,164 @@ func Migrate(db *datastore) error {
 	return nil
 }
 
+// cleanUpFailed undoes whatever a failed migration managed to change. MySQL
+// commits schema changes as soon as they're made, so they survive the failed
+// migration's transaction being rolled back.
+func (db *datastore) cleanUpFailed(ver int, m Migration) {
+	rm, ok := m.(ReversibleMigration)
+	if !ok || db.driverName != driverMySQL {
+		return
+	}
+	log.Info("Undoing partial migration to V%d...", ver)
+	if err := rm.Rollback(db); err != nil {
+		log.Error("Unable to undo partial migration to V%d: %v", ver, err)
+	}
+}
+
+// Rollback reverts all migrations applied after the given version, newest
+// first. A negative version reverts only the latest migration. Unless force is
+// set, it refuses to revert migrations whose rollback deletes data.
+func Rollback(db *datastore, to int, force bool) error {
+	return rollback(db, to, force, nil)
+}
+
+// RollbackDryRun writes the SQL that Rollback would run to w, without changing
+// the database.
+func RollbackDryRun(db *datastore, to int, w io.Writer) error {
+	return rollback(db, to, true, w)
+}
+
+func rollback(db *datastore, to int, force bool, dryRun io.Writer) error {
+	if !db.tableExists("appmigrations") {
+		return fmt.Errorf("database has no migrations to roll back")
+	}
+	version, err := db.version()
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database is on V%d, which is newer than this version of WriteFreely knows about (V%d)", version, len(migrations))
+	}
+	if to < 0 {
+		to = version - 1
+	}
+	if to < 0 || to >= version {
+		return fmt.Errorf("can't roll back from V%d to V%d", version, to)
+	}
+
+	// Make sure we can get all the way there before changing anything
+	var lossy []string
+	for v := version; v > to; v-- {
+		m, ok := migrations[v-1].(ReversibleMigration)
+		if !ok {
+			return fmt.Errorf("V%d (%s) can't be rolled back", v, migrations[v-1].Description())
+		}
+		if m.LosesData() {
+			lossy = append(lossy, fmt.Sprintf("V%d (%s)", v, m.Description()))
+		}
+	}
+	if len(lossy) > 0 && !force {
+		return fmt.Errorf("rolling back %s deletes data. Back up the database first, then run again with --force", strings.Join(lossy, ", "))
+	}
+
+	target := db
+	if dryRun != nil {
+		target = db.dryRun(dryRun)
+		defer target.Close()
+	}
+	for v := version; v > to; v-- {
+		m := migrations[v-1].(ReversibleMigration)
+		if dryRun != nil {
+			fmt.Fprintf(dryRun, "-- V%d -> V%d: undo %s\n", v, v-1, m.Description())
+			if m.LosesData() {
+				fmt.Fprintf(dryRun, "-- (deletes data; needs --force)\n")
+			}
+		} else {
+			log.Info("Rolling back to V%d: undo %s", v-1, m.Description())
+		}
+		err = m.Rollback(target)
+		if err != nil {
+			return fmt.Errorf("V%d: %s", v, err)
+		}
+		_, err = target.Exec("DELETE FROM appmigrations WHERE version = ?", v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetStatus returns every migration this version of WriteFreely knows about,
+// along with when each was applied to the database.
+func GetStatus(db *datastore) ([]Status, error) {
+	applied := map[int]time.Time{}
+	if db.tableExists("appmigrations") {
+		rows, err := db.Query("SELECT version, migrated FROM appmigrations")
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var v int
+			var migrated time.Time
+			err = rows.Scan(&v, &migrated)
+			if err != nil {
+				return nil, err
+			}
+			applied[v] = migrated
+		}
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	ss := make([]Status, len(migrations))
+	for i, m := range migrations {
+		v := i + 1
+		migrated, ok := applied[v]
+		rm, reversible := m.(ReversibleMigration)
+		ss[i] = Status{
+			Version:     v,
+			Description: m.Description(),
+			Applied:     ok,
+			Migrated:    migrated,
+			Reversible:  reversible,
+			LosesData:   reversible && rm.LosesData(),
+		}
+	}
+	return ss, nil
+}
+
+func (db *datastore) version() (int, error) {
+	var version sql.NullInt64
+	err := db.QueryRow("SELECT MAX(version) FROM appmigrations").Scan(&version)
+	return int(version.Int64), err
+}
+
+// execBuilders runs the statements from the given builders in a single
+// transaction.
+func (db *datastore) execBuilders(builders ...wf_db.SQLBuilder) error {
+	return wf_db.RunTransactionWithOptions(context.Background(), db.DB, &sql.TxOptions{}, func(ctx context.Context, tx *sql.Tx) error {
+		for _, builder := range builders {
+			query, err := builder.ToSQL()
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (db *datastore) tableExists(t string) bool {
 	var dummy string
 	var err error
 	if db.driverName == driverSQLite {
 		err = db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", t).Scan(&dummy)
+	} else if db.driverName == driverPostgres {
+		err = db.QueryRow("SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?", t).Scan(&dummy)
 	} else {
 		err = db.QueryRow("SHOW TABLES LIKE '" + t + "'").Scan(&dummy)
 	}
@@ -31,3 +31,7 @@ func supportPostSignatures(db *datastore) error {
 
 	return nil
 }
+
+func rollbackPostSignatures(db *datastore) error {
+	return db.execBuilders(db.dialect().AlterTable("collections").DropColumn("post_signature"))
+}
@@ -11,17 +11,21 @@
 package migrations
 
 /**
- * Widen `oauth_users.access_token`, necessary only for mysql
+ * Widen `oauth_users.access_token`, necessary only for mysql and postgres
  */
 func widenOauthAcceesToken(db *datastore) error {
-	if db.driverName == driverMySQL {
+	if db.driverName == driverMySQL || db.driverName == driverPostgres {
 		t, err := db.Begin()
 		if err != nil {
 			t.Rollback()
 			return err
 		}
 
-		_, err = t.Exec(`ALTER TABLE oauth_users MODIFY COLUMN access_token ` + db.typeText() + db.collateMultiByte() + ` NULL`)
+		if db.driverName == driverPostgres {
+			_, err = t.Exec(`ALTER TABLE oauth_users ALTER COLUMN access_token TYPE ` + db.typeText() + `, ALTER COLUMN access_token DROP NOT NULL`)
+		} else {
+			_, err = t.Exec(`ALTER TABLE oauth_users MODIFY COLUMN access_token ` + db.typeText() + db.collateMultiByte() + ` NULL`)
+		}
 		if err != nil {
 			t.Rollback()
 			return err
@@ -36,3 +40,9 @@ func widenOauthAcceesToken(db *datastore) error {
 
 	return nil
 }
+
+// rollbackWidenOauthAccessToken leaves the column as it is, since narrowing it
+// could cut off existing tokens, and older versions work with either size.
+func rollbackWidenOauthAccessToken(db *datastore) error {
+	return nil
+}
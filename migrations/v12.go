@@ -31,3 +31,7 @@ func fediverseVerifyProfile(db *datastore) error {
 
 	return nil
 }
+
+func rollbackFediverseVerifyProfile(db *datastore) error {
+	return db.execBuilders(db.dialect().AlterTable("remoteusers").DropColumn("url"))
+}
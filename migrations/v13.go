@@ -56,3 +56,10 @@ func supportLetters(db *datastore) error {
 
 	return nil
 }
+
+func rollbackLetters(db *datastore) error {
+	return db.execBuilders(
+		db.dialect().DropTable("emailsubscribers"),
+		db.dialect().DropTable("publishjobs"),
+	)
+}
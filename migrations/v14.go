@@ -35,3 +35,7 @@ func supportPassReset(db *datastore) error {
 	}
 	return nil
 }
+
+func rollbackPassReset(db *datastore) error {
+	return db.execBuilders(db.dialect().DropTable("password_resets"))
+}
@@ -17,7 +17,7 @@ func addPostRetrievalIndex(db *datastore) error {
 		return err
 	}
 
-	_, err = t.Exec("CREATE INDEX posts_get_collection_index ON posts (`collection_id`, `pinned_position`, `created`)")
+	_, err = t.Exec(`CREATE INDEX posts_get_collection_index ON posts (collection_id, pinned_position, created)`)
 	if err != nil {
 		t.Rollback()
 		return err
@@ -31,3 +31,7 @@ func addPostRetrievalIndex(db *datastore) error {
 
 	return nil
 }
+
+func rollbackPostRetrievalIndex(db *datastore) error {
+	return db.execBuilders(db.dialect().DropIndex("posts_get_collection_index", "posts"))
+}
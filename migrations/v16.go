@@ -0,0 +1,75 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package migrations
+
+func supportEmailDeliveryLog(db *datastore) error {
+	t, err := db.Begin()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE TABLE emailsends (
+    id            ` + db.typeIntPrimaryKey() + `,
+    post_id       ` + db.typeVarChar(16) + ` not null,
+    collection_id ` + db.typeInt() + ` not null,
+    message_id    ` + db.typeVarChar(255) + ` null,
+    recipients    ` + db.typeInt() + ` not null,
+    failures      ` + db.typeInt() + ` default 0 not null,
+    error         ` + db.typeVarChar(255) + ` null,
+    sent          ` + db.typeDateTime() + ` not null
+)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE TABLE emailrecipients (
+    send_id       ` + db.typeInt() + ` not null,
+    subscriber_id ` + db.typeChar(8) + ` not null,
+    email_hash    ` + db.typeChar(64) + ` null,
+    status        ` + db.typeVarChar(16) + ` not null,
+    details       ` + db.typeVarChar(255) + ` null,
+    updated       ` + db.typeDateTime() + ` not null,
+	PRIMARY KEY (send_id, subscriber_id)
+)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE INDEX emailsends_message_index ON emailsends (message_id)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE INDEX emailrecipients_email_index ON emailrecipients (email_hash)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func rollbackEmailDeliveryLog(db *datastore) error {
+	return db.execBuilders(
+		db.dialect().DropTable("emailrecipients"),
+		db.dialect().DropTable("emailsends"),
+	)
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package migrations
+
+func supportLettersArchive(db *datastore) error {
+	t, err := db.Begin()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE TABLE letters (
+    id            ` + db.typeIntPrimaryKey() + `,
+    collection_id ` + db.typeInt() + ` not null,
+    post_id       ` + db.typeVarChar(16) + ` not null,
+    send_id       ` + db.typeInt() + ` null,
+    subject       ` + db.typeVarChar(255) + ` not null,
+    content       ` + db.typeText() + ` not null,
+    sent          ` + db.typeDateTime() + ` not null
+)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE INDEX letters_collection_index ON letters (collection_id, sent)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func rollbackLettersArchive(db *datastore) error {
+	return db.execBuilders(db.dialect().DropTable("letters"))
+}
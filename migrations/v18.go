@@ -0,0 +1,53 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package migrations
+
+func supportUserNotifications(db *datastore) error {
+	t, err := db.Begin()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE TABLE notifications (
+    id            ` + db.typeIntPrimaryKey() + `,
+    user_id       ` + db.typeInt() + ` not null,
+    collection_id ` + db.typeInt() + ` not null,
+    kind          ` + db.typeVarChar(16) + ` not null,
+    actor         ` + db.typeVarChar(255) + ` not null,
+    url           ` + db.typeVarChar(255) + ` null,
+    excerpt       ` + db.typeVarChar(255) + ` null,
+    created       ` + db.typeDateTime() + ` not null,
+    sent          ` + db.typeDateTime() + ` null
+)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE INDEX notifications_user_index ON notifications (user_id, sent)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func rollbackUserNotifications(db *datastore) error {
+	return db.execBuilders(db.dialect().DropTable("notifications"))
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package migrations
+
+func supportLetterTemplates(db *datastore) error {
+	t, err := db.Begin()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE TABLE lettertemplates (
+    collection_id ` + db.typeInt() + ` not null,
+    html_template ` + db.typeText() + ` not null,
+    text_template ` + db.typeText() + ` not null,
+    updated       ` + db.typeDateTime() + ` not null,
+    PRIMARY KEY (collection_id)
+)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func rollbackLetterTemplates(db *datastore) error {
+	return db.execBuilders(db.dialect().DropTable("lettertemplates"))
+}
@@ -36,3 +36,10 @@ func supportInstancePages(db *datastore) error {
 
 	return nil
 }
+
+func rollbackInstancePages(db *datastore) error {
+	return db.execBuilders(
+		db.dialect().AlterTable("appcontent").DropColumn("content_type"),
+		db.dialect().AlterTable("appcontent").DropColumn("title"),
+	)
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package migrations
+
+func supportKeyRotation(db *datastore) error {
+	t, err := db.Begin()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE TABLE appkeys (
+    name        ` + db.typeVarChar(32) + ` not null,
+    version     ` + db.typeInt() + ` not null,
+    rotated     ` + db.typeDateTime() + ` not null,
+    grace_until ` + db.typeDateTime() + ` null,
+    PRIMARY KEY (name)
+)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func rollbackKeyRotation(db *datastore) error {
+	return db.execBuilders(db.dialect().DropTable("appkeys"))
+}
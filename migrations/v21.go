@@ -0,0 +1,67 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package migrations
+
+func supportUserSessions(db *datastore) error {
+	t, err := db.Begin()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE TABLE usersessions (
+    id         ` + db.typeChar(32) + ` not null,
+    user_id    ` + db.typeInt() + ` not null,
+    user_agent ` + db.typeVarChar(255) + ` null,
+    ip         ` + db.typeVarChar(45) + ` null,
+    created    ` + db.typeDateTime() + ` not null,
+    last_used  ` + db.typeDateTime() + ` not null,
+    PRIMARY KEY (id)
+)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE INDEX usersessions_user_id_index ON usersessions (user_id)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`ALTER TABLE accesstokens ADD COLUMN ip ` + db.typeVarChar(45) + ` null`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`ALTER TABLE accesstokens ADD COLUMN last_used ` + db.typeDateTime() + ` null`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func rollbackUserSessions(db *datastore) error {
+	return db.execBuilders(
+		db.dialect().AlterTable("accesstokens").DropColumn("last_used"),
+		db.dialect().AlterTable("accesstokens").DropColumn("ip"),
+		db.dialect().DropTable("usersessions"),
+	)
+}
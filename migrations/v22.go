@@ -0,0 +1,48 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package migrations
+
+// supportTokenScopes adds names and scopes to access tokens. Existing tokens
+// are left without scopes, so they keep full access.
+func supportTokenScopes(db *datastore) error {
+	t, err := db.Begin()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`ALTER TABLE accesstokens ADD COLUMN name ` + db.typeVarChar(100) + ` null`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`ALTER TABLE accesstokens ADD COLUMN scopes ` + db.typeVarChar(255) + ` null`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func rollbackTokenScopes(db *datastore) error {
+	return db.execBuilders(
+		db.dialect().AlterTable("accesstokens").DropColumn("scopes"),
+		db.dialect().AlterTable("accesstokens").DropColumn("name"),
+	)
+}
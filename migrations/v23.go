@@ -0,0 +1,57 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package migrations
+
+func supportTwoFactor(db *datastore) error {
+	t, err := db.Begin()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE TABLE usertwofactor (
+    user_id        ` + db.typeInt() + ` not null,
+    secret         ` + db.typeVarBinary(255) + ` not null,
+    enabled        ` + db.typeBool() + ` default 0 not null,
+    last_used_step ` + db.typeInt() + ` default 0 not null,
+    created        ` + db.typeDateTime() + ` not null,
+    PRIMARY KEY (user_id)
+)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE TABLE userrecoverycodes (
+    user_id   ` + db.typeInt() + ` not null,
+    code_hash ` + db.typeChar(64) + ` not null,
+    PRIMARY KEY (user_id, code_hash)
+)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func rollbackTwoFactor(db *datastore) error {
+	return db.execBuilders(
+		db.dialect().DropTable("userrecoverycodes"),
+		db.dialect().DropTable("usertwofactor"),
+	)
+}
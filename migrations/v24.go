@@ -0,0 +1,54 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package migrations
+
+func supportPasskeys(db *datastore) error {
+	t, err := db.Begin()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE TABLE userpasskeys (
+    id         ` + db.typeVarChar(255) + ` not null,
+    user_id    ` + db.typeInt() + ` not null,
+    name       ` + db.typeVarChar(100) + ` not null,
+    public_key ` + db.typeVarBinary(1024) + ` not null,
+    sign_count ` + db.typeInt() + ` default 0 not null,
+    created    ` + db.typeDateTime() + ` not null,
+    last_used  ` + db.typeDateTime() + ` null,
+    PRIMARY KEY (id)
+)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE INDEX userpasskeys_user_id_index ON userpasskeys (user_id)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func rollbackPasskeys(db *datastore) error {
+	return db.execBuilders(
+		db.dialect().DropTable("userpasskeys"),
+	)
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package migrations
+
+func supportEmailVerification(db *datastore) error {
+	t, err := db.Begin()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`ALTER TABLE users ADD COLUMN email_verified ` + db.typeBool() + ` DEFAULT 0 NOT NULL`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	// Existing addresses have been in use all along, so trust them rather than
+	// locking their owners out of password resets.
+	_, err = t.Exec(`UPDATE users SET email_verified = 1 WHERE email IS NOT NULL`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE TABLE emailverifications (
+    user_id ` + db.typeInt() + ` not null,
+    token   ` + db.typeChar(32) + ` not null primary key,
+    created ` + db.typeDateTime() + ` not null
+)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func rollbackEmailVerification(db *datastore) error {
+	return db.execBuilders(
+		db.dialect().DropTable("emailverifications"),
+		db.dialect().AlterTable("users").DropColumn("email_verified"),
+	)
+}
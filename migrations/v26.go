@@ -0,0 +1,44 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package migrations
+
+func supportSignupBlocks(db *datastore) error {
+	t, err := db.Begin()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE TABLE signupblocks (
+    type    ` + db.typeVarChar(16) + ` not null,
+    value   ` + db.typeVarChar(255) + ` not null,
+    created ` + db.typeDateTime() + ` not null,
+    PRIMARY KEY (type, value)
+)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func rollbackSignupBlocks(db *datastore) error {
+	return db.execBuilders(
+		db.dialect().DropTable("signupblocks"),
+	)
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package migrations
+
+func supportInviteLabels(db *datastore) error {
+	t, err := db.Begin()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`ALTER TABLE userinvites ADD COLUMN label ` + db.typeVarChar(255) + ` NULL`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	// Address an invite was emailed to, encrypted like users' emails
+	_, err = t.Exec(`ALTER TABLE userinvites ADD COLUMN email ` + db.typeVarBinary(255) + ` NULL`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func rollbackInviteLabels(db *datastore) error {
+	return db.execBuilders(
+		db.dialect().AlterTable("userinvites").DropColumn("email"),
+		db.dialect().AlterTable("userinvites").DropColumn("label"),
+	)
+}
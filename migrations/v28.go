@@ -0,0 +1,50 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package migrations
+
+func supportUsernameChanges(db *datastore) error {
+	t, err := db.Begin()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE TABLE usernamechanges (
+    user_id       ` + db.typeInt() + ` not null,
+    prev_username ` + db.typeVarChar(100) + ` not null,
+    new_username  ` + db.typeVarChar(100) + ` not null,
+    created       ` + db.typeDateTime() + ` not null
+)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	_, err = t.Exec(`CREATE INDEX usernamechanges_prev_username_index ON usernamechanges (prev_username)`)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	err = t.Commit()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func rollbackUsernameChanges(db *datastore) error {
+	return db.execBuilders(
+		db.dialect().DropTable("usernamechanges"),
+	)
+}
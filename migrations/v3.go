@@ -30,3 +30,7 @@ func supportUserStatus(db *datastore) error {
 
 	return nil
 }
+
+func rollbackUserStatus(db *datastore) error {
+	return db.execBuilders(db.dialect().AlterTable("users").DropColumn("status"))
+}
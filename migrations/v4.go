@@ -18,10 +18,7 @@ import (
 )
 
 func oauth(db *datastore) error {
-	dialect := wf_db.DialectMySQL
-	if db.driverName == driverSQLite {
-		dialect = wf_db.DialectSQLite
-	}
+	dialect := db.dialect()
 	return wf_db.RunTransactionWithOptions(context.Background(), db.DB, &sql.TxOptions{}, func(ctx context.Context, tx *sql.Tx) error {
 		createTableUsersOauth, err := dialect.
 			Table("oauth_users").
@@ -52,3 +49,10 @@ func oauth(db *datastore) error {
 		return nil
 	})
 }
+
+func rollbackOauth(db *datastore) error {
+	return db.execBuilders(
+		db.dialect().DropTable("oauth_client_states"),
+		db.dialect().DropTable("oauth_users"),
+	)
+}
@@ -18,10 +18,7 @@ import (
 )
 
 func oauthSlack(db *datastore) error {
-	dialect := wf_db.DialectMySQL
-	if db.driverName == driverSQLite {
-		dialect = wf_db.DialectSQLite
-	}
+	dialect := db.dialect()
 	return wf_db.RunTransactionWithOptions(context.Background(), db.DB, &sql.TxOptions{}, func(ctx context.Context, tx *sql.Tx) error {
 		builders := []wf_db.SQLBuilder{
 			dialect.
@@ -86,3 +83,16 @@ func oauthSlack(db *datastore) error {
 		return nil
 	})
 }
+
+// rollbackOauthSlack leaves oauth_users.remote_user_id widened, since older
+// versions work with either size.
+func rollbackOauthSlack(db *datastore) error {
+	return db.execBuilders(
+		db.dialect().DropIndex("oauth_users_uk", "oauth_users"),
+		db.dialect().AlterTable("oauth_users").DropColumn("access_token"),
+		db.dialect().AlterTable("oauth_users").DropColumn("client_id"),
+		db.dialect().AlterTable("oauth_users").DropColumn("provider"),
+		db.dialect().AlterTable("oauth_client_states").DropColumn("client_id"),
+		db.dialect().AlterTable("oauth_client_states").DropColumn("provider"),
+	)
+}
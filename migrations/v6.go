@@ -30,3 +30,7 @@ func supportActivityPubMentions(db *datastore) error {
 
 	return nil
 }
+
+func rollbackActivityPubMentions(db *datastore) error {
+	return db.execBuilders(db.dialect().AlterTable("remoteusers").DropColumn("handle"))
+}
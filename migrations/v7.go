@@ -18,10 +18,7 @@ import (
 )
 
 func oauthAttach(db *datastore) error {
-	dialect := wf_db.DialectMySQL
-	if db.driverName == driverSQLite {
-		dialect = wf_db.DialectSQLite
-	}
+	dialect := db.dialect()
 	return wf_db.RunTransactionWithOptions(context.Background(), db.DB, &sql.TxOptions{}, func(ctx context.Context, tx *sql.Tx) error {
 		builders := []wf_db.SQLBuilder{
 			dialect.
@@ -44,3 +41,7 @@ func oauthAttach(db *datastore) error {
 		return nil
 	})
 }
+
+func rollbackOauthAttach(db *datastore) error {
+	return db.execBuilders(db.dialect().AlterTable("oauth_client_states").DropColumn("attach_user_id"))
+}
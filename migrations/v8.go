@@ -18,10 +18,7 @@ import (
 )
 
 func oauthInvites(db *datastore) error {
-	dialect := wf_db.DialectMySQL
-	if db.driverName == driverSQLite {
-		dialect = wf_db.DialectSQLite
-	}
+	dialect := db.dialect()
 	return wf_db.RunTransactionWithOptions(context.Background(), db.DB, &sql.TxOptions{}, func(ctx context.Context, tx *sql.Tx) error {
 		builders := []wf_db.SQLBuilder{
 			dialect.
@@ -43,3 +40,7 @@ func oauthInvites(db *datastore) error {
 		return nil
 	})
 }
+
+func rollbackOauthInvites(db *datastore) error {
+	return db.execBuilders(db.dialect().AlterTable("oauth_client_states").DropColumn("invite_code"))
+}
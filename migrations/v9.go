@@ -17,10 +17,10 @@ func optimizeDrafts(db *datastore) error {
 		return err
 	}
 
-	if db.driverName == driverSQLite {
-		_, err = t.Exec(`CREATE INDEX key_owner_post_id ON posts (owner_id, id)`)
-	} else {
+	if db.driverName == driverMySQL {
 		_, err = t.Exec(`ALTER TABLE posts ADD INDEX(owner_id, id)`)
+	} else {
+		_, err = t.Exec(`CREATE INDEX key_owner_post_id ON posts (owner_id, id)`)
 	}
 	if err != nil {
 		t.Rollback()
@@ -0,0 +1,103 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/writefreely/writefreely/migrations"
+)
+
+func TestMigrationStatus(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		ss, err := migrations.GetStatus(migrations.NewDatastore(db.DB, db.driverName))
+		assert.NoError(t, err)
+		if !assert.Len(t, ss, migrations.CurrentVer()) {
+			return
+		}
+		for _, s := range ss {
+			assert.True(t, s.Applied, "V%d should be applied", s.Version)
+		}
+		// V9 can't be undone, V11 and V15 can be without losing anything, and
+		// V13 drops tables
+		assert.False(t, ss[8].Reversible)
+		assert.True(t, ss[10].Reversible)
+		assert.False(t, ss[10].LosesData)
+		assert.False(t, ss[14].LosesData)
+		assert.True(t, ss[12].Reversible)
+		assert.True(t, ss[12].LosesData)
+	})
+}
+
+func TestRollback(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		mdb := migrations.NewDatastore(db.DB, db.driverName)
+		cur := migrations.CurrentVer()
+		version := func() int {
+			v, err := db.migrationVersion()
+			assert.NoError(t, err)
+			return v
+		}
+		hasTable := func(table string) bool {
+			_, err := db.Exec("SELECT 1 FROM " + table)
+			return err == nil
+		}
+
+		// A dry run only shows what would happen
+		var buf bytes.Buffer
+		assert.NoError(t, migrations.RollbackDryRun(mdb, -1, &buf))
+		assert.Contains(t, buf.String(), "undo support delayed account deletion")
+		assert.Contains(t, buf.String(), "userdeletions")
+		assert.Contains(t, buf.String(), "needs --force")
+		assert.Equal(t, cur, version())
+		assert.True(t, hasTable("userdeletions"))
+
+		// Dropping data has to be forced
+		err := migrations.Rollback(mdb, -1, false)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "--force")
+		}
+		assert.Equal(t, cur, version())
+		assert.True(t, hasTable("userdeletions"))
+
+		assert.NoError(t, migrations.Rollback(mdb, -1, true))
+		assert.Equal(t, cur-1, version())
+		assert.False(t, hasTable("userdeletions"))
+		ss, err := migrations.GetStatus(mdb)
+		assert.NoError(t, err)
+		assert.False(t, ss[cur-1].Applied)
+		assert.True(t, ss[cur-2].Applied)
+
+		// Nothing changes when the target can't be reached
+		err = migrations.Rollback(mdb, 5, true)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "can't be rolled back")
+		}
+		assert.Equal(t, cur-1, version())
+
+		// Lossless rollbacks don't need forcing
+		assert.NoError(t, migrations.Rollback(mdb, 15, true))
+		assert.Equal(t, 15, version())
+		assert.NoError(t, migrations.Rollback(mdb, 14, false))
+		assert.Equal(t, 14, version())
+
+		// and everything migrates back up again
+		buf.Reset()
+		assert.NoError(t, migrations.DryRun(mdb, &buf))
+		assert.Contains(t, buf.String(), "-- V15: speed up blog post retrieval")
+		assert.Equal(t, 14, version())
+		assert.NoError(t, migrations.Migrate(mdb))
+		assert.Equal(t, cur, version())
+		assert.True(t, hasTable("userdeletions"))
+	})
+}
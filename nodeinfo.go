@@ -93,7 +93,7 @@ FROM posts
 INNER JOIN collections c
 ON collection_id = c.id
 WHERE collection_id IS NOT NULL
-	AND updated > DATE_SUB(NOW(), INTERVAL 6 MONTH)) co`).Scan(&activeHalfYear)
+	AND updated > ` + r.db.dateSub(6, "MONTH") + `) co`).Scan(&activeHalfYear)
 		if err != nil {
 			log.Error("Failed getting 6-month active user stats: %s", err)
 		}
@@ -104,7 +104,7 @@ FROM posts
 INNER JOIN collections c
 ON collection_id = c.id
 WHERE collection_id IS NOT NULL
-	AND updated > DATE_SUB(NOW(), INTERVAL 1 MONTH)) co`).Scan(&activeMonth)
+	AND updated > ` + r.db.dateSub(1, "MONTH") + `) co`).Scan(&activeMonth)
 		if err != nil {
 			log.Error("Failed getting 1-month active user stats: %s", err)
 		}
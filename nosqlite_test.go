@@ -0,0 +1,21 @@
+//go:build !sqlite || wflib
+// +build !sqlite wflib
+
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import "testing"
+
+// newSQLiteTestDatastore returns nil, as this build has no SQLite support.
+func newSQLiteTestDatastore(t *testing.T) *datastore {
+	return nil
+}
@@ -0,0 +1,262 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mailgun/mailgun-go"
+	"github.com/writeas/impart"
+	"github.com/writeas/web-core/log"
+)
+
+const (
+	// Kinds of activity a user can be notified about
+	notifyFollower   = "follower"
+	notifySubscriber = "subscriber"
+	notifyReply      = "reply"
+
+	// Notification frequencies. An unset preference means no notifications.
+	notifyImmediately = "immediate"
+	notifyDaily       = "daily"
+
+	userAttrNotifyPrefix = "notify_"
+
+	notificationDigestHours = 24
+	notificationExcerptLen  = 250
+)
+
+var notificationKinds = []NotificationPref{
+	{Kind: notifyFollower, Label: "New fediverse followers"},
+	{Kind: notifySubscriber, Label: "New email subscribers"},
+	{Kind: notifyReply, Label: "Replies to your posts"},
+}
+
+type (
+	// Notification is a single piece of activity on one of a user's
+	// collections, waiting to be (or already) emailed to them.
+	Notification struct {
+		ID           int64
+		UserID       int64
+		CollectionID int64
+		Kind         string
+		Actor        string
+		URL          string
+		Excerpt      string
+		Created      time.Time
+
+		CollectionAlias string
+		CollectionTitle string
+	}
+
+	// NotificationPref is how often a user wants to hear about a kind of
+	// notification.
+	NotificationPref struct {
+		Kind      string
+		Label     string
+		Frequency string
+	}
+)
+
+func (n *Notification) collectionName() string {
+	if n.CollectionTitle != "" {
+		return n.CollectionTitle
+	}
+	return n.CollectionAlias
+}
+
+// Summary returns a one-line description of the notification.
+func (n *Notification) Summary() string {
+	switch n.Kind {
+	case notifyFollower:
+		return n.Actor + " followed " + n.collectionName() + " from the fediverse."
+	case notifySubscriber:
+		return n.Actor + " subscribed to " + n.collectionName() + " by email."
+	case notifyReply:
+		return n.Actor + " replied to a post on " + n.collectionName() + "."
+	}
+	return n.Actor + " interacted with " + n.collectionName() + "."
+}
+
+func (n *Notification) plainText() string {
+	s := n.Summary()
+	if n.Excerpt != "" {
+		s += "\n\n    " + strings.Replace(n.Excerpt, "\n", "\n    ", -1)
+	}
+	if n.URL != "" {
+		s += "\n\n" + n.URL
+	}
+	return s
+}
+
+// getNotificationPrefs returns the user's frequency for every kind of
+// notification.
+func getNotificationPrefs(app *App, userID int64) []NotificationPref {
+	prefs := make([]NotificationPref, len(notificationKinds))
+	for i, np := range notificationKinds {
+		np.Frequency = app.db.GetUserAttribute(userID, userAttrNotifyPrefix+np.Kind)
+		prefs[i] = np
+	}
+	return prefs
+}
+
+// notifyUser queues a notification for the owner of the given collection, if
+// they've opted in to that kind, sending it right away if they want to be
+// notified immediately.
+func notifyUser(app *App, c *Collection, kind, actor, url, excerpt string) {
+	if !app.cfg.Email.Enabled() {
+		return
+	}
+	freq := app.db.GetUserAttribute(c.OwnerID, userAttrNotifyPrefix+kind)
+	if freq != notifyImmediately && freq != notifyDaily {
+		return
+	}
+
+	if e := []rune(excerpt); len(e) > notificationExcerptLen {
+		excerpt = string(e[:notificationExcerptLen-3]) + "..."
+	}
+	if len(url) > 255 {
+		url = ""
+	}
+	if a := []rune(actor); len(a) > 255 {
+		actor = string(a[:255])
+	}
+	n := &Notification{
+		UserID:          c.OwnerID,
+		CollectionID:    c.ID,
+		Kind:            kind,
+		Actor:           actor,
+		URL:             url,
+		Excerpt:         excerpt,
+		Created:         time.Now(),
+		CollectionAlias: c.Alias,
+		CollectionTitle: c.Title,
+	}
+	err := app.db.InsertNotification(n)
+	if err != nil {
+		log.Error("Unable to queue %s notification for user %d: %v", kind, c.OwnerID, err)
+		return
+	}
+	if freq != notifyImmediately {
+		return
+	}
+
+	u, err := app.db.GetUserByID(c.OwnerID)
+	if err != nil {
+		log.Error("Unable to get user %d for notification: %v", c.OwnerID, err)
+		return
+	}
+	err = sendNotifications(app, u, []*Notification{n})
+	if err != nil {
+		return
+	}
+	app.db.MarkNotificationsSent([]*Notification{n})
+}
+
+// sendNotifications emails the given notifications to the user, as a digest
+// if there are more than one.
+func sendNotifications(app *App, u *User, ns []*Notification) error {
+	to := u.EmailClear(app.keys)
+	if to == "" {
+		log.Info("[notify] User %d has no email address; skipping %d notification(s)", u.ID, len(ns))
+		return fmt.Errorf("no email address")
+	}
+
+	var subject, plainMsg string
+	if len(ns) == 1 {
+		subject = ns[0].Summary()
+		plainMsg = ns[0].plainText()
+	} else {
+		subject = fmt.Sprintf("%d new notifications on %s", len(ns), app.cfg.App.SiteName)
+		plainMsg = fmt.Sprintf("Here's what happened on your blogs since %s:", ns[0].Created.Format("January 2, 2006"))
+		for _, n := range ns {
+			plainMsg += "\n\n- " + strings.Replace(n.plainText(), "\n", "\n  ", -1)
+		}
+	}
+	plainMsg += `
+
+---------------------------------------------------------------------------------
+
+Change how often you receive these emails: ` + app.cfg.App.Host + `/me/settings`
+
+	gun := mailgun.NewMailgun(app.cfg.Email.Domain, app.cfg.Email.MailgunPrivate)
+	m := mailgun.NewMessage(app.cfg.App.SiteName+" <noreply-notifications@"+app.cfg.Email.Domain+">", subject, plainMsg, fmt.Sprintf("<%s>", to))
+	m.AddTag("Notification")
+	_, _, err := gun.Send(m)
+	if err != nil {
+		log.Error("Unable to send notifications to user %d: %v", u.ID, err)
+		return err
+	}
+	return nil
+}
+
+// startNotificationsQueue periodically sends digests of notifications to users
+// who asked to have them batched.
+func startNotificationsQueue(app *App) {
+	t := time.NewTicker(time.Hour)
+	for {
+		<-t.C
+		userIDs, err := app.db.GetUsersWithDueNotifications(notificationDigestHours)
+		if err != nil {
+			log.Error("[notify] %s - Skipping.", err)
+			continue
+		}
+		log.Info("[notify] Sending notification digests to %d user(s)...", len(userIDs))
+		for _, id := range userIDs {
+			u, err := app.db.GetUserByID(id)
+			if err != nil {
+				log.Error("[notify] Unable to get user %d: %v", id, err)
+				continue
+			}
+			ns, err := app.db.GetPendingNotifications(id)
+			if err != nil || len(ns) == 0 {
+				continue
+			}
+			if u.EmailClear(app.keys) != "" {
+				err = sendNotifications(app, u, ns)
+				if err != nil {
+					// Try again next time
+					continue
+				}
+			}
+			// Notifications for users without an email address are dropped
+			app.db.MarkNotificationsSent(ns)
+		}
+	}
+}
+
+// handleNotificationPrefs updates how often the user is notified about each
+// kind of activity.
+func handleNotificationPrefs(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	if !app.cfg.Email.Enabled() {
+		return impart.HTTPError{http.StatusNotFound, "Email isn't enabled on this instance."}
+	}
+
+	for _, np := range notificationKinds {
+		attr := userAttrNotifyPrefix + np.Kind
+		var err error
+		switch freq := r.FormValue(attr); freq {
+		case notifyImmediately, notifyDaily:
+			err = app.db.SetUserAttribute(u.ID, attr, freq)
+		default:
+			err = app.db.DeleteUserAttribute(u.ID, attr)
+		}
+		if err != nil {
+			return impart.HTTPError{http.StatusInternalServerError, "Unable to save notification settings."}
+		}
+	}
+
+	_ = addSessionFlash(app, w, r, "Notification settings saved.", nil)
+	return impart.HTTPError{http.StatusFound, "/me/settings"}
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import "testing"
+
+func TestNotificationPlainText(t *testing.T) {
+	n := &Notification{
+		Kind:            notifyReply,
+		Actor:           "matt@example.social",
+		URL:             "https://example.social/@matt/1",
+		Excerpt:         "Great post!\nThanks.",
+		CollectionAlias: "blog",
+	}
+	expected := `matt@example.social replied to a post on blog.
+
+    Great post!
+    Thanks.
+
+https://example.social/@matt/1`
+	if out := n.plainText(); out != expected {
+		t.Errorf("got %q, expected %q", out, expected)
+	}
+
+	n = &Notification{
+		Kind:            notifySubscriber,
+		Actor:           "reader@example.com",
+		CollectionAlias: "blog",
+		CollectionTitle: "My Blog",
+	}
+	if out := n.plainText(); out != "reader@example.com subscribed to My Blog by email." {
+		t.Errorf("got %q", out)
+	}
+}
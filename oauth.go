@@ -37,10 +37,27 @@ type OAuthButtons struct {
 	GiteaDisplayName   string
 	GenericEnabled     bool
 	GenericDisplayName string
+	GenericProviders   []GenericOAuthButton
+}
+
+// GenericOAuthButton holds display information for one of the generic OAuth
+// providers configured in [oauth.generic.<name>] sections.
+type GenericOAuthButton struct {
+	Provider    string
+	DisplayName string
 }
 
 // NewOAuthButtons creates a new OAuthButtons struct based on our app configuration.
 func NewOAuthButtons(cfg *config.Config) *OAuthButtons {
+	var genericProviders []GenericOAuthButton
+	for _, p := range cfg.GenericOauths {
+		if p.ClientID != "" {
+			genericProviders = append(genericProviders, GenericOAuthButton{
+				Provider:    genericOauthProviderName(p.Name),
+				DisplayName: config.OrDefaultString(p.DisplayName, genericOauthDisplayName),
+			})
+		}
+	}
 	return &OAuthButtons{
 		SlackEnabled:       cfg.SlackOauth.ClientID != "",
 		WriteAsEnabled:     cfg.WriteAsOauth.ClientID != "",
@@ -50,6 +67,7 @@ func NewOAuthButtons(cfg *config.Config) *OAuthButtons {
 		GiteaDisplayName:   config.OrDefaultString(cfg.GiteaOauth.DisplayName, giteaDisplayName),
 		GenericEnabled:     cfg.GenericOauth.ClientID != "",
 		GenericDisplayName: config.OrDefaultString(cfg.GenericOauth.DisplayName, genericOauthDisplayName),
+		GenericProviders:   genericProviders,
 	}
 }
 
@@ -60,6 +78,7 @@ type TokenResponse struct {
 	ExpiresIn    int    `json:"expires_in"`
 	RefreshToken string `json:"refresh_token"`
 	TokenType    string `json:"token_type"`
+	IDToken      string `json:"id_token"`
 	Error        string `json:"error"`
 }
 
@@ -71,6 +90,7 @@ type InspectResponse struct {
 	Username    string    `json:"username"`
 	DisplayName string    `json:"-"`
 	Email       string    `json:"email"`
+	Groups      []string  `json:"-"`
 	Error       string    `json:"error"`
 }
 
@@ -100,6 +120,8 @@ type OAuthDatastore interface {
 
 	CreateUser(*config.Config, *User, string, string) error
 	GetUserByID(int64) (*User, error)
+	IsTwoFactorEnabled(int64) (bool, error)
+	SetUserAdmin(int64, bool) error
 }
 
 type HttpClient interface {
@@ -115,6 +137,23 @@ type oauthClient interface {
 	inspectOauthAccessToken(ctx context.Context, accessToken string) (*InspectResponse, error)
 }
 
+// oidcOauthClient is an oauthClient that logs users in with OpenID Connect.
+// Each login sends a nonce and PKCE code challenge that the callback has to
+// check, so they're kept in the session in between.
+type oidcOauthClient interface {
+	oauthClient
+	buildOIDCLoginURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	exchangeOIDCCode(ctx context.Context, code, codeVerifier string) (*TokenResponse, error)
+	inspectIDToken(ctx context.Context, tokenResponse *TokenResponse, nonce string) (*InspectResponse, error)
+}
+
+// groupsOauthClient is an oauthClient whose users' groups decide whether they
+// can sign up and whether they're admins.
+type groupsOauthClient interface {
+	oauthClient
+	groupRules() oauthGroupRules
+}
+
 type callbackProxyClient struct {
 	server           string
 	callbackLocation string
@@ -155,7 +194,12 @@ func (h oauthHandler) viewOauthInit(app *App, w http.ResponseWriter, r *http.Req
 		}
 	}
 
-	location, err := h.oauthClient.buildLoginURL(state)
+	var location string
+	if oc, ok := h.oauthClient.(oidcOauthClient); ok {
+		location, err = h.startOIDCLogin(ctx, w, r, oc, state)
+	} else {
+		location, err = h.oauthClient.buildLoginURL(state)
+	}
 	if err != nil {
 		log.Error("viewOauthInit error: %s", err)
 		return impart.HTTPError{http.StatusInternalServerError, "could not prepare oauth redirect url"}
@@ -243,32 +287,49 @@ func configureGitlabOauth(parentHandler *Handler, r *mux.Router, app *App) {
 }
 
 func configureGenericOauth(parentHandler *Handler, r *mux.Router, app *App) {
-	if app.Config().GenericOauth.ClientID != "" {
-		callbackLocation := app.Config().App.Host + "/oauth/callback/generic"
+	configureGenericOauthProvider(parentHandler, r, app, "", app.Config().GenericOauth)
+	for _, p := range app.Config().GenericOauths {
+		configureGenericOauthProvider(parentHandler, r, app, p.Name, p.GenericOauthCfg)
+	}
+}
+
+func configureGenericOauthProvider(parentHandler *Handler, r *mux.Router, app *App, name string, cfg config.GenericOauthCfg) {
+	if cfg.ClientID != "" {
+		callbackLocation := app.Config().App.Host + "/oauth/callback/" + genericOauthProviderName(name)
 
 		var callbackProxy *callbackProxyClient = nil
-		if app.Config().GenericOauth.CallbackProxy != "" {
+		if cfg.CallbackProxy != "" {
 			callbackProxy = &callbackProxyClient{
-				server:           app.Config().GenericOauth.CallbackProxyAPI,
-				callbackLocation: app.Config().App.Host + "/oauth/callback/generic",
+				server:           cfg.CallbackProxyAPI,
+				callbackLocation: callbackLocation,
 				httpClient:       config.DefaultHTTPClient(),
 			}
-			callbackLocation = app.Config().GenericOauth.CallbackProxy
+			callbackLocation = cfg.CallbackProxy
+		}
+
+		if cfg.Mode == genericOauthModeOIDC {
+			oauthClient := newGenericOIDCClient(cfg, callbackLocation)
+			oauthClient.Name = name
+			configureOauthRoutes(parentHandler, r, app, oauthClient, callbackProxy)
+			return
 		}
 
 		oauthClient := genericOauthClient{
-			ClientID:         app.Config().GenericOauth.ClientID,
-			ClientSecret:     app.Config().GenericOauth.ClientSecret,
-			ExchangeLocation: app.Config().GenericOauth.Host + app.Config().GenericOauth.TokenEndpoint,
-			InspectLocation:  app.Config().GenericOauth.Host + app.Config().GenericOauth.InspectEndpoint,
-			AuthLocation:     app.Config().GenericOauth.Host + app.Config().GenericOauth.AuthEndpoint,
+			Name:             name,
+			ClientID:         cfg.ClientID,
+			ClientSecret:     cfg.ClientSecret,
+			ExchangeLocation: cfg.Host + cfg.TokenEndpoint,
+			InspectLocation:  cfg.Host + cfg.InspectEndpoint,
+			AuthLocation:     cfg.Host + cfg.AuthEndpoint,
 			HttpClient:       config.DefaultHTTPClient(),
 			CallbackLocation: callbackLocation,
-			Scope:            config.OrDefaultString(app.Config().GenericOauth.Scope, "read_user"),
-			MapUserID:        config.OrDefaultString(app.Config().GenericOauth.MapUserID, "user_id"),
-			MapUsername:      config.OrDefaultString(app.Config().GenericOauth.MapUsername, "username"),
-			MapDisplayName:   config.OrDefaultString(app.Config().GenericOauth.MapDisplayName, "-"),
-			MapEmail:         config.OrDefaultString(app.Config().GenericOauth.MapEmail, "email"),
+			Scope:            config.OrDefaultString(cfg.Scope, "read_user"),
+			MapUserID:        config.OrDefaultString(cfg.MapUserID, "user_id"),
+			MapUsername:      config.OrDefaultString(cfg.MapUsername, "username"),
+			MapDisplayName:   config.OrDefaultString(cfg.MapDisplayName, "-"),
+			MapEmail:         config.OrDefaultString(cfg.MapEmail, "email"),
+			MapGroups:        config.OrDefaultString(cfg.MapGroups, "groups"),
+			Groups:           newOauthGroupRules(cfg.AllowedGroups, cfg.AdminGroups),
 		}
 		configureOauthRoutes(parentHandler, r, app, oauthClient, callbackProxy)
 	}
@@ -331,8 +392,26 @@ func (h oauthHandler) viewOauthCallback(app *App, w http.ResponseWriter, r *http
 		log.Error("Unable to ValidateOAuthState: %s", err)
 		return impart.HTTPError{http.StatusInternalServerError, err.Error()}
 	}
+	if provider != h.oauthClient.GetProvider() || clientID != h.oauthClient.GetClientID() {
+		// The login was started with another provider, whose remote user IDs
+		// mean something else
+		log.Error("OAuth state for %s (%s) used on %s callback", provider, clientID, h.oauthClient.GetProvider())
+		return impart.HTTPError{http.StatusBadRequest, "This login was started with another provider. Please try again."}
+	}
 
-	tokenResponse, err := h.oauthClient.exchangeOauthCode(ctx, code)
+	oc, isOIDC := h.oauthClient.(oidcOauthClient)
+	var login *oidcLogin
+	var tokenResponse *TokenResponse
+	if isOIDC {
+		login = takeOIDCLogin(h.Store, w, r, state)
+		if login == nil {
+			log.Error("Unable to find OpenID Connect login for state")
+			return impart.HTTPError{http.StatusBadRequest, "This login expired. Please try again."}
+		}
+		tokenResponse, err = oc.exchangeOIDCCode(ctx, code, login.CodeVerifier)
+	} else {
+		tokenResponse, err = h.oauthClient.exchangeOauthCode(ctx, code)
+	}
 	if err != nil {
 		log.Error("Unable to exchangeOauthCode: %s", err)
 		// TODO: show user friendly message if needed
@@ -344,12 +423,22 @@ func (h oauthHandler) viewOauthCallback(app *App, w http.ResponseWriter, r *http
 		return impart.HTTPError{http.StatusInternalServerError, err.Error()}
 	}
 
-	// Now that we have the access token, let's use it real quick to make sure
-	// it really really works.
-	tokenInfo, err := h.oauthClient.inspectOauthAccessToken(ctx, tokenResponse.AccessToken)
-	if err != nil {
-		log.Error("Unable to inspectOauthAccessToken: %s", err)
-		return impart.HTTPError{http.StatusInternalServerError, err.Error()}
+	var tokenInfo *InspectResponse
+	if isOIDC {
+		// The ID token says who the user is, once we know it's genuine
+		tokenInfo, err = oc.inspectIDToken(ctx, tokenResponse, login.Nonce)
+		if err != nil {
+			log.Error("Unable to inspectIDToken: %s", err)
+			return impart.HTTPError{http.StatusInternalServerError, err.Error()}
+		}
+	} else {
+		// Now that we have the access token, let's use it real quick to make sure
+		// it really really works.
+		tokenInfo, err = h.oauthClient.inspectOauthAccessToken(ctx, tokenResponse.AccessToken)
+		if err != nil {
+			log.Error("Unable to inspectOauthAccessToken: %s", err)
+			return impart.HTTPError{http.StatusInternalServerError, err.Error()}
+		}
 	}
 
 	localUserID, err := h.DB.GetIDForRemoteUser(ctx, tokenInfo.UserID, provider, clientID)
@@ -365,13 +454,42 @@ func (h oauthHandler) viewOauthCallback(app *App, w http.ResponseWriter, r *http
 		return impart.HTTPError{http.StatusFound, "/me/settings"}
 	}
 
+	var groups oauthGroupRules
+	if gc, ok := h.oauthClient.(groupsOauthClient); ok {
+		groups = gc.groupRules()
+	}
+
 	if localUserID != -1 {
 		// Existing user, so log in now
+		if groups.ManagesAdmin() {
+			if err = h.DB.SetUserAdmin(localUserID, groups.IsAdmin(tokenInfo.Groups)); err != nil {
+				log.Error("Unable to SetUserAdmin %d: %s", localUserID, err)
+				return impart.HTTPError{http.StatusInternalServerError, err.Error()}
+			}
+		}
 		user, err := h.DB.GetUserByID(localUserID)
 		if err != nil {
 			log.Error("Unable to GetUserByID %d: %s", localUserID, err)
 			return impart.HTTPError{http.StatusInternalServerError, err.Error()}
 		}
+		if user.IsPending() {
+			addSessionFlash(app, w, r, ErrUserPending.Message, nil)
+			return impart.HTTPError{http.StatusFound, "/login"}
+		}
+
+		// The provider stands in for the password, not the second factor
+		has2FA, err := h.DB.IsTwoFactorEnabled(user.ID)
+		if err != nil {
+			log.Error("Unable to check two-factor auth for %d: %s", user.ID, err)
+			return impart.HTTPError{http.StatusInternalServerError, err.Error()}
+		}
+		if has2FA {
+			return startTwoFactorLogin(app, w, r, user, "/")
+		}
+
+		if err = restoreAccount(app, w, r, user); err != nil {
+			return err
+		}
 		if err = loginOrFail(h.Store, w, r, user); err != nil {
 			log.Error("Unable to loginOrFail %d: %s", localUserID, err)
 			return impart.HTTPError{http.StatusInternalServerError, err.Error()}
@@ -390,6 +508,11 @@ func (h oauthHandler) viewOauthCallback(app *App, w http.ResponseWriter, r *http
 
 	// New user registration below.
 	// First, verify that user is allowed to register
+	if !groups.CanSignUp(tokenInfo.Groups) {
+		log.Info("OAuth user %s isn't in any group allowed to sign up", tokenInfo.UserID)
+		addSessionFlash(app, w, r, "Your account isn't allowed to sign up here.", nil)
+		return impart.HTTPError{http.StatusFound, "/login"}
+	}
 	if inviteCode != "" {
 		// Verify invite code is valid
 		i, err := app.db.GetUserInvite(inviteCode)
@@ -418,6 +541,7 @@ func (h oauthHandler) viewOauthCallback(app *App, w http.ResponseWriter, r *http
 		Provider:        provider,
 		ClientID:        clientID,
 		InviteCode:      inviteCode,
+		Admin:           groups.ManagesAdmin() && groups.IsAdmin(tokenInfo.Groups),
 	}
 	tp.TokenHash = tp.HashTokenParams(h.Config.Server.HashSeed)
 
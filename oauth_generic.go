@@ -21,6 +21,9 @@ import (
 )
 
 type genericOauthClient struct {
+	// Name is set for providers configured in [oauth.generic.<name>]
+	// sections, giving each its own routes and oauth_users records.
+	Name             string
 	ClientID         string
 	ClientSecret     string
 	AuthLocation     string
@@ -32,17 +35,29 @@ type genericOauthClient struct {
 	MapUsername      string
 	MapDisplayName   string
 	MapEmail         string
+	MapGroups        string
+	Groups           oauthGroupRules
 	HttpClient       HttpClient
 }
 
-var _ oauthClient = genericOauthClient{}
+var _ groupsOauthClient = genericOauthClient{}
 
 const (
 	genericOauthDisplayName = "OAuth"
+	genericOauthProvider    = "generic"
 )
 
+// genericOauthProviderName returns the provider name of the generic OAuth
+// provider with the given name, or of the unnamed one.
+func genericOauthProviderName(name string) string {
+	if name == "" {
+		return genericOauthProvider
+	}
+	return genericOauthProvider + "." + name
+}
+
 func (c genericOauthClient) GetProvider() string {
-	return "generic"
+	return genericOauthProviderName(c.Name)
 }
 
 func (c genericOauthClient) GetClientID() string {
@@ -76,7 +91,11 @@ func (c genericOauthClient) exchangeOauthCode(ctx context.Context, code string)
 	form.Add("redirect_uri", c.CallbackLocation)
 	form.Add("scope", c.Scope)
 	form.Add("code", code)
-	req, err := http.NewRequest("POST", c.ExchangeLocation, strings.NewReader(form.Encode()))
+	return c.requestToken(ctx, c.ExchangeLocation, form)
+}
+
+func (c genericOauthClient) requestToken(ctx context.Context, location string, form url.Values) (*TokenResponse, error) {
+	req, err := http.NewRequest("POST", location, strings.NewReader(form.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -129,7 +148,12 @@ func (c genericOauthClient) inspectOauthAccessToken(ctx context.Context, accessT
 		return nil, err
 	}
 
-	// map each relevant field in inspectResponse to the mapped field from the config
+	return c.mapInspectResponse(genericInterface)
+}
+
+// mapInspectResponse maps each relevant field in an InspectResponse to the
+// mapped field from the config.
+func (c genericOauthClient) mapInspectResponse(genericInterface map[string]interface{}) (*InspectResponse, error) {
 	var inspectResponse InspectResponse
 	inspectResponse.UserID, _ = genericInterface[c.MapUserID].(string)
 	if inspectResponse.UserID == "" {
@@ -139,6 +163,70 @@ func (c genericOauthClient) inspectOauthAccessToken(ctx context.Context, accessT
 	inspectResponse.Username, _ = genericInterface[c.MapUsername].(string)
 	inspectResponse.DisplayName, _ = genericInterface[c.MapDisplayName].(string)
 	inspectResponse.Email, _ = genericInterface[c.MapEmail].(string)
+	switch groups := genericInterface[c.MapGroups].(type) {
+	case string:
+		inspectResponse.Groups = []string{groups}
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				inspectResponse.Groups = append(inspectResponse.Groups, s)
+			}
+		}
+	}
 
 	return &inspectResponse, nil
 }
+
+func (c genericOauthClient) groupRules() oauthGroupRules {
+	return c.Groups
+}
+
+// oauthGroupRules decide who can sign up and who is an admin, by the groups
+// a provider says a user is in.
+type oauthGroupRules struct {
+	Allowed []string
+	Admin   []string
+}
+
+func newOauthGroupRules(allowed, admin string) oauthGroupRules {
+	return oauthGroupRules{
+		Allowed: splitGroups(allowed),
+		Admin:   splitGroups(admin),
+	}
+}
+
+func splitGroups(s string) []string {
+	var groups []string
+	for _, g := range strings.Split(s, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// CanSignUp returns whether a user in the given groups can sign up.
+func (gr oauthGroupRules) CanSignUp(groups []string) bool {
+	return len(gr.Allowed) == 0 || inAnyGroup(groups, gr.Allowed)
+}
+
+// ManagesAdmin returns whether logging in decides if a user is an admin.
+func (gr oauthGroupRules) ManagesAdmin() bool {
+	return len(gr.Admin) > 0
+}
+
+// IsAdmin returns whether a user in the given groups should be an admin.
+func (gr oauthGroupRules) IsAdmin(groups []string) bool {
+	return inAnyGroup(groups, gr.Admin)
+}
+
+func inAnyGroup(groups, any []string) bool {
+	for _, g := range groups {
+		for _, a := range any {
+			if g == a {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/writeas/web-core/log"
+	"github.com/writefreely/writefreely/config"
+	"github.com/writefreely/writefreely/oidc"
+)
+
+const genericOauthModeOIDC = "oidc"
+
+// genericOIDCClient is the generic OAuth provider in OpenID Connect mode. It
+// finds the provider's endpoints through discovery, and identifies users by
+// their verified ID token rather than trusting an inspect endpoint.
+type genericOIDCClient struct {
+	genericOauthClient
+	Provider *oidc.Provider
+}
+
+var _ oidcOauthClient = genericOIDCClient{}
+
+func newGenericOIDCClient(cfg config.GenericOauthCfg, callbackLocation string) genericOIDCClient {
+	scope := config.OrDefaultString(cfg.Scope, "openid profile email")
+	if !strings.Contains(" "+scope+" ", " openid ") {
+		scope = "openid " + scope
+	}
+	return genericOIDCClient{
+		genericOauthClient: genericOauthClient{
+			ClientID:         cfg.ClientID,
+			ClientSecret:     cfg.ClientSecret,
+			HttpClient:       config.DefaultHTTPClient(),
+			CallbackLocation: callbackLocation,
+			Scope:            scope,
+			MapUserID:        config.OrDefaultString(cfg.MapUserID, "sub"),
+			MapUsername:      config.OrDefaultString(cfg.MapUsername, "preferred_username"),
+			MapDisplayName:   config.OrDefaultString(cfg.MapDisplayName, "name"),
+			MapEmail:         config.OrDefaultString(cfg.MapEmail, "email"),
+			MapGroups:        config.OrDefaultString(cfg.MapGroups, "groups"),
+			Groups:           newOauthGroupRules(cfg.AllowedGroups, cfg.AdminGroups),
+		},
+		Provider: oidc.NewProvider(cfg.Host, config.DefaultHTTPClient()),
+	}
+}
+
+func (c genericOIDCClient) buildLoginURL(state string) (string, error) {
+	return "", errors.New("OpenID Connect logins need a nonce")
+}
+
+func (c genericOIDCClient) buildOIDCLoginURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	m, err := c.Provider.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("client_id", c.ClientID)
+	q.Set("redirect_uri", c.CallbackLocation)
+	q.Set("response_type", "code")
+	q.Set("state", state)
+	q.Set("scope", c.Scope)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (c genericOIDCClient) exchangeOauthCode(ctx context.Context, code string) (*TokenResponse, error) {
+	return nil, errors.New("OpenID Connect logins need a code verifier")
+}
+
+func (c genericOIDCClient) exchangeOIDCCode(ctx context.Context, code, codeVerifier string) (*TokenResponse, error) {
+	m, err := c.Provider.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Add("client_id", c.ClientID)
+	form.Add("client_secret", c.ClientSecret)
+	form.Add("grant_type", "authorization_code")
+	form.Add("redirect_uri", c.CallbackLocation)
+	form.Add("code", code)
+	form.Add("code_verifier", codeVerifier)
+	return c.requestToken(ctx, m.TokenEndpoint, form)
+}
+
+func (c genericOIDCClient) inspectOauthAccessToken(ctx context.Context, accessToken string) (*InspectResponse, error) {
+	return nil, errors.New("OpenID Connect logins need an ID token")
+}
+
+func (c genericOIDCClient) inspectIDToken(ctx context.Context, tokenResponse *TokenResponse, nonce string) (*InspectResponse, error) {
+	claims, err := c.Provider.VerifyIDToken(ctx, tokenResponse.IDToken, c.ClientID, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// Providers may only put some claims in the userinfo response
+	if tokenResponse.AccessToken != "" {
+		info, err := c.Provider.UserInfo(ctx, tokenResponse.AccessToken)
+		if err != nil {
+			log.Error("Unable to get OpenID Connect userinfo; using ID token claims only: %s", err)
+		} else if info != nil && info.String("sub") != claims.String("sub") {
+			log.Error("OpenID Connect userinfo is for a different subject; ignoring it")
+		} else {
+			for k, v := range info {
+				if _, ok := claims[k]; !ok {
+					claims[k] = v
+				}
+			}
+		}
+	}
+	return c.mapInspectResponse(claims)
+}
+
+// oidcLogin is what an OpenID Connect login needs to remember between
+// redirecting to the provider and handling its callback.
+type oidcLogin struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// startOIDCLogin saves a new oidcLogin in the session, returning where to
+// send the user to log in.
+func (h oauthHandler) startOIDCLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, oc oidcOauthClient, state string) (string, error) {
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", err
+	}
+	location, err := oc.buildOIDCLoginURL(ctx, state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		return "", err
+	}
+
+	// An error may be returned, but a valid session should always be returned.
+	session, _ := h.Store.Get(r, cookieName)
+	session.Values[cookieOIDCVal] = &oidcLogin{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+	}
+	if err = session.Save(r, w); err != nil {
+		return "", err
+	}
+	return location, nil
+}
+
+// takeOIDCLogin removes the login with the given state from the session and
+// returns it, or nil if there isn't one.
+func takeOIDCLogin(store sessions.Store, w http.ResponseWriter, r *http.Request, state string) *oidcLogin {
+	session, err := store.Get(r, cookieName)
+	if err != nil {
+		return nil
+	}
+	login, _ := session.Values[cookieOIDCVal].(*oidcLogin)
+	if login == nil {
+		return nil
+	}
+	delete(session.Values, cookieOIDCVal)
+	if err = session.Save(r, w); err != nil {
+		log.Error("Unable to save session: %s", err)
+	}
+	if login.State != state {
+		return nil
+	}
+	return login
+}
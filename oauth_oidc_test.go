@@ -0,0 +1,159 @@
+package writefreely
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/writeas/impart"
+	"github.com/writefreely/writefreely/config"
+	"github.com/writefreely/writefreely/oidc"
+)
+
+// newTestOIDCProvider stands in for an OpenID Connect provider that issues
+// ID tokens for the nonce it was last sent, as long as the code verifier
+// matches its challenge.
+func newTestOIDCProvider(t *testing.T) *httptest.Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	b64 := base64.RawURLEncoding
+
+	var srv *httptest.Server
+	var nonce, challenge string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"jwks_uri":               srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{"kty": "RSA", "kid": "k1", "n": b64.EncodeToString(key.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(key.E)).Bytes())},
+			},
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		nonce = r.FormValue("nonce")
+		challenge = r.FormValue("code_challenge")
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if oidc.CodeChallenge(r.FormValue("code_verifier")) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+		payload, _ := json.Marshal(map[string]interface{}{
+			"iss":                srv.URL,
+			"sub":                "remote-1",
+			"aud":                "development",
+			"exp":                time.Now().Add(time.Minute).Unix(),
+			"iat":                time.Now().Unix(),
+			"nonce":              nonce,
+			"preferred_username": "nick",
+			"email":              "nick@example.com",
+		})
+		signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+		h := sha256.Sum256([]byte(signed))
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access_token",
+			"token_type":   "Bearer",
+			"id_token":     signed + "." + b64.EncodeToString(sig),
+		})
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGenericOIDCLogin(t *testing.T) {
+	idp := newTestOIDCProvider(t)
+	app := &MockOAuthDatastoreProvider{
+		DoDB: func() OAuthDatastore {
+			return &MockOAuthDatastore{
+				DoValidateOAuthState: func(ctx context.Context, state string) (string, string, int64, string, error) {
+					return "generic", "development", 0, "", nil
+				},
+				DoGetIDForRemoteUser: func(ctx context.Context, remoteUserID, provider, clientID string) (int64, error) {
+					assert.Equal(t, "remote-1", remoteUserID)
+					return 1, nil
+				},
+			}
+		},
+	}
+	oc := newGenericOIDCClient(config.GenericOauthCfg{
+		ClientID:     "development",
+		ClientSecret: "development",
+		Host:         idp.URL,
+	}, "http://localhost/oauth/callback/generic")
+	oc.HttpClient = idp.Client()
+	oc.Provider = oidc.NewProvider(idp.URL, idp.Client())
+	h := oauthHandler{
+		Config:      app.Config(),
+		DB:          app.DB(),
+		Store:       app.SessionStore(),
+		EmailKey:    []byte{0xd, 0xe, 0xc, 0xa, 0xf, 0xf, 0xb, 0xa, 0xd},
+		oauthClient: oc,
+	}
+
+	// Start logging in, and follow the redirect to the provider
+	req := httptest.NewRequest("GET", "/oauth/generic", nil)
+	rr := httptest.NewRecorder()
+	err := h.viewOauthInit(nil, rr, req)
+	httpErr, ok := err.(impart.HTTPError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusTemporaryRedirect, httpErr.Status)
+	loc, err := url.Parse(httpErr.Message)
+	assert.NoError(t, err)
+	assert.Equal(t, "/authorize", loc.Path)
+	assert.Equal(t, "openid profile email", loc.Query().Get("scope"))
+	assert.Equal(t, "S256", loc.Query().Get("code_challenge_method"))
+	assert.NotEmpty(t, loc.Query().Get("nonce"))
+	resp, err := idp.Client().Get(loc.String())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	cookies := rr.Result().Cookies()
+	state := loc.Query().Get("state")
+
+	callback := func(state string, cookies []*http.Cookie) error {
+		req := httptest.NewRequest("GET", "/oauth/callback/generic?code=c0de&state="+state, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		return h.viewOauthCallback(&App{cfg: app.Config(), sessionStore: app.SessionStore()}, httptest.NewRecorder(), req)
+	}
+
+	t.Run("no session", func(t *testing.T) {
+		err := callback(state, nil)
+		httpErr, ok := err.(impart.HTTPError)
+		assert.True(t, ok)
+		assert.Equal(t, http.StatusBadRequest, httpErr.Status)
+	})
+
+	t.Run("wrong state", func(t *testing.T) {
+		err := callback("other", cookies)
+		httpErr, ok := err.(impart.HTTPError)
+		assert.True(t, ok)
+		assert.Equal(t, http.StatusBadRequest, httpErr.Status)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		assert.NoError(t, callback(state, cookies))
+	})
+}
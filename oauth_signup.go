@@ -39,6 +39,7 @@ type viewOauthSignupVars struct {
 	ClientID        string
 	TokenHash       string
 	InviteCode      string
+	Admin           bool
 
 	LoginUsername string
 	Alias         string // TODO: rename this to match the data it represents: the collection title
@@ -59,6 +60,8 @@ const (
 	oauthParamEmail             = "email"
 	oauthParamPassword          = "password"
 	oauthParamInviteCode        = "invite_code"
+	oauthParamAdmin             = "admin"
+	oauthParamReason            = "reason"
 )
 
 type oauthSignupPageParams struct {
@@ -71,6 +74,7 @@ type oauthSignupPageParams struct {
 	Provider        string
 	TokenHash       string
 	InviteCode      string
+	Admin           bool
 }
 
 func (p oauthSignupPageParams) HashTokenParams(key string) string {
@@ -83,6 +87,9 @@ func (p oauthSignupPageParams) HashTokenParams(key string) string {
 	hasher.Write([]byte(p.TokenRemoteUser))
 	hasher.Write([]byte(p.ClientID))
 	hasher.Write([]byte(p.Provider))
+	if p.Admin {
+		hasher.Write([]byte(oauthParamAdmin))
+	}
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
@@ -96,6 +103,7 @@ func (h oauthHandler) viewOauthSignup(app *App, w http.ResponseWriter, r *http.R
 		ClientID:        r.FormValue(oauthParamClientID),
 		Provider:        r.FormValue(oauthParamProvider),
 		InviteCode:      r.FormValue(oauthParamInviteCode),
+		Admin:           r.FormValue(oauthParamAdmin) == "1",
 	}
 	if tp.HashTokenParams(h.Config.Server.HashSeed) != r.FormValue(oauthParamHash) {
 		return impart.HTTPError{Status: http.StatusBadRequest, Message: "Request has been tampered with."}
@@ -105,6 +113,19 @@ func (h oauthHandler) viewOauthSignup(app *App, w http.ResponseWriter, r *http.R
 		return h.showOauthSignupPage(app, w, r, tp, err)
 	}
 
+	if tp.InviteCode != "" {
+		// The invite code isn't signed, so make sure it's still good
+		if i, err := app.db.GetUserInvite(tp.InviteCode); err != nil || !i.Active(app.db) {
+			return h.showOauthSignupPage(app, w, r, tp, fmt.Errorf("Invite link has expired."))
+		}
+	}
+
+	if !tp.Admin {
+		if err := checkSignupBlocks(app, r, r.FormValue(oauthParamEmail)); err != nil {
+			return h.showOauthSignupPage(app, w, r, tp, err)
+		}
+	}
+
 	var err error
 	hashedPass := []byte{}
 	clearPass := r.FormValue(oauthParamPassword)
@@ -122,6 +143,14 @@ func (h oauthHandler) viewOauthSignup(app *App, w http.ResponseWriter, r *http.R
 		Email:      prepareUserEmail(r.FormValue(oauthParamEmail), h.EmailKey),
 		Created:    time.Now().Truncate(time.Second).UTC(),
 	}
+	// Admins come from the provider's groups, so they're already vetted
+	pending := !tp.Admin && needsApproval(app, tp.InviteCode)
+	if pending {
+		if r.FormValue(oauthParamEmail) == "" {
+			return h.showOauthSignupPage(app, w, r, tp, fmt.Errorf("An email address is required, so we can let you know when your account is approved."))
+		}
+		newUser.Status = UserPending
+	}
 	displayName := r.FormValue(oauthParamAlias)
 	if len(displayName) == 0 {
 		displayName = r.FormValue(oauthParamUsername)
@@ -131,6 +160,9 @@ func (h oauthHandler) viewOauthSignup(app *App, w http.ResponseWriter, r *http.R
 	if err != nil {
 		return h.showOauthSignupPage(app, w, r, tp, err)
 	}
+	if !tp.Admin {
+		scoreSignup(app, r, newUser.ID)
+	}
 
 	// Log invite if needed
 	if tp.InviteCode != "" {
@@ -145,6 +177,24 @@ func (h oauthHandler) viewOauthSignup(app *App, w http.ResponseWriter, r *http.R
 		return h.showOauthSignupPage(app, w, r, tp, err)
 	}
 
+	if tp.Admin {
+		if err = h.DB.SetUserAdmin(newUser.ID, true); err != nil {
+			return h.showOauthSignupPage(app, w, r, tp, err)
+		}
+		newUser.Admin = true
+	}
+	if email := r.FormValue(oauthParamEmail); email != "" {
+		startEmailVerification(app, newUser.ID, email)
+	}
+
+	if pending {
+		if err = recordSignupReason(app, newUser.ID, r.FormValue(oauthParamReason)); err != nil {
+			return h.showOauthSignupPage(app, w, r, tp, err)
+		}
+		addSessionFlash(app, w, r, "Thanks for signing up! An admin will review your account, and you'll get an email once it's approved.", nil)
+		return impart.HTTPError{http.StatusFound, "/login"}
+	}
+
 	if err := loginOrFail(h.Store, w, r, newUser); err != nil {
 		return h.showOauthSignupPage(app, w, r, tp, err)
 	}
@@ -208,6 +258,7 @@ func (h oauthHandler) showOauthSignupPage(app *App, w http.ResponseWriter, r *ht
 		ClientID:        tp.ClientID,
 		TokenHash:       tp.TokenHash,
 		InviteCode:      tp.InviteCode,
+		Admin:           tp.Admin,
 
 		LoginUsername: username,
 		Alias:         collTitle,
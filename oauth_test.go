@@ -38,6 +38,8 @@ type MockOAuthDatastore struct {
 	DoCreateUser         func(*config.Config, *User, string) error
 	DoRecordRemoteUserID func(context.Context, int64, string, string, string, string) error
 	DoGetUserByID        func(int64) (*User, error)
+	DoIsTwoFactorEnabled func(int64) (bool, error)
+	DoSetUserAdmin       func(int64, bool) error
 }
 
 var _ OAuthDatastore = &MockOAuthDatastore{}
@@ -133,6 +135,20 @@ func (m *MockOAuthDatastore) GetUserByID(userID int64) (*User, error) {
 	return user, nil
 }
 
+func (m *MockOAuthDatastore) IsTwoFactorEnabled(userID int64) (bool, error) {
+	if m.DoIsTwoFactorEnabled != nil {
+		return m.DoIsTwoFactorEnabled(userID)
+	}
+	return false, nil
+}
+
+func (m *MockOAuthDatastore) SetUserAdmin(userID int64, admin bool) error {
+	if m.DoSetUserAdmin != nil {
+		return m.DoSetUserAdmin(userID, admin)
+	}
+	return nil
+}
+
 func (m *MockOAuthDatastore) GenerateOAuthState(ctx context.Context, provider string, clientID string, attachUserID int64, inviteCode string) (string, error) {
 	if m.DoGenerateOAuthState != nil {
 		return m.DoGenerateOAuthState(ctx, provider, clientID, attachUserID, inviteCode)
@@ -216,7 +232,15 @@ func TestViewOauthInit(t *testing.T) {
 
 func TestViewOauthCallback(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
-		app := &MockOAuthDatastoreProvider{}
+		app := &MockOAuthDatastoreProvider{
+			DoDB: func() OAuthDatastore {
+				return &MockOAuthDatastore{
+					DoValidateOAuthState: func(ctx context.Context, state string) (string, string, int64, string, error) {
+						return "write.as", "development", 0, "", nil
+					},
+				}
+			},
+		}
 		h := oauthHandler{
 			Config:   app.Config(),
 			DB:       app.DB(),
@@ -259,3 +283,200 @@ func TestViewOauthCallback(t *testing.T) {
 		assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
 	})
 }
+
+func TestViewOauthCallbackTwoFactor(t *testing.T) {
+	app := &MockOAuthDatastoreProvider{}
+	h := oauthHandler{
+		Config: app.Config(),
+		DB: &MockOAuthDatastore{
+			DoValidateOAuthState: func(context.Context, string) (string, string, int64, string, error) {
+				return "write.as", "development", 0, "", nil
+			},
+			DoGetIDForRemoteUser: func(context.Context, string, string, string) (int64, error) {
+				return 2, nil
+			},
+			DoGetUserByID: func(userID int64) (*User, error) {
+				return &User{ID: userID}, nil
+			},
+			DoIsTwoFactorEnabled: func(userID int64) (bool, error) {
+				return userID == 2, nil
+			},
+		},
+		Store:    app.SessionStore(),
+		EmailKey: []byte{0xd, 0xe, 0xc, 0xa, 0xf, 0xf, 0xb, 0xa, 0xd},
+		oauthClient: writeAsOauthClient{
+			ClientID:         app.Config().WriteAsOauth.ClientID,
+			ClientSecret:     app.Config().WriteAsOauth.ClientSecret,
+			ExchangeLocation: app.Config().WriteAsOauth.TokenLocation,
+			InspectLocation:  app.Config().WriteAsOauth.InspectLocation,
+			AuthLocation:     app.Config().WriteAsOauth.AuthLocation,
+			CallbackLocation: "http://localhost/oauth/callback",
+			HttpClient: &MockHTTPClient{
+				DoDo: func(req *http.Request) (*http.Response, error) {
+					body := `{"access_token": "access_token", "expires_in": 1000, "refresh_token": "refresh_token", "token_type": "access"}`
+					if req.URL.String() == "https://write.as/oauth/inspect" {
+						body = `{"client_id": "development", "user_id": "1", "expires_at": "2019-12-19T11:42:01Z", "username": "nick", "email": "nick@testing.write.as"}`
+					}
+					return &http.Response{
+						StatusCode: 200,
+						Body:       &StringReadCloser{strings.NewReader(body)},
+					}, nil
+				},
+			},
+		},
+	}
+	req, err := http.NewRequest("GET", "/oauth/callback", nil)
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	err = h.viewOauthCallback(&App{cfg: h.Config, sessionStore: h.Store}, rr, req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "/login/2fa", rr.Header().Get("Location"))
+
+	// The session only holds the pending login, not the user
+	sess, err := h.Store.Get(&http.Request{Header: http.Header{"Cookie": rr.Header()["Set-Cookie"]}}, cookieName)
+	assert.NoError(t, err)
+	assert.Nil(t, sess.Values[cookieUserVal])
+	pending, ok := sess.Values[cookieTwoFactorVal].(*pendingTwoFactor)
+	if assert.True(t, ok) {
+		assert.Equal(t, int64(2), pending.UserID)
+	}
+}
+
+func TestGenericOauthGroups(t *testing.T) {
+	newHandler := func(groups string, db *MockOAuthDatastore) oauthHandler {
+		app := &MockOAuthDatastoreProvider{}
+		db.DoValidateOAuthState = func(context.Context, string) (string, string, int64, string, error) {
+			return "generic", "development", 0, "", nil
+		}
+		return oauthHandler{
+			Config:   app.Config(),
+			DB:       db,
+			Store:    app.SessionStore(),
+			EmailKey: []byte{0xd, 0xe, 0xc, 0xa, 0xf, 0xf, 0xb, 0xa, 0xd},
+			oauthClient: genericOauthClient{
+				ClientID:         "development",
+				ExchangeLocation: "https://example.com/token",
+				InspectLocation:  "https://example.com/inspect",
+				MapUserID:        "user_id",
+				MapUsername:      "username",
+				MapGroups:        "groups",
+				Groups:           newOauthGroupRules("writers, admins", "admins"),
+				HttpClient: &MockHTTPClient{
+					DoDo: func(req *http.Request) (*http.Response, error) {
+						body := `{"access_token": "access_token"}`
+						if req.URL.Path == "/inspect" {
+							body = `{"user_id": "1", "username": "nick", "groups": ` + groups + `}`
+						}
+						return &http.Response{
+							StatusCode: 200,
+							Body:       &StringReadCloser{strings.NewReader(body)},
+						}, nil
+					},
+				},
+			},
+		}
+	}
+	callback := func(h oauthHandler) error {
+		req, err := http.NewRequest("GET", "/oauth/callback", nil)
+		assert.NoError(t, err)
+		return h.viewOauthCallback(&App{cfg: h.Config, sessionStore: h.Store}, httptest.NewRecorder(), req)
+	}
+
+	t.Run("grant admin", func(t *testing.T) {
+		var granted bool
+		h := newHandler(`["writers", "admins"]`, &MockOAuthDatastore{
+			DoGetIDForRemoteUser: func(context.Context, string, string, string) (int64, error) {
+				return 2, nil
+			},
+			DoSetUserAdmin: func(userID int64, admin bool) error {
+				assert.Equal(t, int64(2), userID)
+				granted = admin
+				return nil
+			},
+		})
+		assert.NoError(t, callback(h))
+		assert.True(t, granted)
+	})
+
+	t.Run("revoke admin", func(t *testing.T) {
+		granted := true
+		h := newHandler(`"writers"`, &MockOAuthDatastore{
+			DoGetIDForRemoteUser: func(context.Context, string, string, string) (int64, error) {
+				return 2, nil
+			},
+			DoSetUserAdmin: func(userID int64, admin bool) error {
+				granted = admin
+				return nil
+			},
+		})
+		assert.NoError(t, callback(h))
+		assert.False(t, granted)
+	})
+
+	t.Run("signup not allowed", func(t *testing.T) {
+		h := newHandler(`["readers"]`, &MockOAuthDatastore{})
+		err := callback(h)
+		httpErr, ok := err.(impart.HTTPError)
+		assert.True(t, ok)
+		assert.Equal(t, http.StatusFound, httpErr.Status)
+		assert.Equal(t, "/login", httpErr.Message)
+	})
+}
+
+func TestNamedGenericOauth(t *testing.T) {
+	cfg := config.New()
+	cfg.GenericOauths = []config.NamedGenericOauthCfg{
+		{Name: "staff", GenericOauthCfg: config.GenericOauthCfg{ClientID: "staff", DisplayName: "Staff SSO"}},
+		{Name: "unused"},
+	}
+	buttons := NewOAuthButtons(cfg)
+	assert.False(t, buttons.GenericEnabled)
+	assert.Equal(t, []GenericOAuthButton{{Provider: "generic.staff", DisplayName: "Staff SSO"}}, buttons.GenericProviders)
+
+	app := &MockOAuthDatastoreProvider{
+		DoDB: func() OAuthDatastore {
+			return &MockOAuthDatastore{
+				DoGenerateOAuthState: func(ctx context.Context, provider, clientID string, attachUserID int64, inviteCode string) (string, error) {
+					assert.Equal(t, "generic.staff", provider)
+					assert.Equal(t, "staff", clientID)
+					return "state", nil
+				},
+			}
+		},
+	}
+	h := oauthHandler{
+		Config: app.Config(),
+		DB:     app.DB(),
+		Store:  app.SessionStore(),
+		oauthClient: genericOauthClient{
+			Name:             "staff",
+			ClientID:         "staff",
+			AuthLocation:     "https://sso.example.com/authorize",
+			CallbackLocation: "http://localhost/oauth/callback/generic.staff",
+		},
+	}
+	req, err := http.NewRequest("GET", "/oauth/generic.staff", nil)
+	assert.NoError(t, err)
+	err = h.viewOauthInit(nil, httptest.NewRecorder(), req)
+	httpErr, ok := err.(impart.HTTPError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusTemporaryRedirect, httpErr.Status)
+
+	// A login started with another provider can't be finished with this one
+	h.DB = &MockOAuthDatastore{
+		DoValidateOAuthState: func(ctx context.Context, state string) (string, string, int64, string, error) {
+			return "generic", "staff", 0, "", nil
+		},
+		DoGetIDForRemoteUser: func(ctx context.Context, remoteUserID, provider, clientID string) (int64, error) {
+			t.Error("looked up remote user from another provider")
+			return -1, nil
+		},
+	}
+	req, err = http.NewRequest("GET", "/oauth/callback/generic.staff?state=state", nil)
+	assert.NoError(t, err)
+	err = h.viewOauthCallback(&App{cfg: h.Config, sessionStore: h.Store}, httptest.NewRecorder(), req)
+	httpErr, ok = err.(impart.HTTPError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, httpErr.Status)
+}
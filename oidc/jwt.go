@@ -0,0 +1,254 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	errBadSignature = errors.New("oidc: ID token signature doesn't match")
+	errUnknownKey   = errors.New("oidc: ID token was signed with an unknown key")
+)
+
+// jwt is a parsed, but unverified, JSON Web Token (RFC 7519).
+type jwt struct {
+	header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	payload   []byte
+	signed    []byte
+	signature []byte
+}
+
+func parseJWT(raw string) (*jwt, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("oidc: malformed ID token")
+	}
+	t := &jwt{signed: []byte(parts[0] + "." + parts[1])}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("oidc: malformed ID token header")
+	}
+	if err = json.Unmarshal(header, &t.header); err != nil {
+		return nil, errors.New("oidc: malformed ID token header")
+	}
+	if t.payload, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, errors.New("oidc: malformed ID token claims")
+	}
+	if t.signature, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return nil, errors.New("oidc: malformed ID token signature")
+	}
+	return t, nil
+}
+
+// signingAlg describes a JWS algorithm (RFC 7518) that we accept. The "none"
+// and shared-secret HMAC algorithms are never accepted.
+type signingAlg struct {
+	kty  string
+	crv  string
+	hash crypto.Hash
+	pss  bool
+}
+
+var signingAlgs = map[string]signingAlg{
+	"RS256": {kty: "RSA", hash: crypto.SHA256},
+	"RS384": {kty: "RSA", hash: crypto.SHA384},
+	"RS512": {kty: "RSA", hash: crypto.SHA512},
+	"PS256": {kty: "RSA", hash: crypto.SHA256, pss: true},
+	"PS384": {kty: "RSA", hash: crypto.SHA384, pss: true},
+	"PS512": {kty: "RSA", hash: crypto.SHA512, pss: true},
+	"ES256": {kty: "EC", crv: "P-256", hash: crypto.SHA256},
+	"ES384": {kty: "EC", crv: "P-384", hash: crypto.SHA384},
+	"ES512": {kty: "EC", crv: "P-521", hash: crypto.SHA512},
+	"EdDSA": {kty: "OKP", crv: "Ed25519"},
+}
+
+func (p *Provider) verifySignature(ctx context.Context, t *jwt) error {
+	alg, ok := signingAlgs[t.header.Alg]
+	if !ok {
+		return fmt.Errorf("oidc: ID token signed with unsupported algorithm %q", t.header.Alg)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := p.matchingKeys(t.header.Kid, t.header.Alg, alg)
+	if len(keys) == 0 && time.Since(p.keysFetched) > minKeyRefresh {
+		// The provider may have rotated its keys
+		if err := p.fetchKeys(ctx); err != nil {
+			return err
+		}
+		keys = p.matchingKeys(t.header.Kid, t.header.Alg, alg)
+	}
+	if len(keys) == 0 {
+		return errUnknownKey
+	}
+	for _, k := range keys {
+		if verifyJWS(k.pub, alg, t.signed, t.signature) {
+			return nil
+		}
+	}
+	return errBadSignature
+}
+
+func (p *Provider) fetchKeys(ctx context.Context) error {
+	m, err := p.metadata(ctx)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	p.keysFetched = time.Now()
+	if err = p.getJSON(ctx, m.JWKSURI, "", &set); err != nil {
+		return fmt.Errorf("oidc: fetching keys: %s", err)
+	}
+	p.keys = p.keys[:0]
+	for _, k := range set.Keys {
+		// Skip keys we can't use, rather than failing on them
+		if k.parse() == nil {
+			p.keys = append(p.keys, k)
+		}
+	}
+	return nil
+}
+
+// matchingKeys returns the keys that could have made a signature with the
+// given key ID and algorithm.
+func (p *Provider) matchingKeys(kid, algName string, alg signingAlg) []jsonWebKey {
+	var res []jsonWebKey
+	for _, k := range p.keys {
+		if k.Kty != alg.kty || k.Crv != alg.crv || (kid != "" && k.Kid != kid) {
+			continue
+		}
+		if (k.Alg != "" && k.Alg != algName) || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		res = append(res, k)
+	}
+	return res
+}
+
+// jsonWebKey is a public key from a provider's key set (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+
+	pub crypto.PublicKey
+}
+
+func (k *jsonWebKey) parse() error {
+	b64 := base64.RawURLEncoding
+	switch k.Kty {
+	case "RSA":
+		n, err := b64.DecodeString(k.N)
+		if err != nil {
+			return err
+		}
+		e, err := b64.DecodeString(k.E)
+		if err != nil {
+			return err
+		}
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return errors.New("oidc: unsupported RSA key")
+		}
+		k.pub = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return errors.New("oidc: unsupported curve")
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return err
+		}
+		y, err := b64.DecodeString(k.Y)
+		if err != nil {
+			return err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return errors.New("oidc: invalid EC key")
+		}
+		k.pub = pub
+	case "OKP":
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return err
+		}
+		if k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return errors.New("oidc: unsupported curve")
+		}
+		k.pub = ed25519.PublicKey(x)
+	default:
+		return errors.New("oidc: unsupported key type")
+	}
+	return nil
+}
+
+func verifyJWS(pub crypto.PublicKey, alg signingAlg, signed, sig []byte) bool {
+	var digest []byte
+	if alg.hash != 0 {
+		h := alg.hash.New()
+		h.Write(signed)
+		digest = h.Sum(nil)
+	}
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if alg.pss {
+			return rsa.VerifyPSS(pub, alg.hash, digest, sig, nil) == nil
+		}
+		return rsa.VerifyPKCS1v15(pub, alg.hash, digest, sig) == nil
+	case *ecdsa.PublicKey:
+		// Signatures are R and S, each padded to the curve size
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, signed, sig)
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+// Package oidc implements the relying party side of OpenID Connect: finding
+// a provider's endpoints through discovery, and validating the ID tokens it
+// issues.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+
+	// maxResponseLen is the most we'll read from any provider endpoint.
+	maxResponseLen = 1 << 20
+
+	// metadataTTL is how long a provider's discovered metadata is cached.
+	metadataTTL = 24 * time.Hour
+	// minKeyRefresh is the least time between fetches of a provider's keys,
+	// which are refetched when a token is signed with a key we don't have.
+	minKeyRefresh = time.Minute
+
+	// clockSkew is how far off the provider's clock can be from ours.
+	clockSkew = time.Minute
+)
+
+var ErrNoIDToken = errors.New("oidc: provider didn't return an ID token")
+
+// HTTPClient makes requests to the provider.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Metadata is the part of a provider's discovery document that we use.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect provider, identified by its issuer URL.
+// Its metadata and signing keys are fetched when first needed.
+type Provider struct {
+	Issuer string
+
+	client HTTPClient
+
+	mu          sync.Mutex
+	meta        *Metadata
+	metaExpires time.Time
+	keys        []jsonWebKey
+	keysFetched time.Time
+}
+
+// NewProvider returns the provider with the given issuer URL, which is
+// contacted using the given client.
+func NewProvider(issuer string, client HTTPClient) *Provider {
+	return &Provider{
+		Issuer: issuer,
+		client: client,
+	}
+}
+
+// Metadata returns the provider's metadata, discovering it if needed.
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.metadata(ctx)
+}
+
+func (p *Provider) metadata(ctx context.Context) (*Metadata, error) {
+	if p.meta != nil && time.Now().Before(p.metaExpires) {
+		return p.meta, nil
+	}
+
+	var m Metadata
+	err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+discoveryPath, "", &m)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %s", err)
+	}
+	if m.Issuer != p.Issuer {
+		return nil, fmt.Errorf("oidc: discovery: provider says its issuer is %q, not %q", m.Issuer, p.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery: provider metadata is missing endpoints")
+	}
+	p.meta = &m
+	p.metaExpires = time.Now().Add(metadataTTL)
+	return p.meta, nil
+}
+
+// UserInfo fetches the claims about the user that the given access token
+// was issued for from the provider's userinfo endpoint. It returns nil if the
+// provider doesn't have one.
+func (p *Provider) UserInfo(ctx context.Context, accessToken string) (Claims, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if m.UserinfoEndpoint == "" {
+		return nil, nil
+	}
+	var c Claims
+	if err = p.getJSON(ctx, m.UserinfoEndpoint, accessToken, &c); err != nil {
+		return nil, fmt.Errorf("oidc: userinfo: %s", err)
+	}
+	return c, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, location, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", location, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseLen+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxResponseLen {
+		return fmt.Errorf("%s returned too much data", location)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Claims are the claims about a user in an ID token or userinfo response.
+type Claims map[string]interface{}
+
+// String returns the named claim, if it's a string.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	n, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(n), 0), true
+}
+
+func (c Claims) audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		var res []string
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// VerifyIDToken checks that the given ID token was signed by the provider
+// and issued to the given client, for the login that sent the given nonce.
+// It returns the token's claims.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, clientID, nonce string) (Claims, error) {
+	if raw == "" {
+		return nil, ErrNoIDToken
+	}
+	tok, err := parseJWT(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.verifySignature(ctx, tok); err != nil {
+		return nil, err
+	}
+
+	var c Claims
+	if err = json.Unmarshal(tok.payload, &c); err != nil {
+		return nil, fmt.Errorf("oidc: malformed ID token claims: %s", err)
+	}
+	if iss := c.String("iss"); iss != p.Issuer {
+		return nil, fmt.Errorf("oidc: ID token is from %q, not %q", iss, p.Issuer)
+	}
+	aud := c.audience()
+	found := false
+	for _, a := range aud {
+		if a == clientID {
+			found = true
+		}
+	}
+	if !found {
+		return nil, errors.New("oidc: ID token wasn't issued to this client")
+	}
+	if azp := c.String("azp"); (len(aud) > 1 || azp != "") && azp != clientID {
+		return nil, errors.New("oidc: ID token was issued to another party")
+	}
+
+	now := time.Now()
+	exp, ok := c.time("exp")
+	if !ok || now.After(exp.Add(clockSkew)) {
+		return nil, errors.New("oidc: ID token expired")
+	}
+	iat, ok := c.time("iat")
+	if !ok {
+		return nil, errors.New("oidc: ID token has no issue time")
+	}
+	if iat.After(now.Add(clockSkew)) {
+		return nil, errors.New("oidc: ID token was issued in the future")
+	}
+	if nbf, ok := c.time("nbf"); ok && nbf.After(now.Add(clockSkew)) {
+		return nil, errors.New("oidc: ID token isn't valid yet")
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(c.String("nonce")), []byte(nonce)) != 1 {
+		return nil, errors.New("oidc: ID token nonce doesn't match")
+	}
+	if c.String("sub") == "" {
+		return nil, errors.New("oidc: ID token has no subject")
+	}
+	return c, nil
+}
+
+// NewNonce returns a random value for binding an ID token to a login.
+func NewNonce() (string, error) {
+	return randomString()
+}
+
+// NewCodeVerifier returns a random PKCE code verifier (RFC 7636).
+func NewCodeVerifier() (string, error) {
+	return randomString()
+}
+
+// CodeChallenge returns the S256 code challenge for a PKCE code verifier.
+func CodeChallenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,185 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testIDP stands in for an identity provider, serving discovery and keys.
+type testIDP struct {
+	*httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+	kid    string
+}
+
+func newTestIDP(t *testing.T) *testIDP {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIDP{rsaKey: rsaKey, ecKey: ecKey, kid: "rsa1"}
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{"kty": "RSA", "kid": idp.kid, "use": "sig", "n": b64.EncodeToString(idp.rsaKey.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(idp.rsaKey.E)).Bytes())},
+				{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64.EncodeToString(idp.ecKey.X.Bytes()), "y": b64.EncodeToString(idp.ecKey.Y.Bytes())},
+				{"kty": "oct", "kid": "secret", "k": "c2VjcmV0"},
+			},
+		})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *testIDP) claims() map[string]interface{} {
+	now := time.Now().Unix()
+	return map[string]interface{}{
+		"iss":   idp.URL,
+		"sub":   "user-1",
+		"aud":   "client",
+		"exp":   now + 300,
+		"iat":   now,
+		"nonce": "n0nce",
+	}
+}
+
+func (idp *testIDP) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	b64 := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	h := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	switch alg {
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, idp.rsaKey, crypto.SHA256, h[:])
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, idp.ecKey, h[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := newTestIDP(t)
+	p := NewProvider(idp.URL, idp.Client())
+	ctx := context.Background()
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		kid := map[string]string{"RS256": "rsa1", "ES256": "ec1"}[alg]
+		c, err := p.VerifyIDToken(ctx, idp.sign(t, alg, kid, idp.claims()), "client", "n0nce")
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if c.String("sub") != "user-1" {
+			t.Errorf("%s: sub = %q", alg, c.String("sub"))
+		}
+	}
+
+	for name, change := range map[string]func(map[string]interface{}){
+		"wrong issuer":   func(c map[string]interface{}) { c["iss"] = "https://evil.example" },
+		"wrong audience": func(c map[string]interface{}) { c["aud"] = "other" },
+		"other party":    func(c map[string]interface{}) { c["aud"] = []string{"client", "other"}; c["azp"] = "other" },
+		"expired":        func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no issue time":  func(c map[string]interface{}) { delete(c, "iat") },
+		"wrong nonce":    func(c map[string]interface{}) { c["nonce"] = "replayed" },
+		"no subject":     func(c map[string]interface{}) { delete(c, "sub") },
+	} {
+		c := idp.claims()
+		change(c)
+		if _, err := p.VerifyIDToken(ctx, idp.sign(t, "RS256", "rsa1", c), "client", "n0nce"); err == nil {
+			t.Errorf("%s: token should be rejected", name)
+		}
+	}
+
+	tok := idp.sign(t, "RS256", "rsa1", idp.claims())
+	parts := strings.Split(tok, ".")
+	for name, raw := range map[string]string{
+		"bad signature": parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(make([]byte, 256)),
+		"alg none":      base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + ".",
+		"alg HS256":     base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","kid":"secret"}`)) + "." + parts[1] + "." + parts[2],
+		"wrong key":     idp.sign(t, "ES256", "rsa1", idp.claims()),
+	} {
+		if _, err := p.VerifyIDToken(ctx, raw, "client", "n0nce"); err == nil {
+			t.Errorf("%s: token should be rejected", name)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	idp := newTestIDP(t)
+	p := NewProvider(idp.URL, idp.Client())
+	ctx := context.Background()
+	if _, err := p.VerifyIDToken(ctx, idp.sign(t, "RS256", "rsa1", idp.claims()), "client", "n0nce"); err != nil {
+		t.Fatal(err)
+	}
+
+	idp.rsaKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	idp.kid = "rsa2"
+	tok := idp.sign(t, "RS256", "rsa2", idp.claims())
+	if _, err := p.VerifyIDToken(ctx, tok, "client", "n0nce"); err != errUnknownKey {
+		t.Errorf("keys shouldn't be refetched so soon; got %v", err)
+	}
+	p.keysFetched = time.Now().Add(-2 * minKeyRefresh)
+	if _, err := p.VerifyIDToken(ctx, tok, "client", "n0nce"); err != nil {
+		t.Errorf("after rotation: %v", err)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	idp := newTestIDP(t)
+	if _, err := NewProvider(idp.URL+"/", idp.Client()).Metadata(context.Background()); err == nil {
+		t.Error("discovery should fail when the issuer doesn't match")
+	}
+	m, err := NewProvider(idp.URL, idp.Client()).Metadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.TokenEndpoint != idp.URL+"/token" {
+		t.Errorf("token endpoint = %q", m.TokenEndpoint)
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// From RFC 7636, Appendix B
+	if c := CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); c != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("CodeChallenge = %q", c)
+	}
+}
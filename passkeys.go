@@ -0,0 +1,513 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/sessions"
+	"github.com/writeas/impart"
+	"github.com/writeas/web-core/log"
+	"github.com/writefreely/writefreely/webauthn"
+)
+
+// What a passkey challenge stored in the session is for
+const (
+	passkeyRegister  = "register"
+	passkeyLogin     = "login"
+	passkeyTwoFactor = "2fa"
+)
+
+const maxPasskeyNameLen = 100
+
+var (
+	errPasskeyNotFound   = impart.HTTPError{http.StatusNotFound, "Passkey doesn't exist."}
+	errPasskeyExpired    = impart.HTTPError{http.StatusBadRequest, "This request expired. Please try again."}
+	errPasskeyUnverified = impart.HTTPError{http.StatusUnauthorized, "That passkey couldn't be verified."}
+)
+
+// passkeyChallenge is kept in the session for the length of one WebAuthn
+// ceremony. It's removed as soon as the browser responds, and remembered as
+// used until it expires, so each challenge is only checked once, even if an
+// older copy of the session cookie is sent again.
+type passkeyChallenge struct {
+	Purpose   string
+	Challenge []byte
+	UserID    int64
+	Expires   time.Time
+}
+
+var (
+	usedPasskeyChallengesMu    sync.Mutex
+	usedPasskeyChallenges      = map[string]time.Time{}
+	usedPasskeyChallengesSwept time.Time
+)
+
+// UserPasskey is a passkey registered to a user, as shown in their settings.
+type UserPasskey struct {
+	ID       string     `json:"id"`
+	Name     string     `json:"name"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"last_used"`
+}
+
+type passkeyRegistration struct {
+	Name       string                       `json:"name"`
+	Credential webauthn.AttestationResponse `json:"credential"`
+}
+
+type passkeyAssertion struct {
+	Credential webauthn.AssertionResponse `json:"credential"`
+	To         string                     `json:"to"`
+}
+
+// relyingParty identifies this instance to authenticators. Passkeys are
+// bound to the host name, so they stop working if it changes.
+func relyingParty(app *App) *webauthn.RelyingParty {
+	u, err := url.Parse(app.cfg.App.Host)
+	if err != nil {
+		log.Error("Unable to parse host for passkeys: %v", err)
+		return &webauthn.RelyingParty{}
+	}
+	name := app.cfg.App.SiteName
+	if name == "" {
+		name = u.Hostname()
+	}
+	return &webauthn.RelyingParty{
+		ID:     u.Hostname(),
+		Name:   name,
+		Origin: u.Scheme + "://" + u.Host,
+	}
+}
+
+func passkeyUserHandle(userID int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(userID))
+	return b
+}
+
+func encodePasskeyID(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+// startPasskeyChallenge creates a challenge and stores it in the session.
+func startPasskeyChallenge(app *App, w http.ResponseWriter, r *http.Request, purpose string, userID int64) (webauthn.Bytes, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	session, err := app.sessionStore.Get(r, cookieName)
+	if err != nil {
+		log.Error("Passkey: Session: %v; ignoring", err)
+	}
+	session.Values[cookiePasskeyVal] = &passkeyChallenge{
+		Purpose:   purpose,
+		Challenge: challenge,
+		UserID:    userID,
+		Expires:   time.Now().Add(webauthn.Timeout),
+	}
+	err = session.Save(r, w)
+	if err != nil {
+		log.Error("Passkey: Couldn't save session: %v", err)
+		return nil, ErrInternalCookieSession
+	}
+	return challenge, nil
+}
+
+// takePasskeyChallenge removes the current challenge from the session and
+// returns it, if it's for the given purpose and still valid.
+func takePasskeyChallenge(app *App, w http.ResponseWriter, r *http.Request, purpose string) (*passkeyChallenge, *sessions.Session, error) {
+	session, err := app.sessionStore.Get(r, cookieName)
+	if err != nil {
+		log.Error("Passkey: Session: %v; ignoring", err)
+	}
+	c, ok := session.Values[cookiePasskeyVal].(*passkeyChallenge)
+	if !ok {
+		return nil, session, errPasskeyExpired
+	}
+	delete(session.Values, cookiePasskeyVal)
+	if err = session.Save(r, w); err != nil {
+		log.Error("Passkey: Couldn't save session: %v", err)
+		return nil, session, ErrInternalCookieSession
+	}
+	if c.Purpose != purpose || time.Now().After(c.Expires) {
+		return nil, session, errPasskeyExpired
+	}
+	if !usePasskeyChallenge(c) {
+		log.Info("Passkey: Refusing challenge that was already used")
+		return nil, session, errPasskeyExpired
+	}
+	return c, session, nil
+}
+
+// usePasskeyChallenge marks the given challenge as used until it expires. It
+// returns false if it was already used.
+func usePasskeyChallenge(c *passkeyChallenge) bool {
+	now := time.Now()
+	k := string(c.Challenge)
+
+	usedPasskeyChallengesMu.Lock()
+	defer usedPasskeyChallengesMu.Unlock()
+	if now.Sub(usedPasskeyChallengesSwept) > webauthn.Timeout {
+		for ch, exp := range usedPasskeyChallenges {
+			if now.After(exp) {
+				delete(usedPasskeyChallenges, ch)
+			}
+		}
+		usedPasskeyChallengesSwept = now
+	}
+
+	if _, used := usedPasskeyChallenges[k]; used {
+		return false
+	}
+	usedPasskeyChallenges[k] = c.Expires
+	return true
+}
+
+// sessionAPIAuth authorizes JSON requests made from a logged-in browser, but
+// not with access tokens.
+func sessionAPIAuth(app *App, r *http.Request) (*User, error) {
+	u := getUserSession(app, r)
+	if u == nil {
+		return nil, ErrNotLoggedIn
+	}
+	return u, nil
+}
+
+// safeRedirect returns the given post-login destination if it's a local
+// path, or the default one otherwise.
+func safeRedirect(app *App, to string) string {
+	if strings.HasPrefix(to, "/") && !strings.HasPrefix(to, "//") && !strings.HasPrefix(to, "/\\") {
+		return to
+	}
+	if app.cfg.App.SingleUser {
+		return "/me/new"
+	}
+	return "/"
+}
+
+func viewPasskeys(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	passkeys, err := app.db.GetUserPasskeys(u.ID)
+	if err != nil {
+		log.Error("Unable to get passkeys: %v", err)
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to retrieve passkeys."}
+	}
+
+	flashes, _ := getSessionFlashes(app, w, r, nil)
+	p := struct {
+		*UserPage
+		Passkeys  []UserPasskey
+		CSRFField template.HTML
+	}{
+		UserPage:  NewUserPage(app, r, u, "Passkeys", flashes),
+		Passkeys:  passkeys,
+		CSRFField: csrf.TemplateField(r),
+	}
+
+	showUserPage(w, "passkeys", p)
+	return nil
+}
+
+func handleBeginPasskeyRegistration(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	existing, err := app.db.GetUserPasskeyIDs(u.ID)
+	if err != nil {
+		log.Error("Unable to get passkeys: %v", err)
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to start registering a passkey."}
+	}
+	challenge, err := startPasskeyChallenge(app, w, r, passkeyRegister, u.ID)
+	if err != nil {
+		return err
+	}
+
+	opts := relyingParty(app).CreationOptions(challenge, passkeyUserHandle(u.ID), u.Username, u.Username, existing)
+	return impart.WriteSuccess(w, opts, http.StatusOK)
+}
+
+func handleFinishPasskeyRegistration(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	var req passkeyRegistration
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return ErrBadJSON
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		req.Name = "Passkey"
+	}
+	if len(req.Name) > maxPasskeyNameLen {
+		return impart.HTTPError{http.StatusBadRequest, fmt.Sprintf("Passkey name must be %d characters or less.", maxPasskeyNameLen)}
+	}
+
+	c, _, err := takePasskeyChallenge(app, w, r, passkeyRegister)
+	if err != nil {
+		return err
+	}
+	if c.UserID != u.ID {
+		return errPasskeyExpired
+	}
+
+	cred, err := relyingParty(app).VerifyRegistration(c.Challenge, &req.Credential, false)
+	if err != nil {
+		log.Info("Passkey: Registration failed for user %d: %v", u.ID, err)
+		return impart.HTTPError{http.StatusBadRequest, "That passkey couldn't be registered."}
+	}
+	if _, _, err = app.db.GetPasskey(cred.ID); err == nil {
+		return impart.HTTPError{http.StatusConflict, "That passkey is already registered."}
+	} else if err != errPasskeyNotFound {
+		return err
+	}
+
+	err = app.db.CreatePasskey(u.ID, req.Name, cred)
+	if err != nil {
+		log.Error("Unable to save passkey: %v", err)
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to save passkey."}
+	}
+	log.Info("User %d registered a passkey", u.ID)
+
+	_ = addSessionFlash(app, w, r, fmt.Sprintf("Added passkey %q.", req.Name), nil)
+	return impart.WriteSuccess(w, UserPasskey{ID: encodePasskeyID(cred.ID), Name: req.Name, Created: time.Now()}, http.StatusCreated)
+}
+
+func handleDeletePasskey(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	err := app.db.DeletePasskey(u.ID, r.FormValue("id"))
+	if err != nil {
+		if herr, ok := err.(impart.HTTPError); ok {
+			return herr
+		}
+		log.Error("Unable to delete passkey: %v", err)
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to remove passkey."}
+	}
+	_ = addSessionFlash(app, w, r, "Passkey removed.", nil)
+	return impart.HTTPError{http.StatusFound, "/me/settings/passkeys"}
+}
+
+// handleBeginPasskeyLogin starts a passwordless login, letting the browser
+// offer any passkey it has for this instance.
+func handleBeginPasskeyLogin(app *App, w http.ResponseWriter, r *http.Request) error {
+	challenge, err := startPasskeyChallenge(app, w, r, passkeyLogin, 0)
+	if err != nil {
+		return err
+	}
+	opts := relyingParty(app).RequestOptions(challenge, nil, webauthn.VerificationRequired)
+	return impart.WriteSuccess(w, opts, http.StatusOK)
+}
+
+func handleFinishPasskeyLogin(app *App, w http.ResponseWriter, r *http.Request) error {
+	var req passkeyAssertion
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return ErrBadJSON
+	}
+	c, session, err := takePasskeyChallenge(app, w, r, passkeyLogin)
+	if err != nil {
+		return err
+	}
+
+	// Passkeys prove both possession and, with user verification, the user
+	// themselves, so they stand in for the password and any second factor.
+	userID, err := verifyPasskey(app, c, &req.Credential, true)
+	if err != nil {
+		return err
+	}
+	u, err := app.db.GetUserByID(userID)
+	if err != nil {
+		log.Error("Passkey: Unable to fetch user %d: %v", userID, err)
+		return ErrInternalGeneral
+	}
+	if u.IsPending() {
+		return ErrUserPending
+	}
+	if err = restoreAccount(app, w, r, u); err != nil {
+		return err
+	}
+
+	session.Values[cookieUserVal] = u.Cookie()
+	err = session.Save(r, w)
+	if err != nil {
+		log.Error("Passkey: Couldn't save session: %v", err)
+		return ErrInternalCookieSession
+	}
+	log.Info("Login: User %d logged in with a passkey", u.ID)
+
+	return impart.WriteSuccess(w, map[string]string{"redirect": safeRedirect(app, req.To)}, http.StatusOK)
+}
+
+// handleBeginPasskeyTwoFactor lets a user who has entered their password use
+// one of their passkeys instead of an authenticator code.
+func handleBeginPasskeyTwoFactor(app *App, w http.ResponseWriter, r *http.Request) error {
+	session, err := app.sessionStore.Get(r, cookieName)
+	if err != nil {
+		log.Error("Passkey: Session: %v; ignoring", err)
+	}
+	pending := getPendingTwoFactor(session)
+	if pending == nil {
+		return errPasskeyExpired
+	}
+	allow, err := app.db.GetUserPasskeyIDs(pending.UserID)
+	if err != nil {
+		log.Error("Unable to get passkeys: %v", err)
+		return ErrInternalGeneral
+	}
+	if len(allow) == 0 {
+		return errPasskeyNotFound
+	}
+
+	challenge, err := startPasskeyChallenge(app, w, r, passkeyTwoFactor, pending.UserID)
+	if err != nil {
+		return err
+	}
+	opts := relyingParty(app).RequestOptions(challenge, allow, webauthn.VerificationDiscouraged)
+	return impart.WriteSuccess(w, opts, http.StatusOK)
+}
+
+func handleFinishPasskeyTwoFactor(app *App, w http.ResponseWriter, r *http.Request) error {
+	var req passkeyAssertion
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return ErrBadJSON
+	}
+	c, session, err := takePasskeyChallenge(app, w, r, passkeyTwoFactor)
+	if err != nil {
+		return err
+	}
+	pending := getPendingTwoFactor(session)
+	if pending == nil || pending.UserID != c.UserID {
+		return errPasskeyExpired
+	}
+
+	if _, err = verifyPasskey(app, c, &req.Credential, false); err != nil {
+		return err
+	}
+	err = finishTwoFactorLogin(app, w, r, session, pending)
+	if err != nil {
+		return err
+	}
+	log.Info("Login: User %d used a passkey as their second factor", pending.UserID)
+
+	return impart.WriteSuccess(w, map[string]string{"redirect": pending.To}, http.StatusOK)
+}
+
+// verifyPasskey checks a login assertion against the stored passkey, and the
+// user the challenge was made for, if any. It returns the passkey's owner.
+func verifyPasskey(app *App, c *passkeyChallenge, res *webauthn.AssertionResponse, requireUV bool) (int64, error) {
+	userID, cred, err := app.db.GetPasskey(res.ID)
+	if err == errPasskeyNotFound {
+		return 0, errPasskeyUnverified
+	} else if err != nil {
+		log.Error("Passkey: Unable to get passkey: %v", err)
+		return 0, ErrInternalGeneral
+	}
+	if c.UserID != 0 && c.UserID != userID {
+		return 0, errPasskeyUnverified
+	}
+	if len(res.UserHandle) > 0 && string(res.UserHandle) != string(passkeyUserHandle(userID)) {
+		return 0, errPasskeyUnverified
+	}
+
+	count, err := relyingParty(app).VerifyLogin(c.Challenge, cred, res, requireUV)
+	if err != nil {
+		log.Info("Passkey: Login failed for user %d: %v", userID, err)
+		return 0, errPasskeyUnverified
+	}
+	err = app.db.UpdatePasskeyUse(cred.ID, count)
+	if err != nil {
+		log.Error("Passkey: Unable to update passkey: %v", err)
+	}
+	return userID, nil
+}
+
+func (db *datastore) CreatePasskey(userID int64, name string, cred *webauthn.Credential) error {
+	_, err := db.Exec("INSERT INTO userpasskeys (id, user_id, name, public_key, sign_count, created) VALUES (?, ?, ?, ?, ?, "+db.now()+")", encodePasskeyID(cred.ID), userID, name, cred.PublicKey, cred.SignCount)
+	return err
+}
+
+// GetPasskey returns the owner and stored credential for a passkey ID.
+func (db *datastore) GetPasskey(id []byte) (int64, *webauthn.Credential, error) {
+	var userID int64
+	cred := &webauthn.Credential{ID: id}
+	err := db.QueryRow("SELECT user_id, public_key, sign_count FROM userpasskeys WHERE id = ?", encodePasskeyID(id)).Scan(&userID, &cred.PublicKey, &cred.SignCount)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, nil, errPasskeyNotFound
+	case err != nil:
+		return 0, nil, err
+	}
+	return userID, cred, nil
+}
+
+func (db *datastore) GetUserPasskeys(userID int64) ([]UserPasskey, error) {
+	rows, err := db.Query("SELECT id, name, created, last_used FROM userpasskeys WHERE user_id = ? ORDER BY created ASC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passkeys := []UserPasskey{}
+	for rows.Next() {
+		p := UserPasskey{}
+		var lastUsed sql.NullTime
+		err = rows.Scan(&p.ID, &p.Name, &p.Created, &lastUsed)
+		if err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			p.LastUsed = &lastUsed.Time
+		}
+		passkeys = append(passkeys, p)
+	}
+	return passkeys, rows.Err()
+}
+
+// GetUserPasskeyIDs returns the raw credential IDs of a user's passkeys.
+func (db *datastore) GetUserPasskeyIDs(userID int64) ([][]byte, error) {
+	passkeys, err := db.GetUserPasskeys(userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([][]byte, 0, len(passkeys))
+	for _, p := range passkeys {
+		id, err := base64.RawURLEncoding.DecodeString(p.ID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (db *datastore) CountUserPasskeys(userID int64) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM userpasskeys WHERE user_id = ?", userID).Scan(&n)
+	return n, err
+}
+
+func (db *datastore) UpdatePasskeyUse(id []byte, signCount uint32) error {
+	_, err := db.Exec("UPDATE userpasskeys SET sign_count = ?, last_used = "+db.now()+" WHERE id = ?", signCount, encodePasskeyID(id))
+	return err
+}
+
+func (db *datastore) DeletePasskey(userID int64, id string) error {
+	res, err := db.Exec("DELETE FROM userpasskeys WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errPasskeyNotFound
+	}
+	return nil
+}
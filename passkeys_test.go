@@ -0,0 +1,55 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/writefreely/writefreely/webauthn"
+)
+
+func TestTakePasskeyChallenge(t *testing.T) {
+	app := newTestApp(nil)
+	var cookies []*http.Cookie
+	begin := func(purpose string) webauthn.Bytes {
+		w := httptest.NewRecorder()
+		challenge, err := startPasskeyChallenge(app, w, httptest.NewRequest("GET", "/api/auth/passkey/login", nil), purpose, 0)
+		assert.NoError(t, err)
+		cookies = w.Result().Cookies()
+		return challenge
+	}
+	take := func(purpose string) (*passkeyChallenge, error) {
+		req := httptest.NewRequest("POST", "/api/auth/passkey/login", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		c, _, err := takePasskeyChallenge(app, httptest.NewRecorder(), req, purpose)
+		return c, err
+	}
+
+	// A challenge is only good for what it was made for
+	begin(passkeyRegister)
+	_, err := take(passkeyLogin)
+	assert.Equal(t, errPasskeyExpired, err)
+
+	challenge := begin(passkeyLogin)
+	c, err := take(passkeyLogin)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []byte(challenge), c.Challenge)
+	}
+
+	// and can't be used again by sending the same cookie back
+	_, err = take(passkeyLogin)
+	assert.Equal(t, errPasskeyExpired, err)
+}
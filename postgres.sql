@@ -0,0 +1,236 @@
+--
+-- Database: writefreely
+--
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table accesstokens
+--
+
+CREATE TABLE IF NOT EXISTS accesstokens (
+  token BYTEA NOT NULL,
+  user_id INTEGER NOT NULL,
+  sudo SMALLINT NOT NULL DEFAULT '0',
+  one_time SMALLINT NOT NULL DEFAULT '0',
+  created TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expires TIMESTAMPTZ DEFAULT NULL,
+  user_agent VARCHAR(255) DEFAULT NULL,
+  PRIMARY KEY (token)
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table appcontent
+--
+
+CREATE TABLE IF NOT EXISTS appcontent (
+  id VARCHAR(36) NOT NULL,
+  content TEXT NOT NULL,
+  updated TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table appmigrations
+--
+
+CREATE TABLE IF NOT EXISTS appmigrations (
+  version INTEGER NOT NULL,
+  migrated TIMESTAMPTZ NOT NULL,
+  result TEXT NOT NULL
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table collectionattributes
+--
+
+CREATE TABLE IF NOT EXISTS collectionattributes (
+  collection_id INTEGER NOT NULL,
+  attribute VARCHAR(128) NOT NULL,
+  value VARCHAR(255) NOT NULL,
+  PRIMARY KEY (collection_id, attribute)
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table collectionkeys
+--
+
+CREATE TABLE IF NOT EXISTS collectionkeys (
+  collection_id INTEGER NOT NULL,
+  public_key BYTEA NOT NULL,
+  private_key BYTEA NOT NULL,
+  PRIMARY KEY (collection_id)
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table collectionpasswords
+--
+
+CREATE TABLE IF NOT EXISTS collectionpasswords (
+  collection_id INTEGER NOT NULL,
+  password BYTEA NOT NULL,
+  PRIMARY KEY (collection_id)
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table collectionredirects
+--
+
+CREATE TABLE IF NOT EXISTS collectionredirects (
+  prev_alias VARCHAR(100) NOT NULL,
+  new_alias VARCHAR(100) NOT NULL,
+  PRIMARY KEY (prev_alias)
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table collections
+--
+
+CREATE TABLE IF NOT EXISTS collections (
+  id SERIAL PRIMARY KEY,
+  alias VARCHAR(100) DEFAULT NULL UNIQUE,
+  title VARCHAR(255) NOT NULL,
+  description VARCHAR(160) NOT NULL,
+  style_sheet TEXT,
+  script TEXT,
+  format VARCHAR(8) DEFAULT NULL,
+  privacy SMALLINT NOT NULL,
+  owner_id INTEGER NOT NULL,
+  view_count INTEGER NOT NULL
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table posts
+--
+
+CREATE TABLE IF NOT EXISTS posts (
+  id VARCHAR(16) NOT NULL,
+  slug VARCHAR(100) DEFAULT NULL,
+  modify_token VARCHAR(32) DEFAULT NULL,
+  text_appearance VARCHAR(4) NOT NULL DEFAULT 'norm',
+  language VARCHAR(2) DEFAULT NULL,
+  rtl SMALLINT DEFAULT NULL,
+  privacy SMALLINT NOT NULL,
+  owner_id INTEGER DEFAULT NULL,
+  collection_id INTEGER DEFAULT NULL,
+  pinned_position SMALLINT DEFAULT NULL,
+  created TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  view_count INTEGER NOT NULL,
+  title VARCHAR(160) NOT NULL,
+  content TEXT NOT NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT id_slug UNIQUE (collection_id, slug),
+  CONSTRAINT owner_id UNIQUE (owner_id, id),
+  CONSTRAINT privacy_id UNIQUE (privacy, id)
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table remotefollows
+--
+
+CREATE TABLE IF NOT EXISTS remotefollows (
+  collection_id INTEGER NOT NULL,
+  remote_user_id INTEGER NOT NULL,
+  created TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (collection_id, remote_user_id)
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table remoteuserkeys
+--
+
+CREATE TABLE IF NOT EXISTS remoteuserkeys (
+  id VARCHAR(255) NOT NULL,
+  remote_user_id INTEGER NOT NULL UNIQUE,
+  public_key BYTEA NOT NULL,
+  PRIMARY KEY (id)
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table remoteusers
+--
+
+CREATE TABLE IF NOT EXISTS remoteusers (
+  id SERIAL PRIMARY KEY,
+  actor_id VARCHAR(255) NOT NULL UNIQUE,
+  inbox VARCHAR(255) NOT NULL,
+  shared_inbox VARCHAR(255) NOT NULL
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table userattributes
+--
+
+CREATE TABLE IF NOT EXISTS userattributes (
+  user_id INTEGER NOT NULL,
+  attribute VARCHAR(64) NOT NULL,
+  value VARCHAR(255) NOT NULL,
+  PRIMARY KEY (user_id, attribute)
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table userinvites
+--
+
+CREATE TABLE IF NOT EXISTS userinvites (
+  id VARCHAR(6) NOT NULL,
+  owner_id INTEGER NOT NULL,
+  max_uses SMALLINT DEFAULT NULL,
+  created TIMESTAMPTZ NOT NULL,
+  expires TIMESTAMPTZ DEFAULT NULL,
+  inactive SMALLINT NOT NULL,
+  PRIMARY KEY (id)
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table users
+--
+
+CREATE TABLE IF NOT EXISTS users (
+  id SERIAL PRIMARY KEY,
+  username VARCHAR(100) NOT NULL UNIQUE,
+  password BYTEA NOT NULL,
+  email BYTEA DEFAULT NULL,
+  created TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- --------------------------------------------------------
+
+--
+-- Table structure for table usersinvited
+--
+
+CREATE TABLE IF NOT EXISTS usersinvited (
+  invite_id VARCHAR(6) NOT NULL,
+  user_id INTEGER NOT NULL,
+  PRIMARY KEY (invite_id, user_id)
+);
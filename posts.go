@@ -19,6 +19,7 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -421,9 +422,9 @@ func handleViewPost(app *App, w http.ResponseWriter, r *http.Request) error {
 		}
 	}
 
-	var silenced bool
+	var hidden bool
 	if found {
-		silenced, err = app.db.IsUserSilenced(ownerID.Int64)
+		hidden, err = app.db.IsUserHidden(ownerID.Int64)
 		if err != nil {
 			log.Error("view post: %v", err)
 		}
@@ -500,14 +501,14 @@ func handleViewPost(app *App, w http.ResponseWriter, r *http.Request) error {
 			page.IsOwner = ownerID.Valid && ownerID.Int64 == u.ID
 		}
 
-		if !page.IsOwner && silenced {
+		if !page.IsOwner && hidden {
 			return ErrPostNotFound
 		}
 
 		if !page.IsOwner && protectDraft {
 			return ErrPostNotFound
 		}
-		page.Silenced = silenced
+		page.Silenced = hidden
 		err = templates["post"].ExecuteTemplate(w, "post", page)
 		if err != nil {
 			log.Error("Post template execute error: %v", err)
@@ -575,6 +576,17 @@ func newPost(app *App, w http.ResponseWriter, r *http.Request) error {
 	if userID == -1 {
 		return ErrNotLoggedIn
 	}
+	if needsEmailVerification(app, userID) {
+		return ErrEmailNotVerified
+	}
+
+	// Prevent flooding from any one account or client
+	if ok, wait := app.limits.postAccount.allow(strconv.FormatInt(userID, 10)); !ok {
+		return tooManyRequests(w, wait, "You're publishing too quickly.")
+	}
+	if ok, wait := app.limits.postIP.allow(requestIP(r)); !ok {
+		return tooManyRequests(w, wait, "Too many posts from your network.")
+	}
 
 	if accessToken == "" && u == nil && collAlias != "" {
 		return impart.HTTPError{http.StatusBadRequest, "Parameter `access_token` required."}
@@ -667,10 +679,13 @@ func newPost(app *App, w http.ResponseWriter, r *http.Request) error {
 	newPost.OwnerName = username
 	newPost.URL = newPost.CanonicalURL(app.cfg.App.Host)
 
+	// New accounts that open with link spam get silenced before it goes out
+	silenced = scoreFirstPost(app, userID, *p.Content)
+
 	// Write success now
 	response := impart.WriteSuccess(w, newPost, http.StatusCreated)
 
-	if newPost.Collection != nil {
+	if newPost.Collection != nil && !silenced {
 		if !app.cfg.App.Private && app.cfg.App.Federation && !newPost.Created.After(time.Now()) {
 			go federatePost(app, newPost, newPost.Collection.ID, false)
 		}
@@ -961,6 +976,9 @@ func addPost(app *App, w http.ResponseWriter, r *http.Request) error {
 	if silenced {
 		return ErrUserSilenced
 	}
+	if needsEmailVerification(app, ownerID) {
+		return ErrEmailNotVerified
+	}
 
 	// Parse claimed posts in format:
 	// [{"id": "...", "token": "..."}]
@@ -1144,11 +1162,11 @@ func fetchPost(app *App, w http.ResponseWriter, r *http.Request) error {
 		}
 	}
 
-	silenced, err := app.db.IsUserSilenced(p.OwnerID.Int64)
+	hidden, err := app.db.IsUserHidden(p.OwnerID.Int64)
 	if err != nil {
 		log.Error("fetch post: %v", err)
 	}
-	if silenced {
+	if hidden {
 		return ErrPostNotFound
 	}
 
@@ -1463,7 +1481,7 @@ func viewCollectionPost(app *App, w http.ResponseWriter, r *http.Request) error
 	}
 	c.hostName = app.cfg.App.Host
 
-	silenced, err := app.db.IsUserSilenced(c.OwnerID)
+	hidden, err := app.db.IsUserHidden(c.OwnerID)
 	if err != nil {
 		log.Error("view collection post: %v", err)
 	}
@@ -1473,7 +1491,7 @@ func viewCollectionPost(app *App, w http.ResponseWriter, r *http.Request) error
 		return ErrPostNotFound
 	}
 	if c.IsProtected() && (u == nil || u.ID != c.OwnerID) {
-		if silenced {
+		if hidden {
 			return ErrPostNotFound
 		} else if !isAuthorizedForCollection(app, c.Alias, r) {
 			return impart.HTTPError{http.StatusFound, c.CanonicalURL() + "/?g=" + slug}
@@ -1530,8 +1548,8 @@ Are you sure it was ever here?`,
 	p.Collection = coll
 	p.IsTopLevel = app.cfg.App.SingleUser
 
-	// Only allow a post owner or admin to view a post for silenced collections
-	if silenced && !p.IsOwner && (u == nil || !u.IsAdmin()) {
+	// Only allow a post owner or admin to view a post for hidden collections
+	if hidden && !p.IsOwner && (u == nil || !u.IsAdmin()) {
 		return ErrPostNotFound
 	}
 
@@ -1592,7 +1610,7 @@ Are you sure it was ever here?`,
 			IsOwner:        cr.isCollOwner,
 			IsCustomDomain: cr.isCustomDomain,
 			IsFound:        postFound,
-			Silenced:       silenced,
+			Silenced:       hidden,
 			CollAlias:      c.Alias,
 		}
 		tp.IsAdmin = u != nil && u.IsAdmin()
@@ -0,0 +1,106 @@
+package qr
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRSRemainder(t *testing.T) {
+	// "HELLO WORLD" as 1-M, from the worked example in the QR specification
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder = %v, want %v", got, want)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	tests := []struct {
+		name string
+		got  int
+		want int
+	}{
+		{"M, mask 0", formatBits(eclM, 0), 0x5412},
+		{"L, mask 4", formatBits(1, 4), 0x662F},
+		{"version 7", versionBits(7), 0x07C94},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: got %015b, want %015b", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		data    string
+		version int
+	}{
+		{"hello", 1},
+		{"otpauth://totp/Write%20Freely:matt?secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP&issuer=Write+Freely", 6},
+		{strings.Repeat("x", 213), 10},
+	}
+	for _, test := range tests {
+		c, err := Encode([]byte(test.data))
+		if err != nil {
+			t.Fatalf("Encode(%q): %v", test.data, err)
+		}
+		if want := test.version*4 + 17; c.Size() != want {
+			t.Errorf("Encode(%q) size = %d, want %d", test.data, c.Size(), want)
+			continue
+		}
+
+		// Read the codewords back out of the symbol
+		var mask int
+		for mask = 0; mask < 8; mask++ {
+			bits := formatBits(eclM, mask)
+			match := true
+			for i := 0; i < 8; i++ {
+				match = match && c.Dark(c.size-1-i, 8) == bit(bits, i)
+			}
+			if match {
+				break
+			}
+		}
+		if mask == 8 {
+			t.Errorf("Encode(%q): no valid format bits", test.data)
+			continue
+		}
+		c.applyMask(mask)
+		var read bitBuffer
+		for right := c.size - 1; right >= 1; right -= 2 {
+			if right == 6 {
+				right = 5
+			}
+			for vert := 0; vert < c.size; vert++ {
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.size - 1 - vert
+				}
+				for j := 0; j < 2; j++ {
+					if !c.function[y][right-j] {
+						read = append(read, c.modules[y][right-j])
+					}
+				}
+			}
+		}
+		want := addECAndInterleave(test.version, encodeData(test.version, []byte(test.data)))
+		for i, b := range want {
+			got := 0
+			for j := 0; j < 8; j++ {
+				if read[i*8+j] {
+					got |= 1 << uint(7-j)
+				}
+			}
+			if byte(got) != b {
+				t.Errorf("Encode(%q): codeword %d = %d, want %d", test.data, i, got, b)
+				break
+			}
+		}
+	}
+
+	if _, err := Encode(make([]byte, 214)); err != ErrTooLong {
+		t.Errorf("Encode(214 bytes) error = %v, want ErrTooLong", err)
+	}
+}
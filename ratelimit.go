@@ -0,0 +1,317 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/writeas/impart"
+)
+
+// Defaults for [rate_limit] config values
+const (
+	defaultLoginsPerIP      = 60
+	defaultLoginFailures    = 5
+	defaultLockoutMinutes   = 5
+	defaultSignupsPerIP     = 10
+	defaultResetsPerIP      = 10
+	defaultResetsPerAccount = 3
+	defaultPostsPerIP       = 400
+	defaultPostsPerAccount  = 200
+
+	defaultLetterRepliesPerBlog = 50
+)
+
+const (
+	rateLimitWindow = time.Hour
+
+	// maxLockout is the longest an account stays locked after failed logins.
+	maxLockout = 24 * time.Hour
+	// An account's failed logins are forgotten after this long without another.
+	loginFailureMemory = 24 * time.Hour
+)
+
+const msgAccountLocked = "This account is temporarily locked after too many failed logins from your network."
+
+// rateLimits holds the limiters for each rate-limited action. A nil limiter
+// allows everything.
+type rateLimits struct {
+	loginIP      *rateLimiter
+	signupIP     *rateLimiter
+	resetIP      *rateLimiter
+	resetAccount *rateLimiter
+	postIP       *rateLimiter
+	postAccount  *rateLimiter
+	letterReply  *rateLimiter
+
+	lockouts *loginLockouts
+}
+
+// InitRateLimits sets up rate limiting with the limits from the config.
+func (app *App) InitRateLimits() {
+	rc := app.cfg.RateLimit
+	limiter := func(n, def int) *rateLimiter {
+		return newRateLimiter(configLimit(n, def), rateLimitWindow)
+	}
+	app.limits = rateLimits{
+		loginIP:      limiter(rc.LoginsPerIP, defaultLoginsPerIP),
+		signupIP:     limiter(rc.SignupsPerIP, defaultSignupsPerIP),
+		resetIP:      limiter(rc.ResetsPerIP, defaultResetsPerIP),
+		resetAccount: limiter(rc.ResetsPerAccount, defaultResetsPerAccount),
+		postIP:       limiter(rc.PostsPerIP, defaultPostsPerIP),
+		postAccount:  limiter(rc.PostsPerAccount, defaultPostsPerAccount),
+		letterReply:  limiter(rc.LetterRepliesPerBlog, defaultLetterRepliesPerBlog),
+		lockouts: newLoginLockouts(configLimit(rc.LoginFailures, defaultLoginFailures),
+			time.Duration(configLimit(rc.LockoutMinutes, defaultLockoutMinutes))*time.Minute),
+	}
+}
+
+// configLimit resolves a [rate_limit] config value, where zero means the
+// default and a negative number means no limit (returned as 0).
+func configLimit(n, def int) int {
+	if n == 0 {
+		return def
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// tooManyRequests returns a 429 error telling the client how long to wait,
+// both in the message and the Retry-After header.
+func tooManyRequests(w http.ResponseWriter, wait time.Duration, msg string) error {
+	secs := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	return impart.HTTPError{http.StatusTooManyRequests, fmt.Sprintf("%s Please try again in %s.", msg, friendlyWait(wait))}
+}
+
+func friendlyWait(d time.Duration) string {
+	mins := int((d + time.Minute - 1) / time.Minute)
+	switch {
+	case mins <= 1:
+		return "a minute"
+	case mins < 120:
+		return fmt.Sprintf("%d minutes", mins)
+	}
+	return fmt.Sprintf("%d hours", (mins+59)/60)
+}
+
+// rateLimiter counts attempts by key (an IP address or user ID) in fixed
+// windows, refusing them once a key reaches the limit.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu     sync.Mutex
+	counts map[string]*rateCount
+	swept  time.Time
+}
+
+type rateCount struct {
+	n     int
+	reset time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		counts: map[string]*rateCount{},
+	}
+}
+
+// allow counts an attempt for the given key. If the key is already at its
+// limit, it returns false along with how long until it can try again.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	if l == nil || key == "" {
+		return true, 0
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) > l.window {
+		for k, c := range l.counts {
+			if now.After(c.reset) {
+				delete(l.counts, k)
+			}
+		}
+		l.swept = now
+	}
+
+	c := l.counts[key]
+	if c == nil || now.After(c.reset) {
+		c = &rateCount{reset: now.Add(l.window)}
+		l.counts[key] = c
+	}
+	if c.n >= l.limit {
+		return false, c.reset.Sub(now)
+	}
+	c.n++
+	return true, 0
+}
+
+// loginLockouts locks accounts that have too many failed logins from the same
+// IP address. Once an account reaches the limit from an address, each further
+// failure from it doubles the lockout, up to maxLockout. Since lockouts are
+// tied to an address, someone guessing at an account can't lock its owner out
+// everywhere else.
+type loginLockouts struct {
+	failures int
+	lockout  time.Duration
+
+	mu    sync.Mutex
+	users map[lockoutKey]*loginLockout
+	swept time.Time
+}
+
+type lockoutKey struct {
+	userID int64
+	ip     string
+}
+
+// loginLockout is the record of recent failed logins on an account from one
+// IP address.
+type loginLockout struct {
+	UserID   int64
+	Username string
+	IP       string
+	Failures int
+	Until    time.Time
+
+	last time.Time
+}
+
+func newLoginLockouts(failures int, lockout time.Duration) *loginLockouts {
+	if failures <= 0 || lockout <= 0 {
+		return nil
+	}
+	return &loginLockouts{
+		failures: failures,
+		lockout:  lockout,
+		users:    map[lockoutKey]*loginLockout{},
+	}
+}
+
+// check returns how much longer the given account is locked for from the
+// given IP address, if at all.
+func (l *loginLockouts) check(userID int64, ip string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if lo := l.users[lockoutKey{userID, ip}]; lo != nil {
+		if wait := time.Until(lo.Until); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// fail records a failed login on the given account from the given IP address,
+// returning how long it's now locked for from there, if at all.
+func (l *loginLockouts) fail(userID int64, username, ip string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) > time.Hour {
+		for k, lo := range l.users {
+			if now.Sub(lo.last) > loginFailureMemory && now.After(lo.Until) {
+				delete(l.users, k)
+			}
+		}
+		l.swept = now
+	}
+
+	k := lockoutKey{userID, ip}
+	lo := l.users[k]
+	if lo == nil || now.Sub(lo.last) > loginFailureMemory {
+		lo = &loginLockout{UserID: userID, IP: ip}
+		l.users[k] = lo
+	}
+	lo.Username = username
+	lo.Failures++
+	lo.last = now
+	if lo.Failures < l.failures {
+		return 0
+	}
+
+	wait := l.lockout
+	for i := l.failures; i < lo.Failures && wait < maxLockout; i++ {
+		wait *= 2
+	}
+	if wait > maxLockout {
+		wait = maxLockout
+	}
+	lo.Until = now.Add(wait)
+	return wait
+}
+
+// reset clears the given account's failed logins from the given IP address.
+func (l *loginLockouts) reset(userID int64, ip string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.users, lockoutKey{userID, ip})
+}
+
+// unlock clears all of the given account's failed logins, unlocking it
+// everywhere.
+func (l *loginLockouts) unlock(userID int64) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k := range l.users {
+		if k.userID == userID {
+			delete(l.users, k)
+		}
+	}
+}
+
+// locked returns the accounts that are currently locked, and where from, in
+// the order they unlock.
+func (l *loginLockouts) locked() []loginLockout {
+	if l == nil {
+		return nil
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var res []loginLockout
+	for _, lo := range l.users {
+		if lo.Until.After(now) {
+			res = append(res, *lo)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Until.Before(res[j].Until)
+	})
+	return res
+}
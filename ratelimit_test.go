@@ -0,0 +1,121 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/writeas/impart"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, time.Hour)
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("1.2.3.4"); !ok {
+			t.Fatalf("attempt %d should be allowed", i+1)
+		}
+	}
+	if ok, wait := l.allow("1.2.3.4"); ok || wait <= 0 || wait > time.Hour {
+		t.Errorf("third attempt: got %v, %s; want refused with a wait", ok, wait)
+	}
+	if ok, _ := l.allow("5.6.7.8"); !ok {
+		t.Error("other keys should be allowed")
+	}
+
+	var off *rateLimiter
+	if ok, _ := off.allow("1.2.3.4"); !ok {
+		t.Error("a disabled limiter should allow everything")
+	}
+}
+
+func TestLoginLockouts(t *testing.T) {
+	l := newLoginLockouts(3, time.Minute)
+	for i := 0; i < 2; i++ {
+		if wait := l.fail(1, "alice", "192.0.2.1"); wait != 0 {
+			t.Fatalf("failure %d locked the account for %s", i+1, wait)
+		}
+	}
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		if wait := l.fail(1, "alice", "192.0.2.1"); wait != want {
+			t.Errorf("lockout = %s, want %s", wait, want)
+		}
+	}
+	if l.check(1, "192.0.2.1") <= 0 || l.check(2, "192.0.2.1") != 0 {
+		t.Error("only the failing account should be locked")
+	}
+	if l.check(1, "198.51.100.1") != 0 {
+		t.Error("the account should only be locked from the failing address")
+	}
+	if locked := l.locked(); len(locked) != 1 || locked[0].Username != "alice" || locked[0].IP != "192.0.2.1" || locked[0].Failures != 5 {
+		t.Errorf("locked = %+v", locked)
+	}
+
+	l.fail(1, "alice", "198.51.100.1")
+	l.reset(1, "198.51.100.1")
+	if l.check(1, "192.0.2.1") <= 0 {
+		t.Error("reset should only clear failures from the given address")
+	}
+
+	l.unlock(1)
+	if l.check(1, "192.0.2.1") != 0 || len(l.locked()) != 0 {
+		t.Error("unlock should unlock the account")
+	}
+
+	for i := 0; i < 40; i++ {
+		l.fail(1, "alice", "192.0.2.1")
+	}
+	if wait := l.check(1, "192.0.2.1"); wait > maxLockout {
+		t.Errorf("lockout of %s is longer than the maximum", wait)
+	}
+}
+
+func TestLoginLockoutByAddress(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.cfg.RateLimit.LoginFailures = 3
+		app.InitRateLimits()
+		createTestUser(t, app, "alice", "correct horse")
+
+		logIn := func(pass, remoteAddr string) error {
+			body, _ := json.Marshal(userCredentials{Alias: "alice", Pass: pass})
+			req := httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("User-Agent", "test")
+			req.RemoteAddr = remoteAddr
+			return login(app, httptest.NewRecorder(), req)
+		}
+		status := func(err error) int {
+			if err == nil {
+				return http.StatusOK
+			}
+			if herr, ok := err.(impart.HTTPError); ok {
+				return herr.Status
+			}
+			return 0
+		}
+
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, http.StatusUnauthorized, status(logIn("wrong", "192.0.2.1:1234")))
+		}
+		assert.Equal(t, http.StatusTooManyRequests, status(logIn("wrong", "192.0.2.1:1234")))
+		// Even the right password is refused from the locked address
+		assert.Equal(t, http.StatusTooManyRequests, status(logIn("correct horse", "192.0.2.1:1234")))
+
+		// But the owner can still log in from anywhere else
+		assert.Equal(t, http.StatusOK, status(logIn("correct horse", "198.51.100.1:1234")))
+	})
+}
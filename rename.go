@@ -0,0 +1,174 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/writeas/impart"
+	"github.com/writeas/web-core/activitystreams"
+	"github.com/writeas/web-core/log"
+)
+
+// usernameGraceDays is how long an old username keeps resolving on the
+// fediverse, and stays reserved for whoever gave it up, after a change.
+const usernameGraceDays = 30
+
+// moveContext defines the actor properties that point between a blog's old
+// and new actors.
+var moveContext = map[string]interface{}{
+	"movedTo":     map[string]string{"@id": "as:movedTo", "@type": "@id"},
+	"alsoKnownAs": map[string]string{"@id": "as:alsoKnownAs", "@type": "@id"},
+}
+
+// movablePerson is an ActivityPub actor that can say where it moved to, or
+// where it used to be.
+type movablePerson struct {
+	*activitystreams.Person
+	MovedTo     string   `json:"movedTo,omitempty"`
+	AlsoKnownAs []string `json:"alsoKnownAs,omitempty"`
+}
+
+// actorActivity is an activity about an actor itself, like an Update to its
+// profile or a Move to a new one.
+type actorActivity struct {
+	activitystreams.BaseObject
+	Actor  string      `json:"actor"`
+	Object interface{} `json:"object"`
+	Target string      `json:"target,omitempty"`
+	To     []string    `json:"to,omitempty"`
+}
+
+// collectionActor returns the blog's actor, along with any aliases it had
+// as its owner's username within the grace period.
+func collectionActor(app *App, c *Collection) interface{} {
+	p := c.PersonObject()
+	if c.IsInstanceColl() {
+		return p
+	}
+
+	aka := []string{}
+	for _, prev := range app.db.GetPreviousAliases(c.OwnerID, c.Alias) {
+		prevColl := *c
+		prevColl.Alias = prev
+		aka = append(aka, prevColl.FederatedAccount())
+	}
+	if len(aka) == 0 {
+		return p
+	}
+	p.Context = append(p.Context, moveContext)
+	return &movablePerson{Person: p, AlsoKnownAs: aka}
+}
+
+// renamedActor returns the actor a blog had under a previous alias, pointing
+// to the one it has now.
+func renamedActor(c *Collection, prevAlias string) *movablePerson {
+	prevColl := *c
+	prevColl.Alias = prevAlias
+	p := prevColl.PersonObject(c.ID)
+	p.Context = append(p.Context, moveContext)
+	return &movablePerson{Person: p, MovedTo: c.FederatedAccount()}
+}
+
+// federateUsernameChange tells a renamed blog's followers that its actor
+// moved from the previous alias to the current one, so they can follow it
+// there.
+func federateUsernameChange(app *App, userID int64, prevAlias, alias string) {
+	if app.cfg.App.Private || !app.cfg.App.Federation {
+		return
+	}
+	c, err := app.db.GetCollection(alias)
+	if err != nil || c.OwnerID != userID {
+		return
+	}
+	if c.Visibility == CollPrivate || c.Visibility == CollProtected {
+		return
+	}
+	c.hostName = app.cfg.App.Host
+
+	followers, err := app.db.GetAPFollowers(c)
+	if err != nil {
+		log.Error("Couldn't get followers to announce username change: %v", err)
+		return
+	}
+	inboxes := map[string]bool{}
+	for _, f := range *followers {
+		inbox := f.SharedInbox
+		if inbox == "" {
+			inbox = f.Inbox
+		}
+		inboxes[inbox] = true
+	}
+	if len(inboxes) == 0 {
+		return
+	}
+
+	prev := renamedActor(c, prevAlias)
+	now := time.Now().Unix()
+	update := &actorActivity{
+		BaseObject: activitystreams.BaseObject{
+			Context: []interface{}{activitystreams.Namespace, moveContext},
+			ID:      fmt.Sprintf("%s#updates/%d", prev.ID, now),
+			Type:    "Update",
+		},
+		Actor:  prev.ID,
+		Object: prev,
+		To:     []string{"https://www.w3.org/ns/activitystreams#Public"},
+	}
+	move := &actorActivity{
+		BaseObject: activitystreams.BaseObject{
+			Context: []interface{}{activitystreams.Namespace},
+			ID:      fmt.Sprintf("%s#moves/%d", prev.ID, now),
+			Type:    "Move",
+		},
+		Actor:  prev.ID,
+		Object: prev.ID,
+		Target: prev.MovedTo,
+		To:     []string{prev.Followers},
+	}
+
+	log.Info("Announcing move of %s to %s to %d inboxes", prev.ID, prev.MovedTo, len(inboxes))
+	for inbox := range inboxes {
+		for _, activity := range []*actorActivity{update, move} {
+			if err = makeActivityPost(app.cfg.App.Host, prev.Person, inbox, activity); err != nil {
+				log.Error("Couldn't post %s! %v", activity.Type, err)
+			}
+		}
+	}
+}
+
+func handleAdminChangeUsername(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	username := mux.Vars(r)["username"]
+	user, err := app.db.GetUserForAuth(username)
+	if err == ErrUserNotFound {
+		return impart.HTTPError{http.StatusNotFound, fmt.Sprintf("User '%s' was not found", username)}
+	} else if err != nil {
+		log.Error("failed to get user: %v", err)
+		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not get user from username: %v", err)}
+	}
+
+	err = app.db.ChangeUsername(app, user, r.FormValue("new-username"))
+	if err != nil {
+		if err, ok := err.(impart.HTTPError); ok {
+			_ = addSessionFlash(app, w, r, err.Message, nil)
+			return impart.HTTPError{http.StatusFound, "/admin/user/" + username}
+		}
+		return err
+	}
+
+	log.Info("ADMIN: Changed username %s to %s", username, user.Username)
+	go federateUsernameChange(app, user.ID, username, user.Username)
+	_ = addSessionFlash(app, w, r, fmt.Sprintf("Changed username from %s to %s.", username, user.Username), nil)
+	return impart.HTTPError{http.StatusFound, "/admin/user/" + user.Username}
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/writeas/impart"
+)
+
+func TestUsernameChange(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.cfg.App.Host = "https://example.com"
+		app.cfg.App.Federation = true
+		createTestUser(t, app, "admin", "password")
+		alice := createTestUser(t, app, "alice", "password")
+		bob := createTestUser(t, app, "bob", "password")
+		const oldActor = "https://example.com/api/collections/alice"
+		const newActor = "https://example.com/api/collections/alicia"
+
+		fetchActor := func(alias string) (int, map[string]interface{}) {
+			req := httptest.NewRequest("GET", "/api/collections/"+alias, nil)
+			req = mux.SetURLVars(req, map[string]string{"alias": alias})
+			rr := httptest.NewRecorder()
+			if err := handleFetchCollectionActivities(app, rr, req); err != nil {
+				if herr, ok := err.(impart.HTTPError); ok {
+					return herr.Status, nil
+				}
+				t.Fatalf("fetch %s: %v", alias, err)
+			}
+			actor := map[string]interface{}{}
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &actor))
+			return rr.Code, actor
+		}
+		wfr := wfResolver{db: db, cfg: app.cfg}
+
+		assert.NoError(t, db.ChangeUsername(app, alice, "alicia"))
+		assert.Equal(t, "alicia", alice.Username)
+
+		// The old name is reserved for whoever gave it up
+		assert.Error(t, db.ChangeUsername(app, bob, "alice"))
+		assert.Error(t, db.CreateUser(app.cfg, &User{Username: "alice"}, "alice", ""))
+		assert.False(t, db.IsUsernameReserved("alice", alice.ID))
+
+		// The old handle still resolves to the old actor, which says where
+		// it moved
+		res, err := wfr.FindUser("alice", "example.com", "example.com", nil)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "acct:alice@example.com", res.Subject)
+			assert.Contains(t, res.Aliases, oldActor)
+		}
+		code, actor := fetchActor("alice")
+		if assert.Equal(t, http.StatusOK, code) {
+			assert.Equal(t, oldActor, actor["id"])
+			assert.Equal(t, newActor, actor["movedTo"])
+		}
+
+		// The new actor knows it was the old one
+		code, actor = fetchActor("alicia")
+		if assert.Equal(t, http.StatusOK, code) {
+			assert.Equal(t, newActor, actor["id"])
+			assert.Equal(t, []interface{}{oldActor}, actor["alsoKnownAs"])
+			assert.Nil(t, actor["movedTo"])
+		}
+		code, actor = fetchActor("bob")
+		if assert.Equal(t, http.StatusOK, code) {
+			assert.Nil(t, actor["alsoKnownAs"])
+		}
+
+		// Once the grace period is over, the old name is free again
+		_, err = db.Exec("UPDATE usernamechanges SET created = " + db.dateSub(usernameGraceDays+1, "DAY"))
+		assert.NoError(t, err)
+		_, err = wfr.FindUser("alice", "example.com", "example.com", nil)
+		assert.Error(t, err)
+		code, _ = fetchActor("alice")
+		assert.Equal(t, http.StatusNotFound, code)
+		code, actor = fetchActor("alicia")
+		if assert.Equal(t, http.StatusOK, code) {
+			assert.Nil(t, actor["alsoKnownAs"])
+		}
+		assert.NoError(t, db.ChangeUsername(app, bob, "alice"))
+	})
+}
@@ -16,7 +16,6 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/gorilla/csrf"
 	"github.com/gorilla/mux"
 	"github.com/writeas/go-webfinger"
 	"github.com/writeas/web-core/log"
@@ -57,6 +56,8 @@ func InitRoutes(apper Apper, r *mux.Router) *mux.Router {
 
 	// Primary app routes
 	write := r.PathPrefix("/").Subrouter()
+	write.Use(handler.EnforceScopes)
+	write.Use(handler.UpgradeSessions)
 
 	// Federation endpoint configurations
 	wf := webfinger.Default(wfResolver{apper.App().db, apper.App().cfg})
@@ -90,7 +91,7 @@ func InitRoutes(apper Apper, r *mux.Router) *mux.Router {
 	}
 	auth.HandleFunc("/login", handler.All(login)).Methods("POST")
 	auth.HandleFunc("/read", handler.WebErrors(handleWebCollectionUnlock, UserLevelNone)).Methods("POST")
-	auth.HandleFunc("/me", handler.All(handleAPILogout)).Methods("DELETE")
+	handler.Scope(scopeAny, auth.HandleFunc("/me", handler.All(handleAPILogout)).Methods("DELETE"))
 
 	// Handle logged in user sections
 	me := write.PathPrefix("/me").Subrouter()
@@ -100,54 +101,78 @@ func InitRoutes(apper Apper, r *mux.Router) *mux.Router {
 	me.HandleFunc("/c/{collection}", handler.User(viewEditCollection)).Methods("GET")
 	me.HandleFunc("/c/{collection}/stats", handler.User(viewStats)).Methods("GET")
 	me.HandleFunc("/c/{collection}/subscribers", handler.User(handleViewSubscribers)).Methods("GET")
-	me.Path("/delete").Handler(csrf.Protect(apper.App().keys.CSRFKey)(handler.User(handleUserDelete))).Methods("POST")
+	me.HandleFunc("/c/{collection}/letter/preview", handler.User(handleViewLetterPreview)).Methods("GET")
+	me.Path("/delete").Handler(apper.App().csrfProtect(handler.User(handleUserDelete))).Methods("POST")
 	me.HandleFunc("/posts", handler.Redirect("/me/posts/", UserLevelUser)).Methods("GET")
 	me.HandleFunc("/posts/", handler.User(viewArticles)).Methods("GET")
-	me.HandleFunc("/posts/export.csv", handler.Download(viewExportPosts, UserLevelUser)).Methods("GET")
-	me.HandleFunc("/posts/export.zip", handler.Download(viewExportPosts, UserLevelUser)).Methods("GET")
-	me.HandleFunc("/posts/export.json", handler.Download(viewExportPosts, UserLevelUser)).Methods("GET")
+	handler.Scope(scopeReadPosts, me.HandleFunc("/posts/export.csv", handler.Download(viewExportPosts, UserLevelUser)).Methods("GET"))
+	handler.Scope(scopeReadPosts, me.HandleFunc("/posts/export.zip", handler.Download(viewExportPosts, UserLevelUser)).Methods("GET"))
+	handler.Scope(scopeReadPosts, me.HandleFunc("/posts/export.json", handler.Download(viewExportPosts, UserLevelUser)).Methods("GET"))
 	me.HandleFunc("/export", handler.User(viewExportOptions)).Methods("GET")
 	me.HandleFunc("/export.json", handler.Download(viewExportFull, UserLevelUser)).Methods("GET")
 	me.HandleFunc("/import", handler.User(viewImport)).Methods("GET")
-	me.Path("/settings").Handler(csrf.Protect(apper.App().keys.CSRFKey)(handler.User(viewSettings))).Methods("GET")
+	me.Path("/settings").Handler(apper.App().csrfProtect(handler.User(viewSettings))).Methods("GET")
+	me.Path("/settings/sessions").Handler(apper.App().csrfProtect(handler.User(viewSessions))).Methods("GET")
+	me.Path("/settings/sessions/revoke").Handler(apper.App().csrfProtect(handler.User(handleRevokeSession))).Methods("POST")
+	me.Path("/settings/sessions/revoke-all").Handler(apper.App().csrfProtect(handler.User(handleRevokeAllSessions))).Methods("POST")
+	me.Path("/settings/verify-email").Handler(apper.App().csrfProtect(handler.User(handleResendEmailVerification))).Methods("POST")
+	me.Path("/settings/tokens").Handler(apper.App().csrfProtect(handler.User(handleWebCreatePersonalToken))).Methods("POST")
+	me.Path("/settings/2fa").Handler(apper.App().csrfProtect(handler.User(viewTwoFactorSettings))).Methods("GET")
+	me.Path("/settings/2fa/enable").Handler(apper.App().csrfProtect(handler.User(handleEnableTwoFactor))).Methods("POST")
+	me.Path("/settings/2fa/recovery").Handler(apper.App().csrfProtect(handler.User(handleRegenerateRecoveryCodes))).Methods("POST")
+	me.Path("/settings/2fa/disable").Handler(apper.App().csrfProtect(handler.User(handleDisableTwoFactor))).Methods("POST")
+	me.Path("/settings/passkeys").Handler(apper.App().csrfProtect(handler.User(viewPasskeys))).Methods("GET")
+	me.Path("/settings/passkeys/begin").Handler(apper.App().csrfProtect(handler.UserAll(false, handleBeginPasskeyRegistration, sessionAPIAuth))).Methods("POST")
+	me.Path("/settings/passkeys/finish").Handler(apper.App().csrfProtect(handler.UserAll(false, handleFinishPasskeyRegistration, sessionAPIAuth))).Methods("POST")
+	me.Path("/settings/passkeys/delete").Handler(apper.App().csrfProtect(handler.User(handleDeletePasskey))).Methods("POST")
 	me.HandleFunc("/invites", handler.User(handleViewUserInvites)).Methods("GET")
 	me.HandleFunc("/logout", handler.Web(viewLogout, UserLevelNone)).Methods("GET")
 
-	write.HandleFunc("/api/me", handler.All(viewMeAPI)).Methods("GET")
+	handler.Scope(scopeAny, write.HandleFunc("/api/me", handler.All(viewMeAPI)).Methods("GET"))
 	apiMe := write.PathPrefix("/api/me/").Subrouter()
-	apiMe.HandleFunc("/", handler.All(viewMeAPI)).Methods("GET")
-	apiMe.HandleFunc("/posts", handler.UserWebAPI(viewMyPostsAPI)).Methods("GET")
-	apiMe.HandleFunc("/collections", handler.UserAPI(viewMyCollectionsAPI)).Methods("GET")
+	handler.Scope(scopeAny, apiMe.HandleFunc("/", handler.All(viewMeAPI)).Methods("GET"))
+	handler.Scope(scopeReadPosts, apiMe.HandleFunc("/posts", handler.UserWebAPI(viewMyPostsAPI)).Methods("GET"))
+	handler.Scope(scopeReadPosts, apiMe.HandleFunc("/collections", handler.UserAPI(viewMyCollectionsAPI)).Methods("GET"))
+	apiMe.HandleFunc("/tokens", handler.UserAPI(fetchPersonalTokens)).Methods("GET")
+	apiMe.HandleFunc("/tokens", handler.UserAPI(handleCreatePersonalToken)).Methods("POST")
+	apiMe.HandleFunc("/tokens/{token:[0-9a-f]+}", handler.UserAPI(handleDeletePersonalToken)).Methods("DELETE")
 	apiMe.HandleFunc("/password", handler.All(updatePassphrase)).Methods("POST")
 	apiMe.HandleFunc("/self", handler.All(updateSettings)).Methods("POST")
 	apiMe.HandleFunc("/invites", handler.User(handleCreateUserInvite)).Methods("POST")
 	apiMe.HandleFunc("/import", handler.User(handleImport)).Methods("POST")
 	apiMe.HandleFunc("/oauth/remove", handler.User(removeOauth)).Methods("POST")
+	apiMe.HandleFunc("/email/address", handler.User(handlePostingAddress)).Methods("POST")
+	apiMe.HandleFunc("/notifications", handler.User(handleNotificationPrefs)).Methods("POST")
 
 	// Sign up validation
-	write.HandleFunc("/api/alias", handler.All(handleUsernameCheck)).Methods("POST")
+	handler.Scope(scopeAny, write.HandleFunc("/api/alias", handler.All(handleUsernameCheck)).Methods("POST"))
 
-	write.HandleFunc("/api/markdown", handler.All(handleRenderMarkdown)).Methods("POST")
+	handler.Scope(scopeAny, write.HandleFunc("/api/markdown", handler.All(handleRenderMarkdown)).Methods("POST"))
+
+	// Email delivery events
+	write.HandleFunc("/api/email/events/mailgun", handler.All(handleMailgunEvent)).Methods("POST")
+	write.HandleFunc("/api/email/inbound", handler.All(handleInboundEmail)).Methods("POST")
 
 	instanceURL, _ := url.Parse(apper.App().Config().App.Host)
 	host := instanceURL.Host
 
 	// Handle collections
-	write.HandleFunc("/api/collections", handler.All(newCollection)).Methods("POST")
+	handler.Scope(scopeManageCollections, write.HandleFunc("/api/collections", handler.All(newCollection)).Methods("POST"))
 	apiColls := write.PathPrefix("/api/collections/").Subrouter()
 	apiColls.HandleFunc("/monetization-pointer", handler.PlainTextAPI(handleSPSPEndpoint)).Methods("GET")
-	apiColls.HandleFunc("/"+host, handler.AllReader(fetchCollection)).Methods("GET")
-	apiColls.HandleFunc("/{alias:[0-9a-zA-Z\\-]+}", handler.AllReader(fetchCollection)).Methods("GET")
-	apiColls.HandleFunc("/{alias:[0-9a-zA-Z\\-]+}", handler.All(existingCollection)).Methods("POST", "DELETE")
-	apiColls.HandleFunc("/{alias}/posts", handler.AllReader(fetchCollectionPosts)).Methods("GET")
-	apiColls.HandleFunc("/{alias}/posts", handler.All(newPost)).Methods("POST")
-	apiColls.HandleFunc("/{alias}/posts/{post}", handler.AllReader(fetchPost)).Methods("GET")
-	apiColls.HandleFunc("/{alias}/posts/{post:[a-zA-Z0-9]{10}}", handler.All(existingPost)).Methods("POST")
-	apiColls.HandleFunc("/{alias}/posts/{post}/splitcontent", handler.AllReader(handleGetSplitContent)).Methods("GET", "POST")
-	apiColls.HandleFunc("/{alias}/posts/{post}/{property}", handler.AllReader(fetchPostProperty)).Methods("GET")
-	apiColls.HandleFunc("/{alias}/collect", handler.All(addPost)).Methods("POST")
-	apiColls.HandleFunc("/{alias}/pin", handler.All(pinPost)).Methods("POST")
-	apiColls.HandleFunc("/{alias}/unpin", handler.All(pinPost)).Methods("POST")
+	handler.Scope(scopeReadPosts, apiColls.HandleFunc("/"+host, handler.AllReader(fetchCollection)).Methods("GET"))
+	handler.Scope(scopeReadPosts, apiColls.HandleFunc("/{alias:[0-9a-zA-Z\\-]+}", handler.AllReader(fetchCollection)).Methods("GET"))
+	handler.Scope(scopeManageCollections, apiColls.HandleFunc("/{alias:[0-9a-zA-Z\\-]+}", handler.All(existingCollection)).Methods("POST", "DELETE"))
+	handler.Scope(scopeReadStats, apiColls.HandleFunc("/{alias}/stats", handler.UserWebAPI(fetchCollectionStats)).Methods("GET"))
+	handler.Scope(scopeReadPosts, apiColls.HandleFunc("/{alias}/posts", handler.AllReader(fetchCollectionPosts)).Methods("GET"))
+	handler.Scope(scopeWritePosts, apiColls.HandleFunc("/{alias}/posts", handler.All(newPost)).Methods("POST"))
+	handler.Scope(scopeReadPosts, apiColls.HandleFunc("/{alias}/posts/{post}", handler.AllReader(fetchPost)).Methods("GET"))
+	handler.Scope(scopeWritePosts, apiColls.HandleFunc("/{alias}/posts/{post:[a-zA-Z0-9]{10}}", handler.All(existingPost)).Methods("POST"))
+	handler.Scope(scopeReadPosts, apiColls.HandleFunc("/{alias}/posts/{post}/splitcontent", handler.AllReader(handleGetSplitContent)).Methods("GET", "POST"))
+	handler.Scope(scopeReadPosts, apiColls.HandleFunc("/{alias}/posts/{post}/{property}", handler.AllReader(fetchPostProperty)).Methods("GET"))
+	handler.Scope(scopeWritePosts, apiColls.HandleFunc("/{alias}/collect", handler.All(addPost)).Methods("POST"))
+	handler.Scope(scopeWritePosts, apiColls.HandleFunc("/{alias}/pin", handler.All(pinPost)).Methods("POST"))
+	handler.Scope(scopeWritePosts, apiColls.HandleFunc("/{alias}/unpin", handler.All(pinPost)).Methods("POST"))
 	apiColls.HandleFunc("/{alias}/email/subscribe", handler.All(handleCreateEmailSubscription)).Methods("POST")
 	apiColls.HandleFunc("/{alias}/email/subscribe", handler.All(handleDeleteEmailSubscription)).Methods("DELETE")
 	apiColls.HandleFunc("/{collection}/email/unsubscribe", handler.All(handleDeleteEmailSubscription)).Methods("GET")
@@ -157,14 +182,17 @@ func InitRoutes(apper Apper, r *mux.Router) *mux.Router {
 	apiColls.HandleFunc("/{alias}/followers", handler.AllReader(handleFetchCollectionFollowers)).Methods("GET")
 
 	// Handle posts
-	write.HandleFunc("/api/posts", handler.All(newPost)).Methods("POST")
+	handler.Scope(scopeWritePosts, write.HandleFunc("/api/posts", handler.All(newPost)).Methods("POST"))
 	posts := write.PathPrefix("/api/posts/").Subrouter()
-	posts.HandleFunc("/{post:[a-zA-Z0-9]+}", handler.AllReader(fetchPost)).Methods("GET")
-	posts.HandleFunc("/{post:[a-zA-Z0-9]+}", handler.All(existingPost)).Methods("POST", "PUT")
-	posts.HandleFunc("/{post:[a-zA-Z0-9]+}", handler.All(deletePost)).Methods("DELETE")
-	posts.HandleFunc("/{post:[a-zA-Z0-9]+}/{property}", handler.AllReader(fetchPostProperty)).Methods("GET")
-	posts.HandleFunc("/claim", handler.All(addPost)).Methods("POST")
-	posts.HandleFunc("/disperse", handler.All(dispersePost)).Methods("POST")
+	handler.Scope(scopeReadPosts, posts.HandleFunc("/{post:[a-zA-Z0-9]+}", handler.AllReader(fetchPost)).Methods("GET"))
+	handler.Scope(scopeWritePosts, posts.HandleFunc("/{post:[a-zA-Z0-9]+}", handler.All(existingPost)).Methods("POST", "PUT"))
+	handler.Scope(scopeWritePosts, posts.HandleFunc("/{post:[a-zA-Z0-9]+}", handler.All(deletePost)).Methods("DELETE"))
+	handler.Scope(scopeReadPosts, posts.HandleFunc("/{post:[a-zA-Z0-9]+}/{property}", handler.AllReader(fetchPostProperty)).Methods("GET"))
+	handler.Scope(scopeWritePosts, posts.HandleFunc("/claim", handler.All(addPost)).Methods("POST"))
+	handler.Scope(scopeWritePosts, posts.HandleFunc("/disperse", handler.All(dispersePost)).Methods("POST"))
+
+	// Admin API
+	handler.Scope(scopeAdmin, write.HandleFunc("/api/admin/users", handler.UserAPI(fetchAdminUsers)).Methods("GET"))
 
 	write.HandleFunc("/auth/signup", handler.Web(handleWebSignup, UserLevelNoneRequired)).Methods("POST")
 	write.HandleFunc("/auth/login", handler.Web(webLogin, UserLevelNoneRequired)).Methods("POST")
@@ -177,6 +205,18 @@ func InitRoutes(apper Apper, r *mux.Router) *mux.Router {
 	write.HandleFunc("/admin/user/{username}/delete", handler.Admin(handleAdminDeleteUser)).Methods("POST")
 	write.HandleFunc("/admin/user/{username}/status", handler.Admin(handleAdminToggleUserStatus)).Methods("POST")
 	write.HandleFunc("/admin/user/{username}/passphrase", handler.Admin(handleAdminResetUserPass)).Methods("POST")
+	write.HandleFunc("/admin/user/{username}/unlock", handler.Admin(handleAdminUnlockUser)).Methods("POST")
+	write.HandleFunc("/admin/user/{username}/approve", handler.Admin(handleAdminApproveUser)).Methods("POST")
+	write.HandleFunc("/admin/user/{username}/reject", handler.Admin(handleAdminRejectUser)).Methods("POST")
+	write.HandleFunc("/admin/user/{username}/username", handler.Admin(handleAdminChangeUsername)).Methods("POST")
+	write.HandleFunc("/admin/user/{username}/restore", handler.Admin(handleAdminRestoreUser)).Methods("POST")
+	write.HandleFunc("/admin/invites", handler.Admin(handleViewAdminInvites)).Methods("GET")
+	write.HandleFunc("/admin/invites", handler.Admin(handleAdminCreateInvites)).Methods("POST")
+	write.HandleFunc("/admin/invite/{code:[a-zA-Z0-9]+}", handler.Admin(handleViewAdminInvite)).Methods("GET")
+	write.HandleFunc("/admin/invite/{code:[a-zA-Z0-9]+}/revoke", handler.Admin(handleAdminRevokeInvite)).Methods("POST")
+	write.HandleFunc("/admin/spam", handler.Admin(handleViewAdminSpam)).Methods("GET")
+	write.HandleFunc("/admin/spam/block", handler.Admin(handleAdminAddSignupBlock)).Methods("POST")
+	write.HandleFunc("/admin/spam/unblock", handler.Admin(handleAdminRemoveSignupBlock)).Methods("POST")
 	write.HandleFunc("/admin/pages", handler.Admin(handleViewAdminPages)).Methods("GET")
 	write.HandleFunc("/admin/page/{slug}", handler.Admin(handleViewAdminPage)).Methods("GET")
 	write.HandleFunc("/admin/update/config", handler.AdminApper(handleAdminUpdateConfig)).Methods("POST")
@@ -184,8 +224,15 @@ func InitRoutes(apper Apper, r *mux.Router) *mux.Router {
 	write.HandleFunc("/admin/updates", handler.Admin(handleViewAdminUpdates)).Methods("GET")
 
 	// Handle special pages first
-	write.Path("/reset").Handler(csrf.Protect(apper.App().keys.CSRFKey)(handler.Web(viewResetPassword, UserLevelNoneRequired)))
+	write.Path("/reset").Handler(apper.App().csrfProtect(handler.Web(viewResetPassword, UserLevelNoneRequired)))
 	write.HandleFunc("/login", handler.Web(viewLogin, UserLevelNoneRequired))
+	write.HandleFunc("/verify-email", handler.Web(handleVerifyEmail, UserLevelOptional)).Methods("GET")
+	write.Path("/login/2fa").Handler(apper.App().csrfProtect(handler.Web(viewLoginTwoFactor, UserLevelNoneRequired))).Methods("GET")
+	write.Path("/login/2fa").Handler(apper.App().csrfProtect(handler.Web(handleLoginTwoFactor, UserLevelNoneRequired))).Methods("POST")
+	write.HandleFunc("/login/2fa/passkey/begin", handler.All(handleBeginPasskeyTwoFactor)).Methods("POST")
+	write.HandleFunc("/login/2fa/passkey/finish", handler.All(handleFinishPasskeyTwoFactor)).Methods("POST")
+	write.HandleFunc("/login/passkey/begin", handler.All(handleBeginPasskeyLogin)).Methods("POST")
+	write.HandleFunc("/login/passkey/finish", handler.All(handleFinishPasskeyLogin)).Methods("POST")
 	write.HandleFunc("/signup", handler.Web(handleViewLanding, UserLevelNoneRequired))
 	write.HandleFunc("/invite/{code:[a-zA-Z0-9]+}", handler.Web(handleViewInvite, UserLevelOptional)).Methods("GET")
 	// TODO: show a reader-specific 404 page if the function is disabled
@@ -228,6 +275,9 @@ func RouteCollections(handler *Handler, r *mux.Router) {
 	r.HandleFunc("/tag:{tag}/feed/", handler.Web(ViewFeed, UserLevelReader))
 	r.HandleFunc("/sitemap.xml", handler.AllReader(handleViewSitemap))
 	r.HandleFunc("/feed/", handler.AllReader(ViewFeed))
+	r.HandleFunc("/letters/", handler.Web(handleViewCollectionLetters, UserLevelReader))
+	r.HandleFunc("/letters/feed/", handler.AllReader(ViewLettersFeed))
+	r.HandleFunc("/letters/{letter:[0-9]+}", handler.Web(handleViewCollectionLetters, UserLevelReader))
 	r.HandleFunc("/email/confirm/{subscriber}", handler.All(handleConfirmEmailSubscription)).Methods("GET")
 	r.HandleFunc("/email/unsubscribe/{subscriber}", handler.All(handleDeleteEmailSubscription)).Methods("GET")
 	r.HandleFunc("/{slug}", handler.CollectionPostOrStatic)
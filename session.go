@@ -12,10 +12,12 @@ package writefreely
 
 import (
 	"encoding/gob"
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"github.com/writeas/web-core/log"
 	"net/http"
 	"strings"
+	"time"
 )
 
 const (
@@ -25,20 +27,38 @@ const (
 	userEmailCookieName = "ue"
 	userEmailCookieVal  = "email"
 
-	cookieName    = "wfu"
-	cookieUserVal = "u"
+	cookieName       = "wfu"
+	cookieUserVal    = "u"
+	cookieSessionVal = "s"
+	// cookieSessionNewVal marks a session that was just recorded. It's never
+	// saved to the cookie.
+	cookieSessionNewVal = "sn"
+
+	cookieTwoFactorVal = "2fa"
+	cookiePasskeyVal   = "pk"
+	cookieOIDCVal      = "oidc"
 
 	blogPassCookieName = "ub"
 )
 
 // InitSession creates the cookie store. It depends on the keychain already
-// being loaded.
+// being loaded and the database being connected.
 func (app *App) InitSession() {
 	// Register complex data types we'll be storing in cookies
 	gob.Register(&User{})
+	gob.Register(&pendingTwoFactor{})
+	gob.Register(&passkeyChallenge{})
+	gob.Register(&oidcLogin{})
 
 	// Create the cookie store
 	store := sessions.NewCookieStore(app.keys.CookieAuthKey, app.keys.CookieKey)
+	if len(app.keys.PrevCookieAuthKey) > 0 && len(app.keys.PrevCookieKey) > 0 && time.Now().Before(app.keys.PrevCookiesUntil) {
+		// Keep existing sessions working for a while after the keys change
+		store.Codecs = append(store.Codecs, &graceCodec{
+			Codec: securecookie.New(app.keys.PrevCookieAuthKey, app.keys.PrevCookieKey),
+			until: app.keys.PrevCookiesUntil,
+		})
+	}
 	store.Options = &sessions.Options{
 		Path:     "/",
 		MaxAge:   sessionLength,
@@ -48,7 +68,7 @@ func (app *App) InitSession() {
 	if store.Options.Secure {
 		store.Options.SameSite = http.SameSiteNoneMode
 	}
-	app.sessionStore = store
+	app.sessionStore = &userSessionStore{CookieStore: store, db: app.db}
 }
 
 func getSessionFlashes(app *App, w http.ResponseWriter, r *http.Request, session *sessions.Session) ([]string, error) {
@@ -0,0 +1,180 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/writeas/impart"
+	"github.com/writeas/web-core/log"
+	"github.com/writefreely/writefreely/config"
+	"github.com/writefreely/writefreely/spam"
+)
+
+const (
+	userAttrSignupIP  = "signup_ip"
+	userAttrSpamScore = "spam_score"
+
+	// signupVelocityHours is how far back we look for other accounts signed
+	// up from the same IP address.
+	signupVelocityHours = 24
+
+	// signupVelocityScore is what each of those accounts adds to a new
+	// account's spam score.
+	signupVelocityScore = 2
+)
+
+// signupBlock is an email domain, email address or IP range that isn't
+// allowed to sign up.
+type signupBlock struct {
+	Type    string
+	Value   string
+	Created time.Time
+}
+
+// checkSignupBlocks returns an error if a signup comes from a blocked IP
+// address, or uses a blocked or disposable email address.
+func checkSignupBlocks(app *App, r *http.Request, email string) error {
+	blocks, err := app.db.GetSignupBlocks()
+	if err != nil {
+		return err
+	}
+	bl := spam.NewBlocklist()
+	for _, b := range blocks {
+		if err := bl.Add(b.Type, b.Value); err != nil {
+			log.Error("Skipping invalid signup block %s %s: %v", b.Type, b.Value, err)
+		}
+	}
+
+	ip := requestIP(r)
+	if bl.BlocksIP(ip) {
+		log.Info("Signup: Blocked IP %s", ip)
+		return ErrSignupIPBlocked
+	}
+	if email == "" {
+		return nil
+	}
+	if bl.BlocksEmail(email) {
+		log.Info("Signup: Blocked email address from %s", ip)
+		return ErrSignupEmailBlocked
+	}
+	if app.cfg.Spam.BlockDisposableEmails && spam.IsDisposableEmail(email) {
+		log.Info("Signup: Blocked disposable email address from %s", ip)
+		return ErrSignupEmailBlocked
+	}
+	return nil
+}
+
+// scoreSignup records where a new account signed up from, and scores it for
+// the other accounts that recently signed up from there.
+func scoreSignup(app *App, r *http.Request, userID int64) {
+	ip := requestIP(r)
+	if ip == "" {
+		return
+	}
+	recent := app.db.CountRecentSignupsFromIP(ip, signupVelocityHours)
+	if err := app.db.SetUserAttribute(userID, userAttrSignupIP, ip); err != nil {
+		return
+	}
+	addSpamScore(app, userID, recent*signupVelocityScore)
+}
+
+// scoreFirstPost scores a user for links in their first post, and returns
+// whether they're silenced as a result.
+func scoreFirstPost(app *App, userID int64, content string) bool {
+	if app.cfg.Spam.SilenceScore <= 0 || app.db.GetUserPostsCount(userID) != 1 {
+		return false
+	}
+	return addSpamScore(app, userID, spam.LinkScore(content))
+}
+
+// addSpamScore adds to a user's spam score, silencing them once it reaches
+// the configured limit. It returns whether the user was silenced.
+func addSpamScore(app *App, userID int64, n int) bool {
+	if n <= 0 {
+		return false
+	}
+	score, _ := strconv.Atoi(app.db.GetUserAttribute(userID, userAttrSpamScore))
+	score += n
+	if err := app.db.SetUserAttribute(userID, userAttrSpamScore, strconv.Itoa(score)); err != nil {
+		return false
+	}
+
+	limit := app.cfg.Spam.SilenceScore
+	if limit <= 0 || score < limit {
+		return false
+	}
+	u, err := app.db.GetUserByID(userID)
+	if err != nil || app.db.IsUserAdmin(userID) || u.IsSilenced() {
+		return false
+	}
+	log.Info("Spam: Silencing %s with a spam score of %d", u.Username, score)
+	if err = app.db.SetUserStatus(userID, u.Status|UserSilenced); err != nil {
+		log.Error("Unable to silence user %s: %v", u.Username, err)
+		return false
+	}
+	return true
+}
+
+func handleViewAdminSpam(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	p := struct {
+		*UserPage
+		*AdminPage
+		Config  config.SpamCfg
+		Flashes []string
+
+		Blocks []signupBlock
+	}{
+		UserPage:  NewUserPage(app, r, u, "Spam", nil),
+		AdminPage: NewAdminPage(app),
+		Config:    app.cfg.Spam,
+	}
+
+	p.Flashes, _ = getSessionFlashes(app, w, r, nil)
+	var err error
+	p.Blocks, err = app.db.GetSignupBlocks()
+	if err != nil {
+		return err
+	}
+
+	showUserPage(w, "spam", p)
+	return nil
+}
+
+func handleAdminAddSignupBlock(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	kind := r.FormValue("type")
+	v, err := spam.NormalizeBlock(kind, r.FormValue("value"))
+	if err != nil {
+		_ = addSessionFlash(app, w, r, err.Error(), nil)
+		return impart.HTTPError{http.StatusFound, "/admin/spam"}
+	}
+
+	log.Info("ADMIN: Blocking signups from %s %s", kind, v)
+	if err = app.db.AddSignupBlock(kind, v); err != nil {
+		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not add block: %v", err)}
+	}
+	_ = addSessionFlash(app, w, r, fmt.Sprintf("Blocked %s.", v), nil)
+	return impart.HTTPError{http.StatusFound, "/admin/spam"}
+}
+
+func handleAdminRemoveSignupBlock(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	kind, v := r.FormValue("type"), r.FormValue("value")
+
+	log.Info("ADMIN: Unblocking signups from %s %s", kind, v)
+	if err := app.db.RemoveSignupBlock(kind, v); err != nil {
+		return impart.HTTPError{http.StatusInternalServerError, fmt.Sprintf("Could not remove block: %v", err)}
+	}
+	_ = addSessionFlash(app, w, r, fmt.Sprintf("Unblocked %s.", v), nil)
+	return impart.HTTPError{http.StatusFound, "/admin/spam"}
+}
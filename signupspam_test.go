@@ -0,0 +1,85 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/writefreely/writefreely/spam"
+)
+
+func TestCheckSignupBlocks(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		assert.NoError(t, db.AddSignupBlock(spam.BlockIP, "192.0.2.0/24"))
+		assert.NoError(t, db.AddSignupBlock(spam.BlockDomain, "spam.example"))
+		assert.NoError(t, db.AddSignupBlock(spam.BlockEmail, "bad@example.com"))
+
+		check := func(remoteAddr, xff, email string) error {
+			r := httptest.NewRequest("POST", "/auth/signup", nil)
+			r.RemoteAddr = remoteAddr
+			if xff != "" {
+				r.Header.Set("X-Forwarded-For", xff)
+			}
+			return checkSignupBlocks(app, r, email)
+		}
+
+		assert.NoError(t, check("198.51.100.1:1234", "", ""))
+		assert.NoError(t, check("198.51.100.1:1234", "", "good@example.com"))
+		assert.Equal(t, ErrSignupIPBlocked, check("192.0.2.7:1234", "", "good@example.com"))
+		assert.Equal(t, ErrSignupEmailBlocked, check("198.51.100.1:1234", "", "someone@spam.example"))
+		assert.Equal(t, ErrSignupEmailBlocked, check("198.51.100.1:1234", "", "Bad+x@example.com"))
+
+		// Blocked clients can't get around it by claiming to be someone else
+		assert.Equal(t, ErrSignupIPBlocked, check("192.0.2.7:1234", "198.51.100.1", ""))
+		// but a local reverse proxy is believed
+		assert.Equal(t, ErrSignupIPBlocked, check("127.0.0.1:1234", "192.0.2.7", ""))
+		assert.NoError(t, check("127.0.0.1:1234", "198.51.100.1", ""))
+
+		app.cfg.Spam.BlockDisposableEmails = true
+		assert.Equal(t, ErrSignupEmailBlocked, check("198.51.100.1:1234", "", "someone@mailinator.com"))
+	})
+}
+
+func TestAddSpamScore(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.cfg.Spam.SilenceScore = 5
+		admin := createTestUser(t, app, "admin", "password")
+		spammer := createTestUser(t, app, "spammer", "password")
+
+		assert.False(t, addSpamScore(app, spammer.ID, 0))
+		assert.False(t, addSpamScore(app, spammer.ID, 4))
+		u, err := db.GetUserByID(spammer.ID)
+		assert.NoError(t, err)
+		assert.False(t, u.IsSilenced())
+
+		assert.True(t, addSpamScore(app, spammer.ID, 1))
+		u, err = db.GetUserByID(spammer.ID)
+		assert.NoError(t, err)
+		assert.True(t, u.IsSilenced())
+		assert.Equal(t, "5", db.GetUserAttribute(spammer.ID, userAttrSpamScore))
+		// Already silenced
+		assert.False(t, addSpamScore(app, spammer.ID, 1))
+
+		assert.False(t, addSpamScore(app, admin.ID, 10))
+		u, err = db.GetUserByID(admin.ID)
+		assert.NoError(t, err)
+		assert.False(t, u.IsSilenced())
+
+		// Scoring is off without a limit
+		app.cfg.Spam.SilenceScore = 0
+		other := createTestUser(t, app, "other", "password")
+		assert.False(t, addSpamScore(app, other.ID, 100))
+	})
+}
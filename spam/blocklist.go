@@ -0,0 +1,134 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package spam
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// Kinds of values a Blocklist can hold.
+const (
+	BlockDomain = "domain"
+	BlockEmail  = "email"
+	BlockIP     = "ip"
+)
+
+// Blocklist holds email domains, email addresses and IP ranges that aren't
+// allowed to sign up.
+type Blocklist struct {
+	domains map[string]bool
+	emails  map[string]bool
+	nets    []*net.IPNet
+}
+
+// NewBlocklist returns an empty Blocklist.
+func NewBlocklist() *Blocklist {
+	return &Blocklist{
+		domains: map[string]bool{},
+		emails:  map[string]bool{},
+	}
+}
+
+// NormalizeBlock validates a value of the given kind and returns it in the
+// form a Blocklist stores it: a lowercase domain, an email address cleaned
+// with CleanEmail, or an IP range in CIDR notation.
+func NormalizeBlock(kind, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch kind {
+	case BlockDomain:
+		d := strings.ToLower(strings.TrimPrefix(value, "@"))
+		if !strings.Contains(d, ".") || strings.ContainsAny(d, "@/ ") {
+			return "", errors.New("Domain isn't valid.")
+		}
+		return d, nil
+	case BlockEmail:
+		e := CleanEmail(value)
+		if e == "" {
+			return "", errors.New("Email address isn't valid.")
+		}
+		return e, nil
+	case BlockIP:
+		if _, n, err := net.ParseCIDR(value); err == nil {
+			return n.String(), nil
+		}
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return "", errors.New("IP address or range isn't valid.")
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
+	}
+	return "", errors.New("Unknown block type.")
+}
+
+// Add blocks the given value of the given kind.
+func (b *Blocklist) Add(kind, value string) error {
+	v, err := NormalizeBlock(kind, value)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case BlockDomain:
+		b.domains[v] = true
+	case BlockEmail:
+		b.emails[v] = true
+	case BlockIP:
+		_, n, _ := net.ParseCIDR(v)
+		b.nets = append(b.nets, n)
+	}
+	return nil
+}
+
+// BlocksEmail returns whether the given email address, or the domain it's at,
+// is blocked. Blocking a domain also blocks its subdomains.
+func (b *Blocklist) BlocksEmail(email string) bool {
+	e := CleanEmail(email)
+	if e == "" {
+		return false
+	}
+	if b.emails[e] {
+		return true
+	}
+	return domainListed(b.domains, e[strings.LastIndex(e, "@")+1:])
+}
+
+// BlocksIP returns whether the given IP address is in a blocked range.
+func (b *Blocklist) BlocksIP(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range b.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// domainListed returns whether the given domain or any of its parent domains
+// is in the given set.
+func domainListed(set map[string]bool, domain string) bool {
+	for {
+		if set[domain] {
+			return true
+		}
+		i := strings.IndexRune(domain, '.')
+		if i < 0 {
+			return false
+		}
+		domain = domain[i+1:]
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package spam
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBlocklist(t *testing.T) {
+	b := NewBlocklist()
+	for _, blk := range [][2]string{
+		{BlockDomain, "@Spam.example"},
+		{BlockEmail, "Bad.Actor+x@example.com"},
+		{BlockIP, "192.0.2.0/24"},
+		{BlockIP, "2001:db8::1"},
+	} {
+		if err := b.Add(blk[0], blk[1]); err != nil {
+			t.Fatalf("Add(%q, %q): %v", blk[0], blk[1], err)
+		}
+	}
+
+	emails := map[string]bool{
+		"someone@spam.example":      true,
+		"someone@mail.spam.example": true,
+		"someone@notspam.example":   false,
+		"badactor@example.com":      true,
+		"bad.actor+y@example.com":   true,
+		"good@example.com":          false,
+		"not an email":              false,
+	}
+	for e, want := range emails {
+		if got := b.BlocksEmail(e); got != want {
+			t.Errorf("BlocksEmail(%q) = %v, want %v", e, got, want)
+		}
+	}
+
+	ips := map[string]bool{
+		"192.0.2.55":  true,
+		"192.0.3.1":   false,
+		"2001:db8::1": true,
+		"2001:db8::2": false,
+		"":            false,
+	}
+	for ip, want := range ips {
+		if got := b.BlocksIP(ip); got != want {
+			t.Errorf("BlocksIP(%q) = %v, want %v", ip, got, want)
+		}
+	}
+
+	for _, blk := range [][2]string{
+		{BlockDomain, "localhost"},
+		{BlockEmail, "nobody"},
+		{BlockIP, "192.0.2"},
+		{"phone", "555-0100"},
+	} {
+		if _, err := NormalizeBlock(blk[0], blk[1]); err == nil {
+			t.Errorf("NormalizeBlock(%q, %q) should fail", blk[0], blk[1])
+		}
+	}
+}
+
+func TestIsDisposableEmail(t *testing.T) {
+	if !IsDisposableEmail("someone@Mailinator.com") {
+		t.Error("mailinator.com should be disposable")
+	}
+	if IsDisposableEmail("someone@example.com") {
+		t.Error("example.com shouldn't be disposable")
+	}
+}
+
+func TestLinkScore(t *testing.T) {
+	prose := strings.Repeat("word ", 100)
+	tests := []struct {
+		content string
+		want    int
+	}{
+		{prose, 0},
+		{prose + "https://example.com", 0},
+		{"Buy now https://example.com", linkHeavyScore},
+		{"https://a.example https://b.example https://c.example https://d.example", 2 + linkHeavyScore},
+	}
+	for _, test := range tests {
+		if got := LinkScore(test.content); got != test.want {
+			t.Errorf("LinkScore(%.30q) = %d, want %d", test.content, got, test.want)
+		}
+	}
+}
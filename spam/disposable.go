@@ -0,0 +1,51 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package spam
+
+import (
+	"bufio"
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+//go:embed disposable_domains.txt
+var disposableDomainsList string
+
+var (
+	disposableDomains     map[string]bool
+	disposableDomainsOnce sync.Once
+)
+
+// IsDisposableEmail returns whether the given email address is at a known
+// disposable email provider, according to the bundled list.
+func IsDisposableEmail(email string) bool {
+	disposableDomainsOnce.Do(loadDisposableDomains)
+
+	e := strings.ToLower(strings.TrimSpace(email))
+	i := strings.LastIndex(e, "@")
+	if i < 0 {
+		return false
+	}
+	return domainListed(disposableDomains, e[i+1:])
+}
+
+func loadDisposableDomains() {
+	disposableDomains = map[string]bool{}
+	s := bufio.NewScanner(strings.NewReader(disposableDomainsList))
+	for s.Scan() {
+		d := strings.TrimSpace(s.Text())
+		if d == "" || strings.HasPrefix(d, "#") {
+			continue
+		}
+		disposableDomains[strings.ToLower(d)] = true
+	}
+}
@@ -11,15 +11,68 @@
 package spam
 
 import (
+	"net"
 	"net/http"
 	"strings"
 )
 
-func GetIP(r *http.Request) string {
-	h := r.Header.Get("X-Forwarded-For")
-	if h == "" {
-		return ""
+// DefaultTrustedProxies are the proxies trusted to say who a request is from
+// when none are configured: only ones on the same machine.
+var DefaultTrustedProxies = []string{"127.0.0.0/8", "::1"}
+
+// ParseProxies parses a list of proxies' IP addresses and ranges.
+func ParseProxies(list []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, p := range list {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		cidr, err := NormalizeBlock(BlockIP, p)
+		if err != nil {
+			return nil, err
+		}
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ClientIP returns the IP address a request came from. The X-Forwarded-For
+// header is only believed when the request came through one of the given
+// trusted proxies, in which case the client is the last address in it that
+// isn't also a trusted proxy. Anyone else could put whatever they like there.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !isTrusted(ip, trusted) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrusted(ip, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+func isTrusted(ip string, trusted []*net.IPNet) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(addr) {
+			return true
+		}
 	}
-	ips := strings.Split(h, ",")
-	return strings.TrimSpace(ips[0])
+	return false
 }
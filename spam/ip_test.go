@@ -0,0 +1,52 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package spam
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseProxies([]string{"127.0.0.0/8", "::1", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		remote, xff, want string
+	}{
+		{"192.0.2.1:1234", "", "192.0.2.1"},
+		// Untrusted clients can't say they're someone else
+		{"192.0.2.1:1234", "198.51.100.1", "192.0.2.1"},
+		{"127.0.0.1:1234", "", "127.0.0.1"},
+		{"127.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"[::1]:1234", "2001:db8::1", "2001:db8::1"},
+		// Only the hops added by trusted proxies count
+		{"127.0.0.1:1234", "203.0.113.9, 198.51.100.1", "198.51.100.1"},
+		{"127.0.0.1:1234", "203.0.113.9, 198.51.100.1, 10.1.2.3", "198.51.100.1"},
+		{"127.0.0.1:1234", "10.1.2.3", "10.1.2.3"},
+		{"127.0.0.1:1234", "junk, 198.51.100.1", "198.51.100.1"},
+		{"127.0.0.1:1234", "junk", "127.0.0.1"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.remote
+		if tc.xff != "" {
+			r.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		if got := ClientIP(r, trusted); got != tc.want {
+			t.Errorf("ClientIP(%s, %q) = %s, want %s", tc.remote, tc.xff, got, tc.want)
+		}
+	}
+
+	if _, err = ParseProxies([]string{"nope"}); err == nil {
+		t.Error("ParseProxies should reject invalid addresses")
+	}
+}
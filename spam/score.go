@@ -0,0 +1,51 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package spam
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	// freeLinks is how many links a post can have before each one counts
+	// against it.
+	freeLinks = 2
+
+	// wordsPerLink is the least text we expect to go with each link. Posts
+	// with less are mostly links.
+	wordsPerLink = 25
+
+	// linkHeavyScore is what a post that's mostly links scores.
+	linkHeavyScore = 3
+)
+
+var linkReg = regexp.MustCompile(`https?://[^\s<>"'()\[\]]+`)
+
+// LinkScore rates how much a post's content looks like link spam. Posts
+// without links score 0; each link past the first few scores a point, and
+// posts that are mostly links score a few more.
+func LinkScore(content string) int {
+	links := len(linkReg.FindAllStringIndex(content, -1))
+	if links == 0 {
+		return 0
+	}
+
+	score := 0
+	if links > freeLinks {
+		score += links - freeLinks
+	}
+	words := len(strings.Fields(linkReg.ReplaceAllString(content, " ")))
+	if words < links*wordsPerLink {
+		score += linkHeavyScore
+	}
+	return score
+}
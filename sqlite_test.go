@@ -0,0 +1,41 @@
+//go:build sqlite && !wflib
+// +build sqlite,!wflib
+
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/writefreely/writefreely/config"
+)
+
+// newSQLiteTestDatastore returns a datastore for a new SQLite database with
+// the full schema, which is removed when the test finishes.
+func newSQLiteTestDatastore(t *testing.T) *datastore {
+	db, err := sql.Open("sqlite3_with_regex", filepath.Join(t.TempDir(), "test.db")+"?parseTime=true&_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	app := &App{cfg: config.New(), db: &datastore{DB: db, driverName: driverSQLite}}
+	app.cfg.UseSQLite(true)
+	if err = adminInitDatabase(app); err != nil {
+		t.Fatal(err)
+	}
+	return app.db
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+// Passkeys talks to the browser's WebAuthn API and the passkey endpoints,
+// which send binary data as unpadded base64url.
+var Passkeys = {
+	supported: function() {
+		return !!(window.PublicKeyCredential && navigator.credentials);
+	},
+
+	decode: function(s) {
+		s = s.replace(/-/g, '+').replace(/_/g, '/');
+		while (s.length % 4) {
+			s += '=';
+		}
+		var bin = atob(s);
+		var buf = new Uint8Array(bin.length);
+		for (var i=0; i<bin.length; i++) {
+			buf[i] = bin.charCodeAt(i);
+		}
+		return buf;
+	},
+
+	encode: function(buf) {
+		if (!buf) {
+			return '';
+		}
+		var bytes = new Uint8Array(buf);
+		var bin = '';
+		for (var i=0; i<bytes.length; i++) {
+			bin += String.fromCharCode(bytes[i]);
+		}
+		return btoa(bin).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+	},
+
+	post: function(url, body, csrfToken) {
+		var headers = {'Content-Type': 'application/json'};
+		if (csrfToken) {
+			headers['X-CSRF-Token'] = csrfToken;
+		}
+		return fetch(url, {
+			method: 'POST',
+			credentials: 'same-origin',
+			headers: headers,
+			body: JSON.stringify(body || {})
+		}).then(function(res) {
+			return res.json().catch(function() {
+				return {};
+			}).then(function(data) {
+				if (!res.ok) {
+					throw new Error(data.error_msg || 'Something went wrong. Please try again.');
+				}
+				return data.data;
+			});
+		});
+	},
+
+	descriptors: function(list) {
+		return (list || []).map(function(c) {
+			return {type: c.type, id: Passkeys.decode(c.id)};
+		});
+	},
+
+	// register creates a new passkey for the logged-in user.
+	register: function(beginURL, finishURL, name, csrfToken) {
+		return Passkeys.post(beginURL, {}, csrfToken).then(function(opts) {
+			opts.challenge = Passkeys.decode(opts.challenge);
+			opts.user.id = Passkeys.decode(opts.user.id);
+			opts.excludeCredentials = Passkeys.descriptors(opts.excludeCredentials);
+			return navigator.credentials.create({publicKey: opts});
+		}).then(function(cred) {
+			return Passkeys.post(finishURL, {
+				name: name,
+				credential: {
+					id: Passkeys.encode(cred.rawId),
+					clientDataJSON: Passkeys.encode(cred.response.clientDataJSON),
+					attestationObject: Passkeys.encode(cred.response.attestationObject)
+				}
+			}, csrfToken);
+		});
+	},
+
+	// login signs in with a passkey, returning where to go next.
+	login: function(beginURL, finishURL, to) {
+		return Passkeys.post(beginURL).then(function(opts) {
+			opts.challenge = Passkeys.decode(opts.challenge);
+			opts.allowCredentials = Passkeys.descriptors(opts.allowCredentials);
+			return navigator.credentials.get({publicKey: opts});
+		}).then(function(cred) {
+			return Passkeys.post(finishURL, {
+				to: to,
+				credential: {
+					id: Passkeys.encode(cred.rawId),
+					clientDataJSON: Passkeys.encode(cred.response.clientDataJSON),
+					authenticatorData: Passkeys.encode(cred.response.authenticatorData),
+					signature: Passkeys.encode(cred.response.signature),
+					userHandle: Passkeys.encode(cred.response.userHandle)
+				}
+			});
+		}).then(function(data) {
+			return data.redirect;
+		});
+	}
+};
@@ -0,0 +1,390 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/writeas/impart"
+	"github.com/writeas/web-core/auth"
+	"github.com/writeas/web-core/log"
+)
+
+// tokenScope is a permission that a personal access token can be granted.
+type tokenScope string
+
+const (
+	scopeReadPosts         tokenScope = "read_posts"
+	scopeWritePosts        tokenScope = "write_posts"
+	scopeManageCollections tokenScope = "manage_collections"
+	scopeReadStats         tokenScope = "read_stats"
+	scopeAdmin             tokenScope = "admin"
+
+	// scopeAny marks routes that any access token can use.
+	scopeAny tokenScope = "*"
+)
+
+const maxTokenNameLen = 100
+
+// maxTokenValidDays is the longest a personal access token can be valid for.
+const maxTokenValidDays = 3650
+
+// TokenScopeOption describes a scope that users can grant to a token.
+type TokenScopeOption struct {
+	Scope       tokenScope
+	Label       string
+	Description string
+	AdminOnly   bool
+}
+
+var tokenScopeOptions = []TokenScopeOption{
+	{scopeReadPosts, "Read posts", "View your posts, drafts and blogs", false},
+	{scopeWritePosts, "Write posts", "Create, edit, move and delete posts", false},
+	{scopeManageCollections, "Manage blogs", "Create, change and delete blogs", false},
+	{scopeReadStats, "Read stats", "View your blogs' statistics", false},
+	{scopeAdmin, "Admin", "Use admin API endpoints", true},
+}
+
+func parseScope(s string) (tokenScope, bool) {
+	for _, o := range tokenScopeOptions {
+		if string(o.Scope) == s {
+			return o.Scope, true
+		}
+	}
+	return "", false
+}
+
+func joinScopes(scopes []tokenScope) string {
+	strs := make([]string, len(scopes))
+	for i, s := range scopes {
+		strs[i] = string(s)
+	}
+	return strings.Join(strs, ",")
+}
+
+func splitScopes(s string) []tokenScope {
+	var scopes []tokenScope
+	for _, str := range strings.Split(s, ",") {
+		if str != "" {
+			scopes = append(scopes, tokenScope(str))
+		}
+	}
+	return scopes
+}
+
+func hasScope(scopes []tokenScope, s tokenScope) bool {
+	if s == scopeAny {
+		return true
+	}
+	for _, have := range scopes {
+		if have == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Scope sets the scope an access token needs to use the given route. Routes
+// without one can't be used with scoped tokens at all.
+func (h *Handler) Scope(s tokenScope, route *mux.Route) *mux.Route {
+	h.scopes[route] = s
+	return route
+}
+
+// EnforceScopes is middleware that stops scoped access tokens from being used
+// on routes they don't have the scope for. Tokens without scopes, like those
+// given out when logging in through the API, can be used anywhere. That
+// includes every token created before scopes existed, which keep the full
+// access they were given until they're revoked.
+func (h *Handler) EnforceScopes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := r.Header.Get("Authorization")
+		if t == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		scopes, scoped := h.app.App().db.GetAccessTokenScopes(t)
+		if !scoped {
+			next.ServeHTTP(w, r)
+			return
+		}
+		need, ok := h.scopes[mux.CurrentRoute(r)]
+		if !ok {
+			impart.WriteError(w, impart.HTTPError{http.StatusForbidden, "This access token can't be used here."})
+			return
+		}
+		if !hasScope(scopes, need) {
+			impart.WriteError(w, impart.HTTPError{http.StatusForbidden, fmt.Sprintf("This access token needs the %s scope.", need)})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetAccessTokenScopes returns the scopes granted to the given access token,
+// and whether it has any. Tokens that don't exist have none.
+func (db *datastore) GetAccessTokenScopes(accessToken string) ([]tokenScope, bool) {
+	t := auth.GetToken(accessToken)
+	if len(t) == 0 {
+		return nil, false
+	}
+
+	var scopes sql.NullString
+	err := db.QueryRow("SELECT scopes FROM accesstokens WHERE token LIKE ? AND (expires IS NULL OR expires > "+db.now()+")", t).Scan(&scopes)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, false
+	case err != nil:
+		log.Error("Couldn't SELECT accesstoken scopes: %v", err)
+		return nil, false
+	}
+	if !scopes.Valid {
+		return nil, false
+	}
+	return splitScopes(scopes.String), true
+}
+
+// CreatePersonalAccessToken creates a new named access token with the given
+// scopes for the given user. If validDays is 0, it doesn't expire. It's valid
+// for at most maxTokenValidDays.
+func (db *datastore) CreatePersonalAccessToken(userID int64, name string, scopes []tokenScope, validDays int) (string, error) {
+	if validDays > maxTokenValidDays {
+		validDays = maxTokenValidDays
+	}
+	return db.createAccessToken(userID, accessTokenOpts{
+		validSecs: validDays * day,
+		name:      name,
+		scopes:    scopes,
+	})
+}
+
+// personalTokenRequest is a request to create a personal access token.
+type personalTokenRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn int      `json:"expires_in"`
+}
+
+type personalTokenResponse struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Scopes      []string   `json:"scopes"`
+	Created     time.Time  `json:"created"`
+	Expires     *time.Time `json:"expires"`
+	LastUsed    *time.Time `json:"last_used"`
+	AccessToken string     `json:"access_token,omitempty"`
+}
+
+// createPersonalToken validates the given request and creates a token for it,
+// returning the new token and the scopes it was given.
+func createPersonalToken(app *App, u *User, req *personalTokenRequest) (string, []tokenScope, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return "", nil, impart.HTTPError{http.StatusBadRequest, "Give your token a name."}
+	}
+	if len(req.Name) > maxTokenNameLen {
+		return "", nil, impart.HTTPError{http.StatusBadRequest, fmt.Sprintf("Token name must be %d characters or less.", maxTokenNameLen)}
+	}
+	if req.ExpiresIn < 0 {
+		return "", nil, impart.HTTPError{http.StatusBadRequest, "Expiry must be a number of days, or 0 to never expire."}
+	}
+	if req.ExpiresIn > maxTokenValidDays {
+		req.ExpiresIn = maxTokenValidDays
+	}
+
+	var scopes []tokenScope
+	for _, str := range req.Scopes {
+		s, ok := parseScope(str)
+		if !ok {
+			return "", nil, impart.HTTPError{http.StatusBadRequest, fmt.Sprintf("Unknown scope %q.", str)}
+		}
+		if s == scopeAdmin {
+			fullUser, err := app.db.GetUserByID(u.ID)
+			if err != nil {
+				return "", nil, err
+			}
+			if !fullUser.IsAdmin() {
+				return "", nil, impart.HTTPError{http.StatusForbidden, "Only admins can create tokens with the admin scope."}
+			}
+			if adminNeedsTwoFactor(app, fullUser) {
+				return "", nil, impart.HTTPError{http.StatusForbidden, "Set up two-factor authentication before creating tokens with the admin scope."}
+			}
+		}
+		if !hasScope(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(scopes) == 0 {
+		return "", nil, impart.HTTPError{http.StatusBadRequest, "Choose at least one scope."}
+	}
+
+	t, err := app.db.CreatePersonalAccessToken(u.ID, req.Name, scopes, req.ExpiresIn)
+	if err != nil {
+		return "", nil, impart.HTTPError{http.StatusInternalServerError, "Couldn't create access token."}
+	}
+	return t, scopes, nil
+}
+
+func fetchPersonalTokens(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	tokens, err := app.db.GetUserTokens(u.ID)
+	if err != nil {
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to retrieve access tokens."}
+	}
+	res := []personalTokenResponse{}
+	for _, t := range tokens {
+		if len(t.Scopes) == 0 {
+			continue
+		}
+		res = append(res, personalTokenResponse{
+			ID:       t.ID,
+			Name:     t.Name,
+			Scopes:   t.Scopes,
+			Created:  t.Created,
+			Expires:  t.Expires,
+			LastUsed: t.LastUsed,
+		})
+	}
+	return impart.WriteSuccess(w, res, http.StatusOK)
+}
+
+func handleCreatePersonalToken(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	req := &personalTokenRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		return ErrBadJSON
+	}
+
+	t, scopes, err := createPersonalToken(app, u, req)
+	if err != nil {
+		return err
+	}
+
+	res := personalTokenResponse{
+		Name:        req.Name,
+		Scopes:      strings.Split(joinScopes(scopes), ","),
+		Created:     time.Now().UTC(),
+		AccessToken: t,
+	}
+	if tok := auth.GetToken(t); len(tok) > 0 {
+		res.ID = accessTokenID(tok)
+	}
+	if req.ExpiresIn > 0 {
+		exp := res.Created.Add(time.Duration(req.ExpiresIn) * 24 * time.Hour)
+		res.Expires = &exp
+	}
+	return impart.WriteSuccess(w, res, http.StatusCreated)
+}
+
+func handleDeletePersonalToken(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	err := app.db.DeleteUserToken(u.ID, mux.Vars(r)["token"])
+	if err != nil {
+		if herr, ok := err.(impart.HTTPError); ok {
+			return herr
+		}
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to revoke token."}
+	}
+	return impart.HTTPError{Status: http.StatusNoContent}
+}
+
+// handleWebCreatePersonalToken creates a token from the Sessions & Tokens
+// page, showing it to the user once.
+func handleWebCreatePersonalToken(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	err := r.ParseForm()
+	if err != nil {
+		return impart.HTTPError{http.StatusBadRequest, "Unable to parse form."}
+	}
+	req := &personalTokenRequest{
+		Name:   r.FormValue("name"),
+		Scopes: r.Form["scope"],
+	}
+	req.ExpiresIn, _ = strconv.Atoi(r.FormValue("expires_in"))
+
+	t, _, err := createPersonalToken(app, u, req)
+	if err != nil {
+		if herr, ok := err.(impart.HTTPError); ok && herr.Status < http.StatusInternalServerError {
+			_ = addSessionFlash(app, w, r, herr.Message, nil)
+			return impart.HTTPError{http.StatusFound, "/me/settings/sessions"}
+		}
+		return err
+	}
+
+	_ = addSessionFlash(app, w, r, fmt.Sprintf("Created token %q. Copy it now, since it won't be shown again: %s", req.Name, t), nil)
+	return impart.HTTPError{http.StatusFound, "/me/settings/sessions"}
+}
+
+// CollectionStats is the API representation of a blog's statistics.
+type CollectionStats struct {
+	TopPosts         *[]PublicPost `json:"top_posts"`
+	APFollowers      *int          `json:"ap_followers,omitempty"`
+	EmailSubscribers *int          `json:"email_subscribers,omitempty"`
+}
+
+func fetchCollectionStats(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	c, err := app.db.GetCollection(mux.Vars(r)["alias"])
+	if err != nil {
+		return err
+	}
+	if c.OwnerID != u.ID {
+		return ErrCollectionNotFound
+	}
+	c.hostName = app.cfg.App.Host
+
+	res := &CollectionStats{}
+	res.TopPosts, err = app.db.GetTopPosts(u, c.Alias, c.hostName)
+	if err != nil {
+		log.Error("Unable to get top posts: %v", err)
+		return err
+	}
+	if app.cfg.App.Federation {
+		folls, err := app.db.GetAPFollowers(c)
+		if err != nil {
+			return err
+		}
+		n := len(*folls)
+		res.APFollowers = &n
+	}
+	if app.cfg.Email.Enabled() {
+		subs, err := app.db.GetEmailSubscribers(c.ID, true)
+		if err != nil {
+			return err
+		}
+		n := len(subs)
+		res.EmailSubscribers = &n
+	}
+	return impart.WriteSuccess(w, res, http.StatusOK)
+}
+
+func fetchAdminUsers(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	fullUser, err := app.db.GetUserByID(u.ID)
+	if err != nil {
+		return err
+	}
+	if !fullUser.IsAdmin() {
+		return impart.HTTPError{http.StatusForbidden, "Only admins can do that."}
+	}
+
+	page, err := strconv.Atoi(r.FormValue("p"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	users, err := app.db.GetAllUsers(uint(page))
+	if err != nil {
+		return err
+	}
+	return impart.WriteSuccess(w, users, http.StatusOK)
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestTokenScopes(t *testing.T) {
+	scopes := splitScopes(joinScopes([]tokenScope{scopeReadPosts, scopeReadStats}))
+	if len(scopes) != 2 {
+		t.Fatalf("expected 2 scopes, got %v", scopes)
+	}
+
+	tests := []struct {
+		need tokenScope
+		want bool
+	}{
+		{scopeReadPosts, true},
+		{scopeReadStats, true},
+		{scopeWritePosts, false},
+		{scopeAdmin, false},
+		{scopeAny, true},
+	}
+	for _, tt := range tests {
+		if got := hasScope(scopes, tt.need); got != tt.want {
+			t.Errorf("hasScope(%v, %s) = %t, want %t", scopes, tt.need, got, tt.want)
+		}
+	}
+
+	if len(splitScopes("")) != 0 {
+		t.Error("expected no scopes from empty string")
+	}
+	if _, ok := parseScope("everything"); ok {
+		t.Error("expected unknown scope to be rejected")
+	}
+}
+
+func TestEnforceScopes(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		u := createTestUser(t, app, "alice", "password")
+
+		h := NewHandler(app)
+		r := mux.NewRouter()
+		r.Use(h.EnforceScopes)
+		ok := func(w http.ResponseWriter, r *http.Request) {}
+		h.Scope(scopeReadPosts, r.HandleFunc("/read", ok))
+		h.Scope(scopeWritePosts, r.HandleFunc("/write", ok))
+		h.Scope(scopeAny, r.HandleFunc("/any", ok))
+		r.HandleFunc("/unscoped", ok)
+
+		readToken, err := db.CreatePersonalAccessToken(u.ID, "reader", []tokenScope{scopeReadPosts}, 0)
+		if err != nil {
+			t.Fatalf("create token: %v", err)
+		}
+		// Tokens from logging in, and from before scopes existed, have none
+		fullToken, err := db.GetAccessToken(u.ID)
+		if err != nil {
+			t.Fatalf("get token: %v", err)
+		}
+
+		tests := []struct {
+			token string
+			path  string
+			want  int
+		}{
+			{readToken, "/read", http.StatusOK},
+			{readToken, "/write", http.StatusForbidden},
+			{readToken, "/any", http.StatusOK},
+			{readToken, "/unscoped", http.StatusForbidden},
+			{fullToken, "/read", http.StatusOK},
+			{fullToken, "/write", http.StatusOK},
+			{fullToken, "/unscoped", http.StatusOK},
+			{"", "/write", http.StatusOK},
+		}
+		for _, tt := range tests {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("GET %s with token %q: got %d, want %d", tt.path, tt.token, rr.Code, tt.want)
+			}
+		}
+	})
+}
+
+func TestCreatePersonalAccessTokenExpiry(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		u := createTestUser(t, app, "alice", "password")
+
+		_, err := db.CreatePersonalAccessToken(u.ID, "forever", []tokenScope{scopeReadPosts}, math.MaxInt32)
+		if err != nil {
+			t.Fatalf("create token: %v", err)
+		}
+		tokens, err := db.GetUserTokens(u.ID)
+		if err != nil {
+			t.Fatalf("get tokens: %v", err)
+		}
+		if len(tokens) != 1 || tokens[0].Expires == nil {
+			t.Fatalf("expected one expiring token, got %+v", tokens)
+		}
+		max := time.Now().Add(maxTokenValidDays * 24 * time.Hour)
+		if d := tokens[0].Expires.Sub(max); d > time.Hour || d < -time.Hour {
+			t.Errorf("expected token to expire around %s, got %s", max, tokens[0].Expires)
+		}
+	})
+}
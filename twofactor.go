@@ -0,0 +1,744 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/sessions"
+	"github.com/writeas/impart"
+	"github.com/writeas/web-core/data"
+	"github.com/writeas/web-core/log"
+	"github.com/writefreely/writefreely/page"
+	"github.com/writefreely/writefreely/qr"
+)
+
+const (
+	// TOTP parameters, per RFC 6238. These are the defaults every
+	// authenticator app understands.
+	totpPeriod    = 30
+	totpDigits    = 6
+	totpSkew      = 1
+	totpSecretLen = 20
+
+	recoveryCodeCount = 10
+	recoveryCodeLen   = 10
+
+	// How long a user has to enter their code after their password
+	twoFactorLoginExpiration = 5 * time.Minute
+
+	// Incorrect codes allowed per user before they have to wait
+	twoFactorMaxFailures   = 5
+	twoFactorFailurePeriod = 5 * time.Minute
+)
+
+var (
+	errTwoFactorThrottled = impart.HTTPError{http.StatusTooManyRequests, "Too many incorrect codes. Please wait a few minutes and try again."}
+
+	totpEncoding     = base32.StdEncoding.WithPadding(base32.NoPadding)
+	recoveryEncoding = base32.NewEncoding("abcdefghijkmnpqrstuvwxyz23456789").WithPadding(base32.NoPadding)
+)
+
+// userTwoFactor is a user's TOTP enrollment. It's created when they start
+// setting up two-factor auth and enabled once they confirm a code.
+type userTwoFactor struct {
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+}
+
+// pendingTwoFactor is kept in the session between a successful password
+// check and the second login step.
+type pendingTwoFactor struct {
+	UserID  int64
+	To      string
+	Expires time.Time
+}
+
+type twoFactorFailures struct {
+	count int
+	reset time.Time
+}
+
+var (
+	twoFactorFailuresMu    sync.Mutex
+	twoFactorFailedUsers   = map[int64]*twoFactorFailures{}
+	twoFactorFailuresSwept time.Time
+)
+
+func newTOTPSecret() (string, error) {
+	b := make([]byte, totpSecretLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// totpCode returns the code for the given secret at the given time step.
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, v%1000000)
+}
+
+// totpMatch returns the time step that code is valid for, allowing for a
+// little clock drift, or -1 if it isn't valid.
+func totpMatch(secret, code string, t time.Time) int64 {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return -1
+	}
+	cur := t.Unix() / totpPeriod
+	for step := cur - totpSkew; step <= cur+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return -1
+}
+
+// totpURI returns the otpauth:// URI that authenticator apps scan.
+func totpURI(app *App, u *User, secret string) string {
+	issuer := app.cfg.App.SiteName
+	if issuer == "" {
+		issuer = app.cfg.App.Host
+	}
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+u.Username) + "?" + v.Encode()
+}
+
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	b := make([]byte, 8)
+	for i := range codes {
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		c := recoveryEncoding.EncodeToString(b)[:recoveryCodeLen]
+		codes[i] = c[:recoveryCodeLen/2] + "-" + c[recoveryCodeLen/2:]
+	}
+	return codes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	h := sha256.Sum256([]byte(normalizeTwoFactorCode(code)))
+	return hex.EncodeToString(h[:])
+}
+
+func normalizeTwoFactorCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyTwoFactorCode checks an authenticator or recovery code for a user
+// who has two-factor auth enabled. Each code only works once.
+func verifyTwoFactorCode(app *App, userID int64, code string) (bool, error) {
+	if !reserveTwoFactorAttempt(userID) {
+		return false, errTwoFactorThrottled
+	}
+
+	code = normalizeTwoFactorCode(code)
+	var ok bool
+	if isTOTPCode(code) {
+		tf, err := app.db.GetUserTwoFactor(userID, app.keys.EmailKey)
+		if err != nil {
+			return false, err
+		}
+		if tf != nil && tf.Enabled {
+			if step := totpMatch(tf.Secret, code, time.Now()); step > tf.LastUsedStep {
+				ok, err = app.db.UseTwoFactorStep(userID, step)
+				if err != nil {
+					return false, err
+				}
+			}
+		}
+	} else if code != "" {
+		var err error
+		ok, err = app.db.UseRecoveryCode(userID, hashRecoveryCode(code))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if ok {
+		twoFactorFailuresMu.Lock()
+		delete(twoFactorFailedUsers, userID)
+		twoFactorFailuresMu.Unlock()
+	}
+	return ok, nil
+}
+
+// reserveTwoFactorAttempt counts an attempt at a user's second factor as a
+// failure until it succeeds, so that parallel guesses can't get past the
+// limit. It returns false once the user has failed too many times.
+func reserveTwoFactorAttempt(userID int64) bool {
+	now := time.Now()
+
+	twoFactorFailuresMu.Lock()
+	defer twoFactorFailuresMu.Unlock()
+	if now.Sub(twoFactorFailuresSwept) > time.Hour {
+		for id, f := range twoFactorFailedUsers {
+			if now.After(f.reset) {
+				delete(twoFactorFailedUsers, id)
+			}
+		}
+		twoFactorFailuresSwept = now
+	}
+
+	f := twoFactorFailedUsers[userID]
+	if f == nil || now.After(f.reset) {
+		f = &twoFactorFailures{reset: now.Add(twoFactorFailurePeriod)}
+		twoFactorFailedUsers[userID] = f
+	}
+	if f.count >= twoFactorMaxFailures {
+		return false
+	}
+	f.count++
+	return true
+}
+
+// checkTwoFactorLogin verifies the code an API client sent along with a
+// user's credentials.
+func checkTwoFactorLogin(app *App, u *User, code string) error {
+	if code == "" {
+		return ErrTwoFactorRequired
+	}
+	ok, err := verifyTwoFactorCode(app, u.ID, code)
+	if err != nil {
+		if herr, isHTTP := err.(impart.HTTPError); isHTTP {
+			return herr
+		}
+		log.Error("Login: Unable to verify two-factor code: %v", err)
+		return ErrInternalGeneral
+	}
+	if !ok {
+		return ErrBadTwoFactorCode
+	}
+	return nil
+}
+
+// startTwoFactorLogin remembers a user who has entered their password, and
+// sends them on to enter their second factor.
+func startTwoFactorLogin(app *App, w http.ResponseWriter, r *http.Request, u *User, redirectTo string) error {
+	session, err := app.sessionStore.Get(r, cookieName)
+	if err != nil {
+		log.Error("Login: Session: %v; ignoring", err)
+	}
+	session.Values[cookieTwoFactorVal] = &pendingTwoFactor{
+		UserID:  u.ID,
+		To:      redirectTo,
+		Expires: time.Now().Add(twoFactorLoginExpiration),
+	}
+	err = session.Save(r, w)
+	if err != nil {
+		log.Error("Login: Couldn't save session: %v", err)
+		return ErrInternalCookieSession
+	}
+
+	log.Info("Login: Asking user %d for a second factor", u.ID)
+	w.Header().Set("Location", "/login/2fa")
+	w.WriteHeader(http.StatusFound)
+	return nil
+}
+
+func getPendingTwoFactor(session *sessions.Session) *pendingTwoFactor {
+	if session == nil {
+		return nil
+	}
+	p, ok := session.Values[cookieTwoFactorVal].(*pendingTwoFactor)
+	if !ok || time.Now().After(p.Expires) {
+		return nil
+	}
+	return p
+}
+
+func viewLoginTwoFactor(app *App, w http.ResponseWriter, r *http.Request) error {
+	session, err := app.sessionStore.Get(r, cookieName)
+	if err != nil {
+		log.Error("Unable to get session; ignoring: %v", err)
+	}
+	if getPendingTwoFactor(session) == nil {
+		return impart.HTTPError{http.StatusFound, "/login"}
+	}
+
+	p := &struct {
+		page.StaticPage
+		Flashes     []template.HTML
+		CSRFField   template.HTML
+		HasPasskeys bool
+	}{
+		StaticPage: pageForReq(app, r),
+		CSRFField:  csrf.TemplateField(r),
+	}
+	if n, err := app.db.CountUserPasskeys(getPendingTwoFactor(session).UserID); err != nil {
+		log.Error("Unable to count passkeys: %v", err)
+	} else {
+		p.HasPasskeys = n > 0
+	}
+	flashes, _ := getSessionFlashes(app, w, r, session)
+	for _, flash := range flashes {
+		p.Flashes = append(p.Flashes, template.HTML(flash))
+	}
+	err = pages["login-2fa.tmpl"].ExecuteTemplate(w, "base", p)
+	if err != nil {
+		log.Error("Unable to render two-factor login: %v", err)
+		return err
+	}
+	return nil
+}
+
+func handleLoginTwoFactor(app *App, w http.ResponseWriter, r *http.Request) error {
+	session, err := app.sessionStore.Get(r, cookieName)
+	if err != nil {
+		log.Error("Login: Session: %v; ignoring", err)
+	}
+	pending := getPendingTwoFactor(session)
+	if pending == nil {
+		_ = addSessionFlash(app, w, r, "Your login expired. Please try again.", session)
+		return impart.HTTPError{http.StatusFound, "/login"}
+	}
+
+	ok, err := verifyTwoFactorCode(app, pending.UserID, r.FormValue("code"))
+	if err != nil {
+		herr, isHTTP := err.(impart.HTTPError)
+		if !isHTTP {
+			log.Error("Login: Unable to verify two-factor code: %v", err)
+			return ErrInternalGeneral
+		}
+		// Make them start over
+		delete(session.Values, cookieTwoFactorVal)
+		_ = addSessionFlash(app, w, r, herr.Message, session)
+		return impart.HTTPError{http.StatusFound, "/login"}
+	}
+	if !ok {
+		_ = addSessionFlash(app, w, r, ErrBadTwoFactorCode.Message, session)
+		return impart.HTTPError{http.StatusFound, "/login/2fa"}
+	}
+
+	err = finishTwoFactorLogin(app, w, r, session, pending)
+	if err != nil {
+		return err
+	}
+	log.Info("Login: Redirecting to %s", pending.To)
+	return impart.HTTPError{http.StatusFound, pending.To}
+}
+
+// finishTwoFactorLogin logs in a user who has passed their second step.
+func finishTwoFactorLogin(app *App, w http.ResponseWriter, r *http.Request, session *sessions.Session, pending *pendingTwoFactor) error {
+	u, err := app.db.GetUserByID(pending.UserID)
+	if err != nil {
+		log.Error("Login: Unable to fetch user %d after two-factor: %v", pending.UserID, err)
+		return ErrInternalGeneral
+	}
+	if err = restoreAccount(app, w, r, u); err != nil {
+		return err
+	}
+	delete(session.Values, cookieTwoFactorVal)
+	session.Values[cookieUserVal] = u.Cookie()
+	err = session.Save(r, w)
+	if err != nil {
+		log.Error("Login: Couldn't save session: %v", err)
+		return ErrInternalCookieSession
+	}
+	return nil
+}
+
+// adminNeedsTwoFactor returns whether the given admin has to set up
+// two-factor auth before they can use admin functions.
+func adminNeedsTwoFactor(app *App, u *User) bool {
+	if !app.cfg.App.AdminsRequire2FA {
+		return false
+	}
+	enabled, err := app.db.IsTwoFactorEnabled(u.ID)
+	if err != nil {
+		log.Error("Unable to check two-factor auth for user %d: %v", u.ID, err)
+		return true
+	}
+	return !enabled
+}
+
+func viewTwoFactorSettings(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	return showTwoFactorSettings(app, u, w, r, nil)
+}
+
+// showTwoFactorSettings renders the two-factor settings page, starting
+// enrollment if the user hasn't yet. New recovery codes are only ever shown
+// here, right after they're created.
+func showTwoFactorSettings(app *App, u *User, w http.ResponseWriter, r *http.Request, recoveryCodes []string) error {
+	tf, err := app.db.GetUserTwoFactor(u.ID, app.keys.EmailKey)
+	if err != nil {
+		log.Error("Unable to get two-factor auth: %v", err)
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to retrieve two-factor settings."}
+	}
+	if tf == nil {
+		secret, err := newTOTPSecret()
+		if err != nil {
+			return err
+		}
+		err = app.db.SetPendingTwoFactor(u.ID, secret, app.keys.EmailKey)
+		if err != nil {
+			log.Error("Unable to start two-factor enrollment: %v", err)
+			return impart.HTTPError{http.StatusInternalServerError, "Unable to start two-factor setup."}
+		}
+		tf = &userTwoFactor{Secret: secret}
+	}
+
+	flashes, _ := getSessionFlashes(app, w, r, nil)
+	p := struct {
+		*UserPage
+		Enabled           bool
+		Required          bool
+		Secret            string
+		QRCode            template.HTML
+		RecoveryCodes     []string
+		RecoveryCodesLeft int
+		CSRFField         template.HTML
+	}{
+		UserPage:      NewUserPage(app, r, u, "Two-Factor Authentication", flashes),
+		Enabled:       tf.Enabled,
+		Required:      u.IsAdmin() && app.cfg.App.AdminsRequire2FA,
+		RecoveryCodes: recoveryCodes,
+		CSRFField:     csrf.TemplateField(r),
+	}
+	if tf.Enabled {
+		p.RecoveryCodesLeft, err = app.db.CountRecoveryCodes(u.ID)
+		if err != nil {
+			log.Error("Unable to count recovery codes: %v", err)
+		}
+	} else {
+		// Group the secret for anyone typing it in by hand
+		for i := 0; i < len(tf.Secret); i += 4 {
+			p.Secret += tf.Secret[i:min(i+4, len(tf.Secret))] + " "
+		}
+		p.Secret = strings.TrimSpace(p.Secret)
+
+		code, err := qr.Encode([]byte(totpURI(app, u, tf.Secret)))
+		if err != nil {
+			log.Error("Unable to generate QR code: %v", err)
+		} else {
+			p.QRCode = template.HTML(code.SVG(4, 4))
+		}
+	}
+
+	showUserPage(w, "twofactor", p)
+	return nil
+}
+
+func handleEnableTwoFactor(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	tf, err := app.db.GetUserTwoFactor(u.ID, app.keys.EmailKey)
+	if err != nil {
+		log.Error("Unable to get two-factor auth: %v", err)
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to enable two-factor auth."}
+	}
+	if tf == nil || tf.Enabled {
+		return impart.HTTPError{http.StatusFound, "/me/settings/2fa"}
+	}
+
+	step := totpMatch(tf.Secret, normalizeTwoFactorCode(r.FormValue("code")), time.Now())
+	if step < 0 {
+		_ = addSessionFlash(app, w, r, "That code didn't work. Make sure your device's clock is correct and try again.", nil)
+		return impart.HTTPError{http.StatusFound, "/me/settings/2fa"}
+	}
+
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	err = app.db.EnableTwoFactor(u.ID, step, codes)
+	if err != nil {
+		log.Error("Unable to enable two-factor auth: %v", err)
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to enable two-factor auth."}
+	}
+	log.Info("User %d enabled two-factor auth", u.ID)
+
+	return showTwoFactorSettings(app, u, w, r, codes)
+}
+
+func handleRegenerateRecoveryCodes(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	if err := checkTwoFactorSettingsCode(app, u, w, r); err != nil {
+		return err
+	}
+
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	err = app.db.ReplaceRecoveryCodes(u.ID, codes)
+	if err != nil {
+		log.Error("Unable to replace recovery codes: %v", err)
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to create new recovery codes."}
+	}
+
+	return showTwoFactorSettings(app, u, w, r, codes)
+}
+
+func handleDisableTwoFactor(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	if u.IsAdmin() && app.cfg.App.AdminsRequire2FA {
+		_ = addSessionFlash(app, w, r, "Admins are required to use two-factor authentication on this instance.", nil)
+		return impart.HTTPError{http.StatusFound, "/me/settings/2fa"}
+	}
+	if err := checkTwoFactorSettingsCode(app, u, w, r); err != nil {
+		return err
+	}
+
+	err := app.db.DeleteTwoFactor(u.ID)
+	if err != nil {
+		log.Error("Unable to disable two-factor auth: %v", err)
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to disable two-factor auth."}
+	}
+	log.Info("User %d disabled two-factor auth", u.ID)
+
+	_ = addSessionFlash(app, w, r, "Two-factor authentication is now off.", nil)
+	return impart.HTTPError{http.StatusFound, "/me/settings"}
+}
+
+// checkTwoFactorSettingsCode makes sure a change to two-factor settings comes
+// with a valid code, returning a redirect back to the settings page if not.
+func checkTwoFactorSettingsCode(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	ok, err := verifyTwoFactorCode(app, u.ID, r.FormValue("code"))
+	if err != nil {
+		herr, isHTTP := err.(impart.HTTPError)
+		if !isHTTP {
+			log.Error("Unable to verify two-factor code: %v", err)
+			return ErrInternalGeneral
+		}
+		_ = addSessionFlash(app, w, r, herr.Message, nil)
+		return impart.HTTPError{http.StatusFound, "/me/settings/2fa"}
+	}
+	if !ok {
+		_ = addSessionFlash(app, w, r, ErrBadTwoFactorCode.Message, nil)
+		return impart.HTTPError{http.StatusFound, "/me/settings/2fa"}
+	}
+	return nil
+}
+
+// ResetTwoFactor turns off two-factor auth for the given user, for when
+// they've lost both their authenticator and their recovery codes.
+func ResetTwoFactor(apper Apper, username string) error {
+	// Connect to the database
+	apper.LoadConfig()
+	connectToDatabase(apper.App())
+	defer shutdown(apper.App())
+
+	u, err := apper.App().db.GetUserForAuth(username)
+	if err != nil {
+		log.Error("Get user: %s", err)
+		return err
+	}
+	enabled, err := apper.App().db.IsTwoFactorEnabled(u.ID)
+	if err != nil {
+		log.Error("%s", err)
+		return err
+	}
+	if !enabled {
+		log.Info("%s doesn't have two-factor auth enabled.", u.Username)
+	}
+
+	err = apper.App().db.DeleteTwoFactor(u.ID)
+	if err != nil {
+		log.Error("%s", err)
+		return err
+	}
+	log.Info("Success. %s can now log in with just their password.", u.Username)
+	return nil
+}
+
+// GetUserTwoFactor returns the user's two-factor enrollment, with the secret
+// decrypted, or nil if they haven't started one.
+func (db *datastore) GetUserTwoFactor(userID int64, key []byte) (*userTwoFactor, error) {
+	var encSecret []byte
+	var enabled bool
+	tf := &userTwoFactor{}
+	err := db.QueryRow("SELECT secret, enabled, last_used_step FROM usertwofactor WHERE user_id = ?", userID).Scan(&encSecret, &enabled, &tf.LastUsedStep)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	secret, err := data.Decrypt(key, encSecret)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt two-factor secret: %s", err)
+	}
+	tf.Secret = string(secret)
+	tf.Enabled = enabled
+	return tf, nil
+}
+
+// IsTwoFactorEnabled returns whether the user has finished setting up
+// two-factor auth.
+func (db *datastore) IsTwoFactorEnabled(userID int64) (bool, error) {
+	var enabled bool
+	err := db.QueryRow("SELECT enabled FROM usertwofactor WHERE user_id = ?", userID).Scan(&enabled)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return enabled, nil
+}
+
+// SetPendingTwoFactor stores a new secret for a user who's setting up
+// two-factor auth, replacing any earlier enrollment they didn't finish.
+func (db *datastore) SetPendingTwoFactor(userID int64, secret string, key []byte) error {
+	encSecret, err := data.Encrypt(key, secret)
+	if err != nil {
+		return err
+	}
+
+	t, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = t.Exec("DELETE FROM usertwofactor WHERE user_id = ? AND enabled = 0", userID)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+	_, err = t.Exec("INSERT INTO usertwofactor (user_id, secret, enabled, last_used_step, created) VALUES (?, ?, 0, 0, "+db.now()+")", userID, encSecret)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+	return t.Commit()
+}
+
+// EnableTwoFactor finishes a user's enrollment, recording the step of the
+// code they confirmed it with, and stores their recovery codes.
+func (db *datastore) EnableTwoFactor(userID, step int64, recoveryCodes []string) error {
+	t, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = t.Exec("UPDATE usertwofactor SET enabled = 1, last_used_step = ? WHERE user_id = ?", step, userID)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+	err = replaceRecoveryCodes(t, userID, recoveryCodes)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+	return t.Commit()
+}
+
+// UseTwoFactorStep records that the code for the given time step was used,
+// returning false if it, or a later one, already was.
+func (db *datastore) UseTwoFactorStep(userID, step int64) (bool, error) {
+	res, err := db.Exec("UPDATE usertwofactor SET last_used_step = ? WHERE user_id = ? AND enabled = 1 AND last_used_step < ?", step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ReplaceRecoveryCodes invalidates a user's recovery codes and stores new ones.
+func (db *datastore) ReplaceRecoveryCodes(userID int64, recoveryCodes []string) error {
+	t, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = replaceRecoveryCodes(t, userID, recoveryCodes)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+	return t.Commit()
+}
+
+func replaceRecoveryCodes(t *sql.Tx, userID int64, recoveryCodes []string) error {
+	_, err := t.Exec("DELETE FROM userrecoverycodes WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	for _, c := range recoveryCodes {
+		_, err = t.Exec("INSERT INTO userrecoverycodes (user_id, code_hash) VALUES (?, ?)", userID, hashRecoveryCode(c))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode deletes the given recovery code, returning whether the user
+// had it.
+func (db *datastore) UseRecoveryCode(userID int64, codeHash string) (bool, error) {
+	res, err := db.Exec("DELETE FROM userrecoverycodes WHERE user_id = ? AND code_hash = ?", userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (db *datastore) CountRecoveryCodes(userID int64) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM userrecoverycodes WHERE user_id = ?", userID).Scan(&n)
+	return n, err
+}
+
+// DeleteTwoFactor turns off two-factor auth for a user.
+func (db *datastore) DeleteTwoFactor(userID int64) error {
+	t, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = t.Exec("DELETE FROM usertwofactor WHERE user_id = ?", userID)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+	_, err = t.Exec("DELETE FROM userrecoverycodes WHERE user_id = ?", userID)
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+	return t.Commit()
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// Test vectors from RFC 6238, truncated to six digits
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, test := range tests {
+		now := time.Unix(test.unix, 0)
+		if step := totpMatch(secret, test.code, now); step != test.unix/totpPeriod {
+			t.Errorf("totpMatch(%s) at %d = %d, want %d", test.code, test.unix, step, test.unix/totpPeriod)
+		}
+		// Codes from just before or after still work, but not further out
+		if step := totpMatch(secret, test.code, now.Add(totpPeriod*time.Second)); step != test.unix/totpPeriod {
+			t.Errorf("totpMatch(%s) one step later = %d, want %d", test.code, step, test.unix/totpPeriod)
+		}
+		if step := totpMatch(secret, test.code, now.Add(3*totpPeriod*time.Second)); step != -1 {
+			t.Errorf("totpMatch(%s) three steps later = %d, want -1", test.code, step)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), recoveryCodeCount)
+	}
+	c := codes[0]
+	if isTOTPCode(normalizeTwoFactorCode(c)) {
+		t.Errorf("recovery code %q looks like an authenticator code", c)
+	}
+	if hashRecoveryCode(c) != hashRecoveryCode(" "+c[:5]+c[6:]+" ") {
+		t.Errorf("recovery code %q should match without its dash", c)
+	}
+}
+
+func TestReserveTwoFactorAttempt(t *testing.T) {
+	const userID = -38
+	defer func() {
+		twoFactorFailuresMu.Lock()
+		delete(twoFactorFailedUsers, userID)
+		twoFactorFailuresMu.Unlock()
+	}()
+
+	// Guesses made all at once still can't get past the limit
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 4*twoFactorMaxFailures; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if reserveTwoFactorAttempt(userID) {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != twoFactorMaxFailures {
+		t.Errorf("allowed %d attempts, want %d", allowed, twoFactorMaxFailures)
+	}
+
+	// Until the failures expire
+	twoFactorFailuresMu.Lock()
+	twoFactorFailedUsers[userID].reset = time.Now().Add(-time.Second)
+	twoFactorFailuresMu.Unlock()
+	if !reserveTwoFactorAttempt(userID) {
+		t.Error("attempt refused after failures expired")
+	}
+
+	// and expired failures are swept away, even for users who don't try again
+	const otherID = -39
+	twoFactorFailuresMu.Lock()
+	twoFactorFailedUsers[otherID] = &twoFactorFailures{count: 1, reset: time.Now().Add(-time.Second)}
+	twoFactorFailuresSwept = time.Time{}
+	twoFactorFailuresMu.Unlock()
+	reserveTwoFactorAttempt(userID)
+	twoFactorFailuresMu.Lock()
+	_, kept := twoFactorFailedUsers[otherID]
+	delete(twoFactorFailedUsers, otherID)
+	twoFactorFailuresMu.Unlock()
+	if kept {
+		t.Error("expired failures weren't swept")
+	}
+}
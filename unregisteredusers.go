@@ -54,9 +54,9 @@ func handleWebSignup(app *App, w http.ResponseWriter, r *http.Request) error {
 	if ur.InviteCode != "" {
 		to = "/invite/" + ur.InviteCode
 	}
-	_, err := signupWithRegistration(app, ur, w, r)
+	au, err := signupWithRegistration(app, ur, w, r)
 	if err != nil {
-		if err, ok := err.(impart.HTTPError); ok {
+		if err, ok := err.(impart.HTTPError); ok && err.Status != http.StatusTooManyRequests {
 			session, _ := app.sessionStore.Get(r, cookieName)
 			if session != nil {
 				session.AddFlash(err.Message)
@@ -66,6 +66,10 @@ func handleWebSignup(app *App, w http.ResponseWriter, r *http.Request) error {
 		}
 		return err
 	}
+	if au.User.IsPending() {
+		addSessionFlash(app, w, r, "Thanks for signing up! An admin will review your account, and you'll get an email once it's approved.", nil)
+		return impart.HTTPError{http.StatusFound, "/signup"}
+	}
 	return impart.HTTPError{http.StatusFound, to}
 }
 
@@ -24,6 +24,16 @@ type UserStatus int
 const (
 	UserActive = iota
 	UserSilenced
+	UserPending
+	// UserDeleting marks accounts that will be deleted once their grace
+	// period is up. Statuses are flags, so this one skips iota's 3.
+	UserDeleting = 4
+)
+
+const (
+	userAttrPostByEmail  = "post_by_email"
+	userAttrAdmin        = "admin"
+	userAttrSignupReason = "signup_reason"
 )
 
 type (
@@ -35,6 +45,9 @@ type (
 		To    string `json:"-" schema:"to"`
 
 		EmailLogin bool `json:"via_email" schema:"via_email"`
+
+		// Two-factor code, for API clients; web logins ask for it separately
+		OTP string `json:"otp" schema:"-"`
 	}
 
 	userRegistration struct {
@@ -44,6 +57,10 @@ type (
 		Normalize  bool   `json:"normalize" schema:"normalize"`
 		Signup     bool   `json:"signup" schema:"signup"`
 
+		// Reason is why the user wants to join, for admins approving
+		// registrations.
+		Reason string `json:"reason" schema:"reason"`
+
 		// Feature fields
 		Description  string `json:"description" schema:"description"`
 		Monetization string `json:"monetization" schema:"monetization"`
@@ -72,6 +89,10 @@ type (
 		Created    time.Time   `json:"created"`
 		Status     UserStatus  `json:"status"`
 
+		// Admin is whether the user was made an admin, as the instance's
+		// first user always is.
+		Admin bool `json:"-"`
+
 		clearEmail string `json:"email"`
 	}
 
@@ -127,14 +148,31 @@ func (u User) Cookie() *User {
 }
 
 func (u *User) IsAdmin() bool {
-	// TODO: get this from database
-	return u.ID == 1
+	return u.ID == 1 || u.Admin
 }
 
 func (u *User) IsSilenced() bool {
 	return u.Status&UserSilenced != 0
 }
 
+// IsPending returns whether the user is waiting for an admin to approve their
+// registration.
+func (u *User) IsPending() bool {
+	return u.Status&UserPending != 0
+}
+
+// IsDeleting returns whether the user asked to delete their account and it's
+// waiting to be purged.
+func (u *User) IsDeleting() bool {
+	return u.Status&UserDeleting != 0
+}
+
+// IsHidden returns whether the user's blogs and posts are hidden from everyone
+// else, like IsUserHidden.
+func (u *User) IsHidden() bool {
+	return u.Status&(UserSilenced|UserDeleting) != 0
+}
+
 func (u *User) IsEmailSubscriber(app *App, collID int64) bool {
 	return app.db.IsEmailSubscriber("", u.ID, collID)
 }
@@ -0,0 +1,471 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/writeas/impart"
+	"github.com/writeas/web-core/id"
+	"github.com/writeas/web-core/log"
+	"github.com/writefreely/writefreely/spam"
+)
+
+// sessionTouchMins is how often, in minutes, a session's last-used time, IP
+// and user agent get updated while it's in use.
+const sessionTouchMins = 5
+
+// userSessionStore is a cookie store that also keeps a record of each user
+// session in the database. Sessions that are revoked there are treated as
+// logged out. Cookies from before sessions were recorded are registered the
+// first time they're seen.
+type userSessionStore struct {
+	*sessions.CookieStore
+	db *datastore
+}
+
+func (s *userSessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New decodes the session the same way sessions.CookieStore does, but ties it
+// to this store, so saving it goes through userSessionStore.Save.
+func (s *userSessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+	var err error
+	if c, errCookie := r.Cookie(name); errCookie == nil {
+		err = securecookie.DecodeMulti(name, c.Value, &session.Values, s.Codecs...)
+		if err == nil {
+			session.IsNew = false
+		}
+	}
+	if name == cookieName {
+		s.checkUserSession(r, session)
+	}
+	return session, err
+}
+
+func (s *userSessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Name() == cookieName {
+		delete(session.Values, cookieSessionNewVal)
+		err := s.recordUserSession(r, session)
+		if err != nil {
+			return err
+		}
+	}
+	return s.CookieStore.Save(r, w, session)
+}
+
+// checkUserSession logs the given session out if it doesn't belong to a
+// current user session.
+func (s *userSessionStore) checkUserSession(r *http.Request, session *sessions.Session) {
+	u, ok := session.Values[cookieUserVal].(*User)
+	if !ok {
+		return
+	}
+	sid, _ := session.Values[cookieSessionVal].(string)
+	if sid == "" {
+		// Logged in before sessions were recorded, so record it now instead
+		// of logging them out. UpgradeSessions saves the new ID to the cookie.
+		sid, err := s.db.CreateUserSession(u.ID, r.UserAgent(), requestIP(r))
+		if err == nil {
+			session.Values[cookieSessionVal] = sid
+			session.Values[cookieSessionNewVal] = true
+			return
+		}
+	} else if s.db.TouchUserSession(sid, u.ID, r.UserAgent(), requestIP(r)) {
+		return
+	}
+	delete(session.Values, cookieUserVal)
+	delete(session.Values, cookieSessionVal)
+}
+
+// UpgradeSessions saves the cookie of any session that was just recorded, so
+// that a cookie without a session ID is only accepted once.
+func (h *Handler) UpgradeSessions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie(cookieName); err == nil {
+			session, err := h.sessionStore.Get(r, cookieName)
+			if err == nil && session.Values[cookieSessionNewVal] == true {
+				err = session.Save(r, w)
+				if err != nil {
+					log.Error("Couldn't save upgraded session: %v", err)
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recordUserSession starts a new user session when someone logs in, and ends
+// it when they log out.
+func (s *userSessionStore) recordUserSession(r *http.Request, session *sessions.Session) error {
+	sid, _ := session.Values[cookieSessionVal].(string)
+	u, ok := session.Values[cookieUserVal].(*User)
+	if session.Options.MaxAge < 0 || !ok {
+		if sid != "" {
+			delete(session.Values, cookieSessionVal)
+			return s.db.DeleteUserSession(sid)
+		}
+		return nil
+	}
+
+	if sid != "" {
+		ownerID, err := s.db.GetUserSessionOwner(sid)
+		if err != nil {
+			return err
+		}
+		if ownerID == u.ID {
+			return nil
+		}
+		// Someone else logged in with this cookie, so the old session is over
+		err = s.db.DeleteUserSession(sid)
+		if err != nil {
+			return err
+		}
+	}
+
+	sid, err := s.db.CreateUserSession(u.ID, r.UserAgent(), requestIP(r))
+	if err != nil {
+		return err
+	}
+	session.Values[cookieSessionVal] = sid
+	return nil
+}
+
+// trustedProxies are the reverse proxies whose forwarded headers are trusted.
+var trustedProxies, _ = spam.ParseProxies(spam.DefaultTrustedProxies)
+
+// initTrustedProxies loads the trusted reverse proxies from the config.
+func initTrustedProxies(app *App) error {
+	list := spam.DefaultTrustedProxies
+	if app.cfg.Server.TrustedProxies != "" {
+		list = strings.Split(app.cfg.Server.TrustedProxies, ",")
+	}
+	proxies, err := spam.ParseProxies(list)
+	if err != nil {
+		return fmt.Errorf("trusted_proxies: %s", err)
+	}
+	trustedProxies = proxies
+	return nil
+}
+
+// requestIP returns the IP address a request came from.
+func requestIP(r *http.Request) string {
+	return spam.ClientIP(r, trustedProxies)
+}
+
+// UserSession is a logged-in browser session.
+type UserSession struct {
+	ID        string
+	UserAgent string
+	IP        string
+	Created   time.Time
+	LastUsed  time.Time
+	Current   bool
+}
+
+// UserToken is an API access token, identified by a hash of the token.
+// Personal access tokens have a name and scopes; others have full access.
+type UserToken struct {
+	ID        string
+	Name      string
+	Scopes    []string
+	UserAgent string
+	IP        string
+	Created   time.Time
+	LastUsed  *time.Time
+	Expires   *time.Time
+}
+
+func accessTokenID(token []byte) string {
+	h := sha256.Sum256(token)
+	return hex.EncodeToString(h[:8])
+}
+
+func (db *datastore) CreateUserSession(userID int64, userAgent, ip string) (string, error) {
+	// Clear out any of the user's sessions that have expired
+	_, err := db.Exec("DELETE FROM usersessions WHERE user_id = ? AND last_used < "+db.dateSub(sessionLength/day, "DAY"), userID)
+	if err != nil {
+		log.Error("Unable to delete expired sessions: %v", err)
+	}
+
+	sid := id.Generate62RandomString(32)
+	_, err = db.Exec("INSERT INTO usersessions (id, user_id, user_agent, ip, created, last_used) VALUES (?, ?, ?, ?, "+db.now()+", "+db.now()+")", sid, userID, clipString(userAgent, 255), clipString(ip, 45))
+	if err != nil {
+		log.Error("Couldn't INSERT usersession: %v", err)
+		return "", err
+	}
+	return sid, nil
+}
+
+// TouchUserSession returns whether the given session is current and belongs
+// to the given user, updating when it was last used.
+func (db *datastore) TouchUserSession(sid string, userID int64, userAgent, ip string) bool {
+	var ownerID int64
+	err := db.QueryRow("SELECT user_id FROM usersessions WHERE id = ? AND last_used > "+db.dateSub(sessionLength/day, "DAY"), sid).Scan(&ownerID)
+	switch {
+	case err == sql.ErrNoRows:
+		return false
+	case err != nil:
+		log.Error("Couldn't SELECT usersession: %v", err)
+		return false
+	}
+	if ownerID != userID {
+		return false
+	}
+
+	_, err = db.Exec("UPDATE usersessions SET last_used = "+db.now()+", user_agent = ?, ip = ? WHERE id = ? AND last_used < "+db.dateSub(sessionTouchMins, "MINUTE"), clipString(userAgent, 255), clipString(ip, 45), sid)
+	if err != nil {
+		log.Error("Couldn't UPDATE usersession: %v", err)
+	}
+	return true
+}
+
+// GetUserSessionOwner returns the ID of the user the given session belongs
+// to, or 0 if it doesn't exist.
+func (db *datastore) GetUserSessionOwner(sid string) (int64, error) {
+	var userID int64
+	err := db.QueryRow("SELECT user_id FROM usersessions WHERE id = ?", sid).Scan(&userID)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, nil
+	case err != nil:
+		log.Error("Couldn't SELECT usersession: %v", err)
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (db *datastore) DeleteUserSession(sid string) error {
+	_, err := db.Exec("DELETE FROM usersessions WHERE id = ?", sid)
+	if err != nil {
+		log.Error("Couldn't DELETE usersession: %v", err)
+	}
+	return err
+}
+
+func (db *datastore) GetUserSessions(userID int64) ([]UserSession, error) {
+	rows, err := db.Query("SELECT id, user_agent, ip, created, last_used FROM usersessions WHERE user_id = ? AND last_used > "+db.dateSub(sessionLength/day, "DAY")+" ORDER BY last_used DESC", userID)
+	if err != nil {
+		log.Error("Couldn't SELECT usersessions: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	userSessions := []UserSession{}
+	for rows.Next() {
+		s := UserSession{}
+		var ua, ip sql.NullString
+		err = rows.Scan(&s.ID, &ua, &ip, &s.Created, &s.LastUsed)
+		if err != nil {
+			log.Error("Couldn't scan usersession: %v", err)
+			return nil, err
+		}
+		s.UserAgent, s.IP = ua.String, ip.String
+		userSessions = append(userSessions, s)
+	}
+	return userSessions, rows.Err()
+}
+
+// GetUserTokens returns the given user's current API access tokens, leaving
+// out one-time tokens.
+func (db *datastore) GetUserTokens(userID int64) ([]UserToken, error) {
+	rows, err := db.Query("SELECT token, name, scopes, user_agent, ip, created, last_used, expires FROM accesstokens WHERE user_id = ? AND one_time = 0 AND (expires IS NULL OR expires > "+db.now()+") ORDER BY created DESC", userID)
+	if err != nil {
+		log.Error("Couldn't SELECT accesstokens: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []UserToken{}
+	for rows.Next() {
+		t := UserToken{}
+		var tok []byte
+		var name, scopes, ua, ip sql.NullString
+		var lastUsed, expires sql.NullTime
+		err = rows.Scan(&tok, &name, &scopes, &ua, &ip, &t.Created, &lastUsed, &expires)
+		if err != nil {
+			log.Error("Couldn't scan accesstoken: %v", err)
+			return nil, err
+		}
+		t.ID = accessTokenID(tok)
+		t.UserAgent, t.IP = ua.String, ip.String
+		t.Name = name.String
+		for _, sc := range splitScopes(scopes.String) {
+			t.Scopes = append(t.Scopes, string(sc))
+		}
+		if lastUsed.Valid {
+			t.LastUsed = &lastUsed.Time
+		}
+		if expires.Valid {
+			t.Expires = &expires.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteUserToken deletes the given user's access token with the given ID,
+// as returned by GetUserTokens.
+func (db *datastore) DeleteUserToken(userID int64, tokenID string) error {
+	rows, err := db.Query("SELECT token FROM accesstokens WHERE user_id = ?", userID)
+	if err != nil {
+		log.Error("Couldn't SELECT accesstokens: %v", err)
+		return err
+	}
+	var found []byte
+	for rows.Next() {
+		var tok []byte
+		err = rows.Scan(&tok)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if accessTokenID(tok) == tokenID {
+			found = tok
+			break
+		}
+	}
+	rows.Close()
+	if found == nil {
+		return impart.HTTPError{http.StatusNotFound, "Token doesn't exist."}
+	}
+
+	_, err = db.Exec("DELETE FROM accesstokens WHERE user_id = ? AND token LIKE ?", userID, found)
+	if err != nil {
+		log.Error("Couldn't DELETE accesstoken: %v", err)
+	}
+	return err
+}
+
+// DeleteAllUserSessions logs the given user out of every session and revokes
+// all of their access tokens.
+func (db *datastore) DeleteAllUserSessions(userID int64) error {
+	t, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = t.Exec("DELETE FROM usersessions WHERE user_id = ?", userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Couldn't DELETE usersessions: %v", err)
+		return err
+	}
+	_, err = t.Exec("DELETE FROM accesstokens WHERE user_id = ?", userID)
+	if err != nil {
+		t.Rollback()
+		log.Error("Couldn't DELETE accesstokens: %v", err)
+		return err
+	}
+	return t.Commit()
+}
+
+func clipString(s string, l int) string {
+	if len(s) > l {
+		return s[:l]
+	}
+	return s
+}
+
+func viewSessions(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	userSessions, err := app.db.GetUserSessions(u.ID)
+	if err != nil {
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to retrieve sessions."}
+	}
+	tokens, err := app.db.GetUserTokens(u.ID)
+	if err != nil {
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to retrieve access tokens."}
+	}
+
+	if session, err := app.sessionStore.Get(r, cookieName); err == nil {
+		cur, _ := session.Values[cookieSessionVal].(string)
+		for i := range userSessions {
+			userSessions[i].Current = userSessions[i].ID == cur
+		}
+	}
+
+	flashes, _ := getSessionFlashes(app, w, r, nil)
+
+	p := struct {
+		*UserPage
+		Sessions     []UserSession
+		Tokens       []UserToken
+		ScopeOptions []TokenScopeOption
+		CSRFField    template.HTML
+	}{
+		UserPage:     NewUserPage(app, r, u, "Sessions & Tokens", flashes),
+		Sessions:     userSessions,
+		Tokens:       tokens,
+		ScopeOptions: tokenScopeOptions,
+		CSRFField:    csrf.TemplateField(r),
+	}
+
+	showUserPage(w, "sessions", p)
+	return nil
+}
+
+func handleRevokeSession(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	if sid := r.FormValue("session"); sid != "" {
+		ownerID, err := app.db.GetUserSessionOwner(sid)
+		if err != nil {
+			return impart.HTTPError{http.StatusInternalServerError, "Unable to revoke session."}
+		}
+		if ownerID != u.ID {
+			return impart.HTTPError{http.StatusNotFound, "Session doesn't exist."}
+		}
+		err = app.db.DeleteUserSession(sid)
+		if err != nil {
+			return impart.HTTPError{http.StatusInternalServerError, "Unable to revoke session."}
+		}
+		_ = addSessionFlash(app, w, r, "Session revoked.", nil)
+	} else if tokenID := r.FormValue("token"); tokenID != "" {
+		err := app.db.DeleteUserToken(u.ID, tokenID)
+		if err != nil {
+			if herr, ok := err.(impart.HTTPError); ok {
+				return herr
+			}
+			return impart.HTTPError{http.StatusInternalServerError, "Unable to revoke token."}
+		}
+		_ = addSessionFlash(app, w, r, "Access token revoked.", nil)
+	}
+	return impart.HTTPError{http.StatusFound, "/me/settings/sessions"}
+}
+
+func handleRevokeAllSessions(app *App, u *User, w http.ResponseWriter, r *http.Request) error {
+	err := app.db.DeleteAllUserSessions(u.ID)
+	if err != nil {
+		return impart.HTTPError{http.StatusInternalServerError, "Unable to log out everywhere."}
+	}
+
+	session, err := app.sessionStore.Get(r, cookieName)
+	if err == nil {
+		session.Options.MaxAge = -1
+		err = session.Save(r, w)
+		if err != nil {
+			log.Error("Couldn't save session on logout: %v", err)
+		}
+	}
+	return impart.HTTPError{http.StatusFound, "/login"}
+}
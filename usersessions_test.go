@@ -0,0 +1,188 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package writefreely
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+	"github.com/writeas/impart"
+)
+
+// testLogin logs in with the given credentials and returns the session
+// cookie that was set.
+func testLogin(t *testing.T, app *App, username, pass string) *http.Cookie {
+	body, _ := json.Marshal(userCredentials{Alias: username, Pass: pass, Web: true})
+	req := httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "test")
+	rr := httptest.NewRecorder()
+	assert.NoError(t, login(app, rr, req))
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == cookieName {
+			return c
+		}
+	}
+	t.Fatal("login didn't set a session cookie")
+	return nil
+}
+
+// testSessionUser returns the user logged in with the given cookie, if any.
+func testSessionUser(app *App, c *http.Cookie) *User {
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.AddCookie(c)
+	return getUserSession(app, req)
+}
+
+func TestRevokeSession(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.InitRateLimits()
+		alice := createTestUser(t, app, "alice", "password")
+		bob := createTestUser(t, app, "bob", "password")
+
+		laptop := testLogin(t, app, "alice", "password")
+		phone := testLogin(t, app, "alice", "password")
+		bobCookie := testLogin(t, app, "bob", "password")
+		if u := testSessionUser(app, laptop); assert.NotNil(t, u) {
+			assert.Equal(t, alice.ID, u.ID)
+		}
+		sessions, err := db.GetUserSessions(alice.ID)
+		assert.NoError(t, err)
+		assert.Len(t, sessions, 2)
+		bobSessions, err := db.GetUserSessions(bob.ID)
+		assert.NoError(t, err)
+		assert.Len(t, bobSessions, 1)
+
+		revoke := func(u *User, sid string) error {
+			req := httptest.NewRequest("POST", "/me/settings/sessions/revoke", strings.NewReader(url.Values{"session": {sid}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			return revokeErr(handleRevokeSession(app, u, httptest.NewRecorder(), req))
+		}
+
+		// Someone else's session can't be revoked
+		assert.Equal(t, http.StatusNotFound, revoke(alice, bobSessions[0].ID).(impart.HTTPError).Status)
+		assert.NotNil(t, testSessionUser(app, bobCookie))
+
+		// Revoking one session logs out only that one
+		assert.NoError(t, revoke(alice, sessions[0].ID))
+		loggedIn := 0
+		for _, c := range []*http.Cookie{laptop, phone} {
+			if testSessionUser(app, c) != nil {
+				loggedIn++
+			}
+		}
+		assert.Equal(t, 1, loggedIn)
+		sessions, err = db.GetUserSessions(alice.ID)
+		assert.NoError(t, err)
+		assert.Len(t, sessions, 1)
+	})
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		app.InitRateLimits()
+		alice := createTestUser(t, app, "alice", "password")
+		createTestUser(t, app, "bob", "password")
+
+		laptop := testLogin(t, app, "alice", "password")
+		phone := testLogin(t, app, "alice", "password")
+		bobCookie := testLogin(t, app, "bob", "password")
+		token, err := db.GetAccessToken(alice.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, alice.ID, db.GetUserID(token))
+
+		req := httptest.NewRequest("POST", "/me/settings/sessions/revoke-all", nil)
+		req.AddCookie(laptop)
+		rr := httptest.NewRecorder()
+		assert.Equal(t, impart.HTTPError{http.StatusFound, "/login"}, handleRevokeAllSessions(app, alice, rr, req))
+
+		assert.Nil(t, testSessionUser(app, laptop))
+		assert.Nil(t, testSessionUser(app, phone))
+		assert.Equal(t, int64(-1), db.GetUserID(token))
+		sessions, err := db.GetUserSessions(alice.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, sessions)
+		assert.NotNil(t, testSessionUser(app, bobCookie))
+	})
+}
+
+func TestUpgradeSessions(t *testing.T) {
+	withTestDatastore(t, func(db *datastore) {
+		app := newTestApp(db)
+		alice := createTestUser(t, app, "alice", "password")
+		h := &Handler{sessionStore: app.sessionStore}
+
+		// A cookie from before sessions were recorded has no session ID
+		store := app.sessionStore.(*userSessionStore)
+		session := sessions.NewSession(store, cookieName)
+		session.Values[cookieUserVal] = alice.Cookie()
+		val, err := securecookie.EncodeMulti(cookieName, session.Values, store.Codecs...)
+		assert.NoError(t, err)
+		legacy := &http.Cookie{Name: cookieName, Value: val}
+
+		var gotUser *User
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotUser = getUserSession(app, r)
+		})
+		req := httptest.NewRequest("GET", "/me", nil)
+		req.AddCookie(legacy)
+		rr := httptest.NewRecorder()
+		h.UpgradeSessions(next).ServeHTTP(rr, req)
+
+		// It's accepted, recorded, and replaced with one that has an ID
+		if assert.NotNil(t, gotUser) {
+			assert.Equal(t, alice.ID, gotUser.ID)
+		}
+		userSessions, err := db.GetUserSessions(alice.ID)
+		assert.NoError(t, err)
+		assert.Len(t, userSessions, 1)
+		var upgraded *http.Cookie
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == cookieName {
+				upgraded = c
+			}
+		}
+		if !assert.NotNil(t, upgraded) {
+			return
+		}
+		values := map[interface{}]interface{}{}
+		assert.NoError(t, securecookie.DecodeMulti(cookieName, upgraded.Value, &values, store.Codecs...))
+		assert.Equal(t, userSessions[0].ID, values[cookieSessionVal])
+		assert.NotContains(t, values, cookieSessionNewVal)
+
+		// The new cookie uses the recorded session from now on
+		assert.NotNil(t, testSessionUser(app, upgraded))
+		userSessions, err = db.GetUserSessions(alice.ID)
+		assert.NoError(t, err)
+		assert.Len(t, userSessions, 1)
+
+		// so it can be revoked like any other
+		assert.NoError(t, db.DeleteUserSession(userSessions[0].ID))
+		assert.Nil(t, testSessionUser(app, upgraded))
+	})
+}
+
+func revokeErr(err error) error {
+	if herr, ok := err.(impart.HTTPError); ok && herr.Status == http.StatusFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Authenticators encode their data in CBOR (RFC 8949). This decoder handles
+// the definite-length subset that attestation objects and COSE keys use.
+
+var (
+	errCBORTruncated   = errors.New("cbor: unexpected end of data")
+	errCBORUnsupported = errors.New("cbor: unsupported data item")
+	errCBORTooDeep     = errors.New("cbor: nested too deeply")
+)
+
+const cborMaxDepth = 16
+
+// decodeCBOR decodes the first data item in b, returning it along with the
+// number of bytes it took up. Integers are returned as int64, byte strings as
+// []byte, arrays as []interface{} and maps as map[interface{}]interface{}.
+func decodeCBOR(b []byte) (interface{}, int, error) {
+	d := &cborDecoder{b: b}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v, d.off, nil
+}
+
+type cborDecoder struct {
+	b   []byte
+	off int
+}
+
+func (d *cborDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.b)-d.off) {
+		return nil, errCBORTruncated
+	}
+	res := d.b[d.off : d.off+int(n)]
+	d.off += int(n)
+	return res, nil
+}
+
+// arg reads the argument that follows an initial byte with the given
+// additional information.
+func (d *cborDecoder) arg(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		b, err := d.take(1)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(b[0]), nil
+	case info == 25:
+		b, err := d.take(2)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case info == 26:
+		b, err := d.take(4)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	case info == 27:
+		b, err := d.take(8)
+		if err != nil {
+			return 0, err
+		}
+		return binary.BigEndian.Uint64(b), nil
+	}
+	// Indefinite lengths and reserved values
+	return 0, errCBORUnsupported
+}
+
+func (d *cborDecoder) value(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, errCBORTooDeep
+	}
+	ib, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	major, info := ib[0]>>5, ib[0]&0x1f
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		case 26:
+			n, err := d.arg(info)
+			if err != nil {
+				return nil, err
+			}
+			return float64(math.Float32frombits(uint32(n))), nil
+		case 27:
+			n, err := d.arg(info)
+			if err != nil {
+				return nil, err
+			}
+			return math.Float64frombits(n), nil
+		}
+		return nil, errCBORUnsupported
+	}
+
+	n, err := d.arg(info)
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		if n > math.MaxInt64 {
+			return nil, errCBORUnsupported
+		}
+		return int64(n), nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, errCBORUnsupported
+		}
+		return -1 - int64(n), nil
+	case 2:
+		return d.take(n)
+	case 3:
+		b, err := d.take(n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case 4:
+		// Every item takes at least a byte, so this bounds the allocation
+		if n > uint64(len(d.b)-d.off) {
+			return nil, errCBORTruncated
+		}
+		res := make([]interface{}, n)
+		for i := range res {
+			if res[i], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case 5:
+		if n > uint64(len(d.b)-d.off)/2 {
+			return nil, errCBORTruncated
+		}
+		res := make(map[interface{}]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, errCBORUnsupported
+			}
+			if res[k], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case 6:
+		// Tags don't matter here; return what they're attached to
+		return d.value(depth + 1)
+	}
+	return nil, errCBORUnsupported
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// COSE (RFC 9053) algorithm identifiers for the signatures we can verify.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE key parameters
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+var (
+	errUnsupportedKey = errors.New("webauthn: unsupported public key type")
+	errBadSignature   = errors.New("webauthn: signature doesn't match")
+)
+
+// supportedAlgs are offered to authenticators in order of preference.
+var supportedAlgs = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// coseKey is a credential public key, parsed from its COSE encoding.
+type coseKey struct {
+	alg int64
+	pub crypto.PublicKey
+}
+
+func parseCOSEKey(b []byte) (*coseKey, error) {
+	v, _, err := decodeCBOR(b)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errUnsupportedKey
+	}
+	intParam := func(k int64) int64 {
+		n, _ := m[k].(int64)
+		return n
+	}
+	bytesParam := func(k int64) []byte {
+		b, _ := m[k].([]byte)
+		return b
+	}
+
+	key := &coseKey{alg: intParam(coseAlg)}
+	switch {
+	case intParam(coseKty) == coseKtyEC2 && key.alg == AlgES256 && intParam(-1) == coseCrvP256:
+		x, y := bytesParam(-2), bytesParam(-3)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errUnsupportedKey
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errUnsupportedKey
+		}
+		key.pub = pub
+	case intParam(coseKty) == coseKtyOKP && key.alg == AlgEdDSA && intParam(-1) == coseCrvEd25519:
+		x := bytesParam(-2)
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errUnsupportedKey
+		}
+		key.pub = ed25519.PublicKey(x)
+	case intParam(coseKty) == coseKtyRSA && key.alg == AlgRS256:
+		n, e := bytesParam(-1), bytesParam(-2)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errUnsupportedKey
+		}
+		key.pub = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	default:
+		return nil, errUnsupportedKey
+	}
+	return key, nil
+}
+
+func (k *coseKey) verify(msg, sig []byte) error {
+	switch pub := k.pub.(type) {
+	case *ecdsa.PublicKey:
+		h := sha256.Sum256(msg)
+		if !ecdsa.VerifyASN1(pub, h[:], sig) {
+			return errBadSignature
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, msg, sig) {
+			return errBadSignature
+		}
+	case *rsa.PublicKey:
+		h := sha256.Sum256(msg)
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, h[:], sig) != nil {
+			return errBadSignature
+		}
+	default:
+		return errUnsupportedKey
+	}
+	return nil
+}
@@ -0,0 +1,361 @@
+/*
+ * Copyright © 2026 Musing Studio LLC.
+ *
+ * This file is part of WriteFreely.
+ *
+ * WriteFreely is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License, included
+ * in the LICENSE file in this source code package.
+ */
+
+// Package webauthn implements the server side of Web Authentication, for
+// registering passkeys and logging in with them.
+//
+// It supports the "none" attestation conveyance only: authenticators are
+// trusted to hold the keys they create, without checking who made them,
+// which is all a site that isn't restricting hardware needs.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Timeout is how long a browser gives the user to complete a ceremony.
+const Timeout = 5 * time.Minute
+
+// User verification requirements
+const (
+	VerificationRequired    = "required"
+	VerificationPreferred   = "preferred"
+	VerificationDiscouraged = "discouraged"
+)
+
+// MaxCredentialIDLen is the longest credential ID accepted. The spec allows
+// up to 1023 bytes, but real authenticators use far fewer.
+const MaxCredentialIDLen = 128
+
+// Authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+var (
+	ErrCredentialIDTooLong = errors.New("webauthn: credential ID too long")
+	ErrCloned              = errors.New("webauthn: signature counter went backwards; authenticator may be cloned")
+)
+
+// Bytes is binary data that's sent to and from the browser as unpadded
+// base64url, as the WebAuthn JSON encodings do.
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+// RelyingParty is the site that credentials are registered with.
+type RelyingParty struct {
+	// ID is the site's domain name, which credentials are scoped to.
+	ID string
+	// Name is shown to users by some authenticators.
+	Name string
+	// Origin is the scheme, host and port that ceremonies happen on.
+	Origin string
+}
+
+// Credential is a registered public key credential.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE-encoded
+	SignCount uint32
+}
+
+// CredentialDescriptor identifies a credential to the browser.
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   Bytes  `json:"id"`
+}
+
+type credentialParam struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type rpEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userEntity struct {
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions are the publicKey options for navigator.credentials.create().
+type CreationOptions struct {
+	RP                     rpEntity               `json:"rp"`
+	User                   userEntity             `json:"user"`
+	Challenge              Bytes                  `json:"challenge"`
+	PubKeyCredParams       []credentialParam      `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the publicKey options for navigator.credentials.get().
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse is what the browser returns from
+// navigator.credentials.create(), with binary fields encoded.
+type AttestationResponse struct {
+	ID                Bytes `json:"id"`
+	ClientDataJSON    Bytes `json:"clientDataJSON"`
+	AttestationObject Bytes `json:"attestationObject"`
+}
+
+// AssertionResponse is what the browser returns from
+// navigator.credentials.get(), with binary fields encoded.
+type AssertionResponse struct {
+	ID                Bytes `json:"id"`
+	ClientDataJSON    Bytes `json:"clientDataJSON"`
+	AuthenticatorData Bytes `json:"authenticatorData"`
+	Signature         Bytes `json:"signature"`
+	UserHandle        Bytes `json:"userHandle"`
+}
+
+// NewChallenge returns a random challenge for a single ceremony.
+func NewChallenge() (Bytes, error) {
+	b := make(Bytes, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	res := make([]CredentialDescriptor, len(ids))
+	for i, id := range ids {
+		res[i] = CredentialDescriptor{Type: "public-key", ID: id}
+	}
+	return res
+}
+
+// CreationOptions returns the options for registering a new credential for
+// the given user. Credentials the user already has are excluded, so the same
+// authenticator isn't registered twice.
+func (rp *RelyingParty) CreationOptions(challenge, userHandle []byte, name, displayName string, exclude [][]byte) *CreationOptions {
+	o := &CreationOptions{
+		RP:                 rpEntity{ID: rp.ID, Name: rp.Name},
+		User:               userEntity{ID: userHandle, Name: name, DisplayName: displayName},
+		Challenge:          challenge,
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: authenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: VerificationPreferred,
+		},
+		Attestation: "none",
+	}
+	for _, alg := range supportedAlgs {
+		o.PubKeyCredParams = append(o.PubKeyCredParams, credentialParam{Type: "public-key", Alg: alg})
+	}
+	return o
+}
+
+// RequestOptions returns the options for logging in. With no allowed
+// credentials, the browser offers any passkey it has for the site.
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow [][]byte, userVerification string) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: userVerification,
+	}
+}
+
+// VerifyRegistration checks the browser's response to CreationOptions made
+// with the given challenge, returning the new credential.
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, res *AttestationResponse, requireUV bool) (*Credential, error) {
+	if err := rp.checkClientData(res.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	v, _, err := decodeCBOR(res.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+	att, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("webauthn: malformed attestation object")
+	}
+	rawAuthData, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("webauthn: attestation object has no authenticator data")
+	}
+
+	ad, err := rp.checkAuthData(rawAuthData, requireUV)
+	if err != nil {
+		return nil, err
+	}
+	if ad.credID == nil {
+		return nil, errors.New("webauthn: no credential in authenticator data")
+	}
+	if len(ad.credID) > MaxCredentialIDLen {
+		return nil, ErrCredentialIDTooLong
+	}
+	if !bytes.Equal(ad.credID, res.ID) {
+		return nil, errors.New("webauthn: credential ID doesn't match authenticator data")
+	}
+	if _, err = parseCOSEKey(ad.credKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        ad.credID,
+		PublicKey: ad.credKey,
+		SignCount: ad.signCount,
+	}, nil
+}
+
+// VerifyLogin checks the browser's response to RequestOptions made with the
+// given challenge, against the stored credential it claims to be from. It
+// returns the credential's new signature counter.
+func (rp *RelyingParty) VerifyLogin(challenge []byte, cred *Credential, res *AssertionResponse, requireUV bool) (uint32, error) {
+	if !bytes.Equal(cred.ID, res.ID) {
+		return 0, errors.New("webauthn: wrong credential")
+	}
+	if err := rp.checkClientData(res.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	ad, err := rp.checkAuthData(res.AuthenticatorData, requireUV)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parseCOSEKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(res.ClientDataJSON)
+	signed := append(append([]byte{}, res.AuthenticatorData...), clientDataHash[:]...)
+	if err = key.verify(signed, res.Signature); err != nil {
+		return 0, err
+	}
+
+	// Authenticators that don't keep a counter always send zero
+	if (ad.signCount != 0 || cred.SignCount != 0) && ad.signCount <= cred.SignCount {
+		return 0, ErrCloned
+	}
+	return ad.signCount, nil
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+func (rp *RelyingParty) checkClientData(raw []byte, typ string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("webauthn: malformed client data: %s", err)
+	}
+	if cd.Type != typ {
+		return fmt.Errorf("webauthn: expected %s, got %q", typ, cd.Type)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cd.Challenge, "="))
+	if err != nil || len(challenge) == 0 || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return errors.New("webauthn: challenge doesn't match")
+	}
+	if cd.Origin != rp.Origin {
+		return fmt.Errorf("webauthn: unexpected origin %q", cd.Origin)
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	flags     byte
+	signCount uint32
+	credID    []byte
+	credKey   []byte
+}
+
+func (rp *RelyingParty) checkAuthData(b []byte, requireUV bool) (*authenticatorData, error) {
+	if len(b) < 37 {
+		return nil, errors.New("webauthn: authenticator data too short")
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(b[:32], rpIDHash[:]) != 1 {
+		return nil, errors.New("webauthn: credential is for a different site")
+	}
+	ad := &authenticatorData{
+		flags:     b[32],
+		signCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return nil, errors.New("webauthn: user wasn't present")
+	}
+	if requireUV && ad.flags&flagUserVerified == 0 {
+		return nil, errors.New("webauthn: user wasn't verified")
+	}
+
+	if ad.flags&flagAttested != 0 {
+		// AAGUID, then the credential ID and its public key
+		rest := b[37:]
+		if len(rest) < 18 {
+			return nil, errors.New("webauthn: attested credential data too short")
+		}
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen > len(rest) {
+			return nil, errors.New("webauthn: attested credential data too short")
+		}
+		ad.credID = rest[:idLen]
+		rest = rest[idLen:]
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		ad.credKey = rest[:n]
+	}
+	return ad, nil
+}
@@ -0,0 +1,181 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+)
+
+// Just enough CBOR encoding to play the part of an authenticator
+
+func cborHead(major byte, n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 256:
+		return []byte{major<<5 | 24, byte(n)}
+	}
+	return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+}
+
+func cborInt(n int) []byte {
+	if n < 0 {
+		return cborHead(1, -1-n)
+	}
+	return cborHead(0, n)
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, len(b)), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHead(3, len(s)), s...)
+}
+
+type testAuthenticator struct {
+	key     *ecdsa.PrivateKey
+	credID  []byte
+	counter uint32
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testAuthenticator{key: key, credID: []byte("test-credential-id")}
+}
+
+func (a *testAuthenticator) coseKey() []byte {
+	x, y := make([]byte, 32), make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	var b []byte
+	b = append(b, cborHead(5, 5)...)
+	b = append(append(b, cborInt(coseKty)...), cborInt(coseKtyEC2)...)
+	b = append(append(b, cborInt(coseAlg)...), cborInt(AlgES256)...)
+	b = append(append(b, cborInt(-1)...), cborInt(coseCrvP256)...)
+	b = append(append(b, cborInt(-2)...), cborBytes(x)...)
+	b = append(append(b, cborInt(-3)...), cborBytes(y)...)
+	return b
+}
+
+func (a *testAuthenticator) authData(rpID string, flags byte, attested bool) []byte {
+	h := sha256.Sum256([]byte(rpID))
+	b := append(h[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(b[33:], a.counter)
+	if attested {
+		b = append(b, make([]byte, 16)...)
+		b = append(b, byte(len(a.credID)>>8), byte(len(a.credID)))
+		b = append(b, a.credID...)
+		b = append(b, a.coseKey()...)
+	}
+	return b
+}
+
+func clientDataJSON(typ string, challenge []byte, origin string) []byte {
+	b, _ := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    origin,
+	})
+	return b
+}
+
+func (a *testAuthenticator) register(rpID, origin string, challenge []byte) *AttestationResponse {
+	var att []byte
+	att = append(att, cborHead(5, 3)...)
+	att = append(append(att, cborText("fmt")...), cborText("none")...)
+	att = append(append(att, cborText("attStmt")...), cborHead(5, 0)...)
+	att = append(append(att, cborText("authData")...), cborBytes(a.authData(rpID, flagUserPresent|flagUserVerified|flagAttested, true))...)
+	return &AttestationResponse{
+		ID:                a.credID,
+		ClientDataJSON:    clientDataJSON("webauthn.create", challenge, origin),
+		AttestationObject: att,
+	}
+}
+
+func (a *testAuthenticator) login(t *testing.T, rpID, origin string, challenge []byte, flags byte) *AssertionResponse {
+	a.counter++
+	res := &AssertionResponse{
+		ID:                a.credID,
+		ClientDataJSON:    clientDataJSON("webauthn.get", challenge, origin),
+		AuthenticatorData: a.authData(rpID, flags, false),
+	}
+	h := sha256.Sum256(res.ClientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, res.AuthenticatorData...), h[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Signature = sig
+	return res
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	rp := &RelyingParty{ID: "example.com", Name: "Example", Origin: "https://example.com"}
+	a := newTestAuthenticator(t)
+
+	challenge, _ := NewChallenge()
+	if _, err := rp.VerifyRegistration(challenge, a.register(rp.ID, "https://evil.example", challenge), true); err == nil {
+		t.Error("registration from another origin should fail")
+	}
+	other, _ := NewChallenge()
+	if _, err := rp.VerifyRegistration(challenge, a.register(rp.ID, rp.Origin, other), true); err == nil {
+		t.Error("registration with the wrong challenge should fail")
+	}
+	if _, err := rp.VerifyRegistration(challenge, a.register("evil.example", rp.Origin, challenge), true); err == nil {
+		t.Error("registration for another RP ID should fail")
+	}
+	cred, err := rp.VerifyRegistration(challenge, a.register(rp.ID, rp.Origin, challenge), true)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+
+	challenge, _ = NewChallenge()
+	count, err := rp.VerifyLogin(challenge, cred, a.login(t, rp.ID, rp.Origin, challenge, flagUserPresent|flagUserVerified), true)
+	if err != nil {
+		t.Fatalf("VerifyLogin: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("sign count = %d, want 1", count)
+	}
+	cred.SignCount = count
+
+	res := a.login(t, rp.ID, rp.Origin, challenge, flagUserPresent)
+	if _, err = rp.VerifyLogin(challenge, cred, res, true); err == nil {
+		t.Error("login without user verification should fail when it's required")
+	}
+	if _, err = rp.VerifyLogin(challenge, cred, res, false); err != nil {
+		t.Errorf("login without user verification: %v", err)
+	}
+
+	res = a.login(t, rp.ID, rp.Origin, challenge, flagUserPresent)
+	res.Signature[len(res.Signature)-1] ^= 1
+	if _, err = rp.VerifyLogin(challenge, cred, res, false); err == nil {
+		t.Error("login with a bad signature should fail")
+	}
+
+	cred.SignCount = 100
+	if _, err = rp.VerifyLogin(challenge, cred, a.login(t, rp.ID, rp.Origin, challenge, flagUserPresent), false); err != ErrCloned {
+		t.Errorf("login with an old counter: got %v, want ErrCloned", err)
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	for _, b := range [][]byte{
+		{0x9f, 0x01, 0xff},             // Indefinite-length array
+		{0x5a, 0xff, 0xff, 0xff, 0xff}, // Byte string longer than the data
+		{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	} {
+		if _, _, err := decodeCBOR(b); err == nil {
+			t.Errorf("decodeCBOR(% x) should fail", b)
+		}
+	}
+}
@@ -32,12 +32,20 @@ var wfUserNotFoundErr = impart.HTTPError{http.StatusNotFound, "User not found."}
 func (wfr wfResolver) FindUser(username string, host, requestHost string, r []webfinger.Rel) (*webfinger.Resource, error) {
 	var c *Collection
 	var err error
+	var renamedFrom string
 	if username == host {
 		c = instanceColl
 	} else if wfr.cfg.App.SingleUser {
 		c, err = wfr.db.GetCollectionByID(1)
 	} else {
 		c, err = wfr.db.GetCollection(username)
+		if err == ErrCollectionNotFound {
+			// Keep resolving handles for a while after they're changed
+			c, err = wfr.db.GetRenamedCollection(username)
+			if err == nil {
+				renamedFrom = username
+			}
+		}
 	}
 	if err != nil {
 		log.Error("Unable to get blog: %v", err)
@@ -46,12 +54,12 @@ func (wfr wfResolver) FindUser(username string, host, requestHost string, r []we
 	c.hostName = wfr.cfg.App.Host
 
 	if !c.IsInstanceColl() {
-		silenced, err := wfr.db.IsUserSilenced(c.OwnerID)
+		hidden, err := wfr.db.IsUserHidden(c.OwnerID)
 		if err != nil {
-			log.Error("webfinger find user: check is silenced: %v", err)
+			log.Error("webfinger find user: check is hidden: %v", err)
 			return nil, err
 		}
-		if silenced {
+		if hidden {
 			return nil, wfUserNotFoundErr
 		}
 	}
@@ -68,11 +76,19 @@ func (wfr wfResolver) FindUser(username string, host, requestHost string, r []we
 		return nil, wfUserNotFoundErr
 	}
 
+	actorURL := c.FederatedAccount()
+	if renamedFrom != "" {
+		// Point to the old actor, which says where it moved
+		prevColl := *c
+		prevColl.Alias = renamedFrom
+		actorURL = prevColl.FederatedAccount()
+	}
+
 	res := webfinger.Resource{
 		Subject: "acct:" + username + "@" + host,
 		Aliases: []string{
 			c.CanonicalURL(),
-			c.FederatedAccount(),
+			actorURL,
 		},
 		Links: []webfinger.Link{
 			{
@@ -81,7 +97,7 @@ func (wfr wfResolver) FindUser(username string, host, requestHost string, r []we
 				Rel:  "https://webfinger.net/rel/profile-page",
 			},
 			{
-				HRef: c.FederatedAccount(),
+				HRef: actorURL,
 				Type: "application/activity+json",
 				Rel:  "self",
 			},